@@ -27,6 +27,8 @@ const (
 	DefaultFilePath              = "/ishield-app/shared/decisions.txt"
 	CleanupFinalizerName         = "cleanup.finalizers.integrityshield.io"
 	CsvPath                      = "./bundle/manifests/integrity-shield-operator.clusterserviceversion.yaml"
+	OfflineTrustMaterialPath     = "/ishield-app/trust-material"
+	BundleCachePath              = "/ishield-app/bundle-cache"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -81,6 +83,12 @@ type IntegrityShieldSpec struct {
 
 	// oci registry
 	OCIRegistryConfig OCIRegistryConfig `json:"registryConfig,omitempty"`
+
+	// offline mode for disconnected clusters
+	Offline OfflineConfig `json:"offline,omitempty"`
+
+	// cache of resource bundles in OCI registry
+	BundleCache BundleCacheConfig `json:"bundleCache,omitempty"`
 }
 
 type APIContainer struct {
@@ -151,12 +159,29 @@ type Observer struct {
 
 type RekorServerConfig struct {
 	URL string `json:"url,omitempty"`
+	// PEM encoded public keys of the transparency logs to verify Rekor bundles offline
+	PublicKeys []string `json:"publicKeys,omitempty"`
 }
 
 type OCIRegistryConfig struct {
 	ManifestPullSecret string `json:"manifestPullSecret,omitempty"`
 }
 
+type BundleCacheConfig struct {
+	// duration for which a tag is resolved to the same digest, e.g. 5m
+	TagTTL string `json:"tagTTL,omitempty"`
+	// if true, only bundle references with a digest are accepted
+	RequireDigest bool `json:"requireDigest,omitempty"`
+	// persistent volume claim to keep cached bundles over pod restarts; if empty, an emptyDir is used
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+}
+
+type OfflineConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// secret which contains `fulcio.crt.pem` (Fulcio roots), `rekor.pub` and `ctfe.pub`. It is required when offline mode is enabled.
+	TrustMaterialSecret string `json:"trustMaterialSecret,omitempty"`
+}
+
 // IntegrityShieldStatus defines the observed state of IntegrityShield
 type IntegrityShieldStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -54,6 +54,21 @@ func (in *APIContainer) DeepCopy() *APIContainer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BundleCacheConfig) DeepCopyInto(out *BundleCacheConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BundleCacheConfig.
+func (in *BundleCacheConfig) DeepCopy() *BundleCacheConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BundleCacheConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ControllerContainer) DeepCopyInto(out *ControllerContainer) {
 	*out = *in
@@ -193,8 +208,10 @@ func (in *IntegrityShieldSpec) DeepCopyInto(out *IntegrityShieldSpec) {
 	in.Observer.DeepCopyInto(&out.Observer)
 	in.WebhookNamespacedResource.DeepCopyInto(&out.WebhookNamespacedResource)
 	in.WebhookClusterResource.DeepCopyInto(&out.WebhookClusterResource)
-	out.RekorServerConfig = in.RekorServerConfig
+	in.RekorServerConfig.DeepCopyInto(&out.RekorServerConfig)
 	out.OCIRegistryConfig = in.OCIRegistryConfig
+	out.Offline = in.Offline
+	out.BundleCache = in.BundleCache
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrityShieldSpec.
@@ -280,9 +297,29 @@ func (in *Observer) DeepCopy() *Observer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OfflineConfig) DeepCopyInto(out *OfflineConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OfflineConfig.
+func (in *OfflineConfig) DeepCopy() *OfflineConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(OfflineConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RekorServerConfig) DeepCopyInto(out *RekorServerConfig) {
 	*out = *in
+	if in.PublicKeys != nil {
+		in, out := &in.PublicKeys, &out.PublicKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RekorServerConfig.
@@ -160,6 +160,18 @@ func (r *IntegrityShieldReconciler) deleteManifestIntegrityDecisionCRD(
 	return r.deleteCRD(instance, expected)
 }
 
+func (r *IntegrityShieldReconciler) createOrUpdateVerificationKeyCRD(
+	instance *apiv1.IntegrityShield) (ctrl.Result, error) {
+	expected := res.BuildVerificationKeyCRD(instance)
+	return r.createOrUpdateCRD(instance, expected)
+}
+
+func (r *IntegrityShieldReconciler) deleteVerificationKeyCRD(
+	instance *apiv1.IntegrityShield) (ctrl.Result, error) {
+	expected := res.BuildVerificationKeyCRD(instance)
+	return r.deleteCRD(instance, expected)
+}
+
 /**********************************************
 
 				ConfigMap
@@ -941,10 +953,19 @@ func (r *IntegrityShieldReconciler) createOrUpdateWebhook(instance *apiv1.Integr
 		return ctrl.Result{Requeue: true, RequeueAfter: time.Second * 1}, nil
 	} else if err != nil {
 		return ctrl.Result{}, err
+	} else if len(found.Webhooks) > 0 && (!reflect.DeepEqual(found.Webhooks[0].AdmissionReviewVersions, expected.Webhooks[0].AdmissionReviewVersions) || !reflect.DeepEqual(found.Webhooks[0].Rules, expected.Webhooks[0].Rules)) {
+		// webhook created by an older version may accept only v1beta1 reviews; keep the current CABundle
+		found.Webhooks[0].AdmissionReviewVersions = expected.Webhooks[0].AdmissionReviewVersions
+		found.Webhooks[0].Rules = expected.Webhooks[0].Rules
+		err = r.Update(ctx, found)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update ValidatingWebhookConfiguration", "Name", found.Name)
+			return ctrl.Result{}, err
+		}
+		reqLogger.Info("Updating ValidatingWebhookConfiguration", "Name", found.Name)
+		return ctrl.Result{Requeue: true}, nil
 	}
 
-	// No extra validation
-
 	// No reconcile was necessary
 	return ctrl.Result{}, nil
 
@@ -22,6 +22,7 @@ import (
 
 	"github.com/go-logr/logr"
 	apiv1 "github.com/stolostron/integrity-shield/integrity-shield-operator/api/v1"
+	res "github.com/stolostron/integrity-shield/integrity-shield-operator/resources"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -97,6 +98,12 @@ func (r *IntegrityShieldReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, nil
 	}
 
+	// the deployments cannot verify signatures offline without the trust material
+	if err := res.ValidateOfflineConfig(instance); err != nil {
+		reqLogger.Error(err, "Invalid offline config.")
+		return ctrl.Result{}, err
+	}
+
 	//Pod Security Policy (PSP)
 	// recResult, recErr = r.createOrUpdatePodSecurityPolicy(instance)
 	// if recErr != nil || recResult.Requeue {
@@ -143,6 +150,10 @@ func (r *IntegrityShieldReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	if recErr != nil || recResult.Requeue {
 		return recResult, recErr
 	}
+	recResult, recErr = r.createOrUpdateVerificationKeyCRD(instance)
+	if recErr != nil || recResult.Requeue {
+		return recResult, recErr
+	}
 
 	// Observer
 	if instance.Spec.Observer.Enabled {
@@ -291,6 +302,10 @@ func (r *IntegrityShieldReconciler) deleteClusterScopedChildrenResources(instanc
 	if err != nil {
 		return err
 	}
+	_, err = r.deleteVerificationKeyCRD(instance)
+	if err != nil {
+		return err
+	}
 
 	if instance.Spec.UseGatekeeper {
 		if r.isGatekeeperAvailable(instance) {
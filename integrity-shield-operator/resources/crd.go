@@ -94,3 +94,20 @@ func BuildManifestIntegrityDecisionCRD(cr *apiv1.IntegrityShield) *extv1.CustomR
 	}
 	return buildCRD("manifestintegritydecisions.apis.integrityshield.io", cr.Namespace, crdNames, true)
 }
+
+//verification key crd (cluster-scoped trust store referred by profiles)
+func BuildVerificationKeyCRD(cr *apiv1.IntegrityShield) *extv1.CustomResourceDefinition {
+	crdNames := extv1.CustomResourceDefinitionNames{
+		Kind:       "VerificationKey",
+		Plural:     "verificationkeys",
+		ListKind:   "VerificationKeyList",
+		Singular:   "verificationkey",
+		ShortNames: []string{"vk", "vks"},
+	}
+	newCRD := buildCRD("verificationkeys.apis.integrityshield.io", cr.Namespace, crdNames, false)
+	// the status is updated by the observer without conflicts with changes of the spec
+	newCRD.Spec.Versions[0].Subresources = &extv1.CustomResourceSubresources{
+		Status: &extv1.CustomResourceSubresourceStatus{},
+	}
+	return newCRD
+}
@@ -50,6 +50,10 @@ func BuildDeploymentForIShieldAPI(cr *apiv1.IntegrityShield) *appsv1.Deployment
 	if cr.Spec.OCIRegistryConfig.ManifestPullSecret != "" {
 		volumes = append(volumes, SecretVolume("docker-creds", cr.Spec.OCIRegistryConfig.ManifestPullSecret))
 	}
+	if cr.Spec.Offline.Enabled {
+		volumes = append(volumes, SecretVolume("trust-material", cr.Spec.Offline.TrustMaterialSecret))
+	}
+	volumes = append(volumes, BundleCacheVolume("bundle-cache", cr.Spec.BundleCache.PersistentVolumeClaim))
 
 	volumemounts = []v1.VolumeMount{
 		{
@@ -73,6 +77,17 @@ func BuildDeploymentForIShieldAPI(cr *apiv1.IntegrityShield) *appsv1.Deployment
 			ReadOnly:  true,
 		})
 	}
+	if cr.Spec.Offline.Enabled {
+		volumemounts = append(volumemounts, v1.VolumeMount{
+			MountPath: apiv1.OfflineTrustMaterialPath,
+			Name:      "trust-material",
+			ReadOnly:  true,
+		})
+	}
+	volumemounts = append(volumemounts, v1.VolumeMount{
+		MountPath: apiv1.BundleCachePath,
+		Name:      "bundle-cache",
+	})
 
 	loggerVolumemounts := []v1.VolumeMount{
 		{
@@ -111,16 +126,8 @@ func BuildDeploymentForIShieldAPI(cr *apiv1.IntegrityShield) *appsv1.Deployment
 			Value: apiv1.DefaultFilePath,
 		},
 		{
-			Name:  "REKOR_SERVER",
-			Value: cr.Spec.RekorServerConfig.URL,
-		},
-		{
-			Name:  "COSIGN_EXPERIMENTAL",
-			Value: "1",
-		},
-		{
-			Name:  "TUF_ROOT",
-			Value: "/ishield-app/sigstore",
+			Name:  "REKOR_PUBLIC_KEYS",
+			Value: strings.Join(cr.Spec.RekorServerConfig.PublicKeys, "\n"),
 		},
 	}
 	if cr.Spec.OCIRegistryConfig.ManifestPullSecret != "" {
@@ -129,6 +136,17 @@ func BuildDeploymentForIShieldAPI(cr *apiv1.IntegrityShield) *appsv1.Deployment
 			Value: "/run/secrets/docker",
 		})
 	}
+	env = append(env, BundleCacheEnvVars(cr.Spec.BundleCache)...)
+	if cr.Spec.Offline.Enabled {
+		env = append(env, OfflineEnvVars()...)
+	} else {
+		env = append(env, OnlineEnvVars(cr)...)
+		// keyless verification with the transparency log and Fulcio
+		env = append(env, v1.EnvVar{
+			Name:  "COSIGN_EXPERIMENTAL",
+			Value: "1",
+		})
+	}
 
 	var reporterImage string
 	if cr.Spec.Reporter.Tag != "" {
@@ -271,6 +289,10 @@ func BuildDeploymentForAdmissionController(cr *apiv1.IntegrityShield) *appsv1.De
 	if cr.Spec.OCIRegistryConfig.ManifestPullSecret != "" {
 		volumes = append(volumes, SecretVolume("docker-creds", cr.Spec.OCIRegistryConfig.ManifestPullSecret))
 	}
+	if cr.Spec.Offline.Enabled {
+		volumes = append(volumes, SecretVolume("trust-material", cr.Spec.Offline.TrustMaterialSecret))
+	}
+	volumes = append(volumes, BundleCacheVolume("bundle-cache", cr.Spec.BundleCache.PersistentVolumeClaim))
 
 	servervolumemounts := []v1.VolumeMount{
 		{
@@ -290,6 +312,17 @@ func BuildDeploymentForAdmissionController(cr *apiv1.IntegrityShield) *appsv1.De
 			ReadOnly:  true,
 		})
 	}
+	if cr.Spec.Offline.Enabled {
+		servervolumemounts = append(servervolumemounts, v1.VolumeMount{
+			MountPath: apiv1.OfflineTrustMaterialPath,
+			Name:      "trust-material",
+			ReadOnly:  true,
+		})
+	}
+	servervolumemounts = append(servervolumemounts, v1.VolumeMount{
+		MountPath: apiv1.BundleCachePath,
+		Name:      "bundle-cache",
+	})
 
 	var image string
 	if cr.Spec.ControllerContainer.Tag != "" {
@@ -329,12 +362,8 @@ func BuildDeploymentForAdmissionController(cr *apiv1.IntegrityShield) *appsv1.De
 			Value: cr.Spec.RequestHandlerConfigName,
 		},
 		{
-			Name:  "REKOR_SERVER",
-			Value: cr.Spec.RekorServerConfig.URL,
-		},
-		{
-			Name:  "TUF_ROOT",
-			Value: "/ishield-app/sigstore",
+			Name:  "REKOR_PUBLIC_KEYS",
+			Value: strings.Join(cr.Spec.RekorServerConfig.PublicKeys, "\n"),
 		},
 	}
 	if cr.Spec.OCIRegistryConfig.ManifestPullSecret != "" {
@@ -343,6 +372,12 @@ func BuildDeploymentForAdmissionController(cr *apiv1.IntegrityShield) *appsv1.De
 			Value: "/run/secrets/docker",
 		})
 	}
+	env = append(env, BundleCacheEnvVars(cr.Spec.BundleCache)...)
+	if cr.Spec.Offline.Enabled {
+		env = append(env, OfflineEnvVars()...)
+	} else {
+		env = append(env, OnlineEnvVars(cr)...)
+	}
 
 	serverContainer := v1.Container{
 		Command: []string{
@@ -353,20 +388,22 @@ func BuildDeploymentForAdmissionController(cr *apiv1.IntegrityShield) *appsv1.De
 		Image:           image,
 		ImagePullPolicy: cr.Spec.ControllerContainer.ImagePullPolicy,
 		ReadinessProbe: &v1.Probe{
+			InitialDelaySeconds: 5,
+			PeriodSeconds:       10,
 			ProbeHandler: v1.ProbeHandler{
-				Exec: &v1.ExecAction{
-					Command: []string{
-						"ls",
-					},
+				HTTPGet: &v1.HTTPGetAction{
+					Path: "/readyz",
+					Port: intstr.IntOrString{IntVal: 8081},
 				},
 			},
 		},
 		LivenessProbe: &v1.Probe{
+			InitialDelaySeconds: 15,
+			PeriodSeconds:       20,
 			ProbeHandler: v1.ProbeHandler{
-				Exec: &v1.ExecAction{
-					Command: []string{
-						"ls",
-					},
+				HTTPGet: &v1.HTTPGetAction{
+					Path: "/healthz",
+					Port: intstr.IntOrString{IntVal: 8081},
 				},
 			},
 		},
@@ -431,6 +468,10 @@ func BuildDeploymentForObserver(cr *apiv1.IntegrityShield) *appsv1.Deployment {
 	if cr.Spec.OCIRegistryConfig.ManifestPullSecret != "" {
 		volumes = append(volumes, SecretVolume("docker-creds", cr.Spec.OCIRegistryConfig.ManifestPullSecret))
 	}
+	if cr.Spec.Offline.Enabled {
+		volumes = append(volumes, SecretVolume("trust-material", cr.Spec.Offline.TrustMaterialSecret))
+	}
+	volumes = append(volumes, BundleCacheVolume("bundle-cache", cr.Spec.BundleCache.PersistentVolumeClaim))
 
 	servervolumemounts := []v1.VolumeMount{
 		{
@@ -445,6 +486,17 @@ func BuildDeploymentForObserver(cr *apiv1.IntegrityShield) *appsv1.Deployment {
 			ReadOnly:  true,
 		})
 	}
+	if cr.Spec.Offline.Enabled {
+		servervolumemounts = append(servervolumemounts, v1.VolumeMount{
+			MountPath: apiv1.OfflineTrustMaterialPath,
+			Name:      "trust-material",
+			ReadOnly:  true,
+		})
+	}
+	servervolumemounts = append(servervolumemounts, v1.VolumeMount{
+		MountPath: apiv1.BundleCachePath,
+		Name:      "bundle-cache",
+	})
 
 	var image string
 	if cr.Spec.Observer.Tag != "" {
@@ -488,12 +540,8 @@ func BuildDeploymentForObserver(cr *apiv1.IntegrityShield) *appsv1.Deployment {
 			Value: cr.Spec.Observer.Interval,
 		},
 		{
-			Name:  "REKOR_SERVER",
-			Value: cr.Spec.RekorServerConfig.URL,
-		},
-		{
-			Name:  "TUF_ROOT",
-			Value: "/ishield-app/sigstore",
+			Name:  "REKOR_PUBLIC_KEYS",
+			Value: strings.Join(cr.Spec.RekorServerConfig.PublicKeys, "\n"),
 		},
 	}
 	if cr.Spec.OCIRegistryConfig.ManifestPullSecret != "" {
@@ -502,6 +550,12 @@ func BuildDeploymentForObserver(cr *apiv1.IntegrityShield) *appsv1.Deployment {
 			Value: "/run/secrets/docker",
 		})
 	}
+	env = append(env, BundleCacheEnvVars(cr.Spec.BundleCache)...)
+	if cr.Spec.Offline.Enabled {
+		env = append(env, OfflineEnvVars()...)
+	} else {
+		env = append(env, OnlineEnvVars(cr)...)
+	}
 
 	serverContainer := v1.Container{
 		Name:            cr.Spec.Observer.Name,
@@ -554,6 +608,85 @@ func BuildDeploymentForObserver(cr *apiv1.IntegrityShield) *appsv1.Deployment {
 
 var int420Var int32 = 420
 
+// ValidateOfflineConfig returns an error if offline mode is enabled without the secret of the trust material
+func ValidateOfflineConfig(cr *apiv1.IntegrityShield) error {
+	if cr.Spec.Offline.Enabled && cr.Spec.Offline.TrustMaterialSecret == "" {
+		return fmt.Errorf("offline.trustMaterialSecret must be set when offline mode is enabled")
+	}
+	return nil
+}
+
+// OnlineEnvVars returns env vars for the Rekor server and the local cache of the TUF repository
+func OnlineEnvVars(cr *apiv1.IntegrityShield) []v1.EnvVar {
+	return []v1.EnvVar{
+		{
+			Name:  "REKOR_SERVER",
+			Value: cr.Spec.RekorServerConfig.URL,
+		},
+		{
+			Name:  "TUF_ROOT",
+			Value: "/ishield-app/sigstore",
+		},
+	}
+}
+
+// OfflineEnvVars returns env vars for the trust material in the secret.
+// cosign reads the Fulcio roots and the public keys from these files instead of the TUF repository,
+// so the TUF repository and the Rekor server are never used in offline mode.
+func OfflineEnvVars() []v1.EnvVar {
+	return []v1.EnvVar{
+		{
+			Name:  "ISHIELD_OFFLINE_MODE",
+			Value: "true",
+		},
+		{
+			Name:  "SIGSTORE_ROOT_FILE",
+			Value: filepath.Join(apiv1.OfflineTrustMaterialPath, "fulcio.crt.pem"),
+		},
+		{
+			Name:  "SIGSTORE_REKOR_PUBLIC_KEY",
+			Value: filepath.Join(apiv1.OfflineTrustMaterialPath, "rekor.pub"),
+		},
+		{
+			Name:  "SIGSTORE_CT_LOG_PUBLIC_KEY_FILE",
+			Value: filepath.Join(apiv1.OfflineTrustMaterialPath, "ctfe.pub"),
+		},
+	}
+}
+
+// BundleCacheEnvVars returns env vars for the cache of resource bundles
+func BundleCacheEnvVars(bundleCache apiv1.BundleCacheConfig) []v1.EnvVar {
+	return []v1.EnvVar{
+		{
+			Name:  "ISHIELD_BUNDLE_CACHE_DIR",
+			Value: apiv1.BundleCachePath,
+		},
+		{
+			Name:  "ISHIELD_BUNDLE_TAG_TTL",
+			Value: bundleCache.TagTTL,
+		},
+		{
+			Name:  "ISHIELD_BUNDLE_REQUIRE_DIGEST",
+			Value: strconv.FormatBool(bundleCache.RequireDigest),
+		},
+	}
+}
+
+// BundleCacheVolume returns the persistent volume claim for the cache, or an emptyDir if no claim is set
+func BundleCacheVolume(name, claimName string) v1.Volume {
+	if claimName == "" {
+		return EmptyDirVolume(name)
+	}
+	return v1.Volume{
+		Name: name,
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+			},
+		},
+	}
+}
+
 func SecretVolume(name, secretName string) v1.Volume {
 
 	return v1.Volume{
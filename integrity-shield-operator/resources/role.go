@@ -95,6 +95,17 @@ func BuildClusterRoleForIShield(cr *apiv1.IntegrityShield) *rbacv1.ClusterRole {
 					"create", "update", "get",
 				},
 			},
+			{
+				APIGroups: []string{
+					"",
+				},
+				Resources: []string{
+					"namespaces", "configmaps",
+				},
+				Verbs: []string{
+					"get", "list", "watch",
+				},
+			},
 			// {
 			// 	APIGroups: []string{
 			// 		"apiextensions.k8s.io",
@@ -142,6 +153,17 @@ func BuildClusterRoleForIShield(cr *apiv1.IntegrityShield) *rbacv1.ClusterRole {
 					"get", "list", "create", "update", "delete",
 				},
 			},
+			{
+				APIGroups: []string{
+					"apis.integrityshield.io",
+				},
+				Resources: []string{
+					"verificationkeys",
+				},
+				Verbs: []string{
+					"get", "list", "watch",
+				},
+			},
 		},
 	}
 	return role
@@ -203,6 +225,18 @@ func BuildRoleForIShield(cr *apiv1.IntegrityShield) *rbacv1.Role {
 					"get", "list", "create", "update",
 				},
 			},
+			// key secrets are watched only in this namespace
+			{
+				APIGroups: []string{
+					"",
+				},
+				Resources: []string{
+					"secrets",
+				},
+				Verbs: []string{
+					"get", "list", "watch",
+				},
+			},
 		},
 	}
 	return role
@@ -233,6 +267,28 @@ func BuildClusterRoleForObserver(cr *apiv1.IntegrityShield) *rbacv1.ClusterRole
 					"get", "list",
 				},
 			},
+			{
+				APIGroups: []string{
+					"apis.integrityshield.io",
+				},
+				Resources: []string{
+					"verificationkeys",
+				},
+				Verbs: []string{
+					"get", "list", "watch",
+				},
+			},
+			{
+				APIGroups: []string{
+					"apis.integrityshield.io",
+				},
+				Resources: []string{
+					"verificationkeys/status",
+				},
+				Verbs: []string{
+					"get", "update", "patch",
+				},
+			},
 		},
 	}
 	return role
@@ -263,6 +319,18 @@ func BuildRoleForObserver(cr *apiv1.IntegrityShield) *rbacv1.Role {
 					"get", "list", "create", "watch", "patch", "update",
 				},
 			},
+			// key secrets are watched only in this namespace
+			{
+				APIGroups: []string{
+					"",
+				},
+				Resources: []string{
+					"secrets",
+				},
+				Verbs: []string{
+					"get", "list", "watch",
+				},
+			},
 		},
 	}
 	return role
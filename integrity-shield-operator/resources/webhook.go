@@ -72,6 +72,9 @@ func BuildAPIServiceForIShield(cr *apiv1.IntegrityShield) *corev1.Service {
 	return svc
 }
 
+// "*" does not match subresources, so `scale` and `status` are listed to apply subresourcePolicies in profiles
+var defaultWebhookNamespacedResources = []string{"*", "*/scale", "*/status"}
+
 //webhook configuration
 func BuildValidatingWebhookConfigurationForIShield(cr *apiv1.IntegrityShield) *admregv1.ValidatingWebhookConfiguration {
 
@@ -79,6 +82,13 @@ func BuildValidatingWebhookConfigurationForIShield(cr *apiv1.IntegrityShield) *a
 	cluster := admregv1.ClusterScope
 
 	namespacedRule := cr.Spec.WebhookNamespacedResource
+	if len(namespacedRule.Resources) == 0 {
+		namespacedRule = admregv1.Rule{
+			APIGroups:   []string{"*"},
+			APIVersions: []string{"*"},
+			Resources:   defaultWebhookNamespacedResources,
+		}
+	}
 	namespacedRule.Scope = &namespaced
 
 	clusterRule := cr.Spec.WebhookClusterResource
@@ -127,7 +137,7 @@ func BuildValidatingWebhookConfigurationForIShield(cr *apiv1.IntegrityShield) *a
 				Rules:                   rules,
 				SideEffects:             &sideEffect,
 				TimeoutSeconds:          &timeoutSeconds,
-				AdmissionReviewVersions: []string{"v1beta1"},
+				AdmissionReviewVersions: []string{"v1", "v1beta1"},
 			},
 		},
 	}
@@ -3,8 +3,7 @@ module github.com/stolostron/integrity-shield/observer
 go 1.16
 
 require (
-	github.com/open-policy-agent/gatekeeper v0.0.0-20220630222635-ff9f2cd29731
-	github.com/sigstore/cosign v1.12.0
+	github.com/open-policy-agent/gatekeeper v0.0.0-20220630222635-ff9f2cd29731 // indirect
 	github.com/sigstore/k8s-manifest-sigstore v0.4.0
 	github.com/sirupsen/logrus v1.9.0
 	github.com/stolostron/integrity-shield/reporter v0.0.0-00010101000000-000000000000
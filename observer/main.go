@@ -23,6 +23,8 @@ import (
 	"github.com/stolostron/integrity-shield/observer/pkg/observer"
 )
 
+const revocationCheckInterval = 30 * time.Second
+
 func main() {
 	insp := observer.NewObserver()
 	err := insp.Init()
@@ -35,10 +37,14 @@ func main() {
 	insp.Run()
 	abort := make(chan struct{})
 	ticker := time.NewTicker(time.Duration(intervalInt) * time.Minute)
+	// newly revoked keys and signatures are reported before the next interval
+	revocationTicker := time.NewTicker(revocationCheckInterval)
 	for {
 		select {
 		case <-ticker.C:
 			insp.Run()
+		case <-revocationTicker.C:
+			insp.RunOnRevocation()
 		case <-abort:
 			fmt.Println("Launch aborted!")
 			return
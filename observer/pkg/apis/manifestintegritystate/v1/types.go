@@ -42,6 +42,42 @@ type VerifyResult struct {
 	Signer     string     `json:"signer,omitempty"`
 	SignedTime *time.Time `json:"signedTime,omitempty"`
 	SigRef     string     `json:"sigRef,omitempty"`
+	// e.g. the resource depends on a retiring key
+	Warnings []string `json:"warnings,omitempty"`
+	// transparency log entry of the signature
+	TlogEntry *TlogEntry `json:"tlogEntry,omitempty"`
+	// PGP key which made the signature
+	PGPSigner *PGPSigner `json:"pgpSigner,omitempty"`
+	// VerificationKeys which verified the signature
+	VerificationKeys []string `json:"verificationKeys,omitempty"`
+	// results of the images in the resource
+	Images []ImageResult `json:"images,omitempty"`
+}
+
+// ImageResult is the verification result of an image in the resource
+type ImageResult struct {
+	ImageRef   string     `json:"imageRef"`
+	Digest     string     `json:"digest,omitempty"`
+	InScope    bool       `json:"inScope"`
+	Verified   bool       `json:"verified"`
+	Signer     string     `json:"signer,omitempty"`
+	SignedTime *time.Time `json:"signedTime,omitempty"`
+	FailReason string     `json:"failReason,omitempty"`
+	// name of the image policy which matched the image
+	Policy string `json:"policy,omitempty"`
+}
+
+// TlogEntry is a transparency log entry which is verified with the pinned log key
+type TlogEntry struct {
+	LogIndex       int64     `json:"logIndex"`
+	LogID          string    `json:"logID"`
+	IntegratedTime time.Time `json:"integratedTime"`
+}
+
+// PGPSigner is the fingerprint and the user ID of a PGP key
+type PGPSigner struct {
+	Fingerprint string `json:"fingerprint"`
+	UID         string `json:"uid"`
 }
 
 // ManifestIntegrityStateStatus defines the observed state of ManifestIntegrityState
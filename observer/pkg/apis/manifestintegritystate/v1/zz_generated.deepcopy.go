@@ -24,6 +24,26 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageResult) DeepCopyInto(out *ImageResult) {
+	*out = *in
+	if in.SignedTime != nil {
+		in, out := &in.SignedTime, &out.SignedTime
+		*out = *in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageResult.
+func (in *ImageResult) DeepCopy() *ImageResult {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManifestIntegrityState) DeepCopyInto(out *ManifestIntegrityState) {
 	*out = *in
@@ -131,6 +151,38 @@ func (in *ManifestIntegrityStateStatus) DeepCopy() *ManifestIntegrityStateStatus
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PGPSigner) DeepCopyInto(out *PGPSigner) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PGPSigner.
+func (in *PGPSigner) DeepCopy() *PGPSigner {
+	if in == nil {
+		return nil
+	}
+	out := new(PGPSigner)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TlogEntry) DeepCopyInto(out *TlogEntry) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TlogEntry.
+func (in *TlogEntry) DeepCopy() *TlogEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(TlogEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VerifyResult) DeepCopyInto(out *VerifyResult) {
 	*out = *in
@@ -138,6 +190,33 @@ func (in *VerifyResult) DeepCopyInto(out *VerifyResult) {
 		in, out := &in.SignedTime, &out.SignedTime
 		*out = *in
 	}
+	if in.Warnings != nil {
+		in, out := &in.Warnings, &out.Warnings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TlogEntry != nil {
+		in, out := &in.TlogEntry, &out.TlogEntry
+		*out = new(TlogEntry)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PGPSigner != nil {
+		in, out := &in.PGPSigner, &out.PGPSigner
+		*out = new(PGPSigner)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VerificationKeys != nil {
+		in, out := &in.VerificationKeys, &out.VerificationKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]ImageResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -24,15 +24,16 @@ import (
 	"strconv"
 	"time"
 
-	gkmatch "github.com/open-policy-agent/gatekeeper/pkg/mutation/match"
-	cosign "github.com/sigstore/cosign/cmd/cosign/cli"
 	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
 	log "github.com/sirupsen/logrus"
 	vrc "github.com/stolostron/integrity-shield/observer/pkg/apis/manifestintegritystate/v1"
 	misclient "github.com/stolostron/integrity-shield/observer/pkg/client/manifestintegritystate/clientset/versioned/typed/manifestintegritystate/v1"
 	midclient "github.com/stolostron/integrity-shield/reporter/pkg/client/manifestintegritydecision/clientset/versioned/typed/manifestintegritydecision/v1"
 	"github.com/stolostron/integrity-shield/shield/pkg/config"
+	ishieldimage "github.com/stolostron/integrity-shield/shield/pkg/image"
 	kubeutil "github.com/stolostron/integrity-shield/shield/pkg/kubernetes"
+	ishield "github.com/stolostron/integrity-shield/shield/pkg/shield"
+	"github.com/stolostron/integrity-shield/shield/pkg/tlog"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -64,11 +65,14 @@ var IgnoredKinds = []string{"Event", "Lease", "Endpoints", "TokenReview", "Subje
 type Observer struct {
 	APIResources     []groupResource
 	Namespaces       []string
+	NamespaceLabels  map[string]map[string]string
 	DynamicClient    dynamic.Interface
 	MidClient        *midclient.ApisV1Client
 	MisClient        *misclient.ApisV1Client
 	Clientset        *kubeclient.Clientset
 	IShiledNamespace string
+	// the revocation list used in the last observation
+	revocations *config.RevocationList
 }
 
 // Observer Result Detail
@@ -83,6 +87,11 @@ type VerifyResultDetail struct {
 	Message              string                            `json:"message"`
 	Violation            bool                              `json:"violation"`
 	VerifyResourceResult *k8smanifest.VerifyResourceResult `json:"verifyResourceResult"`
+	Warnings             []string                          `json:"warnings,omitempty"`
+	TlogEntry            *tlog.Entry                       `json:"tlogEntry,omitempty"`
+	PGPSigner            *config.PGPSignerResult           `json:"pgpSigner,omitempty"`
+	VerificationKeys     []string                          `json:"verificationKeys,omitempty"`
+	ImageResults         []ishieldimage.ImageVerifyResult  `json:"imageResults,omitempty"`
 }
 type ConstraintResult struct {
 	ConstraintName  string               `json:"constraintName"`
@@ -157,8 +166,7 @@ func (self *Observer) Init() error {
 	os.Setenv(k8sLogLevelEnvKey, logLevelStr)
 	log.SetLevel(logLevel)
 
-	log.Info("initialize cosign.")
-	_ = cosign.Initialize()
+	ishield.InitializeSigstore()
 	return nil
 }
 
@@ -168,6 +176,11 @@ func (self *Observer) Run() {
 	if err != nil {
 		log.Error("Failed to load RequestHandlerConfig; err: ", err.Error())
 	}
+	var revocations *config.RevocationList
+	if rhconfig != nil {
+		revocations = rhconfig.RevocationList
+	}
+	self.revocations = revocations
 
 	// reload all namespaces
 	kubeconf, _ := kubeutil.GetKubeConfig()
@@ -206,9 +219,16 @@ func (self *Observer) Run() {
 		log.Debug("possible Protected GVKs: ", narrowedGVKList)
 		// get all resources of extracted GVKs
 		resources := []unstructured.Unstructured{}
+		targets := []config.MatchTarget{}
 		for _, gResource := range narrowedGVKList {
 			tmpResources, _ := self.getAllResoucesByGroupResource(gResource, constraint.Match.LabelSelector)
-			resources = append(resources, tmpResources...)
+			for _, resource := range tmpResources {
+				target := self.makeMatchTarget(resource, gResource.APIResource.Namespaced)
+				if constraint.Match.Match(target) {
+					resources = append(resources, resource)
+					targets = append(targets, target)
+				}
+			}
 		}
 
 		// check all resources by verifyResource
@@ -218,7 +238,7 @@ func (self *Observer) Run() {
 		skipObjects := rhconfig.RequestFilterProfile.SkipObjects
 		skipObjects = append(skipObjects, constraint.Parameters.SkipObjects...)
 		results := []VerifyResultDetail{}
-		for _, resource := range resources {
+		for i, resource := range resources {
 			log.Debugf("Observe new resource; ns:%s, kind:%s, name:%s", resource.GetNamespace(), resource.GetKind(), resource.GetName())
 			// check if signature resource
 			signatureResource := isSignatureResource(resource)
@@ -236,8 +256,9 @@ func (self *Observer) Run() {
 				results = append(results, result)
 				continue
 			}
-			result := ObserveResource(resource, constraint.Parameters, ignoreFields, skipObjects, secrets)
-			imgAllow, imgMsg := ObserveImage(resource, constraint.Parameters.ImageProfile)
+			result := ObserveResource(resource, constraint.Parameters, ignoreFields, skipObjects, secrets, targets[i], revocations)
+			imgAllow, imgMsg, imgResults := ObserveImage(resource, constraint.Parameters.ImageProfile, revocations)
+			result.ImageResults = imgResults
 			if !imgAllow {
 				if !result.Violation {
 					result.Violation = true
@@ -262,6 +283,8 @@ func (self *Observer) Run() {
 					ApiGroup:   res.ApiGroup,
 					ApiVersion: res.ApiVersion,
 					Result:     res.Message,
+					Warnings:   res.Warnings,
+					Images:     imageStateResults(res.ImageResults),
 				}
 				violations = append(violations, vres)
 			} else {
@@ -272,12 +295,28 @@ func (self *Observer) Run() {
 					ApiGroup:   res.ApiGroup,
 					ApiVersion: res.ApiVersion,
 					Result:     res.Message,
+					Warnings:   res.Warnings,
+					Images:     imageStateResults(res.ImageResults),
 				}
 				if res.VerifyResourceResult != nil {
 					vres.Signer = res.VerifyResourceResult.Signer
 					vres.SigRef = res.VerifyResourceResult.SigRef
 					vres.SignedTime = res.VerifyResourceResult.SignedTime
 				}
+				if res.TlogEntry != nil {
+					vres.TlogEntry = &vrc.TlogEntry{
+						LogIndex:       res.TlogEntry.LogIndex,
+						LogID:          res.TlogEntry.LogID,
+						IntegratedTime: res.TlogEntry.IntegratedTime,
+					}
+				}
+				if res.PGPSigner != nil {
+					vres.PGPSigner = &vrc.PGPSigner{
+						Fingerprint: res.PGPSigner.Fingerprint,
+						UID:         res.PGPSigner.UID,
+					}
+				}
+				vres.VerificationKeys = res.VerificationKeys
 				nonViolations = append(nonViolations, vres)
 			}
 			log.WithFields(log.Fields{
@@ -319,6 +358,9 @@ func (self *Observer) Run() {
 		constraintResults = append(constraintResults, cres)
 	}
 
+	// status of verification keys
+	self.updateVerificationKeyStatus(constraintResults)
+
 	// export ConstraintResult
 	res := ObservationDetailResults{
 		ConstraintResults: constraintResults,
@@ -459,7 +501,7 @@ func (self *Observer) exportResultDetail(results ObservationDetailResults) error
 //
 
 type ConstraintSpec struct {
-	Match      gkmatch.Match          `json:"match,omitempty"`
+	Match      config.MatchCondition  `json:"match,omitempty"`
 	Parameters config.ParameterObject `json:"parameters,omitempty"`
 }
 
@@ -509,3 +551,24 @@ func isSignatureResource(resource unstructured.Unstructured) bool {
 	}
 	return label
 }
+
+// imageStateResults converts the image results into the entries of ManifestIntegrityState
+func imageStateResults(results []ishieldimage.ImageVerifyResult) []vrc.ImageResult {
+	if len(results) == 0 {
+		return nil
+	}
+	images := []vrc.ImageResult{}
+	for _, r := range results {
+		images = append(images, vrc.ImageResult{
+			ImageRef:   r.ImageRef,
+			Digest:     r.Digest,
+			InScope:    r.InScope,
+			Verified:   r.Verified,
+			Signer:     r.Signer,
+			SignedTime: r.SignedTime,
+			FailReason: r.FailReason,
+			Policy:     r.Policy,
+		})
+	}
+	return images
+}
@@ -19,9 +19,8 @@ package observer
 import (
 	"context"
 
-	gkmatch "github.com/open-policy-agent/gatekeeper/pkg/mutation/match"
-	gkutil "github.com/open-policy-agent/gatekeeper/pkg/util"
 	log "github.com/sirupsen/logrus"
+	"github.com/stolostron/integrity-shield/shield/pkg/config"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -89,10 +88,13 @@ func (self *Observer) getNamespaces(kubeconfig *rest.Config) error {
 		return err
 	}
 	var nslist []string
+	nsLabels := map[string]map[string]string{}
 	for _, ns := range namespaces.Items {
 		nslist = append(nslist, ns.Name)
+		nsLabels[ns.Name] = ns.GetLabels()
 	}
 	self.Namespaces = nslist
+	self.NamespaceLabels = nsLabels
 	return nil
 }
 
@@ -133,83 +135,38 @@ func (self *Observer) getAllResoucesByGroupResource(gResourceWithTargetNS groupR
 	return resources, nil
 }
 
-func (self *Observer) getPossibleProtectedGVKs(match gkmatch.Match) []groupResourceWithTargetNS {
+func (self *Observer) getPossibleProtectedGVKs(match config.MatchCondition) []groupResourceWithTargetNS {
 	possibleProtectedGVKs := []groupResourceWithTargetNS{}
+	matchedNamespaces := self.getMathedNamespaces(match)
 	for _, apiResource := range self.APIResources {
 		matched := self.checkIfRuleMatchWithGVK(match, apiResource)
 		if matched {
-			matchedNamespaces := self.getMathedNamespaces(match)
-			tmpGvks := self.getGroupResourceWithTargetNS(apiResource, matchedNamespaces)
+			tmpGvks := self.getGroupResourceWithTargetNS(match, apiResource, matchedNamespaces)
 			possibleProtectedGVKs = append(possibleProtectedGVKs, tmpGvks...)
 		}
 	}
 	return possibleProtectedGVKs
 }
 
-func (self *Observer) checkIfRuleMatchWithGVK(match gkmatch.Match, apiResource groupResource) bool {
-	matched := false
-	// kind
-	if len(match.Kinds) != 0 {
-		for _, kinds := range match.Kinds {
-			kmatch := false
-			agmatch := false
-			if len(kinds.APIGroups) != 0 {
-				agmatch = Contains(kinds.APIGroups, apiResource.APIGroup)
-			} else {
-				agmatch = true
-			}
-			if len(kinds.APIGroups) != 0 {
-				kmatch = Contains(kinds.Kinds, apiResource.APIResource.Kind)
-			} else {
-				kmatch = true
-			}
-			if kmatch && agmatch {
-				matched = true
-			}
-		}
-	} else {
-		matched = true
-	}
-	return matched
+func (self *Observer) checkIfRuleMatchWithGVK(match config.MatchCondition, apiResource groupResource) bool {
+	return match.MatchKind(apiResource.APIGroup, apiResource.APIResource.Kind) && match.MatchScope(apiResource.APIResource.Namespaced)
 }
 
-func (self *Observer) getMathedNamespaces(match gkmatch.Match) []string {
-	// namespace
-	var matchedNamespaces []string
-	if len(match.Namespaces) == 0 {
-		if match.NamespaceSelector != nil {
-			labeledNS := self.getLabelMatchedNamespace(match.NamespaceSelector)
-			if match.ExcludedNamespaces != nil {
-				excludedNs := self.listAllMatchedNamespaces(match.ExcludedNamespaces)
-				labeledNS = self.checkExcludedNamespace(excludedNs, labeledNS)
-			}
-			matchedNamespaces = labeledNS
-		} else {
-			if match.ExcludedNamespaces != nil {
-				targetNs := self.Namespaces
-				excludedNs := self.listAllMatchedNamespaces(match.ExcludedNamespaces)
-				targetNs = self.checkExcludedNamespace(excludedNs, targetNs)
-				matchedNamespaces = targetNs
-			} else {
-				matchedNamespaces = self.Namespaces
-			}
-		}
-	} else {
-		// len(match.Namespaces) != 0
-		targetNs := self.listAllMatchedNamespaces(match.Namespaces)
-		if match.ExcludedNamespaces != nil {
-			excludedNs := self.listAllMatchedNamespaces(match.ExcludedNamespaces)
-			targetNs = self.checkExcludedNamespace(excludedNs, targetNs)
+func (self *Observer) getMathedNamespaces(match config.MatchCondition) []string {
+	matchedNamespaces := []string{}
+	for _, ns := range self.Namespaces {
+		if match.MatchNamespaceName(ns) && match.MatchNamespaceLabels(self.NamespaceLabels[ns]) {
+			matchedNamespaces = append(matchedNamespaces, ns)
 		}
-		matchedNamespaces = targetNs
 	}
 	return matchedNamespaces
 }
 
-func (self *Observer) getGroupResourceWithTargetNS(apiResource groupResource, matchedNamespaces []string) []groupResourceWithTargetNS {
+func (self *Observer) getGroupResourceWithTargetNS(match config.MatchCondition, apiResource groupResource, matchedNamespaces []string) []groupResourceWithTargetNS {
 	possibleProtectedGVKs := []groupResourceWithTargetNS{}
 	if !apiResource.APIResource.Namespaced {
-		if len(matchedNamespaces) == 0 {
+		// Namespace objects are checked with their own names later
+		if !match.HasNamespaceCondition() || config.IsNamespaceKind(apiResource.APIGroup, apiResource.APIResource.Kind) {
 			possibleProtectedGVKs = append(possibleProtectedGVKs, groupResourceWithTargetNS{
 				groupResource: apiResource,
 			})
@@ -223,6 +180,22 @@ func (self *Observer) getGroupResourceWithTargetNS(apiResource groupResource, ma
 	return possibleProtectedGVKs
 }
 
+// makeMatchTarget returns a listed resource as a target of match conditions and signer bindings,
+// so it is checked with the same conditions as the admission controller
+func (self *Observer) makeMatchTarget(resource unstructured.Unstructured, namespaced bool) config.MatchTarget {
+	gvk := resource.GroupVersionKind()
+	return config.MatchTarget{
+		ApiGroup:        gvk.Group,
+		Kind:            gvk.Kind,
+		Name:            resource.GetName(),
+		Namespace:       resource.GetNamespace(),
+		Namespaced:      namespaced,
+		Labels:          resource.GetLabels(),
+		Annotations:     resource.GetAnnotations(),
+		NamespaceLabels: self.NamespaceLabels[resource.GetNamespace()],
+	}
+}
+
 func Contains(pattern []string, value string) bool {
 	for _, p := range pattern {
 		if p == value {
@@ -231,50 +204,3 @@ func Contains(pattern []string, value string) bool {
 	}
 	return false
 }
-
-func (self *Observer) getLabelMatchedNamespace(labelSelector *metav1.LabelSelector) []string {
-	matchedNs := []string{}
-	if labelSelector == nil {
-		return []string{}
-	}
-
-	namespaces, err := self.Clientset.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(labelSelector)})
-	if err != nil {
-		log.Errorf("failed to list a namespace:`%s`", err.Error())
-		return []string{}
-	}
-	for _, ns := range namespaces.Items {
-		matchedNs = append(matchedNs, ns.Name)
-	}
-	return matchedNs
-}
-
-func (self *Observer) checkExcludedNamespace(excludedNamespaces []string, targetNamespaces []string) []string {
-	matchedNs := []string{}
-	for _, ns := range targetNamespaces {
-		if !Contains(excludedNamespaces, ns) {
-			matchedNs = append(matchedNs, ns)
-		}
-	}
-	return matchedNs
-}
-
-// creating a simple namespace list considering wildcard rules
-func (self *Observer) listAllMatchedNamespaces(rule []gkutil.Wildcard) []string {
-	matchedNs := []string{}
-	if rule == nil {
-		return matchedNs
-	}
-	for _, ns := range self.Namespaces {
-		matched := false
-		for _, r := range rule {
-			if r.Matches(ns) {
-				matched = true
-			}
-		}
-		if matched {
-			matchedNs = append(matchedNs, ns)
-		}
-	}
-	return matchedNs
-}
@@ -0,0 +1,64 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package observer
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+// RunOnRevocation observes resources again if entries are added to the revocation list after the last observation,
+// so resources signed with a newly revoked key are reported without waiting for the next interval.
+func (self *Observer) RunOnRevocation() {
+	rhconfig, err := config.LoadRequestHandlerConfig()
+	if err != nil || rhconfig == nil {
+		return
+	}
+	self.runOnRevocation(rhconfig.RevocationList, self.Run)
+}
+
+// runOnRevocation calls run if the current revocation list has a new entry, and returns true if it is called
+func (self *Observer) runOnRevocation(current *config.RevocationList, run func()) bool {
+	if !hasNewRevocation(self.revocations, current) {
+		return false
+	}
+	log.Info("new entries are found in the revocation list; observe resources again.")
+	run()
+	return true
+}
+
+// hasNewRevocation returns true if the current list has an entry which is not in the last list
+func hasNewRevocation(last, current *config.RevocationList) bool {
+	if current.Empty() {
+		return false
+	}
+	for _, e := range current.Entries {
+		found := false
+		if last != nil {
+			for _, l := range last.Entries {
+				if l == e {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package observer
+
+import (
+	"testing"
+
+	"github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+func TestRunOnRevocation(t *testing.T) {
+	revokedKey := config.RevocationEntry{KeyFingerprint: "4f2a", Reason: "the key was leaked"}
+	revokedSigner := config.RevocationEntry{Signer: "old-ci-bot@example.com"}
+
+	observer := &Observer{}
+	runs := 0
+	run := func() {
+		runs++
+		// Run records the revocation list which is used in the observation
+		observer.revocations = &config.RevocationList{Entries: []config.RevocationEntry{revokedKey}}
+	}
+
+	if observer.runOnRevocation(nil, run) || observer.runOnRevocation(&config.RevocationList{}, run) {
+		t.Errorf("resources should not be observed again without revocation entries")
+		return
+	}
+	current := &config.RevocationList{Entries: []config.RevocationEntry{revokedKey}}
+	if !observer.runOnRevocation(current, run) || runs != 1 {
+		t.Errorf("resources should be observed again when the first entry is added")
+		return
+	}
+	if observer.runOnRevocation(current, run) || runs != 1 {
+		t.Errorf("resources should not be observed again for the entries in the last observation")
+		return
+	}
+	current = &config.RevocationList{Entries: []config.RevocationEntry{revokedKey, revokedSigner}}
+	if !observer.runOnRevocation(current, run) || runs != 2 {
+		t.Errorf("resources should be observed again when a new entry is added")
+		return
+	}
+	// removing an entry does not make a resource rejected
+	observer.revocations = current
+	if observer.runOnRevocation(&config.RevocationList{Entries: []config.RevocationEntry{revokedSigner}}, run) || runs != 2 {
+		t.Errorf("resources should not be observed again when an entry is removed")
+		return
+	}
+}
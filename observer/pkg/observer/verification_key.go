@@ -0,0 +1,123 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package observer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stolostron/integrity-shield/shield/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// updateVerificationKeyStatus records the profiles which refer to each VerificationKey
+// and the number of resources whose signatures are currently verified with it.
+func (self *Observer) updateVerificationKeyStatus(constraintResults []ConstraintResult) {
+	client := self.DynamicClient.Resource(config.VerificationKeyGVR)
+	vkList, err := client.List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		log.Debugf("failed to list verification keys; %s", err.Error())
+		return
+	}
+	for _, obj := range vkList.Items {
+		data, _ := json.Marshal(obj.Object)
+		var vk config.VerificationKey
+		if err := json.Unmarshal(data, &vk); err != nil {
+			log.Errorf("failed to load the verification key `%s`; %s", obj.GetName(), err.Error())
+			continue
+		}
+		status := verificationKeyStatus(vk, constraintResults)
+		if reflect.DeepEqual(status.UsedBy, vk.Status.UsedBy) && status.VerifiedResources == vk.Status.VerifiedResources {
+			continue
+		}
+		status.LastUpdated = time.Now().Format(timeFormat)
+		statusObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+		if err != nil {
+			log.Errorf("failed to convert the status of the verification key `%s`; %s", vk.Name, err.Error())
+			continue
+		}
+		obj.Object["status"] = statusObj
+		_, err = client.UpdateStatus(context.Background(), &obj, metav1.UpdateOptions{})
+		if err != nil {
+			log.Errorf("failed to update the status of the verification key `%s`; %s", vk.Name, err.Error())
+		}
+	}
+}
+
+func verificationKeyStatus(vk config.VerificationKey, constraintResults []ConstraintResult) config.VerificationKeyStatus {
+	usedBy := []string{}
+	verified := map[string]bool{}
+	for _, cres := range constraintResults {
+		used, err := referVerificationKey(cres.Constraint.Parameters.ManifestVerifyRule, vk)
+		if err != nil {
+			log.Warningf("failed to check verification keys in the constraint `%s`; %s", cres.ConstraintName, err.Error())
+		}
+		if !used {
+			continue
+		}
+		usedBy = append(usedBy, cres.ConstraintName)
+		for _, res := range cres.Results {
+			if res.Violation || !containsString(res.VerificationKeys, vk.Name) {
+				continue
+			}
+			// a resource protected by two profiles is counted once
+			verified[fmt.Sprintf("%s/%s/%s/%s", res.ApiGroup, res.Kind, res.Namespace, res.Name)] = true
+		}
+	}
+	sort.Strings(usedBy)
+	if len(usedBy) == 0 {
+		usedBy = nil
+	}
+	return config.VerificationKeyStatus{
+		UsedBy:            usedBy,
+		VerifiedResources: len(verified),
+	}
+}
+
+func referVerificationKey(rule config.ManifestVerifyRule, vk config.VerificationKey) (bool, error) {
+	keyConfigs := append([]config.KeyConfig{}, rule.KeyConfigs...)
+	if rule.SignatureThreshold != nil {
+		for _, s := range rule.SignatureThreshold.Signers {
+			keyConfigs = append(keyConfigs, s.KeyConfigs...)
+		}
+	}
+	for _, k := range keyConfigs {
+		matched, err := k.MatchVerificationKey(vk)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -17,9 +17,9 @@
 package observer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
 	"time"
@@ -28,20 +28,14 @@ import (
 	log "github.com/sirupsen/logrus"
 	config "github.com/stolostron/integrity-shield/shield/pkg/config"
 	ishieldimage "github.com/stolostron/integrity-shield/shield/pkg/image"
+	ishield "github.com/stolostron/integrity-shield/shield/pkg/shield"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 const AnnotationKeyDomain = "integrityshield.io"
 const ImageRefAnnotationKeyShield = "integrityshield.io/signature"
 
-func ObserveResource(resource unstructured.Unstructured, paramObj config.ParameterObject, ignoreFields k8smanifest.ObjectFieldBindingList, skipObjects k8smanifest.ObjectReferenceList, secrets []config.KeyConfig) VerifyResultDetail {
-	// prepare tmpDir
-	tmpDir, err := ioutil.TempDir("", string(resource.GetName()))
-	if err != nil {
-		return VerifyResultDetail{}
-	}
-	defer os.RemoveAll(tmpDir)
-
+func ObserveResource(resource unstructured.Unstructured, paramObj config.ParameterObject, ignoreFields k8smanifest.ObjectFieldBindingList, skipObjects k8smanifest.ObjectReferenceList, secrets []config.KeyConfig, target config.MatchTarget, revocations *config.RevocationList) VerifyResultDetail {
 	namespace := os.Getenv("POD_NAMESPACE")
 	if namespace == "" {
 		namespace = defaultPodNamespace
@@ -71,68 +65,13 @@ func ObserveResource(resource unstructured.Unstructured, paramObj config.Paramet
 		vo.AnnotationConfig.AnnotationKeyDomain = AnnotationKeyDomain
 	}
 
-	// prepare local key for verifyResource
-	keyPathList := []string{}
-	if len(secrets) != 0 {
-		for _, keyconfig := range secrets {
-			if keyconfig.Secret.Namespace != "" && keyconfig.Secret.Name != "" {
-				if keyconfig.Secret.Mount {
-					keyPath, err := keyconfig.LoadKeySecret()
-					if err != nil {
-						log.Errorf("Failed to load key secret: %s", err.Error())
-						return VerifyResultDetail{
-							Time:                 time.Now().Format(timeFormat),
-							Kind:                 resource.GroupVersionKind().Kind,
-							Name:                 resource.GetName(),
-							Namespace:            resource.GetNamespace(),
-							Error:                false,
-							Message:              fmt.Sprintf("Failed to load key secret: %s", err.Error()),
-							VerifyResourceResult: &k8smanifest.VerifyResourceResult{},
-							Violation:            true,
-						}
-					}
-					keyPathList = append(keyPathList, keyPath)
-				} else {
-					keyRef := keyconfig.ConvertToCosignKeyRef()
-					keyPathList = append(keyPathList, keyRef)
-				}
-			}
-			if keyconfig.Key.PEM != "" && keyconfig.Key.Name != "" {
-				keyPath, err := keyconfig.ConvertToLocalFilePath(tmpDir)
-				if err != nil {
-					return VerifyResultDetail{
-						Time:                 time.Now().Format(timeFormat),
-						Kind:                 resource.GroupVersionKind().Kind,
-						Name:                 resource.GetName(),
-						Namespace:            resource.GetNamespace(),
-						Error:                false,
-						Message:              fmt.Sprintf("Failed to set public key file: %s", err.Error()),
-						VerifyResourceResult: &k8smanifest.VerifyResourceResult{},
-						Violation:            true,
-					}
-				}
-				keyPathList = append(keyPathList, keyPath)
-			}
-		}
-		if len(keyPathList) == 0 {
-			return VerifyResultDetail{
-				Time:                 time.Now().Format(timeFormat),
-				Kind:                 resource.GroupVersionKind().Kind,
-				Name:                 resource.GetName(),
-				Namespace:            resource.GetNamespace(),
-				Error:                false,
-				Message:              "KeyConfigs is not properly configured, failed to set public key.",
-				VerifyResourceResult: &k8smanifest.VerifyResourceResult{},
-				Violation:            true,
-			}
-		}
-		keyPathString := strings.Join(keyPathList, ",")
-		if keyPathString != "" {
-			vo.KeyPath = keyPathString
-		}
+	// verify with public keys held in the key store
+	rule := paramObj.ManifestVerifyRule
+	rule.KeyConfigs = secrets
+	result, err := ishield.VerifyManifestWithRule(resource, &rule, target, vo)
+	if err == nil {
+		result = ishield.ApplyRevocationList(revocations, &rule, resource, vo, result)
 	}
-
-	result, err := k8smanifest.VerifyResource(resource, vo)
 	resBytes, _ := json.Marshal(result)
 	log.Debug("Verify resource result from k8smanifest: ", resBytes)
 	if err != nil {
@@ -159,7 +98,9 @@ func ObserveResource(resource unstructured.Unstructured, paramObj config.Paramet
 			message = fmt.Sprintf("singed by a valid signer: %s", result.Signer)
 		} else {
 			message = "no signature found"
-			if result.Diff != nil && result.Diff.Size() > 0 {
+			if result.FailReason != "" {
+				message = result.FailReason
+			} else if result.Diff != nil && result.Diff.Size() > 0 {
 				message = fmt.Sprintf("diff found: %s", result.Diff.String())
 			} else if result.Signer != "" {
 				message = fmt.Sprintf("signer config not matched, this is signed by %s", result.Signer)
@@ -183,33 +124,39 @@ func ObserveResource(resource unstructured.Unstructured, paramObj config.Paramet
 		Namespace:            resource.GetNamespace(),
 		Error:                false,
 		Message:              resultMsg,
-		VerifyResourceResult: result,
+		VerifyResourceResult: result.VerifyResourceResult,
 		Violation:            violation,
+		Warnings:             result.Warnings,
+		TlogEntry:            result.TlogEntry,
+		PGPSigner:            result.PGPSigner,
+		VerificationKeys:     result.VerificationKeys,
 	}
 }
 
-func ObserveImage(resource unstructured.Unstructured, profile config.ImageProfile) (bool, string) {
+// ObserveImage also returns the result of each image, e.g. the resolved digest and the signer
+func ObserveImage(resource unstructured.Unstructured, profile config.ImageProfile, revocations *config.RevocationList) (bool, string, []ishieldimage.ImageVerifyResult) {
 	// image verify
 	imageAllow := true
 	imageMessage := ""
 	var imageVerifyResults []ishieldimage.ImageVerifyResult
 	if profile.Enabled() {
-		_, err := ishieldimage.VerifyImageInManifest(resource, profile)
+		results, err := ishieldimage.VerifyImageInManifestWithResults(context.Background(), resource, profile, revocations)
 		if err != nil {
 			log.Errorf("failed to verify images: %s", err.Error())
 			imageAllow = false
 			imageMessage = "Image signature verification is required, but failed to verify signature: " + err.Error()
 
 		} else {
+			imageVerifyResults = results
 			for _, res := range imageVerifyResults {
-				if res.InScope && !res.Verified {
+				if res.Denied() {
 					imageAllow = false
-					imageMessage = "Image signature verification is required, but failed to verify signature: " + res.FailReason
+					imageMessage = "Image signature verification is required, but failed to verify signature: " + res.Message()
 					break
 				}
 			}
 		}
 	}
 
-	return imageAllow, imageMessage
+	return imageAllow, imageMessage, imageVerifyResults
 }
@@ -0,0 +1,72 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package observer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stolostron/integrity-shield/shield/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestObserveImage(t *testing.T) {
+	revokedDigest := "sha256:" + strings.Repeat("a", 64)
+	revokedImage := "registry.example.com/sample/app@" + revokedDigest
+	otherImage := "other.example.com/sample/app@sha256:" + strings.Repeat("b", 64)
+	pod := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "sample-pod", "namespace": "sample-ns"},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": revokedImage},
+				map[string]interface{}{"name": "other", "image": otherImage},
+			},
+		},
+	}}
+	profile := config.ImageProfile{Policies: []config.ImagePolicy{
+		{Name: "sample-images", Match: config.ImageRefList{"registry.example.com/*"}},
+	}}
+	revocations := &config.RevocationList{Entries: []config.RevocationEntry{{ManifestDigest: revokedDigest}}}
+
+	allow, message, results := ObserveImage(pod, profile, revocations)
+	if allow || !strings.Contains(message, "revoked") {
+		t.Errorf("the revoked image should be a violation: %v, %s", allow, message)
+		return
+	}
+	// the results are recorded in ManifestIntegrityState
+	images := imageStateResults(results)
+	if len(images) != 2 || images[0].ImageRef != revokedImage || !images[0].InScope || images[0].Verified || !strings.Contains(images[0].FailReason, "revoked") {
+		t.Errorf("unexpected state of the revoked image: %+v", images)
+		return
+	}
+	if images[1].ImageRef != otherImage || images[1].InScope {
+		t.Errorf("the image which matches no policy should not be in scope: %+v", images[1])
+		return
+	}
+
+	profile.Policies[0].Mode = config.ImagePolicyModeSkip
+	if allow, message, results = ObserveImage(pod, profile, nil); !allow || message != "" || len(results) != 2 {
+		t.Errorf("the images which are not in scope should not be a violation: %v, %s, %+v", allow, message, results)
+		return
+	}
+	if imageStateResults(nil) != nil {
+		t.Errorf("no image result should be recorded for a resource without images")
+		return
+	}
+}
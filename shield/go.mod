@@ -3,12 +3,19 @@ module github.com/stolostron/integrity-shield/shield
 go 1.16
 
 require (
+	github.com/cyberphone/json-canonicalization v0.0.0-20210823021906-dc406ceaf94b
 	github.com/ghodss/yaml v1.0.0
+	github.com/golang-jwt/jwt/v4 v4.4.2
+	github.com/google/cel-go v0.12.6
+	github.com/google/go-containerregistry v0.11.0
 	github.com/jinzhu/copier v0.3.2
 	github.com/pkg/errors v0.9.1
 	github.com/sigstore/cosign v1.12.0
 	github.com/sigstore/k8s-manifest-sigstore v0.4.0
+	github.com/sigstore/rekor v0.11.0
+	github.com/sigstore/sigstore v1.4.1-0.20220908204944-ec922cf4f1c2
 	github.com/sirupsen/logrus v1.9.0
+	golang.org/x/crypto v0.0.0-20220829220503-c86fa9a7ed90
 	k8s.io/api v0.25.0-alpha.2
 	k8s.io/apimachinery v0.25.0-alpha.2
 	k8s.io/client-go v0.25.0-alpha.2
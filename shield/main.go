@@ -24,7 +24,6 @@ import (
 	"net/http"
 	"path"
 
-	cosign "github.com/sigstore/cosign/cmd/cosign/cli"
 	log "github.com/sirupsen/logrus"
 	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
 	"github.com/stolostron/integrity-shield/shield/pkg/shield"
@@ -43,9 +42,7 @@ func init() {
 	log.SetFormatter(&log.JSONFormatter{})
 	log.Info("Integrity Shield has been started.")
 
-	log.Info("initialize cosign.")
-	//  "TUF_ROOT" is set to "/ishield-app/sigstore"
-	_ = cosign.Initialize()
+	shield.InitializeSigstore()
 }
 
 func defaultHandler(w http.ResponseWriter, r *http.Request) {
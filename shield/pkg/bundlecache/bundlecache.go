@@ -0,0 +1,363 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package bundlecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// directory of the on-disk cache; if empty, bundles are cached only in memory
+	CacheDirEnvKey = "ISHIELD_BUNDLE_CACHE_DIR"
+	// duration for which tag-to-digest resolution is cached
+	TagTTLEnvKey = "ISHIELD_BUNDLE_TAG_TTL"
+	// if true, only references with a digest are accepted
+	RequireDigestEnvKey = "ISHIELD_BUNDLE_REQUIRE_DIGEST"
+
+	DefaultTagTTL = 5 * time.Minute
+
+	// key prefix of the manifest cache in k8s-manifest-sigstore
+	manifestCacheKeyPrefix = "cache/fetch-manifest/"
+)
+
+// BundleCache is a content-addressed cache of resource bundle images which are keyed by digest.
+// Bundles are kept in memory and, if the directory is set, on disk as blobs named by their digest,
+// and they are verified with the digest again whenever they are read.
+type BundleCache struct {
+	dir           string
+	tagTTL        time.Duration
+	requireDigest bool
+
+	mu sync.Mutex
+	// tag reference -> resolved digest
+	tags map[string]resolvedTag
+	// digest -> concatenated YAML manifests in the bundle
+	bundles map[string]cachedBundle
+
+	resolveDigest func(ref name.Reference) (v1.Hash, error)
+	pullImage     func(ref name.Digest) (v1.Image, error)
+	now           func() time.Time
+}
+
+type resolvedTag struct {
+	digest     name.Digest
+	resolvedAt time.Time
+}
+
+type cachedBundle struct {
+	concatYAML []byte
+	sum        [sha256.Size]byte
+}
+
+var defaultCache *BundleCache
+var defaultCacheOnce sync.Once
+
+// Default returns a bundle cache configured with the environment variables
+func Default() *BundleCache {
+	defaultCacheOnce.Do(func() {
+		tagTTL := DefaultTagTTL
+		if ttlStr := os.Getenv(TagTTLEnvKey); ttlStr != "" {
+			ttl, err := time.ParseDuration(ttlStr)
+			if err != nil {
+				log.Warningf("failed to parse %s; use the default value %s; %s", TagTTLEnvKey, DefaultTagTTL, err.Error())
+			} else {
+				tagTTL = ttl
+			}
+		}
+		requireDigest, _ := strconv.ParseBool(os.Getenv(RequireDigestEnvKey))
+		defaultCache = NewBundleCache(os.Getenv(CacheDirEnvKey), tagTTL, requireDigest)
+	})
+	return defaultCache
+}
+
+// NewBundleCache returns a bundle cache. If dir is empty, bundles are cached only in memory.
+func NewBundleCache(dir string, tagTTL time.Duration, requireDigest bool) *BundleCache {
+	return &BundleCache{
+		dir:           dir,
+		tagTTL:        tagTTL,
+		requireDigest: requireDigest,
+		tags:          map[string]resolvedTag{},
+		bundles:       map[string]cachedBundle{},
+		resolveDigest: resolveDigestWithRegistry,
+		pullImage:     pullImageFromRegistry,
+		now:           time.Now,
+	}
+}
+
+// Prepare resolves the comma separated bundle references to digest references and loads the bundles,
+// so that k8s-manifest-sigstore finds them in its manifest cache instead of pulling them.
+// The digest references are returned to be verified instead of the original references.
+func (c *BundleCache) Prepare(resBundleRef string) (string, error) {
+	digestRefs := []string{}
+	for _, ref := range k8smnfutil.SplitCommaSeparatedString(resBundleRef) {
+		digestRef, err := c.Resolve(ref)
+		if err != nil {
+			return "", err
+		}
+		concatYAML, err := c.Get(digestRef)
+		if err != nil {
+			return "", err
+		}
+		err = k8smnfutil.SetCache(manifestCacheKeyPrefix+digestRef.String(), concatYAML, nil)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to set the bundle to the manifest cache")
+		}
+		digestRefs = append(digestRefs, digestRef.String())
+	}
+	return strings.Join(digestRefs, ","), nil
+}
+
+// Resolve returns the digest reference of the bundle. A tag is resolved with the registry,
+// and the result is cached for the TTL.
+func (c *BundleCache) Resolve(ref string) (name.Digest, error) {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return name.Digest{}, errors.Wrap(err, "failed to parse the bundle reference")
+	}
+	if digestRef, ok := parsed.(name.Digest); ok {
+		return digestRef, nil
+	}
+	if c.requireDigest {
+		return name.Digest{}, fmt.Errorf("the bundle reference `%s` has no digest; a reference with a digest is required", ref)
+	}
+	now := c.now()
+	c.mu.Lock()
+	resolved, ok := c.tags[parsed.String()]
+	c.mu.Unlock()
+	if ok && now.Sub(resolved.resolvedAt) < c.tagTTL {
+		return resolved.digest, nil
+	}
+	hash, err := c.resolveDigest(parsed)
+	if err != nil {
+		return name.Digest{}, errors.Wrap(err, "failed to resolve the digest of the bundle")
+	}
+	digestRef := parsed.Context().Digest(hash.String())
+	c.mu.Lock()
+	c.tags[parsed.String()] = resolvedTag{digest: digestRef, resolvedAt: now}
+	c.mu.Unlock()
+	return digestRef, nil
+}
+
+// Get returns the concatenated YAML manifests in the bundle. The bundle is read from memory, from disk
+// or from the registry in this order, and it is verified with the digest in every case.
+func (c *BundleCache) Get(digestRef name.Digest) ([]byte, error) {
+	digest, err := v1.NewHash(digestRef.DigestStr())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the bundle digest")
+	}
+
+	c.mu.Lock()
+	cached, ok := c.bundles[digest.String()]
+	c.mu.Unlock()
+	if ok {
+		if sha256.Sum256(cached.concatYAML) == cached.sum {
+			return cached.concatYAML, nil
+		}
+		log.Warningf("the bundle %s in memory is modified; load it again", digest.String())
+	}
+
+	layers, err := c.readImage(digest)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			log.Warningf("the bundle %s on disk is not used; %s", digest.String(), err.Error())
+		}
+		layers, err = c.pull(digestRef, digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	concatYAML, err := concatYAMLsInLayers(layers)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.bundles[digest.String()] = cachedBundle{concatYAML: concatYAML, sum: sha256.Sum256(concatYAML)}
+	c.mu.Unlock()
+	return concatYAML, nil
+}
+
+// pull gets the bundle image from the registry and writes its manifest and layers to disk
+func (c *BundleCache) pull(digestRef name.Digest, digest v1.Hash) ([][]byte, error) {
+	img, err := c.pullImage(digestRef)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pull the bundle")
+	}
+	manifest, err := img.RawManifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the manifest of the bundle")
+	}
+	if err = verifyBlob(digest, manifest); err != nil {
+		return nil, err
+	}
+	imgLayers, err := img.Layers()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get layers in the bundle")
+	}
+	layers := [][]byte{}
+	blobs := map[v1.Hash][]byte{digest: manifest}
+	for _, layer := range imgLayers {
+		layerDigest, err := layer.Digest()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the digest of a layer")
+		}
+		blob, err := k8smnfutil.GetBlob(layer)
+		if err != nil {
+			return nil, err
+		}
+		if err = verifyBlob(layerDigest, blob); err != nil {
+			return nil, err
+		}
+		layers = append(layers, blob)
+		blobs[layerDigest] = blob
+	}
+	if c.dir != "" {
+		for h, blob := range blobs {
+			if err = c.writeBlob(h, blob); err != nil {
+				log.Warningf("failed to write the bundle to disk; %s", err.Error())
+				break
+			}
+		}
+	}
+	return layers, nil
+}
+
+// readImage reads the manifest and layers of the bundle on disk and verifies them with their digests
+func (c *BundleCache) readImage(digest v1.Hash) ([][]byte, error) {
+	if c.dir == "" {
+		return nil, &os.PathError{Op: "open", Path: digest.String(), Err: os.ErrNotExist}
+	}
+	manifestBytes, err := c.readBlob(digest)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(manifestBytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the manifest of the bundle")
+	}
+	layers := [][]byte{}
+	for _, desc := range manifest.Layers {
+		blob, err := c.readBlob(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, blob)
+	}
+	return layers, nil
+}
+
+func (c *BundleCache) blobPath(h v1.Hash) string {
+	return filepath.Join(c.dir, "blobs", h.Algorithm, h.Hex)
+}
+
+func (c *BundleCache) readBlob(h v1.Hash) ([]byte, error) {
+	blob, err := ioutil.ReadFile(c.blobPath(h))
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyBlob(h, blob); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// writeBlob writes the blob unless a valid one exists. The blob is written to a temporary file and renamed,
+// so that other processes sharing the volume never read a partial blob.
+func (c *BundleCache) writeBlob(h v1.Hash, blob []byte) error {
+	if _, err := c.readBlob(h); err == nil {
+		return nil
+	}
+	path := c.blobPath(h)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, h.Hex+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(blob)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func verifyBlob(h v1.Hash, blob []byte) error {
+	if h.Algorithm != "sha256" {
+		return fmt.Errorf("the digest algorithm `%s` is not supported", h.Algorithm)
+	}
+	sum := sha256.Sum256(blob)
+	if hex.EncodeToString(sum[:]) != h.Hex {
+		return fmt.Errorf("the digest of the blob does not match %s", h.String())
+	}
+	return nil
+}
+
+// concatYAMLsInLayers is the same as GenerateConcatYAMLsFromImage in k8s-manifest-sigstore
+func concatYAMLsInLayers(layers [][]byte) ([]byte, error) {
+	if len(layers) == 0 {
+		return nil, errors.New("failed to get blob in image; this image has no layers")
+	}
+	yamls := [][]byte{}
+	sumErr := []string{}
+	for _, blob := range layers {
+		yamlsInLayer, err := k8smnfutil.GetYAMLsInArtifact(blob)
+		if err != nil {
+			sumErr = append(sumErr, errors.Wrap(err, "failed to decompress tar gz blob").Error())
+			continue
+		}
+		yamls = append(yamls, yamlsInLayer...)
+	}
+	if len(yamls) == 0 && len(sumErr) > 0 {
+		return nil, errors.New(strings.Join(sumErr, "; "))
+	}
+	return k8smnfutil.ConcatenateYAMLs(yamls), nil
+}
+
+func resolveDigestWithRegistry(ref name.Reference) (v1.Hash, error) {
+	desc, err := remote.Head(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	return desc.Digest, nil
+}
+
+func pullImageFromRegistry(ref name.Digest) (v1.Image, error) {
+	return k8smnfutil.PullImage(ref.String())
+}
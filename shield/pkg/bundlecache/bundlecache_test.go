@@ -0,0 +1,154 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package bundlecache
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+)
+
+const sampleManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: sample-cm
+data:
+  key: value
+`
+
+// fakeRegistry serves one bundle image and counts the requests
+type fakeRegistry struct {
+	img      v1.Image
+	resolved int
+	pulled   int
+}
+
+func (r *fakeRegistry) setup(c *BundleCache, now *time.Time) {
+	c.resolveDigest = func(ref name.Reference) (v1.Hash, error) {
+		r.resolved++
+		return r.img.Digest()
+	}
+	c.pullImage = func(ref name.Digest) (v1.Image, error) {
+		r.pulled++
+		return r.img, nil
+	}
+	c.now = func() time.Time { return *now }
+}
+
+func TestBundleCache(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image, static.NewLayer([]byte(sampleManifest), types.DockerLayer))
+	if err != nil {
+		t.Errorf("failed to make a bundle image: %s", err.Error())
+		return
+	}
+	digest, _ := img.Digest()
+	dir, err := ioutil.TempDir("", "bundlecache")
+	if err != nil {
+		t.Errorf("failed to make a cache dir: %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	registry := &fakeRegistry{img: img}
+	cache := NewBundleCache(dir, time.Minute, false)
+	registry.setup(cache, &now)
+
+	tagRef := "sample-registry.io/sample-bundle:0.1.0"
+	digestRef, err := cache.Prepare(tagRef)
+	if err != nil {
+		t.Errorf("failed to prepare the bundle: %s", err.Error())
+		return
+	}
+	if digestRef != "sample-registry.io/sample-bundle@"+digest.String() {
+		t.Errorf("tag should be resolved to the digest: %s", digestRef)
+		return
+	}
+	cached, err := k8smnfutil.GetCache(manifestCacheKeyPrefix + digestRef)
+	if err != nil || len(cached) != 2 || !strings.Contains(string(cached[0].([]byte)), "sample-cm") {
+		t.Errorf("bundle should be set to the manifest cache of k8s-manifest-sigstore; %v", err)
+		return
+	}
+
+	// the resolved tag and the bundle are reused
+	now = now.Add(30 * time.Second)
+	if _, err = cache.Prepare(tagRef); err != nil || registry.resolved != 1 || registry.pulled != 1 {
+		t.Errorf("cached tag and bundle should be used; resolved: %d, pulled: %d, err: %v", registry.resolved, registry.pulled, err)
+		return
+	}
+	now = now.Add(time.Minute)
+	if _, err = cache.Prepare(tagRef); err != nil || registry.resolved != 2 || registry.pulled != 1 {
+		t.Errorf("tag should be resolved again after the TTL; resolved: %d, pulled: %d, err: %v", registry.resolved, registry.pulled, err)
+		return
+	}
+
+	// a new cache with the same directory, e.g. after a pod restart, reads the bundle on disk
+	restarted := NewBundleCache(dir, time.Minute, true)
+	restartedRegistry := &fakeRegistry{img: img}
+	restartedRegistry.setup(restarted, &now)
+	if _, err = restarted.Prepare(tagRef); err == nil {
+		t.Errorf("tag reference should be rejected if a digest is required")
+		return
+	}
+	parsedDigestRef, _ := name.NewDigest(digestRef)
+	if _, err = restarted.Get(parsedDigestRef); err != nil || restartedRegistry.pulled != 0 {
+		t.Errorf("bundle on disk should be used; pulled: %d, err: %v", restartedRegistry.pulled, err)
+		return
+	}
+
+	// a modified blob on disk is not used and is replaced with the bundle in the registry
+	layers, _ := img.Layers()
+	layerDigest, _ := layers[0].Digest()
+	err = ioutil.WriteFile(restarted.blobPath(layerDigest), []byte("modified"), 0600)
+	if err != nil {
+		t.Errorf("failed to modify the blob: %s", err.Error())
+		return
+	}
+	modified := NewBundleCache(dir, time.Minute, true)
+	modifiedRegistry := &fakeRegistry{img: img}
+	modifiedRegistry.setup(modified, &now)
+	if _, err = modified.Get(parsedDigestRef); err != nil || modifiedRegistry.pulled != 1 {
+		t.Errorf("modified blob should be pulled again; pulled: %d, err: %v", modifiedRegistry.pulled, err)
+		return
+	}
+	if _, err = modified.readBlob(layerDigest); err != nil {
+		t.Errorf("modified blob should be replaced: %s", err.Error())
+		return
+	}
+
+	// a bundle which does not match the digest is not accepted
+	other, _ := mutate.AppendLayers(empty.Image, static.NewLayer([]byte("other"), types.DockerLayer))
+	otherRegistry := &fakeRegistry{img: other}
+	memoryCache := NewBundleCache("", time.Minute, false)
+	otherRegistry.setup(memoryCache, &now)
+	memoryCache.resolveDigest = func(ref name.Reference) (v1.Hash, error) { return v1.Hash{}, errors.New("unexpected resolution") }
+	if _, err = memoryCache.Get(parsedDigestRef); err == nil {
+		t.Errorf("bundle which does not match the digest should not be accepted")
+		return
+	}
+}
@@ -0,0 +1,256 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/pkg/errors"
+)
+
+// variables which can be used in expressions
+const (
+	ExpressionVarObject          = "object"
+	ExpressionVarOldObject       = "oldObject"
+	ExpressionVarRequest         = "request"
+	ExpressionVarNamespaceObject = "namespaceObject"
+)
+
+// the number of compiled rules kept in memory; rules of old profile generations are dropped when this is exceeded
+const maxCompiledExpressionRules = 256
+
+// ExpressionRules defines CEL expressions for scope, skip and ignore decisions.
+// Each expression must return a bool and can use `object`, `oldObject`, `request` and `namespaceObject`.
+type ExpressionRules struct {
+	// the object is in scope only if any of these expressions is true
+	Scope []string `json:"scope,omitempty"`
+	// the request is allowed without signature if any of these expressions is true
+	Skip []string `json:"skip,omitempty"`
+	// the fields are ignored if the expression is true
+	Ignore []IgnoreExpression `json:"ignore,omitempty"`
+}
+
+type IgnoreExpression struct {
+	Fields     []string `json:"fields,omitempty"`
+	Expression string   `json:"expression,omitempty"`
+}
+
+// CompiledExpressionRules is a set of programs compiled from ExpressionRules.
+// A nil CompiledExpressionRules has no expressions.
+type CompiledExpressionRules struct {
+	scope  []cel.Program
+	skip   []cel.Program
+	ignore []compiledIgnoreExpression
+}
+
+type compiledIgnoreExpression struct {
+	fields  []string
+	program cel.Program
+}
+
+type compiledExpressionEntry struct {
+	rules *CompiledExpressionRules
+	err   error
+}
+
+var (
+	expressionEnv     *cel.Env
+	expressionEnvErr  error
+	expressionEnvOnce sync.Once
+
+	compiledExpressionMu    sync.Mutex
+	compiledExpressionCache = map[string]compiledExpressionEntry{}
+)
+
+func (r *ExpressionRules) Enabled() bool {
+	return r != nil && (len(r.Scope) > 0 || len(r.Skip) > 0 || len(r.Ignore) > 0)
+}
+
+// UsesVariable returns true if any expression refers to the variable
+func (r *ExpressionRules) UsesVariable(name string) bool {
+	if r == nil {
+		return false
+	}
+	exprs := []string{}
+	exprs = append(exprs, r.Scope...)
+	exprs = append(exprs, r.Skip...)
+	for _, ie := range r.Ignore {
+		exprs = append(exprs, ie.Expression)
+	}
+	for _, expr := range exprs {
+		if strings.Contains(expr, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCompiledExpressionRules returns compiled programs for the rules.
+// Programs are compiled once for each content of the rules, so they are compiled again only when a profile is changed.
+func GetCompiledExpressionRules(r *ExpressionRules) (*CompiledExpressionRules, error) {
+	if !r.Enabled() {
+		return nil, nil
+	}
+	ruleBytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal expression rules")
+	}
+	sum := sha256.Sum256(ruleBytes)
+	key := hex.EncodeToString(sum[:])
+
+	compiledExpressionMu.Lock()
+	defer compiledExpressionMu.Unlock()
+	if entry, ok := compiledExpressionCache[key]; ok {
+		return entry.rules, entry.err
+	}
+	compiled, err := CompileExpressionRules(r)
+	if len(compiledExpressionCache) >= maxCompiledExpressionRules {
+		compiledExpressionCache = map[string]compiledExpressionEntry{}
+	}
+	compiledExpressionCache[key] = compiledExpressionEntry{rules: compiled, err: err}
+	return compiled, err
+}
+
+// CompileExpressionRules compiles all expressions in the rules and returns the first error.
+func CompileExpressionRules(r *ExpressionRules) (*CompiledExpressionRules, error) {
+	if !r.Enabled() {
+		return nil, nil
+	}
+	compiled := &CompiledExpressionRules{}
+	for _, expr := range r.Scope {
+		prg, err := compileExpression(expr)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid expression in scope")
+		}
+		compiled.scope = append(compiled.scope, prg)
+	}
+	for _, expr := range r.Skip {
+		prg, err := compileExpression(expr)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid expression in skip")
+		}
+		compiled.skip = append(compiled.skip, prg)
+	}
+	for _, ie := range r.Ignore {
+		if len(ie.Fields) == 0 {
+			return nil, fmt.Errorf("no fields are specified for the ignore expression `%s`", ie.Expression)
+		}
+		prg, err := compileExpression(ie.Expression)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid expression in ignore")
+		}
+		compiled.ignore = append(compiled.ignore, compiledIgnoreExpression{fields: ie.Fields, program: prg})
+	}
+	return compiled, nil
+}
+
+// InScope returns true if no scope expression is defined or any of them is true
+func (c *CompiledExpressionRules) InScope(vars map[string]interface{}) (bool, error) {
+	if c == nil || len(c.scope) == 0 {
+		return true, nil
+	}
+	return evalAny(c.scope, vars)
+}
+
+// Skip returns true if any skip expression is true
+func (c *CompiledExpressionRules) Skip(vars map[string]interface{}) (bool, error) {
+	if c == nil || len(c.skip) == 0 {
+		return false, nil
+	}
+	return evalAny(c.skip, vars)
+}
+
+// IgnoreFields returns the fields of the ignore expressions which are true
+func (c *CompiledExpressionRules) IgnoreFields(vars map[string]interface{}) ([]string, error) {
+	fields := []string{}
+	if c == nil {
+		return fields, nil
+	}
+	for _, ie := range c.ignore {
+		matched, err := evalBool(ie.program, vars)
+		if err != nil {
+			return fields, err
+		}
+		if matched {
+			fields = append(fields, ie.fields...)
+		}
+	}
+	return fields, nil
+}
+
+func getExpressionEnv() (*cel.Env, error) {
+	expressionEnvOnce.Do(func() {
+		expressionEnv, expressionEnvErr = cel.NewEnv(
+			cel.Variable(ExpressionVarObject, cel.DynType),
+			cel.Variable(ExpressionVarOldObject, cel.DynType),
+			cel.Variable(ExpressionVarRequest, cel.DynType),
+			cel.Variable(ExpressionVarNamespaceObject, cel.DynType),
+		)
+	})
+	return expressionEnv, expressionEnvErr
+}
+
+func compileExpression(expr string) (cel.Program, error) {
+	env, err := getExpressionEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create CEL environment")
+	}
+	ast, iss := env.Compile(expr)
+	if iss != nil && iss.Err() != nil {
+		return nil, errors.Wrap(iss.Err(), fmt.Sprintf("failed to compile `%s`", expr))
+	}
+	outputType := ast.OutputType()
+	if outputType != cel.BoolType && outputType != cel.DynType {
+		return nil, fmt.Errorf("expression `%s` must return bool, but returns %s", expr, outputType.String())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create a program for `%s`", expr))
+	}
+	return prg, nil
+}
+
+func evalAny(programs []cel.Program, vars map[string]interface{}) (bool, error) {
+	for _, prg := range programs {
+		matched, err := evalBool(prg, vars)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evalBool(prg cel.Program, vars map[string]interface{}) (bool, error) {
+	val, _, err := prg.Eval(vars)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to evaluate expression")
+	}
+	b, ok := val.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returns %T, not bool", val.Value())
+	}
+	return b, nil
+}
@@ -0,0 +1,94 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpressionRules(t *testing.T) {
+	rules := &ExpressionRules{
+		Scope: []string{`object.kind == "Deployment"`},
+		Skip: []string{
+			`request.userInfo.username.startsWith("system:serviceaccount:kube-system:")`,
+		},
+		Ignore: []IgnoreExpression{
+			{
+				Fields:     []string{"spec.replicas"},
+				Expression: `has(object.metadata.annotations) && "autoscaled" in object.metadata.annotations`,
+			},
+		},
+	}
+	compiled, err := GetCompiledExpressionRules(rules)
+	if err != nil {
+		t.Errorf("failed to compile expressions: %s", err.Error())
+		return
+	}
+	cachedCompiled, _ := GetCompiledExpressionRules(rules)
+	if cachedCompiled != compiled {
+		t.Errorf("expressions with the same content should be compiled only once")
+		return
+	}
+
+	vars := map[string]interface{}{
+		ExpressionVarObject: map[string]interface{}{
+			"kind": "Deployment",
+			"metadata": map[string]interface{}{
+				"name":        "sample-deploy",
+				"annotations": map[string]interface{}{"autoscaled": "true"},
+			},
+			"spec": map[string]interface{}{"replicas": int64(3)},
+		},
+		ExpressionVarOldObject: nil,
+		ExpressionVarRequest: map[string]interface{}{
+			"userInfo": map[string]interface{}{"username": "sample-user"},
+		},
+		ExpressionVarNamespaceObject: nil,
+	}
+	inScope, err := compiled.InScope(vars)
+	if err != nil || !inScope {
+		t.Errorf("unexpected scope result: got: %v, %v\nwant: %v", inScope, err, true)
+		return
+	}
+	skip, err := compiled.Skip(vars)
+	if err != nil || skip {
+		t.Errorf("unexpected skip result: got: %v, %v\nwant: %v", skip, err, false)
+		return
+	}
+	fields, err := compiled.IgnoreFields(vars)
+	if err != nil || !reflect.DeepEqual(fields, []string{"spec.replicas"}) {
+		t.Errorf("unexpected ignore fields: got: %v, %v\nwant: %v", fields, err, []string{"spec.replicas"})
+		return
+	}
+
+	// compile errors are reported at validation time
+	invalidRule := &ManifestVerifyRule{
+		Expressions: &ExpressionRules{Skip: []string{`object.metadata.name ==`}},
+	}
+	if err := ValidateManifestVerifyRule(invalidRule); err == nil {
+		t.Errorf("invalid expression should be reported")
+		return
+	}
+	nonBoolRule := &ManifestVerifyRule{
+		Expressions: &ExpressionRules{Scope: []string{`1 + 2`}},
+	}
+	if err := ValidateManifestVerifyRule(nonBoolRule); err == nil {
+		t.Errorf("expression which does not return bool should be reported")
+		return
+	}
+}
@@ -0,0 +1,110 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// modes of an image policy
+const (
+	ImagePolicyModeEnforce = "enforce"
+	ImagePolicyModeInform  = "inform"
+	ImagePolicyModeSkip    = "skip"
+)
+
+// ImagePolicy verifies the images which match its patterns with its own keys, keyless identities or Notation trust policy.
+// Each image is evaluated against the first policy in `imageProfile.policies` which matches it.
+type ImagePolicy struct {
+	Name                   string              `json:"name,omitempty"`
+	Match                  ImageRefList        `json:"match"`
+	Exclude                ImageRefList        `json:"exclude,omitempty"`
+	Mode                   string              `json:"mode,omitempty"` // enforce (default), inform or skip
+	KeyConfigs             []KeyConfig         `json:"keyConfigs,omitempty"`
+	KeylessIdentities      KeylessIdentityList `json:"keylessIdentities,omitempty"`
+	KeylessCertificateRoot string              `json:"keylessCertificateRoot,omitempty"`
+	Notation               *NotationVerifier   `json:"notation,omitempty"`
+}
+
+// GetMode returns the mode of the policy, which is `enforce` if not set
+func (p ImagePolicy) GetMode() string {
+	if p.Mode == "" {
+		return ImagePolicyModeEnforce
+	}
+	return p.Mode
+}
+
+// MatchWith returns if the policy matches the image ref or not
+func (p ImagePolicy) MatchWith(imageRef string) bool {
+	return p.Profile().MatchWith(imageRef)
+}
+
+// Profile returns the image profile to verify the images which match the policy
+func (p ImagePolicy) Profile() ImageProfile {
+	return ImageProfile{
+		KeyConfigs:             p.KeyConfigs,
+		KeylessIdentities:      p.KeylessIdentities,
+		KeylessCertificateRoot: p.KeylessCertificateRoot,
+		Notation:               p.Notation,
+		Match:                  p.Match,
+		Exclude:                p.Exclude,
+	}
+}
+
+// String returns the name of the policy used in messages
+func (p ImagePolicy) String() string {
+	if p.Name == "" {
+		return fmt.Sprintf("image policy for %v", p.Match)
+	}
+	return fmt.Sprintf("image policy `%s`", p.Name)
+}
+
+// FindPolicy returns the first policy which matches the image ref, or nil if no policy matches it
+func (p ImageProfile) FindPolicy(imageRef string) *ImagePolicy {
+	for i := range p.Policies {
+		if p.Policies[i].MatchWith(imageRef) {
+			return &p.Policies[i]
+		}
+	}
+	return nil
+}
+
+// validatePolicies returns an error if any image policy cannot be used for verification
+func (p ImageProfile) validatePolicies() error {
+	if len(p.KeyConfigs) > 0 || len(p.KeylessIdentities) > 0 || p.KeylessCertificateRoot != "" || p.Notation != nil {
+		return errors.New("keyConfigs, keylessIdentities, keylessCertificateRoot and notation in imageProfile cannot be used with policies; set them in each policy")
+	}
+	if len(p.Match) > 0 || len(p.Exclude) > 0 {
+		return errors.New("match and exclude in imageProfile cannot be used with policies; set them in each policy")
+	}
+	for i, policy := range p.Policies {
+		if len(policy.Match) == 0 {
+			return fmt.Errorf("match is required in imageProfile.policies[%d]", i)
+		}
+		switch policy.GetMode() {
+		case ImagePolicyModeEnforce, ImagePolicyModeInform, ImagePolicyModeSkip:
+		default:
+			return fmt.Errorf("unknown mode `%s` in imageProfile.policies[%d]; use enforce, inform or skip", policy.Mode, i)
+		}
+		if err := policy.Profile().Validate(); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid imageProfile.policies[%d]", i))
+		}
+	}
+	return nil
+}
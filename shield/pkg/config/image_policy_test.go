@@ -0,0 +1,93 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+)
+
+func TestImagePolicies(t *testing.T) {
+	internalKey := KeyConfig{Secret: KeySecret{Name: "internal-pubkey", Namespace: "sample-ns"}}
+	vendorKey := KeyConfig{Secret: KeySecret{Name: "vendor-pubkey", Namespace: "sample-ns"}}
+	profile := ImageProfile{
+		Policies: []ImagePolicy{
+			{Name: "internal-debug", Match: ImageRefList{"registry.internal.example.com/debug/*"}, Mode: ImagePolicyModeSkip},
+			{Name: "internal", Match: ImageRefList{"registry.internal.example.com/*"}, KeyConfigs: []KeyConfig{internalKey}},
+			{Name: "vendor", Match: ImageRefList{"registry.vendor.example.com/*"}, Exclude: ImageRefList{"registry.vendor.example.com/beta/*"}, Mode: ImagePolicyModeInform, KeyConfigs: []KeyConfig{vendorKey}},
+		},
+	}
+	if err := profile.Validate(); err != nil {
+		t.Errorf("image profile with policies should be valid: %s", err.Error())
+		return
+	}
+	if !profile.Enabled() {
+		t.Errorf("image profile with policies should be enabled")
+		return
+	}
+	if err := profile.CheckOffline(); err != nil {
+		t.Errorf("image policies with keyConfigs should be verified offline: %s", err.Error())
+		return
+	}
+
+	testCases := map[string]string{
+		"registry.internal.example.com/debug/shell:1.0": "internal-debug",
+		"registry.internal.example.com/app:1.0":         "internal",
+		"registry.vendor.example.com/db:2.3":            "vendor",
+		"registry.vendor.example.com/beta/db:2.4":       "",
+		"docker.io/library/nginx:1.21":                  "",
+	}
+	for image, expected := range testCases {
+		name := ""
+		if policy := profile.FindPolicy(image); policy != nil {
+			name = policy.Name
+		}
+		if name != expected {
+			t.Errorf("the image `%s` should match the policy `%s`, but it matches `%s`", image, expected, name)
+			return
+		}
+	}
+	if mode := profile.Policies[1].GetMode(); mode != ImagePolicyModeEnforce {
+		t.Errorf("the default mode should be enforce, but it is %s", mode)
+		return
+	}
+
+	invalidProfiles := []ImageProfile{
+		{KeyConfigs: []KeyConfig{internalKey}, Policies: profile.Policies},
+		{Match: ImageRefList{"registry.internal.example.com/*"}, Policies: profile.Policies},
+		{Policies: []ImagePolicy{{Name: "no-match", KeyConfigs: []KeyConfig{internalKey}}}},
+		{Policies: []ImagePolicy{{Name: "unknown-mode", Match: ImageRefList{"*"}, Mode: "audit", KeyConfigs: []KeyConfig{internalKey}}}},
+		{Policies: []ImagePolicy{{Name: "x509", Match: ImageRefList{"*"}, KeyConfigs: []KeyConfig{{Secret: internalKey.Secret, X509: &X509KeyConfig{}}}}}},
+	}
+	for i, p := range invalidProfiles {
+		if err := p.Validate(); err == nil {
+			t.Errorf("invalid image profile [%d] should be rejected", i)
+			return
+		}
+	}
+
+	// keyless policies need the transparency log, but skipped policies are not verified at all
+	keyless := ImageProfile{Policies: []ImagePolicy{{Match: ImageRefList{"*"}, KeylessIdentities: KeylessIdentityList{{Issuer: "https://token.actions.githubusercontent.com", Subject: "https://github.com/sample-org/*"}}}}}
+	if err := keyless.CheckOffline(); err == nil {
+		t.Errorf("keyless image policies should not be verified offline")
+		return
+	}
+	keyless.Policies[0].Mode = ImagePolicyModeSkip
+	if err := keyless.CheckOffline(); err != nil {
+		t.Errorf("skipped image policies should be allowed offline: %s", err.Error())
+		return
+	}
+}
@@ -0,0 +1,97 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HasLifecycle returns true if the key has a validity window or is retiring.
+// Such keys are verified one by one so that the key which verified a signature is known.
+func (k KeyConfig) HasLifecycle() bool {
+	return k.NotBefore != nil || k.NotAfter != nil || k.Retiring
+}
+
+// Description returns a name of the key for messages
+func (k KeyConfig) Description() string {
+	if k.VerificationKeyName != "" {
+		return fmt.Sprintf("verification key `%s`", k.VerificationKeyName)
+	}
+	if k.VerificationKey != "" {
+		return fmt.Sprintf("verification key `%s`", k.VerificationKey)
+	}
+	if k.VerificationKeySelector != nil {
+		return fmt.Sprintf("verification keys selected by `%s`", metav1.FormatLabelSelector(k.VerificationKeySelector))
+	}
+	if k.X509 != nil {
+		return fmt.Sprintf("x509 CA bundle in the %s", k.X509.CABundle.String())
+	}
+	if k.KMS != nil {
+		return fmt.Sprintf("KMS key `%s`", k.KMS.Ref)
+	}
+	if k.PGPKeyring != nil {
+		return fmt.Sprintf("PGP keyring in the %s", k.PGPKeyring.String())
+	}
+	if k.Secret.Namespace != "" && k.Secret.Name != "" {
+		return fmt.Sprintf("secret `%s/%s`", k.Secret.Namespace, k.Secret.Name)
+	}
+	return fmt.Sprintf("key `%s`", k.Key.Name)
+}
+
+// ValidateWindow returns an error if notAfter is not later than notBefore
+func (k KeyConfig) ValidateWindow() error {
+	if k.NotBefore != nil && k.NotAfter != nil && !k.NotAfter.After(k.NotBefore.Time) {
+		return fmt.Errorf("notAfter must be later than notBefore in the %s", k.Description())
+	}
+	return nil
+}
+
+// CheckSignedTime returns an error if a signature made with this key must not be accepted.
+// The signed time is checked with the validity window. If the signed time is unknown,
+// the current time is checked instead, but a retiring key is not accepted.
+func (k KeyConfig) CheckSignedTime(signedTime *time.Time, now time.Time) error {
+	t := now
+	if signedTime != nil {
+		t = *signedTime
+	} else if k.Retiring {
+		return fmt.Errorf("the %s is retiring and the signed time is unknown", k.Description())
+	}
+	if k.NotBefore != nil && t.Before(k.NotBefore.Time) {
+		return fmt.Errorf("the %s is not valid before %s (time: %s)", k.Description(), k.NotBefore.Format(time.RFC3339), t.Format(time.RFC3339))
+	}
+	if k.NotAfter != nil && t.After(k.NotAfter.Time) {
+		return fmt.Errorf("the %s is not valid after %s (time: %s)", k.Description(), k.NotAfter.Format(time.RFC3339), t.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// SplitKeyConfigsByLifecycle returns keys without lifecycle and keys with lifecycle
+func SplitKeyConfigsByLifecycle(keyConfigs []KeyConfig) ([]KeyConfig, []KeyConfig) {
+	plain := []KeyConfig{}
+	lifecycle := []KeyConfig{}
+	for _, k := range keyConfigs {
+		if k.HasLifecycle() {
+			lifecycle = append(lifecycle, k)
+		} else {
+			plain = append(plain, k)
+		}
+	}
+	return plain, lifecycle
+}
@@ -0,0 +1,69 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestKeyConfigLifecycle(t *testing.T) {
+	notBefore := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	notAfter := metav1.NewTime(time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC))
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	inWindow := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	afterWindow := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	retiring := KeyConfig{Key: Key{Name: "old-key"}, NotBefore: &notBefore, NotAfter: &notAfter, Retiring: true}
+	plain := KeyConfig{Key: Key{Name: "new-key"}}
+
+	if !retiring.HasLifecycle() || plain.HasLifecycle() {
+		t.Errorf("only keys with a window or retiring flag should have lifecycle")
+		return
+	}
+	if err := retiring.CheckSignedTime(&inWindow, now); err != nil {
+		t.Errorf("signature in the window should be accepted: %s", err.Error())
+		return
+	}
+	if err := retiring.CheckSignedTime(&afterWindow, now); err == nil {
+		t.Errorf("signature after the window should not be accepted")
+		return
+	}
+	if err := retiring.CheckSignedTime(nil, now); err == nil {
+		t.Errorf("retiring key should not be accepted without signed time")
+		return
+	}
+	active := KeyConfig{Key: Key{Name: "active-key"}, NotBefore: &notBefore}
+	if err := active.CheckSignedTime(nil, now); err != nil {
+		t.Errorf("active key should be checked with the current time if signed time is unknown: %s", err.Error())
+		return
+	}
+
+	invalid := KeyConfig{Key: Key{Name: "invalid-key"}, NotBefore: &notAfter, NotAfter: &notBefore}
+	if err := ValidateManifestVerifyRule(&ManifestVerifyRule{KeyConfigs: []KeyConfig{invalid}}); err == nil {
+		t.Errorf("notAfter before notBefore should be rejected")
+		return
+	}
+
+	plainKeys, lifecycleKeys := SplitKeyConfigsByLifecycle([]KeyConfig{retiring, plain, active})
+	if len(plainKeys) != 1 || len(lifecycleKeys) != 2 {
+		t.Errorf("unexpected split result; plain: %d, lifecycle: %d", len(plainKeys), len(lifecycleKeys))
+		return
+	}
+}
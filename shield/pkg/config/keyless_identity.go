@@ -0,0 +1,145 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// KeylessIdentity is an identity in the certificate of a keyless signature.
+// The OIDC issuer must match exactly, and the subject (email or URI) must match exactly or with the regular expression.
+type KeylessIdentity struct {
+	Issuer        string `json:"issuer"`
+	Subject       string `json:"subject,omitempty"`
+	SubjectRegExp string `json:"subjectRegExp,omitempty"`
+}
+
+type KeylessIdentityList []KeylessIdentity
+
+// KeylessIdentityResult is the identity in the certificate which matched one of the keyless identities
+type KeylessIdentityResult struct {
+	// set only for image signatures
+	Image   string `json:"image,omitempty"`
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+// Validate returns an error if an identity does not have an issuer and a subject, or has an invalid regular expression
+func (l KeylessIdentityList) Validate() error {
+	for i, id := range l {
+		if id.Issuer == "" {
+			return fmt.Errorf("issuer is empty in the keyless identity [%d]", i)
+		}
+		if (id.Subject == "") == (id.SubjectRegExp == "") {
+			return fmt.Errorf("either subject or subjectRegExp must be set in the keyless identity [%d]", i)
+		}
+		if id.SubjectRegExp != "" {
+			if _, err := regexp.Compile(id.SubjectRegExp); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("invalid subjectRegExp in the keyless identity [%d]", i))
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the first identity which matches the issuer and one of the subjects in a certificate, or nil
+func (l KeylessIdentityList) Match(issuer string, subjects []string) *KeylessIdentityResult {
+	for _, id := range l {
+		if id.Issuer != issuer {
+			continue
+		}
+		var subjectRegExp *regexp.Regexp
+		if id.SubjectRegExp != "" {
+			// the whole subject must match
+			re, err := regexp.Compile("^(?:" + id.SubjectRegExp + ")$")
+			if err != nil {
+				continue
+			}
+			subjectRegExp = re
+		}
+		for _, s := range subjects {
+			if (subjectRegExp == nil && s == id.Subject) || (subjectRegExp != nil && subjectRegExp.MatchString(s)) {
+				return &KeylessIdentityResult{Issuer: issuer, Subject: s}
+			}
+		}
+	}
+	return nil
+}
+
+// String returns identities for messages
+func (l KeylessIdentityList) String() string {
+	s := ""
+	for i, id := range l {
+		if i > 0 {
+			s += ", "
+		}
+		subject := id.Subject
+		if id.SubjectRegExp != "" {
+			subject = fmt.Sprintf("/%s/", id.SubjectRegExp)
+		}
+		s += fmt.Sprintf("%s (issuer: %s)", subject, id.Issuer)
+	}
+	return s
+}
+
+// ValidateKeyless returns an error if keyless identities are set with keys or with a signature threshold
+func (p *ManifestVerifyRule) ValidateKeyless() error {
+	if len(p.KeylessIdentities) == 0 && p.KeylessCertificateRoot == "" {
+		return nil
+	}
+	if len(p.KeyConfigs) > 0 {
+		return errors.New("keylessIdentities and keylessCertificateRoot cannot be used with keyConfigs")
+	}
+	if p.SignatureThreshold != nil {
+		return errors.New("keylessIdentities and keylessCertificateRoot cannot be used with signatureThreshold")
+	}
+	return errors.Wrap(p.KeylessIdentities.Validate(), "invalid keylessIdentities")
+}
+
+// Validate returns an error if the profile cannot be used for verification
+func (p ImageProfile) Validate() error {
+	if len(p.Policies) > 0 {
+		return p.validatePolicies()
+	}
+	for _, k := range p.KeyConfigs {
+		if k.X509 != nil {
+			return errors.New("x509 keyConfigs are not supported in imageProfile")
+		}
+		if k.PGPKeyring != nil {
+			return errors.New("pgpKeyring keyConfigs are not supported in imageProfile")
+		}
+		if k.IsVerificationKeyRef() {
+			return errors.New("verificationKey keyConfigs are not supported in imageProfile")
+		}
+		if err := k.ValidateKMS(); err != nil {
+			return errors.Wrap(err, "invalid keyConfigs in imageProfile")
+		}
+	}
+	if err := p.ValidateNotation(); err != nil {
+		return err
+	}
+	if len(p.KeylessIdentities) == 0 && p.KeylessCertificateRoot == "" {
+		return nil
+	}
+	if len(p.KeyConfigs) > 0 {
+		return errors.New("keylessIdentities and keylessCertificateRoot cannot be used with keyConfigs in imageProfile")
+	}
+	return errors.Wrap(p.KeylessIdentities.Validate(), "invalid keylessIdentities in imageProfile")
+}
@@ -0,0 +1,75 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+)
+
+func TestKeylessIdentity(t *testing.T) {
+	identities := KeylessIdentityList{
+		{Issuer: "https://accounts.google.com", Subject: "signer@example.com"},
+		{Issuer: "https://token.actions.githubusercontent.com", SubjectRegExp: `https://github\.com/sample-org/[^/]+/\.github/workflows/.*`},
+	}
+	if err := identities.Validate(); err != nil {
+		t.Errorf("identities should be valid: %s", err.Error())
+		return
+	}
+
+	result := identities.Match("https://accounts.google.com", []string{"signer@example.com"})
+	if result == nil || result.Subject != "signer@example.com" {
+		t.Errorf("email identity should match: %v", result)
+		return
+	}
+	if identities.Match("https://github.com/login/oauth", []string{"signer@example.com"}) != nil {
+		t.Errorf("identity from another issuer should not match")
+		return
+	}
+	workflow := "https://github.com/sample-org/sample-repo/.github/workflows/release.yaml@refs/heads/main"
+	if identities.Match("https://token.actions.githubusercontent.com", []string{workflow}) == nil {
+		t.Errorf("workflow identity should match the regular expression")
+		return
+	}
+	if identities.Match("https://token.actions.githubusercontent.com", []string{"https://github.com/evil-org/x?https://github.com/sample-org/r/.github/workflows/a"}) != nil {
+		t.Errorf("regular expression should match the whole subject")
+		return
+	}
+
+	invalid := []KeylessIdentityList{
+		{{Subject: "signer@example.com"}},
+		{{Issuer: "https://accounts.google.com"}},
+		{{Issuer: "https://accounts.google.com", Subject: "signer@example.com", SubjectRegExp: ".*"}},
+		{{Issuer: "https://accounts.google.com", SubjectRegExp: "("}},
+	}
+	for i, l := range invalid {
+		if err := l.Validate(); err == nil {
+			t.Errorf("invalid identities [%d] should be rejected", i)
+			return
+		}
+	}
+
+	rule := &ManifestVerifyRule{KeylessIdentities: identities, KeyConfigs: []KeyConfig{{}}}
+	if err := rule.ValidateKeyless(); err == nil {
+		t.Errorf("keyless identities with keys should be rejected")
+		return
+	}
+	profile := ImageProfile{KeylessIdentities: identities}
+	if err := profile.Validate(); err != nil {
+		t.Errorf("image profile should be valid: %s", err.Error())
+		return
+	}
+}
@@ -0,0 +1,56 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reference schemes of KMS providers
+var KMSRefSchemes = []string{"hashivault://", "awskms://", "gcpkms://", "azurekms://"}
+
+// KMSKey refers to a public key in HashiCorp Vault or a cloud KMS.
+// Credentials of the provider, e.g. VAULT_ADDR and VAULT_TOKEN, are read from the Secret.
+type KMSKey struct {
+	Ref               string     `json:"ref"`
+	CredentialsSecret *KeySecret `json:"credentialsSecret,omitempty"`
+}
+
+// ValidateKMS returns an error if the KMS reference is not supported or is set with another key
+func (k KeyConfig) ValidateKMS() error {
+	if k.KMS == nil {
+		return nil
+	}
+	if k.Key.PEM != "" || k.Secret.Name != "" || k.X509 != nil || k.PGPKeyring != nil {
+		return fmt.Errorf("kms cannot be set with key, keySecret, x509 or pgpKeyring in the %s", k.Description())
+	}
+	supported := false
+	for _, scheme := range KMSRefSchemes {
+		if strings.HasPrefix(k.KMS.Ref, scheme) && len(k.KMS.Ref) > len(scheme) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("kms ref must start with one of %s; %s", strings.Join(KMSRefSchemes, ", "), k.KMS.Ref)
+	}
+	if s := k.KMS.CredentialsSecret; s != nil && (s.Name == "" || s.Namespace == "") {
+		return fmt.Errorf("name and namespace of credentialsSecret must be set in the %s", k.Description())
+	}
+	return nil
+}
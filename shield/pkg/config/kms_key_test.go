@@ -0,0 +1,53 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+)
+
+func TestKMSKeyConfig(t *testing.T) {
+	valid := []KeyConfig{
+		{KMS: &KMSKey{Ref: "hashivault://sample-key", CredentialsSecret: &KeySecret{Name: "vault-credentials", Namespace: "sample-ns"}}},
+		{KMS: &KMSKey{Ref: "awskms:///arn:aws:kms:us-east-1:111122223333:alias/sample-key"}},
+		{KMS: &KMSKey{Ref: "gcpkms://projects/sample/locations/global/keyRings/sample/cryptoKeys/sample-key"}},
+		{KMS: &KMSKey{Ref: "azurekms://sample-vault.vault.azure.net/sample-key"}},
+	}
+	for i, k := range valid {
+		if err := k.ValidateKMS(); err != nil {
+			t.Errorf("KMS key config [%d] should be valid: %s", i, err.Error())
+			return
+		}
+	}
+	if ref := valid[0].ConvertToCosignKeyRef(); ref != "hashivault://sample-key" {
+		t.Errorf("cosign key ref should be the KMS ref: %s", ref)
+		return
+	}
+
+	invalid := []KeyConfig{
+		{KMS: &KMSKey{Ref: "k8s://sample-ns/sample-key"}},
+		{KMS: &KMSKey{Ref: "hashivault://"}},
+		{KMS: &KMSKey{Ref: "hashivault://sample-key"}, Secret: KeySecret{Name: "sample-key", Namespace: "sample-ns"}},
+		{KMS: &KMSKey{Ref: "hashivault://sample-key", CredentialsSecret: &KeySecret{Name: "vault-credentials"}}},
+	}
+	for i, k := range invalid {
+		if err := k.ValidateKMS(); err == nil {
+			t.Errorf("invalid KMS key config [%d] should be rejected", i)
+			return
+		}
+	}
+}
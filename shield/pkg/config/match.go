@@ -0,0 +1,202 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"github.com/jinzhu/copier"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Scope in MatchCondition
+const (
+	MatchScopeAll        = "*"
+	MatchScopeCluster    = "Cluster"
+	MatchScopeNamespaced = "Namespaced"
+)
+
+// MatchCondition defines which resources are protected by a profile.
+// The same semantics are used by the admission controller and the observer.
+type MatchCondition struct {
+	Kinds              []Kinds               `json:"kinds,omitempty"`
+	ExcludedKinds      []Kinds               `json:"excludedKinds,omitempty"`
+	Scope              string                `json:"scope,omitempty"`
+	Names              []string              `json:"names,omitempty"`
+	Namespaces         []string              `json:"namespaces,omitempty"`
+	ExcludedNamespaces []string              `json:"excludedNamespaces,omitempty"`
+	LabelSelector      *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	AnnotationSelector *metav1.LabelSelector `json:"annotationSelector,omitempty"`
+	NamespaceSelector  *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+type Kinds struct {
+	Kinds     []string `json:"kinds,omitempty"`
+	ApiGroups []string `json:"apiGroups,omitempty"`
+}
+
+// MatchTarget is an object to be checked with MatchCondition
+type MatchTarget struct {
+	ApiGroup    string
+	Kind        string
+	Name        string
+	Namespace   string
+	Namespaced  bool
+	Labels      map[string]string
+	Annotations map[string]string
+	// labels of the namespace which the object belongs to
+	NamespaceLabels map[string]string
+}
+
+func (m *MatchCondition) DeepCopyInto(m2 *MatchCondition) {
+	_ = copier.Copy(&m2, &m)
+}
+
+// Match returns true if the target satisfies all conditions.
+// `namespaces` and `namespaceSelector` select namespaced objects only, so cluster-scoped objects do not match them.
+// A Namespace object is treated as an object in the namespace of its own name.
+// `excludedNamespaces` never excludes cluster-scoped objects.
+func (m *MatchCondition) Match(t MatchTarget) bool {
+	if !m.MatchKind(t.ApiGroup, t.Kind) {
+		return false
+	}
+	if !m.MatchScope(t.Namespaced) {
+		return false
+	}
+	namespace := t.Namespace
+	namespaceLabels := t.NamespaceLabels
+	if IsNamespaceKind(t.ApiGroup, t.Kind) {
+		namespace = t.Name
+		namespaceLabels = t.Labels
+	}
+	if namespace == "" {
+		if m.HasNamespaceCondition() {
+			return false
+		}
+	} else {
+		if !m.MatchNamespaceName(namespace) {
+			return false
+		}
+		if !m.MatchNamespaceLabels(namespaceLabels) {
+			return false
+		}
+	}
+	return m.MatchName(t.Name) && m.MatchLabels(t.Labels) && m.MatchAnnotations(t.Annotations)
+}
+
+// MatchKind checks `kinds` and `excludedKinds`
+func (m *MatchCondition) MatchKind(apiGroup, kind string) bool {
+	if len(m.Kinds) != 0 && !matchKinds(m.Kinds, apiGroup, kind) {
+		return false
+	}
+	if len(m.ExcludedKinds) != 0 && matchKinds(m.ExcludedKinds, apiGroup, kind) {
+		return false
+	}
+	return true
+}
+
+// MatchScope checks `scope`; empty scope is the same as "*"
+func (m *MatchCondition) MatchScope(namespaced bool) bool {
+	switch m.Scope {
+	case "", MatchScopeAll:
+		return true
+	case MatchScopeCluster:
+		return !namespaced
+	case MatchScopeNamespaced:
+		return namespaced
+	default:
+		log.Warnf("unknown scope `%s` in match condition", m.Scope)
+		return false
+	}
+}
+
+// HasNamespaceCondition returns true if target namespaces are limited by `namespaces` or `namespaceSelector`
+func (m *MatchCondition) HasNamespaceCondition() bool {
+	return len(m.Namespaces) != 0 || m.NamespaceSelector != nil
+}
+
+// MatchNamespaceName checks `namespaces` and `excludedNamespaces`
+func (m *MatchCondition) MatchNamespaceName(namespace string) bool {
+	if len(m.Namespaces) != 0 && !k8smnfutil.MatchWithPatternArray(namespace, m.Namespaces) {
+		return false
+	}
+	if len(m.ExcludedNamespaces) != 0 && k8smnfutil.MatchWithPatternArray(namespace, m.ExcludedNamespaces) {
+		return false
+	}
+	return true
+}
+
+// MatchNamespaceLabels checks `namespaceSelector`
+func (m *MatchCondition) MatchNamespaceLabels(namespaceLabels map[string]string) bool {
+	return matchSelector(m.NamespaceSelector, namespaceLabels)
+}
+
+// MatchName checks `names`
+func (m *MatchCondition) MatchName(name string) bool {
+	if len(m.Names) == 0 {
+		return true
+	}
+	return k8smnfutil.MatchWithPatternArray(name, m.Names)
+}
+
+// MatchLabels checks `labelSelector`
+func (m *MatchCondition) MatchLabels(objLabels map[string]string) bool {
+	return matchSelector(m.LabelSelector, objLabels)
+}
+
+// MatchAnnotations checks `annotationSelector`
+func (m *MatchCondition) MatchAnnotations(annotations map[string]string) bool {
+	return matchSelector(m.AnnotationSelector, annotations)
+}
+
+func IsNamespaceKind(apiGroup, kind string) bool {
+	return apiGroup == "" && kind == "Namespace"
+}
+
+func matchKinds(kindsList []Kinds, apiGroup, kind string) bool {
+	for _, kinds := range kindsList {
+		kindMatched := len(kinds.Kinds) == 0 || k8smnfutil.MatchWithPatternArray(kind, kinds.Kinds)
+		groupMatched := len(kinds.ApiGroups) == 0 || matchApiGroup(apiGroup, kinds.ApiGroups)
+		if kindMatched && groupMatched {
+			return true
+		}
+	}
+	return false
+}
+
+// an empty string in apiGroups means the core group, not a wildcard
+func matchApiGroup(apiGroup string, apiGroups []string) bool {
+	for _, g := range apiGroups {
+		if g == apiGroup || (g != "" && k8smnfutil.MatchPattern(g, apiGroup)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSelector(labelSelector *metav1.LabelSelector, labelsMap map[string]string) bool {
+	if labelSelector == nil {
+		return true
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		log.Errorf("failed to convert the LabelSelector api type into a struct that implements labels.Selector; %s", err.Error())
+		return false
+	}
+	return selector.Matches(labels.Set(labelsMap))
+}
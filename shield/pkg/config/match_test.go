@@ -0,0 +1,106 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatchCondition(t *testing.T) {
+	match := MatchCondition{
+		Kinds: []Kinds{
+			{ApiGroups: []string{""}, Kinds: []string{"ConfigMap", "Namespace"}},
+			{ApiGroups: []string{"apps"}},
+		},
+		ExcludedKinds: []Kinds{
+			{ApiGroups: []string{"apps"}, Kinds: []string{"ReplicaSet"}},
+		},
+		Names:              []string{"sample-*"},
+		Namespaces:         []string{"sample-*"},
+		ExcludedNamespaces: []string{"sample-excluded"},
+		AnnotationSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "skip-verification", Operator: metav1.LabelSelectorOpDoesNotExist},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name   string
+		target MatchTarget
+		want   bool
+	}{
+		{
+			name:   "configmap in target namespace",
+			target: MatchTarget{Kind: "ConfigMap", Name: "sample-cm", Namespace: "sample-ns", Namespaced: true},
+			want:   true,
+		},
+		{
+			name:   "kind in other group with the same name",
+			target: MatchTarget{ApiGroup: "other.io", Kind: "ConfigMap", Name: "sample-cm", Namespace: "sample-ns", Namespaced: true},
+			want:   false,
+		},
+		{
+			name:   "excluded kind",
+			target: MatchTarget{ApiGroup: "apps", Kind: "ReplicaSet", Name: "sample-rs", Namespace: "sample-ns", Namespaced: true},
+			want:   false,
+		},
+		{
+			name:   "name not matched",
+			target: MatchTarget{ApiGroup: "apps", Kind: "Deployment", Name: "other-deploy", Namespace: "sample-ns", Namespaced: true},
+			want:   false,
+		},
+		{
+			name:   "excluded namespace",
+			target: MatchTarget{Kind: "ConfigMap", Name: "sample-cm", Namespace: "sample-excluded", Namespaced: true},
+			want:   false,
+		},
+		{
+			name:   "annotation selector not matched",
+			target: MatchTarget{Kind: "ConfigMap", Name: "sample-cm", Namespace: "sample-ns", Namespaced: true, Annotations: map[string]string{"skip-verification": "true"}},
+			want:   false,
+		},
+		{
+			name:   "namespace object is checked with its own name",
+			target: MatchTarget{Kind: "Namespace", Name: "sample-ns"},
+			want:   true,
+		},
+		{
+			name:   "cluster scoped object does not match namespaces",
+			target: MatchTarget{ApiGroup: "apps", Kind: "Deployment", Name: "sample-deploy"},
+			want:   false,
+		},
+	}
+	for _, tc := range testCases {
+		got := match.Match(tc.target)
+		if got != tc.want {
+			t.Errorf("%s: got: %v\nwant: %v", tc.name, got, tc.want)
+		}
+	}
+
+	scopeMatch := MatchCondition{Scope: MatchScopeCluster}
+	if scopeMatch.Match(MatchTarget{Kind: "ConfigMap", Name: "sample-cm", Namespace: "sample-ns", Namespaced: true}) {
+		t.Errorf("namespaced object should not match `Cluster` scope")
+		return
+	}
+	if !scopeMatch.Match(MatchTarget{ApiGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "sample-role"}) {
+		t.Errorf("cluster scoped object should match `Cluster` scope")
+		return
+	}
+}
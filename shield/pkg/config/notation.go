@@ -0,0 +1,42 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// NotationVerifier verifies Notation (Notary v2) signatures of images, which are stored as OCI referrers of the images.
+// The Secret has the trust policy in `trustpolicy.json` and the certificates of the trust stores,
+// e.g. `ca.acme-rockets.pem` for the trust store `ca:acme-rockets`.
+type NotationVerifier struct {
+	TrustPolicySecret KeySecret `json:"trustPolicySecret"`
+}
+
+// ValidateNotation returns an error if the Notation verifier is set with cosign keys or keyless identities
+func (p ImageProfile) ValidateNotation() error {
+	if p.Notation == nil {
+		return nil
+	}
+	if len(p.KeyConfigs) > 0 || len(p.KeylessIdentities) > 0 || p.KeylessCertificateRoot != "" {
+		return errors.New("notation cannot be used with keyConfigs, keylessIdentities or keylessCertificateRoot in imageProfile")
+	}
+	if s := p.Notation.TrustPolicySecret; s.Name == "" || s.Namespace == "" {
+		return errors.New("name and namespace of trustPolicySecret must be set in notation of imageProfile")
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+)
+
+func TestNotationImageProfile(t *testing.T) {
+	notation := &NotationVerifier{TrustPolicySecret: KeySecret{Name: "notation-trust-policy", Namespace: "integrity-shield-operator-system"}}
+	profile := ImageProfile{Notation: notation}
+	if err := profile.Validate(); err != nil {
+		t.Errorf("image profile with notation should be valid: %s", err.Error())
+		return
+	}
+	if err := profile.CheckOffline(); err != nil {
+		t.Errorf("notation signatures should be verified offline: %s", err.Error())
+		return
+	}
+
+	invalidProfiles := []ImageProfile{
+		{Notation: &NotationVerifier{TrustPolicySecret: KeySecret{Name: "notation-trust-policy"}}},
+		{Notation: notation, KeyConfigs: []KeyConfig{{Secret: KeySecret{Name: "signer-pubkey", Namespace: "sample-ns"}}}},
+		{Notation: notation, KeylessIdentities: KeylessIdentityList{{Issuer: "https://token.actions.githubusercontent.com", Subject: "https://github.com/sample-org/*"}}},
+	}
+	for i, p := range invalidProfiles {
+		if err := p.Validate(); err == nil {
+			t.Errorf("invalid image profile [%d] should be rejected", i)
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stolostron/integrity-shield/shield/pkg/tlog"
+)
+
+const (
+	OfflineModeEnvKey = "ISHIELD_OFFLINE_MODE"
+	// trust material which is mounted from a secret in offline mode.
+	// cosign reads these files instead of the targets in the TUF repository.
+	FulcioRootFileEnvKey     = "SIGSTORE_ROOT_FILE"
+	RekorPublicKeyFileEnvKey = tlog.RekorPublicKeyFileEnvKey
+	CTLogPublicKeyFileEnvKey = "SIGSTORE_CT_LOG_PUBLIC_KEY_FILE"
+)
+
+// IsOfflineMode returns true if Integrity Shield must not access the network for verification material
+func IsOfflineMode() bool {
+	offline, _ := strconv.ParseBool(os.Getenv(OfflineModeEnvKey))
+	return offline
+}
+
+// CheckOfflineTrustMaterial returns an error if trust material for offline mode is missing
+func CheckOfflineTrustMaterial() error {
+	missing := []string{}
+	for _, key := range []string{FulcioRootFileEnvKey, RekorPublicKeyFileEnvKey, CTLogPublicKeyFileEnvKey} {
+		path := os.Getenv(key)
+		if path == "" {
+			missing = append(missing, key)
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("trust material for offline mode is not found: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// IsKeyless returns true if some signatures are verified without keys, i.e. with certificates issued by Fulcio
+func (p *ManifestVerifyRule) IsKeyless() bool {
+	if len(p.KeyConfigs) > 0 {
+		return false
+	}
+	if p.SignatureThreshold == nil {
+		return true
+	}
+	for _, s := range p.SignatureThreshold.Signers {
+		if len(s.KeyConfigs) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOffline returns an error if the rule needs material which is available only online
+func (p *ManifestVerifyRule) CheckOffline() error {
+	if p.ProvenancePolicy != nil && p.SignatureRef.ProvenanceResourceRef.Name == "" {
+		return errors.New("provenance is searched in the transparency log, which is not available in offline mode; set signatureRef.provenanceResourceRef")
+	}
+	if !p.IsKeyless() {
+		return nil
+	}
+	if p.SignatureRef.ImageRef != "" {
+		return errors.New("keyless signatures in an image are checked with the transparency log, which is not available in offline mode; use keyConfigs")
+	}
+	if os.Getenv(FulcioRootFileEnvKey) == "" && p.KeylessCertificateRoot == "" {
+		return errors.New("keyless signatures need Fulcio roots in the trust material in offline mode")
+	}
+	return nil
+}
+
+// CheckOffline returns an error if the profile needs material which is available only online
+func (p ImageProfile) CheckOffline() error {
+	for i, policy := range p.Policies {
+		if policy.GetMode() == ImagePolicyModeSkip {
+			continue
+		}
+		if err := policy.Profile().CheckOffline(); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("imageProfile.policies[%d]", i))
+		}
+	}
+	if len(p.Policies) > 0 {
+		return nil
+	}
+	// notation signatures are verified with the trust stores in the trust policy secret
+	if len(p.KeyConfigs) == 0 && p.Notation == nil {
+		return errors.New("keyless image signatures are checked with the transparency log, which is not available in offline mode; use keyConfigs")
+	}
+	return nil
+}
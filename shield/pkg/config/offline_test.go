@@ -0,0 +1,70 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOffline(t *testing.T) {
+	origFulcioRoot, fulcioRootFound := os.LookupEnv(FulcioRootFileEnvKey)
+	defer func() {
+		if fulcioRootFound {
+			os.Setenv(FulcioRootFileEnvKey, origFulcioRoot)
+		} else {
+			os.Unsetenv(FulcioRootFileEnvKey)
+		}
+	}()
+	os.Setenv(FulcioRootFileEnvKey, "/ishield-app/trust-material/fulcio.crt.pem")
+
+	keyed := KeyConfig{Key: Key{Name: "sample-key"}}
+	cases := []struct {
+		name    string
+		rule    ManifestVerifyRule
+		offline bool
+	}{
+		{"keyed rule", ManifestVerifyRule{KeyConfigs: []KeyConfig{keyed}}, true},
+		{"keyless rule with Fulcio roots", ManifestVerifyRule{}, true},
+		{"keyless rule with a signature in an image", ManifestVerifyRule{SignatureRef: SignatureRef{ImageRef: "sample-registry/sample-manifest:0.1.0"}}, false},
+		{"provenance policy without a provenance configmap", ManifestVerifyRule{KeyConfigs: []KeyConfig{keyed}, ProvenancePolicy: &ProvenancePolicy{BuildType: "sample-build"}}, false},
+		{"threshold signer without keys", ManifestVerifyRule{SignatureThreshold: &SignatureThreshold{MinSigners: 1, Signers: []ThresholdSigner{
+			{Name: "keyed", KeyConfigs: []KeyConfig{keyed}},
+			{Name: "keyless", Identity: "signer@example.com"},
+		}}, SignatureRef: SignatureRef{ImageRef: "sample-registry/sample-manifest:0.1.0"}}, false},
+	}
+	for _, c := range cases {
+		err := c.rule.CheckOffline()
+		if c.offline && err != nil {
+			t.Errorf("%s should be verified offline: %s", c.name, err.Error())
+			return
+		} else if !c.offline && err == nil {
+			t.Errorf("%s should not be verified offline", c.name)
+			return
+		}
+	}
+
+	os.Unsetenv(FulcioRootFileEnvKey)
+	if err := (&ManifestVerifyRule{}).CheckOffline(); err == nil {
+		t.Errorf("keyless rule should not be verified offline without Fulcio roots")
+		return
+	}
+	if err := (ImageProfile{}).CheckOffline(); err == nil {
+		t.Errorf("keyless image profile should not be verified offline")
+		return
+	}
+}
@@ -17,30 +17,26 @@
 package config
 
 import (
-	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/jinzhu/copier"
 	"github.com/pkg/errors"
 	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
 	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
-	kubeutil "github.com/stolostron/integrity-shield/shield/pkg/kubernetes"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	kubeclient "k8s.io/client-go/kubernetes"
 )
 
 // Parameter in constraint
 type ParameterObject struct {
-	ConstraintName     string `json:"constraintName"`
-	ManifestVerifyRule `json:""`
-	ImageProfile       ImageProfile `json:"imageProfile,omitempty"`
-	Action             *Action      `json:"action,omitempty"`
-	GetProvenance      bool         `json:"getProvenance,omitempty"`
+	ConstraintName      string `json:"constraintName"`
+	ManifestVerifyRule  `json:""`
+	ImageProfile        ImageProfile          `json:"imageProfile,omitempty"`
+	Action              *Action               `json:"action,omitempty"`
+	GetProvenance       bool                  `json:"getProvenance,omitempty"`
+	SubresourcePolicies SubresourcePolicyList `json:"subresourcePolicies,omitempty"`
 }
 
 type ManifestVerifyRule struct {
@@ -49,6 +45,16 @@ type ManifestVerifyRule struct {
 	InScopeObjects                   k8smanifest.ObjectReferenceList `json:"objectSelector,omitempty"`
 	SkipUsers                        ObjectUserBindingList           `json:"skipUsers,omitempty"`
 	InScopeUsers                     ObjectUserBindingList           `json:"inScopeUsers,omitempty"`
+	Expressions                      *ExpressionRules                `json:"expressions,omitempty"`
+	SignatureThreshold               *SignatureThreshold             `json:"signatureThreshold,omitempty"`
+	SignerBindings                   []SignerBinding                 `json:"signerBindings,omitempty"`
+	ProvenancePolicy                 *ProvenancePolicy               `json:"provenancePolicy,omitempty"`
+	MaxSignatureAge                  *metav1.Duration                `json:"maxSignatureAge,omitempty"`
+	SignatureAgeGracePeriod          *metav1.Duration                `json:"signatureAgeGracePeriod,omitempty"`
+	RequireTlogEntry                 bool                            `json:"requireTlogEntry,omitempty"`
+	KeylessIdentities                KeylessIdentityList             `json:"keylessIdentities,omitempty"`
+	KeylessCertificateRoot           string                          `json:"keylessCertificateRoot,omitempty"` // PEM encoded root certificates instead of Fulcio roots
+	TimestampAuthority               *TimestampAuthority             `json:"timestampAuthority,omitempty"`
 	k8smanifest.VerifyResourceOption `json:""`
 }
 
@@ -58,6 +64,32 @@ type Action struct {
 	AdmissionOnly bool   `json:"admissionOnly,omitempty"`
 }
 
+// actions for subresource requests
+const (
+	SubresourceActionAllow         = "allow"
+	SubresourceActionVerify        = "verify"
+	SubresourceActionBoundedChange = "boundedChange"
+)
+
+// SubresourcePolicy defines how a request for subresources such as `scale` or `status` is processed.
+// Requests for subresources which do not match any policy are verified in the same way as the main resource.
+type SubresourcePolicy struct {
+	Subresources []string `json:"subresources,omitempty"`
+	// allow, verify or boundedChange (only for `scale`)
+	Action   string         `json:"action,omitempty"`
+	Replicas *ReplicaBounds `json:"replicas,omitempty"`
+}
+
+type SubresourcePolicyList []SubresourcePolicy
+
+// ReplicaBounds is used by boundedChange action to check replica counts on `scale` requests.
+type ReplicaBounds struct {
+	Min *int32 `json:"min,omitempty"`
+	Max *int32 `json:"max,omitempty"`
+	// max difference between the current replicas and the requested replicas
+	MaxChange *int32 `json:"maxChange,omitempty"`
+}
+
 type SignatureRef struct {
 	ImageRef              string      `json:"imageRef,omitempty"`
 	SignatureResourceRef  ResourceRef `json:"signatureResourceRef,omitempty"`
@@ -72,6 +104,22 @@ type ResourceRef struct {
 type KeyConfig struct {
 	Key    Key       `json:"key,omitempty"`       // PEM encoded public key
 	Secret KeySecret `json:"keySecret,omitempty"` // public key as a Kubernetes Secret
+	// validity window of signatures made with this key
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+	NotAfter  *metav1.Time `json:"notAfter,omitempty"`
+	// a retiring key is accepted only if the signed time is known and within the validity window
+	Retiring bool `json:"retiring,omitempty"`
+	// signing certificates issued by a CA bundle instead of a public key
+	X509 *X509KeyConfig `json:"x509,omitempty"`
+	// armored or binary PGP public keys in a Secret or a ConfigMap
+	PGPKeyring *DataRef `json:"pgpKeyring,omitempty"`
+	// public key in HashiCorp Vault or a cloud KMS
+	KMS *KMSKey `json:"kms,omitempty"`
+	// cluster-scoped VerificationKeys referred by name or by a label selector
+	VerificationKey         string                `json:"verificationKey,omitempty"`
+	VerificationKeySelector *metav1.LabelSelector `json:"verificationKeySelector,omitempty"`
+	// the name of the VerificationKey which this key is resolved from
+	VerificationKeyName string `json:"-"`
 }
 
 type Key struct {
@@ -82,7 +130,7 @@ type Key struct {
 type KeySecret struct {
 	Name      string `json:"name,omitempty"`
 	Namespace string `json:"namespace,omitempty"`
-	Mount     bool   `json:"mount,omitempty"` // if true, save secret data as a file.
+	Mount     bool   `json:"mount,omitempty"` // deprecated: keys in secrets are always loaded into memory by the key store
 }
 
 type ImageRef string
@@ -106,15 +154,24 @@ func (r ImageRef) Match(imageRef string) bool {
 
 type ObjectUserBindingList []ObjectUserBinding
 
+// ObjectUserBinding matches a request if the object matches `objects` and the requester matches any of `users`, `groups` and `serviceAccountNamespaces`.
 type ObjectUserBinding struct {
-	Objects k8smanifest.ObjectReferenceList `json:"objects,omitempty"`
-	Users   []string                        `json:"users,omitempty"`
+	Objects                  k8smanifest.ObjectReferenceList `json:"objects,omitempty"`
+	Users                    []string                        `json:"users,omitempty"`
+	Groups                   []string                        `json:"groups,omitempty"`
+	ServiceAccountNamespaces []string                        `json:"serviceAccountNamespaces,omitempty"`
 }
 
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
 type ImageProfile struct {
-	KeyConfigs []KeyConfig  `json:"keyConfigs,omitempty"`
-	Match      ImageRefList `json:"match,omitempty"`
-	Exclude    ImageRefList `json:"exclude,omitempty"`
+	KeyConfigs             []KeyConfig         `json:"keyConfigs,omitempty"`
+	KeylessIdentities      KeylessIdentityList `json:"keylessIdentities,omitempty"`
+	KeylessCertificateRoot string              `json:"keylessCertificateRoot,omitempty"` // PEM encoded root certificates instead of Fulcio roots
+	Notation               *NotationVerifier   `json:"notation,omitempty"`
+	Match                  ImageRefList        `json:"match,omitempty"`
+	Exclude                ImageRefList        `json:"exclude,omitempty"`
+	Policies               []ImagePolicy       `json:"policies,omitempty"` // each image is verified with the first matching policy
 }
 
 func (p *ParameterObject) DeepCopyInto(p2 *ParameterObject) {
@@ -126,8 +183,27 @@ func (p *ManifestVerifyRule) DeepCopyInto(p2 *ManifestVerifyRule) {
 }
 
 func (u ObjectUserBinding) Match(obj unstructured.Unstructured, username string) bool {
-	if u.Objects.Match(obj) {
-		if k8smnfutil.MatchWithPatternArray(username, u.Users) {
+	return u.MatchUserInfo(obj, authenticationv1.UserInfo{Username: username})
+}
+
+func (u ObjectUserBinding) MatchUserInfo(obj unstructured.Unstructured, userInfo authenticationv1.UserInfo) bool {
+	if !u.Objects.Match(obj) {
+		return false
+	}
+	return u.matchUser(userInfo)
+}
+
+func (u ObjectUserBinding) matchUser(userInfo authenticationv1.UserInfo) bool {
+	if k8smnfutil.MatchWithPatternArray(userInfo.Username, u.Users) {
+		return true
+	}
+	for _, group := range userInfo.Groups {
+		if k8smnfutil.MatchWithPatternArray(group, u.Groups) {
+			return true
+		}
+	}
+	if saNamespace, _, ok := parseServiceAccountUsername(userInfo.Username); ok {
+		if k8smnfutil.MatchWithPatternArray(saNamespace, u.ServiceAccountNamespaces) {
 			return true
 		}
 	}
@@ -135,20 +211,46 @@ func (u ObjectUserBinding) Match(obj unstructured.Unstructured, username string)
 }
 
 func (l ObjectUserBindingList) Match(obj unstructured.Unstructured, username string) bool {
+	return l.MatchUserInfo(obj, authenticationv1.UserInfo{Username: username})
+}
+
+func (l ObjectUserBindingList) MatchUserInfo(obj unstructured.Unstructured, userInfo authenticationv1.UserInfo) bool {
 	if len(l) == 0 {
 		return false
 	}
 	for _, u := range l {
-		if u.Match(obj, username) {
+		if u.MatchUserInfo(obj, userInfo) {
 			return true
 		}
 	}
 	return false
 }
 
+// returns the namespace and the name of a service account username `system:serviceaccount:<namespace>:<name>`
+func parseServiceAccountUsername(username string) (string, string, bool) {
+	if !strings.HasPrefix(username, serviceAccountUsernamePrefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(username, serviceAccountUsernamePrefix), ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// returns the first policy which matches the subresource, or nil if none matches
+func (l SubresourcePolicyList) Find(subresource string) *SubresourcePolicy {
+	for i := range l {
+		if k8smnfutil.MatchWithPatternArray(subresource, l[i].Subresources) {
+			return &l[i]
+		}
+	}
+	return nil
+}
+
 // if any profile condition is defined, image profile returns enabled = true
 func (p ImageProfile) Enabled() bool {
-	return len(p.Match) > 0 || len(p.Exclude) > 0
+	return len(p.Match) > 0 || len(p.Exclude) > 0 || len(p.Policies) > 0
 }
 
 // returns if this profile matches the specified image ref or not
@@ -162,61 +264,45 @@ func (p ImageProfile) MatchWith(imageRef string) bool {
 }
 
 // validate ManifestVerifyRule
+// ValidateManifestVerifyRule returns an error if the rule cannot be used for verification
 func ValidateManifestVerifyRule(p *ManifestVerifyRule) error {
-	// TODO: fix
-	return nil
-}
-
-func (k KeyConfig) LoadKeySecret() (string, error) {
-	kubeconf, _ := kubeutil.GetKubeConfig()
-	clientset, err := kubeclient.NewForConfig(kubeconf)
-	if err != nil {
-		return "", err
+	if p == nil {
+		return nil
 	}
-	secret, err := clientset.CoreV1().Secrets(k.Secret.Namespace).Get(context.Background(), k.Secret.Name, metav1.GetOptions{})
+	_, err := CompileExpressionRules(p.Expressions)
 	if err != nil {
-		return "", errors.Wrap(err, fmt.Sprintf("failed to get a secret `%s` in `%s` namespace", k.Secret.Namespace, k.Secret.Name))
-	}
-	keyDir := fmt.Sprintf("/tmp/%s/%s/", k.Secret.Namespace, k.Secret.Name)
-	sumErr := []string{}
-	keyPath := ""
-	for fname, keyData := range secret.Data {
-		err := os.MkdirAll(keyDir, os.ModePerm)
-		if err != nil {
-			sumErr = append(sumErr, err.Error())
-			continue
-		}
-		fpath := filepath.Join(keyDir, fname)
-		err = ioutil.WriteFile(fpath, keyData, 0644)
-		if err != nil {
-			sumErr = append(sumErr, err.Error())
-			continue
+		return errors.Wrap(err, "failed to compile expressions")
+	}
+	for _, k := range p.KeyConfigs {
+		if err := k.validateKey(); err != nil {
+			return err
 		}
-		keyPath = fpath
-		break
 	}
-	if keyPath == "" && len(sumErr) > 0 {
-		return "", errors.New(fmt.Sprintf("failed to save secret data as a file; %s", strings.Join(sumErr, "; ")))
+	if err := p.SignatureThreshold.Validate(); err != nil {
+		return errors.Wrap(err, "invalid signatureThreshold")
 	}
-	if keyPath == "" {
-		return "", errors.New(fmt.Sprintf("no key files are found in the secret `%s` in `%s` namespace", k.Secret.Namespace, k.Secret.Name))
+	if err := ValidateSignerBindings(p.SignerBindings); err != nil {
+		return errors.Wrap(err, "invalid signerBindings")
 	}
-
-	return keyPath, nil
+	if err := p.ProvenancePolicy.Validate(); err != nil {
+		return errors.Wrap(err, "invalid provenancePolicy")
+	}
+	if err := p.ValidateSignatureAge(); err != nil {
+		return err
+	}
+	if err := p.ValidateKeyless(); err != nil {
+		return err
+	}
+	if err := p.TimestampAuthority.Validate(); err != nil {
+		return errors.Wrap(err, "invalid timestampAuthority")
+	}
+	return nil
 }
 
 func (k KeyConfig) ConvertToCosignKeyRef() string {
+	if k.KMS != nil {
+		return k.KMS.Ref
+	}
 	ref := fmt.Sprintf("k8s://%s/%s", k.Secret.Namespace, k.Secret.Name)
 	return ref
 }
-
-func (k KeyConfig) ConvertToLocalFilePath(dir string) (string, error) {
-	key := fmt.Sprintf("%s-key.pub", k.Key.Name)
-	fpath := filepath.Join(dir, key)
-	err := ioutil.WriteFile(fpath, []byte(k.Key.PEM), 0644)
-	if err != nil {
-		return "", errors.New(fmt.Sprintf("failed to save PEM public key as a file; %s; %s", fpath, err))
-	}
-
-	return fpath, nil
-}
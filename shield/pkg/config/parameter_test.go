@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -120,3 +121,52 @@ func TestManifestIntegrityConstraint(t *testing.T) {
 	}
 
 }
+
+func TestObjectUserBindingWithUserInfo(t *testing.T) {
+	var resource unstructured.Unstructured
+	resource.SetKind("ConfigMap")
+	resource.SetName("sample-cm")
+	resource.SetNamespace("sample-ns")
+
+	skipUsers := ObjectUserBindingList{
+		{
+			Groups: []string{"sample-group"},
+		},
+		{
+			ServiceAccountNamespaces: []string{"kube-system"},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		userInfo authenticationv1.UserInfo
+		want     bool
+	}{
+		{
+			name:     "group matched",
+			userInfo: authenticationv1.UserInfo{Username: "sample-user", Groups: []string{"system:authenticated", "sample-group"}},
+			want:     true,
+		},
+		{
+			name:     "no condition matched",
+			userInfo: authenticationv1.UserInfo{Username: "sample-user", Groups: []string{"system:authenticated"}},
+			want:     false,
+		},
+		{
+			name:     "service account in matched namespace",
+			userInfo: authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:sample-controller"},
+			want:     true,
+		},
+		{
+			name:     "service account in other namespace",
+			userInfo: authenticationv1.UserInfo{Username: "system:serviceaccount:sample-ns:sample-controller"},
+			want:     false,
+		},
+	}
+	for _, tc := range testCases {
+		got := skipUsers.MatchUserInfo(resource, tc.userInfo)
+		if got != tc.want {
+			t.Errorf("%s: got: %v\nwant: %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// PGPSignerResult is the PGP key which made the signature
+type PGPSignerResult struct {
+	Fingerprint string `json:"fingerprint"`
+	UID         string `json:"uid"`
+}
+
+// ValidatePGP returns an error if the PGP keyring is invalid or is set with another key
+func (k KeyConfig) ValidatePGP() error {
+	if k.PGPKeyring == nil {
+		return nil
+	}
+	if k.Key.PEM != "" || k.Secret.Name != "" || k.X509 != nil {
+		return fmt.Errorf("pgpKeyring cannot be set with key, keySecret or x509 in the %s", k.Description())
+	}
+	return errors.Wrap(k.PGPKeyring.validate(), "invalid pgpKeyring")
+}
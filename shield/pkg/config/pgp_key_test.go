@@ -0,0 +1,46 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+)
+
+func TestPGPKeyConfig(t *testing.T) {
+	keyring := &DataRef{Name: "sample-keyring", Namespace: "sample-ns"}
+	k := KeyConfig{PGPKeyring: keyring}
+	if err := k.ValidatePGP(); err != nil {
+		t.Errorf("PGP keyring should be valid: %s", err.Error())
+		return
+	}
+
+	invalid := []KeyConfig{
+		{PGPKeyring: keyring, Secret: KeySecret{Name: "sample-key", Namespace: "sample-ns"}},
+		{PGPKeyring: keyring, X509: &X509KeyConfig{CABundle: *keyring}},
+		{PGPKeyring: &DataRef{Name: "sample-keyring"}},
+	}
+	for i, c := range invalid {
+		if err := c.ValidatePGP(); err == nil {
+			t.Errorf("invalid PGP key config [%d] should be rejected", i)
+			return
+		}
+	}
+	if err := (ImageProfile{KeyConfigs: []KeyConfig{k}}).Validate(); err == nil {
+		t.Errorf("PGP keyring in image profile should be rejected")
+		return
+	}
+}
@@ -0,0 +1,192 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProvenancePolicy defines requirements on the SLSA/in-toto provenance attached to the resource.
+// All attached provenances must satisfy the policy. Patterns can have a trailing wildcard.
+type ProvenancePolicy struct {
+	// the builder ID must match one of them
+	BuilderIDs []string `json:"builderIDs,omitempty"`
+	// the source repository must match one of them, e.g. `https://github.com/org/*`
+	SourceRepositories []string `json:"sourceRepositories,omitempty"`
+	BuildType          string   `json:"buildType,omitempty"`
+	// the build must be finished within this duration, e.g. `720h`
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// ProvenanceStatement is a part of an in-toto statement which is checked with ProvenancePolicy
+type ProvenanceStatement struct {
+	BuilderID        string     `json:"builderID"`
+	BuildType        string     `json:"buildType"`
+	SourceRepository string     `json:"sourceRepository"`
+	BuildTime        *time.Time `json:"buildTime"`
+}
+
+// Validate checks that the policy has at least one requirement
+func (p *ProvenancePolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if len(p.BuilderIDs) == 0 && len(p.SourceRepositories) == 0 && p.BuildType == "" && p.MaxAge == nil {
+		return errors.New("at least one of builderIDs, sourceRepositories, buildType and maxAge is required")
+	}
+	if p.MaxAge != nil && p.MaxAge.Duration <= 0 {
+		return fmt.Errorf("maxAge must be positive, but %s is specified", p.MaxAge.Duration.String())
+	}
+	return nil
+}
+
+// Check returns an error which shows all requirements the statement does not satisfy
+func (p *ProvenancePolicy) Check(s ProvenanceStatement, now time.Time) error {
+	if p == nil {
+		return nil
+	}
+	violations := []string{}
+	if len(p.BuilderIDs) > 0 && !k8smnfutil.MatchWithPatternArray(s.BuilderID, p.BuilderIDs) {
+		violations = append(violations, fmt.Sprintf("builder ID `%s` is not allowed", s.BuilderID))
+	}
+	if len(p.SourceRepositories) > 0 && (s.SourceRepository == "" || !k8smnfutil.MatchWithPatternArray(s.SourceRepository, p.SourceRepositories)) {
+		violations = append(violations, fmt.Sprintf("source repository `%s` is not allowed", s.SourceRepository))
+	}
+	if p.BuildType != "" && s.BuildType != p.BuildType {
+		violations = append(violations, fmt.Sprintf("build type `%s` is not `%s`", s.BuildType, p.BuildType))
+	}
+	if p.MaxAge != nil {
+		if s.BuildTime == nil {
+			violations = append(violations, "build time is unknown")
+		} else if now.Sub(*s.BuildTime) > p.MaxAge.Duration {
+			violations = append(violations, fmt.Sprintf("build at %s is older than %s", s.BuildTime.Format(time.RFC3339), p.MaxAge.Duration.String()))
+		}
+	}
+	if len(violations) > 0 {
+		return errors.New(strings.Join(violations, ", "))
+	}
+	return nil
+}
+
+// ParseProvenanceStatement reads an in-toto statement with a SLSA provenance v0.2 or v1 predicate.
+// Tekton Chains provenance, which has the builder ID in the invocation, is also supported.
+func ParseProvenanceStatement(rawAttestation string) (*ProvenanceStatement, error) {
+	var statement struct {
+		PredicateType string                 `json:"predicateType"`
+		Predicate     map[string]interface{} `json:"predicate"`
+	}
+	err := json.Unmarshal([]byte(rawAttestation), &statement)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the attestation")
+	}
+	if statement.Predicate == nil {
+		return nil, fmt.Errorf("no predicate in the attestation (predicateType: %s)", statement.PredicateType)
+	}
+	pred := statement.Predicate
+	s := &ProvenanceStatement{}
+	if _, found := pred["buildDefinition"]; found {
+		// SLSA provenance v1
+		s.BuildType = getProvenanceString(pred, "buildDefinition", "buildType")
+		s.BuilderID = getProvenanceString(pred, "runDetails", "builder", "id")
+		s.SourceRepository = getProvenanceFirstURI(pred, "buildDefinition", "resolvedDependencies")
+		s.BuildTime = getProvenanceTime(pred, "runDetails", "metadata", "finishedOn")
+		if s.BuildTime == nil {
+			s.BuildTime = getProvenanceTime(pred, "runDetails", "metadata", "startedOn")
+		}
+	} else {
+		s.BuildType = getProvenanceString(pred, "buildType")
+		s.BuilderID = getProvenanceString(pred, "builder", "id")
+		if s.BuilderID == "" {
+			s.BuilderID = getProvenanceString(pred, "invocation", "builder.id")
+		}
+		s.SourceRepository = getProvenanceString(pred, "invocation", "configSource", "uri")
+		if s.SourceRepository == "" {
+			s.SourceRepository = getProvenanceFirstURI(pred, "materials")
+		}
+		s.BuildTime = getProvenanceTime(pred, "metadata", "buildFinishedOn")
+		if s.BuildTime == nil {
+			s.BuildTime = getProvenanceTime(pred, "metadata", "buildStartedOn")
+		}
+	}
+	s.SourceRepository = normalizeSourceURI(s.SourceRepository)
+	return s, nil
+}
+
+// `git+https://github.com/org/repo@refs/heads/main` is normalized to `https://github.com/org/repo`
+func normalizeSourceURI(uri string) string {
+	uri = strings.TrimPrefix(uri, "git+")
+	scheme := ""
+	if i := strings.Index(uri, "://"); i >= 0 {
+		scheme = uri[:i+3]
+		uri = uri[i+3:]
+	}
+	// user info such as `git@` is before the first slash
+	if slash := strings.Index(uri, "/"); slash >= 0 {
+		if at := strings.Index(uri[slash:], "@"); at >= 0 {
+			uri = uri[:slash+at]
+		}
+	}
+	return scheme + uri
+}
+
+func getProvenanceValue(m map[string]interface{}, keys ...string) interface{} {
+	var current interface{} = m
+	for _, k := range keys {
+		cm, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = cm[k]
+	}
+	return current
+}
+
+func getProvenanceString(m map[string]interface{}, keys ...string) string {
+	s, _ := getProvenanceValue(m, keys...).(string)
+	return s
+}
+
+func getProvenanceFirstURI(m map[string]interface{}, keys ...string) string {
+	list, _ := getProvenanceValue(m, keys...).([]interface{})
+	for _, item := range list {
+		if im, ok := item.(map[string]interface{}); ok {
+			if uri, _ := im["uri"].(string); uri != "" {
+				return uri
+			}
+		}
+	}
+	return ""
+}
+
+func getProvenanceTime(m map[string]interface{}, keys ...string) *time.Time {
+	s := getProvenanceString(m, keys...)
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
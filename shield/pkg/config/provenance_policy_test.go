@@ -0,0 +1,102 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testSLSAv02Attestation = `{
+  "_type": "https://in-toto.io/Statement/v0.1",
+  "predicateType": "https://slsa.dev/provenance/v0.2",
+  "subject": [{"name": "sample-image", "digest": {"sha256": "abcd"}}],
+  "predicate": {
+    "builder": {"id": "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/builder_go_slsa3.yml@refs/tags/v1.2.0"},
+    "buildType": "https://github.com/slsa-framework/slsa-github-generator/go@v1",
+    "invocation": {"configSource": {"uri": "git+https://github.com/sample-org/sample-repo@refs/heads/main", "entryPoint": ".github/workflows/release.yml"}},
+    "metadata": {"buildStartedOn": "2022-09-01T00:00:00Z", "buildFinishedOn": "2022-09-01T00:10:00Z"}
+  }
+}`
+
+const testSLSAv1Attestation = `{
+  "_type": "https://in-toto.io/Statement/v1",
+  "predicateType": "https://slsa.dev/provenance/v1",
+  "predicate": {
+    "buildDefinition": {
+      "buildType": "https://tekton.dev/chains/v2/slsa",
+      "resolvedDependencies": [{"uri": "git+https://github.com/other-org/other-repo@refs/heads/main"}]
+    },
+    "runDetails": {"builder": {"id": "https://tekton.dev/chains/v2"}, "metadata": {"finishedOn": "2022-01-01T00:00:00Z"}}
+  }
+}`
+
+func TestProvenancePolicy(t *testing.T) {
+	now := time.Date(2022, 9, 2, 0, 0, 0, 0, time.UTC)
+	policy := &ProvenancePolicy{
+		BuilderIDs:         []string{"https://github.com/slsa-framework/slsa-github-generator/*"},
+		SourceRepositories: []string{"https://github.com/sample-org/*"},
+		BuildType:          "https://github.com/slsa-framework/slsa-github-generator/go@v1",
+		MaxAge:             &metav1.Duration{Duration: 72 * time.Hour},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Errorf("valid policy is rejected: %s", err.Error())
+		return
+	}
+	if err := (&ProvenancePolicy{}).Validate(); err == nil {
+		t.Errorf("policy without requirements should be rejected")
+		return
+	}
+
+	statement, err := ParseProvenanceStatement(testSLSAv02Attestation)
+	if err != nil {
+		t.Errorf("failed to parse SLSA v0.2 provenance: %s", err.Error())
+		return
+	}
+	if statement.SourceRepository != "https://github.com/sample-org/sample-repo" {
+		t.Errorf("unexpected source repository: %s", statement.SourceRepository)
+		return
+	}
+	if err := policy.Check(*statement, now); err != nil {
+		t.Errorf("provenance should satisfy the policy: %s", err.Error())
+		return
+	}
+
+	statement, err = ParseProvenanceStatement(testSLSAv1Attestation)
+	if err != nil {
+		t.Errorf("failed to parse SLSA v1 provenance: %s", err.Error())
+		return
+	}
+	if statement.BuilderID != "https://tekton.dev/chains/v2" || statement.BuildTime == nil {
+		t.Errorf("unexpected SLSA v1 statement: %v", statement)
+		return
+	}
+	err = policy.Check(*statement, now)
+	if err == nil {
+		t.Errorf("provenance from another builder and repository should not satisfy the policy")
+		return
+	}
+	for _, expected := range []string{"builder ID", "source repository", "build type", "older than"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("violation about %s is not reported: %s", expected, err.Error())
+			return
+		}
+	}
+}
@@ -53,6 +53,7 @@ type RequestHandlerConfig struct {
 	DecisionReporterConfig  DecisionReporterConfig `json:"decisionReporterConfig,omitempty"`
 	SideEffectConfig        SideEffectConfig       `json:"sideEffect,omitempty"`
 	DefaultConstraintAction Action                 `json:"defaultConstraintAction,omitempty"`
+	RevocationList          *RevocationList        `json:"revocationList,omitempty"`
 	Options                 []string
 }
 
@@ -136,5 +137,10 @@ func LoadRequestHandlerConfig() (*RequestHandlerConfig, error) {
 	if err != nil {
 		return sc, errors.Wrap(err, fmt.Sprintf("failed to unmarshal config.yaml into %T", sc))
 	}
+	if sc != nil {
+		if err = sc.RevocationList.Validate(); err != nil {
+			return sc, errors.Wrap(err, "invalid revocationList")
+		}
+	}
 	return sc, nil
 }
@@ -0,0 +1,226 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+)
+
+const sha256DigestPrefix = "sha256:"
+
+var hexPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// RevocationList is the list of revoked keys, signers, signatures and signed manifests.
+// It is checked for all profiles after the signature is verified.
+type RevocationList struct {
+	Entries []RevocationEntry `json:"entries,omitempty"`
+}
+
+// RevocationEntry revokes one of
+// - a public key by the hex SHA-256 of its DER (PKIX) encoding, or a PGP key by its fingerprint
+// - a signer identity, e.g. the email in a certificate. `*` is supported at the end
+// - a signature by `sha256:<hex>` of the decoded signature
+// - a signed manifest or an image by `sha256:<hex>` of the manifest or the image digest
+type RevocationEntry struct {
+	KeyFingerprint  string `json:"keyFingerprint,omitempty"`
+	Signer          string `json:"signer,omitempty"`
+	SignatureDigest string `json:"signatureDigest,omitempty"`
+	ManifestDigest  string `json:"manifestDigest,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// Validate returns an error if an entry does not have exactly one revoked item or has an invalid digest
+func (l *RevocationList) Validate() error {
+	if l == nil {
+		return nil
+	}
+	for i, e := range l.Entries {
+		count := 0
+		for _, v := range []string{e.KeyFingerprint, e.Signer, e.SignatureDigest, e.ManifestDigest} {
+			if v != "" {
+				count++
+			}
+		}
+		if count != 1 {
+			return fmt.Errorf("exactly one of keyFingerprint, signer, signatureDigest and manifestDigest must be set in the revocation entry [%d]", i)
+		}
+		if e.KeyFingerprint != "" && !hexPattern.MatchString(normalizeFingerprint(e.KeyFingerprint)) {
+			return fmt.Errorf("keyFingerprint must be hex in the revocation entry [%d]; %s", i, e.KeyFingerprint)
+		}
+		for _, d := range []string{e.SignatureDigest, e.ManifestDigest} {
+			if d == "" {
+				continue
+			}
+			if err := validateSHA256Digest(d); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("invalid digest in the revocation entry [%d]", i))
+			}
+		}
+	}
+	return nil
+}
+
+// Empty returns true if nothing is revoked
+func (l *RevocationList) Empty() bool {
+	return l == nil || len(l.Entries) == 0
+}
+
+// CheckKeyFingerprint returns the entry which revokes the key fingerprint
+func (l *RevocationList) CheckKeyFingerprint(fingerprint string) *RevocationEntry {
+	if l.Empty() || fingerprint == "" {
+		return nil
+	}
+	fingerprint = normalizeFingerprint(fingerprint)
+	for i, e := range l.Entries {
+		if e.KeyFingerprint != "" && normalizeFingerprint(e.KeyFingerprint) == fingerprint {
+			return &l.Entries[i]
+		}
+	}
+	return nil
+}
+
+// CheckKey returns the entry which revokes the public key
+func (l *RevocationList) CheckKey(pub crypto.PublicKey) *RevocationEntry {
+	if l.Empty() {
+		return nil
+	}
+	fingerprint, err := KeyFingerprint(pub)
+	if err != nil {
+		return nil
+	}
+	return l.CheckKeyFingerprint(fingerprint)
+}
+
+// CheckSigner returns the entry which revokes the signer
+func (l *RevocationList) CheckSigner(signer string) *RevocationEntry {
+	if l.Empty() || signer == "" {
+		return nil
+	}
+	for i, e := range l.Entries {
+		if e.Signer != "" && k8smnfutil.MatchPattern(e.Signer, signer) {
+			return &l.Entries[i]
+		}
+	}
+	return nil
+}
+
+// CheckSignature returns the entry which revokes the decoded signature
+func (l *RevocationList) CheckSignature(signature []byte) *RevocationEntry {
+	if l.Empty() {
+		return nil
+	}
+	digest := SHA256Digest(signature)
+	for i, e := range l.Entries {
+		if e.SignatureDigest != "" && strings.ToLower(e.SignatureDigest) == digest {
+			return &l.Entries[i]
+		}
+	}
+	return nil
+}
+
+// HasManifestDigests returns true if a signed manifest or an image is revoked by the digest
+func (l *RevocationList) HasManifestDigests() bool {
+	if l.Empty() {
+		return false
+	}
+	for _, e := range l.Entries {
+		if e.ManifestDigest != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckManifest returns the entry which revokes the signed manifest
+func (l *RevocationList) CheckManifest(manifest []byte) *RevocationEntry {
+	return l.CheckManifestDigest(SHA256Digest(manifest))
+}
+
+// CheckManifestDigest returns the entry which revokes the digest of a signed manifest or an image
+func (l *RevocationList) CheckManifestDigest(digest string) *RevocationEntry {
+	if l.Empty() || digest == "" {
+		return nil
+	}
+	digest = strings.ToLower(digest)
+	for i, e := range l.Entries {
+		if e.ManifestDigest != "" && strings.ToLower(e.ManifestDigest) == digest {
+			return &l.Entries[i]
+		}
+	}
+	return nil
+}
+
+// String describes the revoked item and the reason
+func (e RevocationEntry) String() string {
+	item := ""
+	switch {
+	case e.KeyFingerprint != "":
+		item = fmt.Sprintf("the key `%s`", e.KeyFingerprint)
+	case e.Signer != "":
+		item = fmt.Sprintf("the signer `%s`", e.Signer)
+	case e.SignatureDigest != "":
+		item = fmt.Sprintf("the signature `%s`", e.SignatureDigest)
+	case e.ManifestDigest != "":
+		item = fmt.Sprintf("the manifest `%s`", e.ManifestDigest)
+	}
+	if e.Reason == "" {
+		return fmt.Sprintf("%s is revoked", item)
+	}
+	return fmt.Sprintf("%s is revoked; %s", item, e.Reason)
+}
+
+// KeyFingerprint returns the hex SHA-256 of the DER (PKIX) encoding of the public key
+func KeyFingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal the public key")
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SHA256Digest returns the digest of the data in the form of `sha256:<hex>`
+func SHA256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return sha256DigestPrefix + hex.EncodeToString(sum[:])
+}
+
+func validateSHA256Digest(digest string) error {
+	if !strings.HasPrefix(digest, sha256DigestPrefix) {
+		return fmt.Errorf("digest must start with `%s`; %s", sha256DigestPrefix, digest)
+	}
+	hexSum := strings.ToLower(strings.TrimPrefix(digest, sha256DigestPrefix))
+	if len(hexSum) != sha256.Size*2 || !hexPattern.MatchString(hexSum) {
+		return fmt.Errorf("digest must have %d hex characters; %s", sha256.Size*2, digest)
+	}
+	return nil
+}
+
+// normalizeFingerprint accepts fingerprints in upper case, with colons or spaces, and with the `sha256:` prefix
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(fingerprint)
+	fingerprint = strings.TrimPrefix(fingerprint, sha256DigestPrefix)
+	return strings.NewReplacer(":", "", " ", "").Replace(fingerprint)
+}
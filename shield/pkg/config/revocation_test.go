@@ -0,0 +1,101 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestRevocationList(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("failed to generate a key: %s", err.Error())
+		return
+	}
+	fingerprint, err := KeyFingerprint(key.Public())
+	if err != nil {
+		t.Errorf("failed to get the fingerprint of the key: %s", err.Error())
+		return
+	}
+	signature := []byte("sample-signature")
+	manifest := []byte("sample-manifest")
+
+	revocations := &RevocationList{Entries: []RevocationEntry{
+		{KeyFingerprint: "SHA256:" + strings.ToUpper(fingerprint), Reason: "compromised"},
+		{Signer: "compromised-ci-*"},
+		{SignatureDigest: SHA256Digest(signature)},
+		{ManifestDigest: strings.ToUpper(SHA256Digest(manifest)[len("sha256:"):])},
+	}}
+	if err := revocations.Validate(); err == nil {
+		t.Errorf("a manifest digest without the prefix should be rejected")
+		return
+	}
+	revocations.Entries[3].ManifestDigest = SHA256Digest(manifest)
+	if err := revocations.Validate(); err != nil {
+		t.Errorf("revocation list should be valid: %s", err.Error())
+		return
+	}
+	if entry := revocations.CheckKey(key.Public()); entry == nil || entry.String() != "the key `SHA256:"+strings.ToUpper(fingerprint)+"` is revoked; compromised" {
+		t.Errorf("the key should be revoked: %v", entry)
+		return
+	}
+	if entry := revocations.CheckSigner("compromised-ci-1@example.com"); entry == nil {
+		t.Errorf("the signer should be revoked")
+		return
+	}
+	if entry := revocations.CheckSigner("someone@example.com"); entry != nil {
+		t.Errorf("other signers should not be revoked: %v", entry)
+		return
+	}
+	if entry := revocations.CheckSignature(signature); entry == nil {
+		t.Errorf("the signature should be revoked")
+		return
+	}
+	if entry := revocations.CheckManifest(manifest); entry == nil {
+		t.Errorf("the manifest should be revoked")
+		return
+	}
+	if entry := revocations.CheckManifest(signature); entry != nil {
+		t.Errorf("other manifests should not be revoked: %v", entry)
+		return
+	}
+
+	var empty *RevocationList
+	if !empty.Empty() || empty.CheckSigner("compromised-ci-1@example.com") != nil || empty.Validate() != nil {
+		t.Errorf("nil revocation list should revoke nothing")
+		return
+	}
+
+	invalidEntries := []RevocationEntry{
+		{},
+		{Signer: "compromised-ci-1@example.com", KeyFingerprint: fingerprint},
+		{KeyFingerprint: "not-a-fingerprint"},
+		{SignatureDigest: "sha256:1234"},
+		{ManifestDigest: "sha512:" + fingerprint},
+	}
+	for i, e := range invalidEntries {
+		invalid := &RevocationList{Entries: []RevocationEntry{e}}
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("invalid revocation entry [%d] should be rejected", i)
+			return
+		}
+	}
+}
@@ -0,0 +1,65 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ValidateSignatureAge checks that maxSignatureAge and signatureAgeGracePeriod are positive
+func (p *ManifestVerifyRule) ValidateSignatureAge() error {
+	if p.MaxSignatureAge != nil && p.MaxSignatureAge.Duration <= 0 {
+		return fmt.Errorf("maxSignatureAge must be positive, but %s is specified", p.MaxSignatureAge.Duration.String())
+	}
+	if p.SignatureAgeGracePeriod != nil {
+		if p.MaxSignatureAge == nil {
+			return errors.New("signatureAgeGracePeriod requires maxSignatureAge")
+		}
+		if p.SignatureAgeGracePeriod.Duration < 0 {
+			return fmt.Errorf("signatureAgeGracePeriod must not be negative, but %s is specified", p.SignatureAgeGracePeriod.Duration.String())
+		}
+	}
+	return nil
+}
+
+// CheckSignatureAge returns an error if the signature is older than maxSignatureAge and the grace period,
+// and returns a warning if the signature is older than maxSignatureAge but in the grace period.
+// A signature whose signed time is unknown is not accepted.
+func (p *ManifestVerifyRule) CheckSignatureAge(signedTime *time.Time, now time.Time) (string, error) {
+	if p.MaxSignatureAge == nil {
+		return "", nil
+	}
+	if signedTime == nil {
+		return "", fmt.Errorf("maxSignatureAge is %s, but the signed time is unknown", p.MaxSignatureAge.Duration.String())
+	}
+	age := now.Sub(*signedTime)
+	if age <= p.MaxSignatureAge.Duration {
+		return "", nil
+	}
+	grace := time.Duration(0)
+	if p.SignatureAgeGracePeriod != nil {
+		grace = p.SignatureAgeGracePeriod.Duration
+	}
+	deadline := signedTime.Add(p.MaxSignatureAge.Duration + grace)
+	if age <= p.MaxSignatureAge.Duration+grace {
+		return fmt.Sprintf("the signature at %s is older than maxSignatureAge %s and will not be accepted after %s; sign it again", signedTime.Format(time.RFC3339), p.MaxSignatureAge.Duration.String(), deadline.Format(time.RFC3339)), nil
+	}
+	return "", fmt.Errorf("the signature at %s is older than maxSignatureAge %s and the grace period ended at %s", signedTime.Format(time.RFC3339), p.MaxSignatureAge.Duration.String(), deadline.Format(time.RFC3339))
+}
@@ -0,0 +1,62 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSignatureAge(t *testing.T) {
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	rule := &ManifestVerifyRule{
+		MaxSignatureAge:         &metav1.Duration{Duration: 30 * 24 * time.Hour},
+		SignatureAgeGracePeriod: &metav1.Duration{Duration: 7 * 24 * time.Hour},
+	}
+	if err := rule.ValidateSignatureAge(); err != nil {
+		t.Errorf("valid signature age is rejected: %s", err.Error())
+		return
+	}
+
+	recent := now.Add(-10 * 24 * time.Hour)
+	if warning, err := rule.CheckSignatureAge(&recent, now); warning != "" || err != nil {
+		t.Errorf("recent signature should be accepted without warning; warning: %s, err: %v", warning, err)
+		return
+	}
+	inGrace := now.Add(-33 * 24 * time.Hour)
+	if warning, err := rule.CheckSignatureAge(&inGrace, now); warning == "" || err != nil {
+		t.Errorf("signature in the grace period should be accepted with warning; warning: %s, err: %v", warning, err)
+		return
+	}
+	expired := now.Add(-40 * 24 * time.Hour)
+	if _, err := rule.CheckSignatureAge(&expired, now); err == nil {
+		t.Errorf("signature after the grace period should not be accepted")
+		return
+	}
+	if _, err := rule.CheckSignatureAge(nil, now); err == nil {
+		t.Errorf("signature without signed time should not be accepted")
+		return
+	}
+
+	graceOnly := &ManifestVerifyRule{SignatureAgeGracePeriod: &metav1.Duration{Duration: time.Hour}}
+	if err := graceOnly.ValidateSignatureAge(); err == nil {
+		t.Errorf("grace period without maxSignatureAge should be rejected")
+		return
+	}
+}
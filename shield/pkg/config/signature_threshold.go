@@ -0,0 +1,109 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SignatureThreshold requires signatures by at least MinSigners distinct signers in Signers (m-of-n)
+type SignatureThreshold struct {
+	MinSigners int               `json:"minSigners"`
+	Signers    []ThresholdSigner `json:"signers"`
+}
+
+// ThresholdSigner is a named signer which is identified by its keys and/or its identity.
+// If keyConfigs is empty, keyConfigs of the rule are used with the identity.
+type ThresholdSigner struct {
+	Name       string      `json:"name"`
+	KeyConfigs []KeyConfig `json:"keyConfigs,omitempty"`
+	// signer name in the signature, e.g. email of a keyless signer or subject of a certificate
+	Identity string `json:"identity,omitempty"`
+}
+
+// SignatureThresholdResult shows signers whose signatures are found and missing
+type SignatureThresholdResult struct {
+	MinSigners int      `json:"minSigners"`
+	Found      []string `json:"found"`
+	Missing    []string `json:"missing"`
+}
+
+// Satisfied returns true if signatures by enough signers are found
+func (r *SignatureThresholdResult) Satisfied() bool {
+	return r != nil && len(r.Found) >= r.MinSigners
+}
+
+func (r *SignatureThresholdResult) String() string {
+	if r == nil {
+		return ""
+	}
+	return fmt.Sprintf("signatures by %d of %d required signers are found (found: %s, missing: %s)", len(r.Found), r.MinSigners, listOrNone(r.Found), listOrNone(r.Missing))
+}
+
+// Validate checks the number of required signers and that one signature cannot be counted for two signers
+func (t *SignatureThreshold) Validate() error {
+	if t == nil {
+		return nil
+	}
+	if t.MinSigners < 1 || t.MinSigners > len(t.Signers) {
+		return fmt.Errorf("minSigners must be between 1 and the number of signers (%d), but %d is specified", len(t.Signers), t.MinSigners)
+	}
+	names := map[string]bool{}
+	keys := map[string]string{}
+	for _, s := range t.Signers {
+		if s.Name == "" {
+			return fmt.Errorf("name is required for each signer")
+		}
+		if names[s.Name] {
+			return fmt.Errorf("signer `%s` is defined more than once", s.Name)
+		}
+		names[s.Name] = true
+		if len(s.KeyConfigs) == 0 && s.Identity == "" {
+			return fmt.Errorf("keyConfigs or identity is required for the signer `%s`", s.Name)
+		}
+		for _, k := range s.KeyConfigs {
+			if err := k.validateKey(); err != nil {
+				return err
+			}
+		}
+		// signers with identities may share keys such as a CA certificate
+		if s.Identity != "" {
+			id := "identity " + s.Identity
+			if other, found := keys[id]; found {
+				return fmt.Errorf("the %s is shared by the signers `%s` and `%s`", id, other, s.Name)
+			}
+			keys[id] = s.Name
+			continue
+		}
+		for _, k := range s.KeyConfigs {
+			id := k.Description()
+			if other, found := keys[id]; found && other != s.Name {
+				return fmt.Errorf("the %s is shared by the signers `%s` and `%s`", id, other, s.Name)
+			}
+			keys[id] = s.Name
+		}
+	}
+	return nil
+}
+
+func listOrNone(l []string) string {
+	if len(l) == 0 {
+		return "none"
+	}
+	return strings.Join(l, ", ")
+}
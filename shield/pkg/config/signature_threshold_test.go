@@ -0,0 +1,60 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSignatureThreshold(t *testing.T) {
+	teamA := ThresholdSigner{Name: "team-a", KeyConfigs: []KeyConfig{{Secret: KeySecret{Name: "team-a-key", Namespace: "ishield"}}}}
+	teamB := ThresholdSigner{Name: "team-b", KeyConfigs: []KeyConfig{{Secret: KeySecret{Name: "team-b-key", Namespace: "ishield"}}}}
+	alice := ThresholdSigner{Name: "alice", Identity: "alice@example.com"}
+
+	threshold := &SignatureThreshold{MinSigners: 2, Signers: []ThresholdSigner{teamA, teamB, alice}}
+	if err := threshold.Validate(); err != nil {
+		t.Errorf("valid threshold is rejected: %s", err.Error())
+		return
+	}
+	tooMany := &SignatureThreshold{MinSigners: 4, Signers: []ThresholdSigner{teamA, teamB, alice}}
+	if err := tooMany.Validate(); err == nil {
+		t.Errorf("minSigners larger than the number of signers should be rejected")
+		return
+	}
+	// one signature must not be counted for two signers
+	sharedKey := ThresholdSigner{Name: "team-c", KeyConfigs: teamA.KeyConfigs}
+	shared := &SignatureThreshold{MinSigners: 2, Signers: []ThresholdSigner{teamA, sharedKey}}
+	if err := shared.Validate(); err == nil {
+		t.Errorf("key shared by two signers should be rejected")
+		return
+	}
+	if err := ValidateManifestVerifyRule(&ManifestVerifyRule{SignatureThreshold: shared}); err == nil {
+		t.Errorf("rule with an invalid threshold should be rejected")
+		return
+	}
+
+	result := &SignatureThresholdResult{MinSigners: 2, Found: []string{"team-a"}, Missing: []string{"team-b", "alice"}}
+	if result.Satisfied() {
+		t.Errorf("threshold should not be satisfied by one signer")
+		return
+	}
+	if msg := result.String(); !strings.Contains(msg, "found: team-a") || !strings.Contains(msg, "missing: team-b, alice") {
+		t.Errorf("result should show found and missing signers: %s", msg)
+		return
+	}
+}
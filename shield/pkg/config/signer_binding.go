@@ -0,0 +1,107 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+)
+
+// SignerBinding limits objects which can be signed by the keys or the signer identities.
+// Keys and identities which are not bound by any binding can sign any object in scope of the rule.
+type SignerBinding struct {
+	Name       string      `json:"name"`
+	KeyConfigs []KeyConfig `json:"keyConfigs,omitempty"`
+	// signer names in the signature, e.g. email of a keyless signer; a trailing wildcard can be used
+	Identities []string       `json:"identities,omitempty"`
+	Match      MatchCondition `json:"match"`
+}
+
+// HasKey returns true if the key is the same secret or inline key as one of the keys in the binding
+func (b SignerBinding) HasKey(key KeyConfig) bool {
+	for _, k := range b.KeyConfigs {
+		if k.Description() == key.Description() {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIdentity returns true if the signer name matches one of the identities in the binding
+func (b SignerBinding) MatchIdentity(signer string) bool {
+	if signer == "" || len(b.Identities) == 0 {
+		return false
+	}
+	return k8smnfutil.MatchWithPatternArray(signer, b.Identities)
+}
+
+// IsBoundKey returns true if the key is bound by any binding
+func IsBoundKey(bindings []SignerBinding, key KeyConfig) bool {
+	for _, b := range bindings {
+		if b.HasKey(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizeSigner returns an error if the key or the signer is bound but no binding for it matches the target.
+// key is nil if the signature is verified by keys which are not checked one by one.
+func AuthorizeSigner(bindings []SignerBinding, key *KeyConfig, signer string, target MatchTarget) error {
+	bound := []string{}
+	for _, b := range bindings {
+		if !(key != nil && b.HasKey(*key)) && !b.MatchIdentity(signer) {
+			continue
+		}
+		if b.Match.Match(target) {
+			return nil
+		}
+		bound = append(bound, b.Name)
+	}
+	if len(bound) == 0 {
+		return nil
+	}
+	signerName := signer
+	if key != nil {
+		if signerName == "" {
+			signerName = key.Description()
+		} else {
+			signerName = fmt.Sprintf("%s (%s)", signerName, key.Description())
+		}
+	}
+	return fmt.Errorf("signer %s is not authorized for this object; allowed only by the signer bindings: %s", signerName, strings.Join(bound, ", "))
+}
+
+// ValidateSignerBindings checks that each binding has a name and keys or identities
+func ValidateSignerBindings(bindings []SignerBinding) error {
+	names := map[string]bool{}
+	for _, b := range bindings {
+		if b.Name == "" {
+			return fmt.Errorf("name is required for each signer binding")
+		}
+		if names[b.Name] {
+			return fmt.Errorf("signer binding `%s` is defined more than once", b.Name)
+		}
+		names[b.Name] = true
+		if len(b.KeyConfigs) == 0 && len(b.Identities) == 0 {
+			return fmt.Errorf("keyConfigs or identities is required for the signer binding `%s`", b.Name)
+		}
+	}
+	return nil
+}
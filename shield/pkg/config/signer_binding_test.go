@@ -0,0 +1,79 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSignerBinding(t *testing.T) {
+	teamAKey := KeyConfig{Secret: KeySecret{Name: "team-a-key", Namespace: "ishield"}}
+	otherKey := KeyConfig{Secret: KeySecret{Name: "other-key", Namespace: "ishield"}}
+	bindings := []SignerBinding{
+		{
+			Name:       "team-a",
+			KeyConfigs: []KeyConfig{teamAKey},
+			Match:      MatchCondition{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}},
+		},
+		{
+			Name:       "config-signers",
+			Identities: []string{"config-bot@*"},
+			Match:      MatchCondition{Kinds: []Kinds{{Kinds: []string{"ConfigMap"}}}},
+		},
+	}
+	if err := ValidateSignerBindings(bindings); err != nil {
+		t.Errorf("valid signer bindings are rejected: %s", err.Error())
+		return
+	}
+	if !IsBoundKey(bindings, teamAKey) || IsBoundKey(bindings, otherKey) {
+		t.Errorf("only keys in the bindings should be bound")
+		return
+	}
+
+	teamANamespace := MatchTarget{Kind: "ConfigMap", Name: "sample-cm", Namespace: "team-a-ns", Namespaced: true, NamespaceLabels: map[string]string{"team": "a"}}
+	teamBNamespace := MatchTarget{Kind: "Secret", Name: "sample-secret", Namespace: "team-b-ns", Namespaced: true, NamespaceLabels: map[string]string{"team": "b"}}
+
+	if err := AuthorizeSigner(bindings, &teamAKey, "", teamANamespace); err != nil {
+		t.Errorf("team-a key should be authorized in the team-a namespace: %s", err.Error())
+		return
+	}
+	err := AuthorizeSigner(bindings, &teamAKey, "", teamBNamespace)
+	if err == nil || !strings.Contains(err.Error(), "not authorized for this object") {
+		t.Errorf("team-a key should not be authorized in the team-b namespace; err: %v", err)
+		return
+	}
+	if err := AuthorizeSigner(bindings, &otherKey, "", teamBNamespace); err != nil {
+		t.Errorf("a key without bindings should be authorized for any object: %s", err.Error())
+		return
+	}
+	if err := AuthorizeSigner(bindings, nil, "config-bot@example.com", teamBNamespace); err == nil {
+		t.Errorf("a bound identity should not be authorized for a Secret")
+		return
+	}
+	if err := AuthorizeSigner(bindings, nil, "config-bot@example.com", teamANamespace); err != nil {
+		t.Errorf("a bound identity should be authorized for a ConfigMap: %s", err.Error())
+		return
+	}
+
+	if err := ValidateSignerBindings([]SignerBinding{{Name: "empty"}}); err == nil {
+		t.Errorf("a binding without keys and identities should be rejected")
+		return
+	}
+}
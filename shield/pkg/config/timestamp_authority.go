@@ -0,0 +1,48 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stolostron/integrity-shield/shield/pkg/tsa"
+)
+
+// TimestampAuthority is the certificate chain of RFC 3161 timestamp authorities (TSA) which are trusted to timestamp signatures.
+// A trusted timestamp is used instead of the signed time asserted by the signer to check validity windows of keys and the signature age.
+type TimestampAuthority struct {
+	// PEM encoded root and intermediate certificates. The TSA certificate can also be added if tokens do not embed it.
+	CertChain string `json:"certChain"`
+	// if true, a signature without a trusted timestamp is not accepted
+	Required bool `json:"required,omitempty"`
+}
+
+// Validate returns an error if the certificate chain has no root certificate
+func (t *TimestampAuthority) Validate() error {
+	if t == nil {
+		return nil
+	}
+	if t.CertChain == "" {
+		return errors.New("certChain must be set")
+	}
+	_, err := t.Verifier()
+	return err
+}
+
+// Verifier returns a verifier of timestamp tokens with the certificate chain
+func (t *TimestampAuthority) Verifier() (*tsa.Verifier, error) {
+	return tsa.NewVerifier([]byte(t.CertChain))
+}
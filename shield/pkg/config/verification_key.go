@@ -0,0 +1,172 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// VerificationKeyGVR is the cluster-scoped resource of verification keys
+var VerificationKeyGVR = schema.GroupVersionResource{
+	Group:    "apis.integrityshield.io",
+	Version:  "v1",
+	Resource: "verificationkeys",
+}
+
+// VerificationKey is a public key managed as a cluster-scoped resource.
+// Profiles refer to it by name or by a label selector instead of embedding the key.
+type VerificationKey struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VerificationKeySpec   `json:"spec,omitempty"`
+	Status VerificationKeyStatus `json:"status,omitempty"`
+}
+
+// VerificationKeySpec holds one of the key material or a reference to it
+type VerificationKeySpec struct {
+	Key        *Key       `json:"key,omitempty"`       // PEM encoded public key
+	Secret     *KeySecret `json:"keySecret,omitempty"` // public key as a Kubernetes Secret
+	PGPKeyring *DataRef   `json:"pgpKeyring,omitempty"`
+	KMS        *KMSKey    `json:"kms,omitempty"`
+
+	Owner       string `json:"owner,omitempty"`
+	Description string `json:"description,omitempty"`
+	// validity window of signatures made with this key
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+	NotAfter  *metav1.Time `json:"notAfter,omitempty"`
+	// a revoked key is never used for verification
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// VerificationKeyStatus is updated by the observer
+type VerificationKeyStatus struct {
+	// names of the profiles which refer to this key
+	UsedBy []string `json:"usedBy,omitempty"`
+	// the number of resources whose signatures are currently verified with this key
+	VerifiedResources int    `json:"verifiedResources"`
+	LastUpdated       string `json:"lastUpdated,omitempty"`
+}
+
+// IsVerificationKeyRef returns true if the key is a reference to VerificationKeys
+func (k KeyConfig) IsVerificationKeyRef() bool {
+	return k.VerificationKey != "" || k.VerificationKeySelector != nil
+}
+
+// MatchVerificationKey returns true if the VerificationKey is referred by this key config
+func (k KeyConfig) MatchVerificationKey(vk VerificationKey) (bool, error) {
+	if k.VerificationKey != "" {
+		return k.VerificationKey == vk.Name, nil
+	}
+	if k.VerificationKeySelector == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(k.VerificationKeySelector)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid verificationKeySelector")
+	}
+	return selector.Matches(labels.Set(vk.Labels)), nil
+}
+
+// ValidateVerificationKeyRef returns an error if the reference is invalid or is set with another key
+func (k KeyConfig) ValidateVerificationKeyRef() error {
+	if !k.IsVerificationKeyRef() {
+		return nil
+	}
+	if k.VerificationKey != "" && k.VerificationKeySelector != nil {
+		return errors.New("verificationKey and verificationKeySelector cannot be set together")
+	}
+	if k.Key.PEM != "" || k.Secret.Name != "" || k.X509 != nil || k.PGPKeyring != nil || k.KMS != nil {
+		return fmt.Errorf("the %s cannot be set with key, keySecret, x509, pgpKeyring or kms", k.Description())
+	}
+	if k.VerificationKeySelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(k.VerificationKeySelector); err != nil {
+			return errors.Wrap(err, "invalid verificationKeySelector")
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the key material is not set exactly once
+func (vk VerificationKey) Validate() error {
+	count := 0
+	if vk.Spec.Key != nil {
+		if vk.Spec.Key.PEM == "" {
+			return fmt.Errorf("PEM of the key must be set in the verification key `%s`", vk.Name)
+		}
+		count++
+	}
+	if vk.Spec.Secret != nil {
+		if vk.Spec.Secret.Name == "" || vk.Spec.Secret.Namespace == "" {
+			return fmt.Errorf("name and namespace of keySecret must be set in the verification key `%s`", vk.Name)
+		}
+		count++
+	}
+	if vk.Spec.PGPKeyring != nil {
+		count++
+	}
+	if vk.Spec.KMS != nil {
+		count++
+	}
+	if count != 1 {
+		return fmt.Errorf("one of key, keySecret, pgpKeyring and kms must be set in the verification key `%s`", vk.Name)
+	}
+	return vk.KeyConfig().validateKey()
+}
+
+// KeyConfig returns the key config which is used for verification.
+// Signatures are accepted only within the validity window of the verification key.
+func (vk VerificationKey) KeyConfig() KeyConfig {
+	k := KeyConfig{
+		NotBefore:           vk.Spec.NotBefore,
+		NotAfter:            vk.Spec.NotAfter,
+		PGPKeyring:          vk.Spec.PGPKeyring,
+		KMS:                 vk.Spec.KMS,
+		VerificationKeyName: vk.Name,
+	}
+	if vk.Spec.Key != nil {
+		k.Key = *vk.Spec.Key
+		if k.Key.Name == "" {
+			k.Key.Name = vk.Name
+		}
+	}
+	if vk.Spec.Secret != nil {
+		k.Secret = *vk.Spec.Secret
+	}
+	return k
+}
+
+func (k KeyConfig) validateKey() error {
+	if err := k.ValidateWindow(); err != nil {
+		return err
+	}
+	if err := k.ValidateX509(); err != nil {
+		return err
+	}
+	if err := k.ValidatePGP(); err != nil {
+		return err
+	}
+	if err := k.ValidateKMS(); err != nil {
+		return err
+	}
+	return k.ValidateVerificationKeyRef()
+}
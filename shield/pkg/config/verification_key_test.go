@@ -0,0 +1,95 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVerificationKey(t *testing.T) {
+	vk := VerificationKey{
+		ObjectMeta: metav1.ObjectMeta{Name: "release-key", Labels: map[string]string{"team": "release"}},
+		Spec: VerificationKeySpec{
+			Secret:   &KeySecret{Name: "release-key", Namespace: "sample-ns"},
+			Owner:    "release-team",
+			NotAfter: &metav1.Time{Time: time.Now().Add(time.Hour)},
+		},
+	}
+	if err := vk.Validate(); err != nil {
+		t.Errorf("verification key should be valid: %s", err.Error())
+		return
+	}
+	k := vk.KeyConfig()
+	if k.Secret.Name != "release-key" || k.NotAfter == nil || k.VerificationKeyName != "release-key" {
+		t.Errorf("key config should have the secret and the validity window of the verification key: %v", k)
+		return
+	}
+	if desc := k.Description(); desc != "verification key `release-key`" {
+		t.Errorf("unexpected description: %s", desc)
+		return
+	}
+
+	refs := map[string]KeyConfig{
+		"name":     {VerificationKey: "release-key"},
+		"selector": {VerificationKeySelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "release"}}},
+	}
+	for name, ref := range refs {
+		if err := ref.ValidateVerificationKeyRef(); err != nil {
+			t.Errorf("reference by %s should be valid: %s", name, err.Error())
+			return
+		}
+		if matched, err := ref.MatchVerificationKey(vk); err != nil || !matched {
+			t.Errorf("reference by %s should match the verification key", name)
+			return
+		}
+	}
+	other := KeyConfig{VerificationKeySelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "dev"}}}
+	if matched, _ := other.MatchVerificationKey(vk); matched {
+		t.Errorf("selector of another team should not match the verification key")
+		return
+	}
+
+	invalidRefs := []KeyConfig{
+		{VerificationKey: "release-key", VerificationKeySelector: refs["selector"].VerificationKeySelector},
+		{VerificationKey: "release-key", Secret: KeySecret{Name: "sample-key", Namespace: "sample-ns"}},
+		{VerificationKeySelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Unknown"}}}},
+	}
+	for i, k := range invalidRefs {
+		if err := ValidateManifestVerifyRule(&ManifestVerifyRule{KeyConfigs: []KeyConfig{k}}); err == nil {
+			t.Errorf("invalid reference [%d] should be rejected", i)
+			return
+		}
+	}
+
+	invalidKeys := []VerificationKeySpec{
+		{},
+		{Secret: &KeySecret{Name: "release-key", Namespace: "sample-ns"}, KMS: &KMSKey{Ref: "hashivault://release-key"}},
+		{Secret: &KeySecret{Name: "release-key"}},
+		{KMS: &KMSKey{Ref: "k8s://sample-ns/release-key"}},
+		{Key: &Key{PEM: "sample"}, NotBefore: &metav1.Time{Time: time.Now()}, NotAfter: &metav1.Time{Time: time.Now().Add(-time.Hour)}},
+	}
+	for i, spec := range invalidKeys {
+		invalid := VerificationKey{ObjectMeta: metav1.ObjectMeta{Name: "invalid-key"}, Spec: spec}
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("invalid verification key [%d] should be rejected", i)
+			return
+		}
+	}
+}
@@ -26,12 +26,15 @@ var DefaultDryRunNS = "ishield-dryrun-ns"
 type ManifestVerifyConfig struct {
 	RequestFilterProfile *RequestFilterProfile `json:"requestFilterProfile,omitempty"`
 	DryRunNamespcae      string                `json:"dryRunNamespcae,omitempty"`
+	RevocationList       *RevocationList       `json:"revocationList,omitempty"`
 }
 
 type RequestFilterProfile struct {
 	SkipObjects  k8smanifest.ObjectReferenceList    `json:"skipObjects,omitempty"`
 	SkipUsers    ObjectUserBindingList              `json:"skipUsers,omitempty"`
 	IgnoreFields k8smanifest.ObjectFieldBindingList `json:"ignoreFields,omitempty"`
+	// only skip and ignore expressions are used in the common profile
+	Expressions *ExpressionRules `json:"expressions,omitempty"`
 }
 
 func NewManifestVerifyConfig(dryRunNs string) *ManifestVerifyConfig {
@@ -0,0 +1,116 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+)
+
+// kinds of DataRef
+const (
+	DataRefKindSecret    = "Secret"
+	DataRefKindConfigMap = "ConfigMap"
+)
+
+// X509KeyConfig trusts signing certificates issued by a CA bundle instead of a single public key.
+// The certificate in the signature must chain to the bundle, allow code signing, match the name constraints
+// and not be revoked by the CRLs.
+type X509KeyConfig struct {
+	CABundle DataRef   `json:"caBundle"`
+	CRLs     []DataRef `json:"crls,omitempty"`
+	// patterns of the subject common name of the signing certificate; a trailing wildcard can be used
+	CommonNames []string `json:"commonNames,omitempty"`
+	// patterns of email, DNS and URI subject alternative names of the signing certificate; any one of them must match
+	SANs []string `json:"sans,omitempty"`
+}
+
+// DataRef refers to data in a Secret or a ConfigMap. If key is empty, all data in the object are used.
+type DataRef struct {
+	Kind      string `json:"kind,omitempty"` // Secret (default) or ConfigMap
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key,omitempty"`
+}
+
+// GetKind returns the kind of the object, which is Secret by default
+func (r DataRef) GetKind() string {
+	if r.Kind == "" {
+		return DataRefKindSecret
+	}
+	return r.Kind
+}
+
+func (r DataRef) String() string {
+	s := fmt.Sprintf("%s `%s/%s`", r.GetKind(), r.Namespace, r.Name)
+	if r.Key != "" {
+		s = fmt.Sprintf("%s (key: %s)", s, r.Key)
+	}
+	return s
+}
+
+func (r DataRef) validate() error {
+	if r.Name == "" || r.Namespace == "" {
+		return errors.New("name and namespace must be set")
+	}
+	if r.GetKind() != DataRefKindSecret && r.GetKind() != DataRefKindConfigMap {
+		return fmt.Errorf("kind must be %s or %s; %s", DataRefKindSecret, DataRefKindConfigMap, r.Kind)
+	}
+	return nil
+}
+
+// ValidateX509 returns an error if the x509 key config is invalid or is set with another key
+func (k KeyConfig) ValidateX509() error {
+	if k.X509 == nil {
+		return nil
+	}
+	if k.Key.PEM != "" || k.Secret.Name != "" {
+		return fmt.Errorf("x509 cannot be set with key or keySecret in the %s", k.Description())
+	}
+	if err := k.X509.CABundle.validate(); err != nil {
+		return errors.Wrap(err, "invalid caBundle of x509")
+	}
+	for _, crl := range k.X509.CRLs {
+		if err := crl.validate(); err != nil {
+			return errors.Wrap(err, "invalid crls of x509")
+		}
+	}
+	return nil
+}
+
+// CheckNames returns an error if the certificate does not match the common name and SAN constraints
+func (c *X509KeyConfig) CheckNames(cert *x509.Certificate) error {
+	if len(c.CommonNames) > 0 && !k8smnfutil.MatchWithPatternArray(cert.Subject.CommonName, c.CommonNames) {
+		return fmt.Errorf("the common name `%s` of the certificate is not allowed", cert.Subject.CommonName)
+	}
+	if len(c.SANs) == 0 {
+		return nil
+	}
+	sans := append(append([]string{}, cert.EmailAddresses...), cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, san := range sans {
+		if k8smnfutil.MatchWithPatternArray(san, c.SANs) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no subject alternative name of the certificate is allowed; %v", sans)
+}
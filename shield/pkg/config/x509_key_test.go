@@ -0,0 +1,70 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestX509KeyConfig(t *testing.T) {
+	caBundle := DataRef{Name: "sample-ca", Namespace: "sample-ns"}
+	k := KeyConfig{X509: &X509KeyConfig{
+		CABundle:    caBundle,
+		CRLs:        []DataRef{{Kind: DataRefKindConfigMap, Name: "sample-crl", Namespace: "sample-ns"}},
+		CommonNames: []string{"release-*"},
+		SANs:        []string{"release-bot@example.com", "https://github.com/sample-org/*"},
+	}}
+	if err := k.ValidateX509(); err != nil {
+		t.Errorf("x509 key config should be valid: %s", err.Error())
+		return
+	}
+	if k.X509.CABundle.GetKind() != DataRefKindSecret {
+		t.Errorf("the CA bundle should be in a secret by default: %s", k.X509.CABundle.GetKind())
+		return
+	}
+
+	invalid := []KeyConfig{
+		{X509: &X509KeyConfig{CABundle: caBundle}, Key: Key{Name: "sample-key", PEM: "sample-pem"}},
+		{X509: &X509KeyConfig{CABundle: DataRef{Name: "sample-ca"}}},
+		{X509: &X509KeyConfig{CABundle: caBundle, CRLs: []DataRef{{Kind: "Pod", Name: "sample-crl", Namespace: "sample-ns"}}}},
+	}
+	for i, c := range invalid {
+		if err := c.ValidateX509(); err == nil {
+			t.Errorf("invalid x509 key config [%d] should be rejected", i)
+			return
+		}
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "release-bot"}, EmailAddresses: []string{"release-bot@example.com"}}
+	if err := k.X509.CheckNames(cert); err != nil {
+		t.Errorf("the certificate should match the names: %s", err.Error())
+		return
+	}
+	cert.Subject.CommonName = "dev-bot"
+	if err := k.X509.CheckNames(cert); err == nil {
+		t.Errorf("the certificate with another common name should be rejected")
+		return
+	}
+	cert.Subject.CommonName = "release-bot"
+	cert.EmailAddresses = []string{"release-bot@example.org"}
+	if err := k.X509.CheckNames(cert); err == nil {
+		t.Errorf("the certificate with another SAN should be rejected")
+		return
+	}
+}
@@ -0,0 +1,197 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/oci"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+	ishieldconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+// AttestationVerifier verifies signatures of in-toto attestations with the keys or the keyless identities of a rule.
+// Keys are loaded at the first verification and used for the other attestations.
+type AttestationVerifier struct {
+	v *imageVerifier
+}
+
+// NewAttestationVerifier returns a verifier with the keys, or with the keyless identities if no key is given.
+// Keys which cannot be used for cosign signatures (PGP keyrings and x509 CAs) are not used.
+func NewAttestationVerifier(keyConfigs []ishieldconfig.KeyConfig, identities ishieldconfig.KeylessIdentityList, certificateRoot string) *AttestationVerifier {
+	profile := ishieldconfig.ImageProfile{
+		KeylessIdentities:      identities,
+		KeylessCertificateRoot: certificateRoot,
+	}
+	if len(keyConfigs) > 0 {
+		profile.KeyConfigs = []ishieldconfig.KeyConfig{}
+		for _, k := range keyConfigs {
+			if k.X509 != nil || k.PGPKeyring != nil {
+				continue
+			}
+			profile.KeyConfigs = append(profile.KeyConfigs, k)
+		}
+		if len(profile.KeyConfigs) == 0 {
+			return &AttestationVerifier{v: &imageVerifier{loaded: true, loadErr: errors.New("no key which can verify attestations is found")}}
+		}
+	}
+	return &AttestationVerifier{v: &imageVerifier{profile: profile}}
+}
+
+// VerifyImage verifies cosign attestations attached to the image and returns the in-toto statements in the verified ones.
+// The subject of each statement is checked with the digest of the image by cosign.
+func (a *AttestationVerifier) VerifyImage(ctx context.Context, imageRef string) ([][]byte, error) {
+	if err := a.v.load(ctx); err != nil {
+		return nil, err
+	}
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse image ref `%s`", imageRef))
+	}
+	baseOpts, err := newCheckOpts(ctx, cosign.IntotoSubjectClaimVerifier)
+	if err != nil {
+		return nil, err
+	}
+	errMsgs := []string{}
+	if len(a.v.keys) > 0 {
+		for _, key := range a.v.keys {
+			co := *baseOpts
+			co.SigVerifier = key.verifier
+			atts, _, err := cosign.VerifyImageAttestations(ctx, ref, &co)
+			if err != nil {
+				errMsgs = append(errMsgs, fmt.Sprintf("%s: %s", key.description, err.Error()))
+				continue
+			}
+			accepted := []oci.Signature{}
+			for _, att := range atts {
+				if err := checkOfflineBundle(ctx, att); err != nil {
+					errMsgs = append(errMsgs, fmt.Sprintf("%s: %s", key.description, err.Error()))
+					continue
+				}
+				accepted = append(accepted, att)
+			}
+			if statements := attestationStatements(accepted); len(statements) > 0 {
+				return statements, nil
+			}
+		}
+		return nil, fmt.Errorf("no attestation of the image `%s` is verified with the keys; %s", imageRef, strings.Join(errMsgs, "; "))
+	}
+
+	co := baseOpts
+	co.RootCerts = a.v.roots.Roots
+	co.IntermediateCerts = a.v.roots.Intermediates
+	atts, _, err := cosign.VerifyImageAttestations(ctx, ref, co)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to verify the attestation of the image `%s`", imageRef))
+	}
+	accepted := []oci.Signature{}
+	for _, att := range atts {
+		cert, err := att.Cert()
+		if err != nil || cert == nil {
+			continue
+		}
+		if _, err := a.v.roots.VerifyIdentity(cert, a.v.profile.KeylessIdentities); err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		if err := checkOfflineBundle(ctx, att); err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		accepted = append(accepted, att)
+	}
+	if statements := attestationStatements(accepted); len(statements) > 0 {
+		return statements, nil
+	}
+	return nil, fmt.Errorf("no attestation of the image `%s` is accepted; %s", imageRef, strings.Join(errMsgs, "; "))
+}
+
+// VerifyEnvelope verifies the DSSE envelope with the keys and returns the in-toto statement in it.
+// An envelope has no certificate, so it cannot be verified with keyless identities.
+func (a *AttestationVerifier) VerifyEnvelope(ctx context.Context, envelope []byte) ([]byte, error) {
+	if err := a.v.load(ctx); err != nil {
+		return nil, err
+	}
+	if len(a.v.keys) == 0 {
+		return nil, errors.New("an attestation which is not attached to an image can be verified only with keys")
+	}
+	return verifyEnvelopeWithKeys(envelope, a.v.keys)
+}
+
+func verifyEnvelopeWithKeys(envelope []byte, keys []imageKey) ([]byte, error) {
+	statement, err := envelopePayload(envelope)
+	if err != nil {
+		return nil, err
+	}
+	errMsgs := []string{}
+	for _, key := range keys {
+		err := dsse.WrapVerifier(key.verifier).VerifySignature(bytes.NewReader(envelope), nil)
+		if err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("%s: %s", key.description, err.Error()))
+			continue
+		}
+		return statement, nil
+	}
+	return nil, fmt.Errorf("the attestation is not verified with the keys; %s", strings.Join(errMsgs, "; "))
+}
+
+// envelopePayload returns the decoded payload of the DSSE envelope
+func envelopePayload(envelope []byte) ([]byte, error) {
+	var env struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+		Signatures  []struct {
+			Sig string `json:"sig"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(envelope, &env); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the attestation envelope")
+	}
+	if env.Payload == "" || len(env.Signatures) == 0 {
+		return nil, errors.New("the attestation is not a signed DSSE envelope")
+	}
+	statement, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode the payload of the attestation envelope")
+	}
+	return statement, nil
+}
+
+// attestationStatements returns the in-toto statements in the payloads of verified attestations
+func attestationStatements(atts []oci.Signature) [][]byte {
+	statements := [][]byte{}
+	for _, att := range atts {
+		p, err := att.Payload()
+		if err != nil {
+			continue
+		}
+		statement, err := envelopePayload(p)
+		if err != nil {
+			continue
+		}
+		statements = append(statements, statement)
+	}
+	return statements
+}
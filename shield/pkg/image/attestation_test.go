@@ -0,0 +1,93 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package image
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+)
+
+const sampleStatement = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[],"predicate":{"builder":{"id":"https://example.com/builder"}}}`
+
+func newTestKey(t *testing.T, description string) (signature.SignerVerifier, imageKey) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate a key: %s", err.Error())
+	}
+	sv, err := signature.LoadECDSASignerVerifier(priv, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("failed to load the key: %s", err.Error())
+	}
+	return sv, imageKey{description: description, verifier: sv}
+}
+
+func TestVerifyEnvelopeWithKeys(t *testing.T) {
+	signer, signerKey := newTestKey(t, "signer key")
+	_, otherKey := newTestKey(t, "other key")
+
+	envelope, err := dsse.WrapSigner(signer, "application/vnd.in-toto+json").SignMessage(bytes.NewReader([]byte(sampleStatement)))
+	if err != nil {
+		t.Errorf("failed to sign the statement: %s", err.Error())
+		return
+	}
+
+	statement, err := verifyEnvelopeWithKeys(envelope, []imageKey{otherKey, signerKey})
+	if err != nil {
+		t.Errorf("envelope should be verified with the signer key: %s", err.Error())
+		return
+	}
+	if string(statement) != sampleStatement {
+		t.Errorf("unexpected statement: %s", string(statement))
+		return
+	}
+
+	if _, err := verifyEnvelopeWithKeys(envelope, []imageKey{otherKey}); err == nil {
+		t.Errorf("envelope should not be verified with other keys")
+		return
+	}
+
+	// the payload is replaced after signing
+	var env map[string]interface{}
+	_ = json.Unmarshal(envelope, &env)
+	env["payload"] = base64.StdEncoding.EncodeToString([]byte(`{"predicateType":"https://slsa.dev/provenance/v0.2","predicate":{}}`))
+	tampered, _ := json.Marshal(env)
+	if _, err := verifyEnvelopeWithKeys(tampered, []imageKey{signerKey}); err == nil {
+		t.Errorf("tampered envelope should not be verified")
+		return
+	}
+
+	invalid := map[string]string{
+		"unsigned statement": sampleStatement,
+		"not json":           "not-json",
+		"no signature":       `{"payloadType":"application/vnd.in-toto+json","payload":"e30=","signatures":[]}`,
+		"invalid payload":    `{"payloadType":"application/vnd.in-toto+json","payload":"!!!","signatures":[{"sig":"MEUCIQ=="}]}`,
+	}
+	for name, data := range invalid {
+		if _, err := verifyEnvelopeWithKeys([]byte(data), []imageKey{signerKey}); err == nil {
+			t.Errorf("%s should not be verified", name)
+		}
+	}
+}
@@ -17,30 +17,98 @@
 package image
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
 
-	"github.com/sigstore/cosign/cmd/cosign/cli/manifest"
-	"github.com/sigstore/cosign/cmd/cosign/cli/verify"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/oci"
+	ociremote "github.com/sigstore/cosign/pkg/oci/remote"
+	sigs "github.com/sigstore/cosign/pkg/signature"
+	k8scosign "github.com/sigstore/k8s-manifest-sigstore/pkg/cosign"
+	rekorclient "github.com/sigstore/rekor/pkg/client"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+	log "github.com/sirupsen/logrus"
 	ishieldconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/keyless"
+	"github.com/stolostron/integrity-shield/shield/pkg/keystore"
+	"github.com/stolostron/integrity-shield/shield/pkg/notation"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 type ImageVerifyResult struct {
-	Object     unstructured.Unstructured `json:"object"`
+	Object     unstructured.Unstructured `json:"-"`
 	ImageRef   string                    `json:"imageRef"`
+	Digest     string                    `json:"digest,omitempty"`
 	Verified   bool                      `json:"verified"`
 	InScope    bool                      `json:"inScope"`
 	Signer     string                    `json:"signer"`
 	SignedTime *time.Time                `json:"signedTime"`
 	FailReason string                    `json:"failReason"`
+	// the image policy which matched the image and its mode
+	Policy string `json:"policy,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	// set only for keyless signatures
+	KeylessIdentity *ishieldconfig.KeylessIdentityResult `json:"keylessIdentity,omitempty"`
+}
+
+// Denied returns true if the image is in scope and not verified, unless it matched an image policy in the inform mode
+func (r ImageVerifyResult) Denied() bool {
+	return r.InScope && !r.Verified && r.Mode != ishieldconfig.ImagePolicyModeInform
+}
+
+// Message returns the result of the image in a line of admission and observer messages
+func (r ImageVerifyResult) Message() string {
+	image := fmt.Sprintf("`%s`", r.ImageRef)
+	if r.Digest != "" && !strings.HasSuffix(r.ImageRef, r.Digest) {
+		image = fmt.Sprintf("%s (%s)", image, r.Digest)
+	}
+	switch {
+	case !r.InScope:
+		return fmt.Sprintf("%s is not verified", image)
+	case !r.Verified:
+		if r.Policy != "" {
+			return fmt.Sprintf("%s is not verified by the image policy `%s` (%s); %s", image, r.Policy, r.Mode, r.FailReason)
+		}
+		return fmt.Sprintf("%s is not verified; %s", image, r.FailReason)
+	case r.Signer == "":
+		return fmt.Sprintf("%s is verified", image)
+	case r.SignedTime == nil:
+		return fmt.Sprintf("%s is signed by %s", image, r.Signer)
+	default:
+		return fmt.Sprintf("%s is signed by %s at %s", image, r.Signer, r.SignedTime.UTC().Format(time.RFC3339))
+	}
+}
+
+// ResultsMessage joins the messages of the image results
+func ResultsMessage(results []ImageVerifyResult) string {
+	msgs := []string{}
+	for _, r := range results {
+		msgs = append(msgs, r.Message())
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// KeylessIdentities returns the keyless identities of the verified images
+func KeylessIdentities(results []ImageVerifyResult) []ishieldconfig.KeylessIdentityResult {
+	var identities []ishieldconfig.KeylessIdentityResult
+	for _, r := range results {
+		if r.Verified && r.KeylessIdentity != nil {
+			identities = append(identities, *r.KeylessIdentity)
+		}
+	}
+	return identities
 }
 
 type ImageVerifyOption struct {
@@ -49,78 +117,568 @@ type ImageVerifyOption struct {
 
 // verify all images in a container of the specified resource
 func VerifyImageInManifest(resource unstructured.Unstructured, profile ishieldconfig.ImageProfile) (bool, error) {
-	yamlBytes, err := yaml.Marshal(resource.Object)
+	return VerifyImageInManifestWithContext(context.Background(), resource, profile)
+}
+
+// VerifyImageInManifestWithContext is VerifyImageInManifest with a context passed to cosign.
+func VerifyImageInManifestWithContext(ctx context.Context, resource unstructured.Unstructured, profile ishieldconfig.ImageProfile) (bool, error) {
+	verified, _, err := VerifyImageInManifestWithIdentity(ctx, resource, profile)
+	return verified, err
+}
+
+// VerifyImageInManifestWithIdentity also returns the keyless identities of the images
+// if the profile has keylessIdentities or keylessCertificateRoot.
+func VerifyImageInManifestWithIdentity(ctx context.Context, resource unstructured.Unstructured, profile ishieldconfig.ImageProfile) (bool, []ishieldconfig.KeylessIdentityResult, error) {
+	return VerifyImageInManifestWithRevocations(ctx, resource, profile, nil)
+}
+
+// VerifyImageInManifestWithRevocations also rejects images whose keys, signer identities, signatures or digests are revoked.
+// Signer identities and signatures are checked only for keyless signatures which are verified with keylessIdentities or keylessCertificateRoot.
+func VerifyImageInManifestWithRevocations(ctx context.Context, resource unstructured.Unstructured, profile ishieldconfig.ImageProfile, revocations *ishieldconfig.RevocationList) (bool, []ishieldconfig.KeylessIdentityResult, error) {
+	results, err := VerifyImageInManifestWithResults(ctx, resource, profile, revocations)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to yaml.Marshal() the resource")
+		return false, nil, err
 	}
-	tmpDir, err := ioutil.TempDir("", "verify-image")
-	if err != nil {
-		return false, fmt.Errorf("failed to create temp dir: %s", err.Error())
+	for _, r := range results {
+		if r.Denied() {
+			return false, nil, errors.New(r.Message())
+		}
+	}
+	return true, KeylessIdentities(results), nil
+}
+
+// VerifyImageInManifestWithResults verifies the images in the resource one by one and returns the result of each image.
+// If the profile has policies, each image is verified with the first image policy which matches it.
+// Images which match no policy or a policy in the skip mode are not in scope, and failures in the inform mode are only logged.
+// An error is returned only if the images cannot be verified at all, e.g. no image is found or the profile is invalid.
+func VerifyImageInManifestWithResults(ctx context.Context, resource unstructured.Unstructured, profile ishieldconfig.ImageProfile, revocations *ishieldconfig.RevocationList) ([]ImageVerifyResult, error) {
+	images := GetImagesInResource(resource)
+	if len(images) == 0 {
+		return nil, errors.New("no images found in manifest")
+	}
+	if ishieldconfig.IsOfflineMode() {
+		if err := profile.CheckOffline(); err != nil {
+			return nil, errors.Wrap(err, "offline mode")
+		}
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, err
 	}
-	defer os.RemoveAll(tmpDir)
+	// keys and trust policies are loaded once for the images verified with the same policy; nil is the profile itself
+	verifiers := map[*ishieldconfig.ImagePolicy]*imageVerifier{}
+	results := []ImageVerifyResult{}
+	for _, img := range images {
+		result := ImageVerifyResult{Object: resource, ImageRef: img, InScope: true}
+		// revoked images are rejected regardless of image policies
+		if err := checkRevokedImage(ctx, img, revocations); err != nil {
+			result.FailReason = err.Error()
+			results = append(results, result)
+			continue
+		}
+		var policy *ishieldconfig.ImagePolicy
+		target := profile
+		if len(profile.Policies) > 0 {
+			policy = profile.FindPolicy(img)
+			if policy == nil {
+				log.Debugf("the image `%s` matches no image policy", img)
+				result.InScope = false
+				results = append(results, result)
+				continue
+			}
+			result.Policy = policy.Name
+			result.Mode = policy.GetMode()
+			if result.Mode == ishieldconfig.ImagePolicyModeSkip {
+				log.Debugf("the image `%s` is not verified by the %s in the skip mode", img, policy.String())
+				result.InScope = false
+				results = append(results, result)
+				continue
+			}
+			target = policy.Profile()
+		}
+		verifier, ok := verifiers[policy]
+		if !ok {
+			verifier = &imageVerifier{profile: target, revocations: revocations}
+			verifiers[policy] = verifier
+		}
+		if err := verifier.verify(ctx, &result); err != nil {
+			result.FailReason = err.Error()
+			if result.Mode == ishieldconfig.ImagePolicyModeInform {
+				log.Warnf("the image `%s` is allowed by the %s in the inform mode, but it is not verified; %s", img, policy.String(), err.Error())
+			}
+		} else {
+			result.Verified = result.InScope
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// imageVerifier verifies images with the Notation trust policy, the keyless identities or the keys of a profile.
+// The keys and the trust policy are loaded for the first image and used for the other images.
+type imageVerifier struct {
+	profile     ishieldconfig.ImageProfile
+	revocations *ishieldconfig.RevocationList
+	loaded      bool
+	loadErr     error
+	notation    *notation.Verifier
+	keys        []imageKey
+	roots       *keyless.CertificateRoots
+}
+
+// imageKey is a public key and the description of the key config which has it
+type imageKey struct {
+	description string
+	ref         string
+	verifier    signature.Verifier
+}
+
+func (v *imageVerifier) load(ctx context.Context) error {
+	if v.loaded {
+		return v.loadErr
+	}
+	v.loaded = true
+	switch {
+	case v.profile.Notation != nil:
+		v.notation, v.loadErr = loadNotationVerifier(v.profile.Notation, v.revocations)
+	case len(v.profile.KeyConfigs) > 0:
+		v.keys, v.loadErr = loadImageKeys(ctx, v.profile.KeyConfigs, v.revocations)
+	default:
+		// images are verified as keyless signatures with Fulcio roots if no key or certificate root is set
+		v.roots, v.loadErr = keyless.LoadCertificateRoots(v.profile.KeylessCertificateRoot)
+	}
+	return v.loadErr
+}
 
-	manifestPath := filepath.Join(tmpDir, "manifest.yaml")
-	err = ioutil.WriteFile(manifestPath, yamlBytes, 0644)
+// verify verifies the signature of the image and sets the digest, the signer and the signed time to the result
+func (v *imageVerifier) verify(ctx context.Context, result *ImageVerifyResult) error {
+	if err := v.load(ctx); err != nil {
+		return err
+	}
+	switch {
+	case v.notation != nil:
+		return v.verifyNotation(ctx, result)
+	case len(v.keys) > 0:
+		return v.verifyWithKeys(ctx, result)
+	default:
+		return v.verifyKeyless(ctx, result)
+	}
+}
+
+// verifyNotation verifies Notation signatures of the image with the trust policy and the trust stores in the secret of the profile
+func (v *imageVerifier) verifyNotation(ctx context.Context, result *ImageVerifyResult) error {
+	res, err := v.notation.Verify(ctx, result.ImageRef)
 	if err != nil {
-		return false, fmt.Errorf("failed to create temp manifest file: %s", err.Error())
+		return err
+	}
+	// the image is not in scope of a trust policy with the level `skip`, and it is not reported as verified
+	if res.Skipped {
+		log.Debugf("the signature of the image `%s` is not verified by the trust policy `%s`", result.ImageRef, res.Policy)
+		result.InScope = false
+		return nil
 	}
+	result.Digest = res.Digest
+	result.Signer = res.Signer
+	result.SignedTime = res.SignedTime
+	return nil
+}
 
-	keyPathList := []string{}
-	if len(profile.KeyConfigs) != 0 {
-		for _, keyconfig := range profile.KeyConfigs {
-			if keyconfig.Secret.Namespace != "" && keyconfig.Secret.Name != "" {
-				if keyconfig.Secret.Mount {
-					keyPath, err := keyconfig.LoadKeySecret()
-					if err != nil {
-						return false, fmt.Errorf("Failed to load key secret: %s", err.Error())
-					}
-					keyPathList = append(keyPathList, keyPath)
-				} else {
-					keyRef := keyconfig.ConvertToCosignKeyRef()
-					keyPathList = append(keyPathList, keyRef)
-				}
+// verifyWithKeys verifies cosign signatures of the image with the keys in order, and the description of the first key which verifies it is the signer
+func (v *imageVerifier) verifyWithKeys(ctx context.Context, result *ImageVerifyResult) error {
+	ref, err := name.ParseReference(result.ImageRef)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to parse image ref `%s`", result.ImageRef))
+	}
+	baseOpts, err := newCheckOpts(ctx, cosign.SimpleClaimVerifier)
+	if err != nil {
+		return err
+	}
+	errMsgs := []string{}
+	for _, key := range v.keys {
+		co := *baseOpts
+		co.SigVerifier = key.verifier
+		checkedSigs, _, err := cosign.VerifyImageSignatures(ctx, ref, &co)
+		if err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("%s: %s", key.description, err.Error()))
+			continue
+		}
+		for _, sig := range checkedSigs {
+			if err := checkOfflineBundle(ctx, sig); err != nil {
+				errMsgs = append(errMsgs, fmt.Sprintf("%s: %s", key.description, err.Error()))
+				continue
 			}
-			if keyconfig.Key.PEM != "" && keyconfig.Key.Name != "" {
-				keyPath, err := keyconfig.ConvertToLocalFilePath(tmpDir)
-				if err != nil {
-					return false, fmt.Errorf("Failed to get local file path: %s", err.Error())
-				}
-				keyPathList = append(keyPathList, keyPath)
+			setSignatureDetails(ctx, result, sig)
+			result.Signer = key.description
+			return nil
+		}
+	}
+	return fmt.Errorf("no signature of the image `%s` is verified with the keys; %s", result.ImageRef, strings.Join(errMsgs, "; "))
+}
+
+// verifyKeyless verifies keyless signatures of the image with the certificate roots and the identities of the profile
+func (v *imageVerifier) verifyKeyless(ctx context.Context, result *ImageVerifyResult) error {
+	identity, sig, err := verifyKeylessIdentityInImage(ctx, result.ImageRef, v.roots, v.profile.KeylessIdentities, v.revocations)
+	if err != nil {
+		return err
+	}
+	identity.Image = result.ImageRef
+	setSignatureDetails(ctx, result, sig)
+	result.Signer = identity.Subject
+	result.KeylessIdentity = identity
+	return nil
+}
+
+// loadNotationVerifier loads the trust policy of the Notation verifier, which rejects revoked signatures
+func loadNotationVerifier(c *ishieldconfig.NotationVerifier, revocations *ishieldconfig.RevocationList) (*notation.Verifier, error) {
+	verifier, err := keystore.Default().GetNotationVerifier(c)
+	if err != nil {
+		return nil, err
+	}
+	verifier.Reject = func(result *notation.Result) error {
+		if entry := checkRevokedNotationSignature(result, revocations); entry != nil {
+			return errors.New(entry.String())
+		}
+		return nil
+	}
+	return verifier, nil
+}
+
+// loadImageKeys loads the public keys in the key configs except revoked ones
+func loadImageKeys(ctx context.Context, keyConfigs []ishieldconfig.KeyConfig, revocations *ishieldconfig.RevocationList) ([]imageKey, error) {
+	keyConfigs, err := keystore.Default().ResolveVerificationKeys(keyConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load keys: %s", err.Error())
+	}
+	keys := []imageKey{}
+	for _, keyConfig := range keyConfigs {
+		keyRefs, err := keystore.Default().GetKeyRefs([]ishieldconfig.KeyConfig{keyConfig})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load keys: %s", err.Error())
+		}
+		for _, keyRef := range keyRefs {
+			keys = append(keys, imageKey{description: keyConfig.Description(), ref: keyRef})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no key is available for image verification")
+	}
+	for i := range keys {
+		keys[i].verifier, err = sigs.PublicKeyFromKeyRef(ctx, keys[i].ref)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to load the public key in the %s", keys[i].description))
+		}
+	}
+	return removeRevokedKeys(keys, revocations)
+}
+
+// setSignatureDetails sets the image digest in the payload of the cosign signature,
+// and the time when the signature was integrated into the transparency log if it has a verified bundle
+func setSignatureDetails(ctx context.Context, result *ImageVerifyResult, sig oci.Signature) {
+	if p, err := sig.Payload(); err == nil {
+		var sci payload.SimpleContainerImage
+		if err := json.Unmarshal(p, &sci); err == nil {
+			result.Digest = sci.Critical.Image.DockerManifestDigest
+		}
+	}
+	if verified, err := cosign.VerifyBundle(ctx, sig, nil); err != nil || !verified {
+		return
+	}
+	if b, err := sig.Bundle(); err == nil && b != nil {
+		signedTime := time.Unix(b.Payload.IntegratedTime, 0).UTC()
+		result.SignedTime = &signedTime
+	}
+}
+
+// newCheckOpts returns cosign options to verify signatures in registries with the claim verifier.
+// Online, a signature without a bundle is looked up in the transparency log at REKOR_SERVER.
+// Offline, the log is not accessed, and the signatures must be checked with checkOfflineBundle instead.
+func newCheckOpts(ctx context.Context, claimVerifier func(oci.Signature, v1.Hash, map[string]interface{}) error) (*cosign.CheckOpts, error) {
+	regClientOpts, err := registryClientOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	co := &cosign.CheckOpts{
+		ClaimVerifier:      claimVerifier,
+		RegistryClientOpts: regClientOpts,
+	}
+	if !ishieldconfig.IsOfflineMode() {
+		co.RekorClient, err = rekorclient.GetRekorClient(k8scosign.GetRekorServerURL())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create a transparency log client")
+		}
+	}
+	return co, nil
+}
+
+// checkOfflineBundle returns an error in the offline mode if the signature has no bundle which is verified with the pinned log key,
+// because the transparency log cannot be searched for the signature offline
+func checkOfflineBundle(ctx context.Context, sig oci.Signature) error {
+	if !ishieldconfig.IsOfflineMode() {
+		return nil
+	}
+	verified, err := cosign.VerifyBundle(ctx, sig, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify the transparency log bundle of the signature")
+	}
+	if !verified {
+		return errors.New("the signature has no transparency log bundle, which is required in the offline mode")
+	}
+	return nil
+}
+
+func registryClientOpts(ctx context.Context) ([]ociremote.Option, error) {
+	regOpt := &options.RegistryOptions{}
+	regClientOpts, err := regOpt.ClientOpts(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get registry client option")
+	}
+	return regClientOpts, nil
+}
+
+// VerifyKeylessIdentityInImage verifies keyless signatures of the image and returns the identity of the first signature
+// whose certificate is issued by the roots and matches one of the identities.
+func VerifyKeylessIdentityInImage(ctx context.Context, imageRef string, roots *keyless.CertificateRoots, identities ishieldconfig.KeylessIdentityList) (*ishieldconfig.KeylessIdentityResult, error) {
+	identity, _, err := verifyKeylessIdentityInImage(ctx, imageRef, roots, identities, nil)
+	return identity, err
+}
+
+// verifyKeylessIdentityInImage also returns the signature which is accepted
+func verifyKeylessIdentityInImage(ctx context.Context, imageRef string, roots *keyless.CertificateRoots, identities ishieldconfig.KeylessIdentityList, revocations *ishieldconfig.RevocationList) (*ishieldconfig.KeylessIdentityResult, oci.Signature, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to parse image ref `%s`", imageRef))
+	}
+	co, err := newCheckOpts(ctx, cosign.SimpleClaimVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	co.RootCerts = roots.Roots
+	co.IntermediateCerts = roots.Intermediates
+	checkedSigs, _, err := cosign.VerifyImageSignatures(ctx, ref, co)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to verify the signature of the image `%s`", imageRef))
+	}
+	errMsgs := []string{}
+	for _, sig := range checkedSigs {
+		cert, err := sig.Cert()
+		if err != nil || cert == nil {
+			continue
+		}
+		identity, err := roots.VerifyIdentity(cert, identities)
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		if entry := checkRevokedSignature(sig, identity, revocations); entry != nil {
+			errMsgs = append(errMsgs, entry.String())
+			continue
+		}
+		if err := checkOfflineBundle(ctx, sig); err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		return identity, sig, nil
+	}
+	if len(errMsgs) == 0 {
+		return nil, nil, fmt.Errorf("no keyless signature is found in the image `%s`", imageRef)
+	}
+	return nil, nil, fmt.Errorf("no signature of the image `%s` is accepted; %s", imageRef, strings.Join(errMsgs, "; "))
+}
+
+// checkRevokedSignature returns the entry which revokes the signer, the signature or the key in the certificate of the keyless signature
+func checkRevokedSignature(sig oci.Signature, identity *ishieldconfig.KeylessIdentityResult, revocations *ishieldconfig.RevocationList) *ishieldconfig.RevocationEntry {
+	if revocations.Empty() {
+		return nil
+	}
+	if entry := revocations.CheckSigner(identity.Subject); entry != nil {
+		return entry
+	}
+	if b64sig, err := sig.Base64Signature(); err == nil {
+		if decoded, err := base64.StdEncoding.DecodeString(b64sig); err == nil {
+			if entry := revocations.CheckSignature(decoded); entry != nil {
+				return entry
 			}
 		}
 	}
-	if len(keyPathList) == 0 {
-		keyPathList = []string{""} // for keyless verification
+	if cert, err := sig.Cert(); err == nil && cert != nil {
+		return revocations.CheckKey(cert.PublicKey)
 	}
+	return nil
+}
 
-	allImagesVerified := false
-	failReason := ""
-	// overallFailReason := ""
-	for _, keyPath := range keyPathList {
-		cmd := manifest.VerifyManifestCommand{VerifyCommand: verify.VerifyCommand{}}
-		if keyPath != "" {
-			cmd.KeyRef = keyPath
+// checkRevokedNotationSignature returns the entry which revokes the signer, the signature or the key in the signing certificate of the Notation signature
+func checkRevokedNotationSignature(result *notation.Result, revocations *ishieldconfig.RevocationList) *ishieldconfig.RevocationEntry {
+	if revocations.Empty() || result.Certificate == nil {
+		return nil
+	}
+	signers := append([]string{result.Signer, result.Certificate.Subject.CommonName}, result.Certificate.EmailAddresses...)
+	for _, signer := range signers {
+		if entry := revocations.CheckSigner(signer); entry != nil {
+			return entry
 		}
+	}
+	if entry := revocations.CheckSignature(result.Signature); entry != nil {
+		return entry
+	}
+	return revocations.CheckKey(result.Certificate.PublicKey)
+}
 
-		var verifiedWithThisKey bool
-		// currently cosigncli.VerifyManifestCommand.Exec() does not return detail information like image names and their signer names
-		// TODO: create an issue in sigstore/cosign for this function to return some additional information
-		iErr := cmd.Exec(context.Background(), []string{manifestPath})
-		if iErr == nil {
-			verifiedWithThisKey = true
-		} else {
-			failReason = iErr.Error()
+// removeRevokedKeys returns the keys whose public keys are not revoked.
+// An error is returned if all keys are revoked, so the images are not verified as keyless signatures instead.
+func removeRevokedKeys(keys []imageKey, revocations *ishieldconfig.RevocationList) ([]imageKey, error) {
+	if revocations.Empty() || len(keys) == 0 {
+		return keys, nil
+	}
+	validKeys := []imageKey{}
+	reasons := []string{}
+	for _, key := range keys {
+		pub, err := key.verifier.PublicKey()
+		if err == nil {
+			if entry := revocations.CheckKey(pub); entry != nil {
+				log.Infof("the key in the %s is not used for image verification; %s", key.description, entry.String())
+				reasons = append(reasons, entry.String())
+				continue
+			}
+		}
+		validKeys = append(validKeys, key)
+	}
+	if len(validKeys) == 0 {
+		return nil, fmt.Errorf("no key is available for image verification; %s", strings.Join(reasons, "; "))
+	}
+	return validKeys, nil
+}
+
+// checkRevokedImage returns an error if the digest of the image is revoked.
+// Images without a digest in the reference are resolved in the registry.
+func checkRevokedImage(ctx context.Context, img string, revocations *ishieldconfig.RevocationList) error {
+	entry, err := findRevokedImage(ctx, img, revocations)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		return fmt.Errorf("the image `%s` is not accepted; %s", img, entry.String())
+	}
+	return nil
+}
+
+func findRevokedImage(ctx context.Context, img string, revocations *ishieldconfig.RevocationList) (*ishieldconfig.RevocationEntry, error) {
+	if !revocations.HasManifestDigests() {
+		return nil, nil
+	}
+	regClientOpts, err := registryClientOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := name.ParseReference(img)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse image ref `%s`", img))
+	}
+	digest, ok := ref.(name.Digest)
+	if !ok {
+		digest, err = ociremote.ResolveDigest(ref, regClientOpts...)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to resolve the digest of the image `%s`", img))
 		}
-		if verifiedWithThisKey {
-			allImagesVerified = true
-			break
+	}
+	return revocations.CheckManifestDigest(digest.DigestStr()), nil
+}
+
+// FindRevocationInImage returns the first entry which revokes the digest of the image, one of its cosign signatures,
+// or the key or the certificate which made the signature. A signature without a certificate is checked with the keys
+// which verify it, so the keys of the rule must be given to find a revoked key.
+func FindRevocationInImage(ctx context.Context, imageRef string, keys []crypto.PublicKey, revocations *ishieldconfig.RevocationList) (*ishieldconfig.RevocationEntry, error) {
+	if revocations.Empty() {
+		return nil, nil
+	}
+	entry, err := findRevokedImage(ctx, imageRef, revocations)
+	if err != nil || entry != nil {
+		return entry, err
+	}
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse image ref `%s`", imageRef))
+	}
+	regClientOpts, err := registryClientOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	se, err := ociremote.SignedEntity(ref, regClientOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get the image `%s`", imageRef))
+	}
+	sigs, err := se.Signatures()
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get the signatures of the image `%s`", imageRef))
+	}
+	sigList, err := sigs.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get the signatures of the image `%s`", imageRef))
+	}
+	for _, sig := range sigList {
+		if entry := findRevocationInImageSignature(sig, keys, revocations); entry != nil {
+			return entry, nil
 		}
 	}
+	return nil, nil
+}
 
-	var retErr error
-	if !allImagesVerified {
-		retErr = errors.New(failReason)
+// findRevocationInImageSignature checks the key only if the signature is made with it, as signature sets in annotations are checked
+func findRevocationInImageSignature(sig oci.Signature, keys []crypto.PublicKey, revocations *ishieldconfig.RevocationList) *ishieldconfig.RevocationEntry {
+	b64sig, err := sig.Base64Signature()
+	if err != nil {
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(b64sig)
+	if err != nil {
+		return nil
+	}
+	if entry := revocations.CheckSignature(decoded); entry != nil {
+		return entry
+	}
+	p, err := sig.Payload()
+	if err != nil {
+		return nil
+	}
+	if cert, err := sig.Cert(); err == nil && cert != nil {
+		keys = []crypto.PublicKey{cert.PublicKey}
 	}
+	for _, pub := range keys {
+		verifier, err := signature.LoadVerifier(pub, crypto.SHA256)
+		if err != nil || verifier.VerifySignature(bytes.NewReader(decoded), bytes.NewReader(p)) != nil {
+			continue
+		}
+		if entry := revocations.CheckKey(pub); entry != nil {
+			return entry
+		}
+	}
+	return nil
+}
 
-	return allImagesVerified, retErr
+// GetImagesInResource returns images of init containers and containers in the resource.
+// Pod, workloads with a pod template (e.g. Deployment, Job) and CronJob are supported.
+func GetImagesInResource(resource unstructured.Unstructured) []string {
+	images := []string{}
+	podSpecPaths := [][]string{
+		{"spec"},
+		{"spec", "template", "spec"},
+		{"spec", "jobTemplate", "spec", "template", "spec"},
+	}
+	for _, podSpecPath := range podSpecPaths {
+		for _, containersField := range []string{"initContainers", "containers"} {
+			fields := append(append([]string{}, podSpecPath...), containersField)
+			containers, found, err := unstructured.NestedSlice(resource.Object, fields...)
+			if err != nil || !found {
+				continue
+			}
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if image, ok := container["image"].(string); ok && image != "" {
+					images = append(images, image)
+				}
+			}
+		}
+	}
+	return images
 }
@@ -0,0 +1,309 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	cbundle "github.com/sigstore/cosign/pkg/cosign/bundle"
+	"github.com/sigstore/cosign/pkg/oci/mutate"
+	ociremote "github.com/sigstore/cosign/pkg/oci/remote"
+	"github.com/sigstore/cosign/pkg/oci/static"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+	ishieldconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/notation"
+)
+
+// pushTestImage pushes a random image to a registry on the local host and returns the reference with the digest
+func pushTestImage(t *testing.T) string {
+	server := httptest.NewServer(registry.New(registry.Logger(stdlog.New(ioutil.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	tag, err := name.ParseReference(fmt.Sprintf("%s/sample-image:0.1.0", strings.TrimPrefix(server.URL, "http://")))
+	if err != nil {
+		t.Fatalf("failed to parse the image ref: %s", err.Error())
+	}
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("failed to create an image: %s", err.Error())
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatalf("failed to push the image: %s", err.Error())
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("failed to get the digest: %s", err.Error())
+	}
+	return tag.Context().Digest(digest.String()).String()
+}
+
+// testLog is a local stand-in of a transparency log which issues cosign bundles
+type testLog struct {
+	priv  *ecdsa.PrivateKey
+	logID string
+	// file of the PEM public key, which is pinned with SIGSTORE_REKOR_PUBLIC_KEY
+	keyFile string
+}
+
+func newTestLog(t *testing.T) *testLog {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate a log key: %s", err.Error())
+	}
+	der, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal the log key: %s", err.Error())
+	}
+	keyFile := filepath.Join(t.TempDir(), "rekor.pub")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write the log key: %s", err.Error())
+	}
+	sum := sha256.Sum256(der)
+	return &testLog{priv: priv, logID: hex.EncodeToString(sum[:]), keyFile: keyFile}
+}
+
+// bundle returns a bundle of a `hashedrekord` entry of the signature, which is integrated at the time
+func (l *testLog) bundle(t *testing.T, sig, message []byte, signer signature.Signer, integratedTime time.Time) *cbundle.RekorBundle {
+	pub, _ := signer.PublicKey()
+	pubPEM, err := cryptoutils.MarshalPublicKeyToPEM(pub)
+	if err != nil {
+		t.Fatalf("failed to marshal the signer key: %s", err.Error())
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"signature": map[string]interface{}{
+				"content":   base64.StdEncoding.EncodeToString(sig),
+				"publicKey": map[string]interface{}{"content": base64.StdEncoding.EncodeToString(pubPEM)},
+			},
+			"data": map[string]interface{}{
+				"hash": map[string]interface{}{"algorithm": "sha256", "value": strings.TrimPrefix(sha256Digest(message), "sha256:")},
+			},
+		},
+	})
+	p := cbundle.RekorPayload{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: integratedTime.Unix(),
+		LogIndex:       1,
+		LogID:          l.logID,
+	}
+	contents, _ := json.Marshal(p)
+	canonicalized, err := jsoncanonicalizer.Transform(contents)
+	if err != nil {
+		t.Fatalf("failed to canonicalize the bundle payload: %s", err.Error())
+	}
+	hash := sha256.Sum256(canonicalized)
+	set, err := ecdsa.SignASN1(rand.Reader, l.priv, hash[:])
+	if err != nil {
+		t.Fatalf("failed to sign the bundle payload: %s", err.Error())
+	}
+	return &cbundle.RekorBundle{SignedEntryTimestamp: set, Payload: p}
+}
+
+// setTestEnv sets the environment variable during the test
+func setTestEnv(t *testing.T, key, value string) {
+	orig, found := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if found {
+			os.Setenv(key, orig)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+	os.Setenv(key, value)
+}
+
+// signTestImage attaches a cosign signature of the image made with the signer, and returns the decoded signature.
+// The signature has a bundle of the log if it is given.
+func signTestImage(t *testing.T, imageRef string, signer signature.Signer, log *testLog) []byte {
+	ref, err := name.NewDigest(imageRef)
+	if err != nil {
+		t.Fatalf("failed to parse the image ref: %s", err.Error())
+	}
+	p, err := (&payload.Cosign{Image: ref}).MarshalJSON()
+	if err != nil {
+		t.Fatalf("failed to marshal the payload: %s", err.Error())
+	}
+	sig, err := signer.SignMessage(bytes.NewReader(p))
+	if err != nil {
+		t.Fatalf("failed to sign the image: %s", err.Error())
+	}
+	opts := []static.Option{}
+	if log != nil {
+		opts = append(opts, static.WithBundle(log.bundle(t, sig, p, signer, time.Now().Add(-time.Minute))))
+	}
+	ociSig, err := static.NewSignature(p, base64.StdEncoding.EncodeToString(sig), opts...)
+	if err != nil {
+		t.Fatalf("failed to create the signature: %s", err.Error())
+	}
+	se, err := ociremote.SignedEntity(ref)
+	if err != nil {
+		t.Fatalf("failed to get the image: %s", err.Error())
+	}
+	se, err = mutate.AttachSignatureToEntity(se, ociSig)
+	if err != nil {
+		t.Fatalf("failed to attach the signature: %s", err.Error())
+	}
+	if err := ociremote.WriteSignatures(ref.Context(), se); err != nil {
+		t.Fatalf("failed to push the signature: %s", err.Error())
+	}
+	return sig
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestFindRevocationInImage(t *testing.T) {
+	ctx := context.Background()
+	signer, _ := newTestKey(t, "signer key")
+	other, _ := newTestKey(t, "other key")
+	signerPub, _ := signer.PublicKey()
+	otherPub, _ := other.PublicKey()
+	signerFingerprint, _ := ishieldconfig.KeyFingerprint(signerPub)
+	otherFingerprint, _ := ishieldconfig.KeyFingerprint(otherPub)
+
+	imageRef := pushTestImage(t)
+	sig := signTestImage(t, imageRef, signer, nil)
+	digest, _ := name.NewDigest(imageRef)
+
+	cases := []struct {
+		name    string
+		entry   ishieldconfig.RevocationEntry
+		revoked bool
+	}{
+		{"revoked key", ishieldconfig.RevocationEntry{KeyFingerprint: signerFingerprint}, true},
+		{"revoked signature", ishieldconfig.RevocationEntry{SignatureDigest: sha256Digest(sig)}, true},
+		{"revoked image", ishieldconfig.RevocationEntry{ManifestDigest: digest.DigestStr()}, true},
+		{"key which did not make the signature", ishieldconfig.RevocationEntry{KeyFingerprint: otherFingerprint}, false},
+		{"other signer", ishieldconfig.RevocationEntry{Signer: "other@example.com"}, false},
+	}
+	for _, c := range cases {
+		revocations := &ishieldconfig.RevocationList{Entries: []ishieldconfig.RevocationEntry{c.entry}}
+		entry, err := FindRevocationInImage(ctx, imageRef, []crypto.PublicKey{otherPub, signerPub}, revocations)
+		if err != nil {
+			t.Errorf("%s: failed to check the revocation list: %s", c.name, err.Error())
+			return
+		}
+		if c.revoked && entry == nil {
+			t.Errorf("%s should be found", c.name)
+			return
+		} else if !c.revoked && entry != nil {
+			t.Errorf("%s should not be found: %s", c.name, entry.String())
+			return
+		}
+	}
+}
+
+func TestVerifyImageWithKeys(t *testing.T) {
+	signer, key := newTestKey(t, "sample key")
+	imageRef := pushTestImage(t)
+	signTestImage(t, imageRef, signer, nil)
+	verify := func() (ImageVerifyResult, error) {
+		v := &imageVerifier{loaded: true, keys: []imageKey{key}}
+		result := ImageVerifyResult{ImageRef: imageRef, InScope: true}
+		err := v.verify(context.Background(), &result)
+		return result, err
+	}
+
+	// online, the signature without a bundle is looked up in the transparency log at REKOR_SERVER
+	searched := false
+	rekor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searched = searched || r.URL.Path == "/api/v1/log/entries/retrieve"
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer rekor.Close()
+	setTestEnv(t, "REKOR_SERVER", rekor.URL)
+	if _, err := verify(); err == nil || !searched {
+		t.Errorf("the signature which is not in the transparency log should be rejected: searched %v, %v", searched, err)
+		return
+	}
+
+	// offline, the log is not accessed and a bundle verified with the pinned log key is required
+	log := newTestLog(t)
+	setTestEnv(t, ishieldconfig.OfflineModeEnvKey, "true")
+	setTestEnv(t, ishieldconfig.RekorPublicKeyFileEnvKey, log.keyFile)
+	searched = false
+	if _, err := verify(); err == nil || searched || !strings.Contains(err.Error(), "no transparency log bundle") {
+		t.Errorf("the signature without a bundle should be rejected offline: searched %v, %v", searched, err)
+		return
+	}
+	signTestImage(t, imageRef, signer, newTestLog(t))
+	if _, err := verify(); err == nil {
+		t.Errorf("the signature with a bundle of an untrusted log should be rejected offline")
+		return
+	}
+	signTestImage(t, imageRef, signer, log)
+	result, err := verify()
+	if err != nil {
+		t.Errorf("the signature with a verified bundle should be accepted offline: %s", err.Error())
+		return
+	}
+	if result.Signer != "sample key" || result.SignedTime == nil || !strings.HasSuffix(imageRef, result.Digest) || searched {
+		t.Errorf("unexpected result: %+v", result)
+		return
+	}
+}
+
+func TestVerifyNotationSkipped(t *testing.T) {
+	policy := `{"version": "1.0", "trustPolicies": [{"name": "others", "registryScopes": ["*"], "signatureVerification": {"level": "skip"}}]}`
+	nv, err := notation.NewVerifier(map[string][]byte{notation.TrustPolicyKey: []byte(policy)})
+	if err != nil {
+		t.Errorf("failed to load the trust policy: %s", err.Error())
+		return
+	}
+	v := &imageVerifier{loaded: true, notation: nv}
+	result := ImageVerifyResult{ImageRef: "registry.example.com/sample-image:0.1.0", InScope: true}
+	if err = v.verify(context.Background(), &result); err != nil {
+		t.Errorf("the image should be skipped without an error: %s", err.Error())
+		return
+	}
+	if result.InScope || result.Denied() || result.Message() != "`registry.example.com/sample-image:0.1.0` is not verified" {
+		t.Errorf("the image skipped by the trust policy should not be in scope: %+v, %s", result, result.Message())
+		return
+	}
+}
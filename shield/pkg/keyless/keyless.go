@@ -0,0 +1,173 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keyless
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sigstore/cosign/cmd/cosign/cli/fulcio"
+	"github.com/sigstore/sigstore/pkg/signature"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+var (
+	// OIDC issuer in certificates issued by Fulcio
+	issuerOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	// OIDC issuer as a DER encoded string in certificates issued by newer Fulcio
+	issuerV2OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// CertificateRoots are certificates to verify the certificate of a keyless signature
+type CertificateRoots struct {
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+}
+
+// LoadCertificateRoots returns the root and intermediate certificates in the PEM data.
+// If the data is empty, Fulcio roots are returned, which can be overridden by SIGSTORE_ROOT_FILE.
+func LoadCertificateRoots(rootPEM string) (*CertificateRoots, error) {
+	if rootPEM == "" {
+		roots, err := fulcio.GetRoots()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get Fulcio roots")
+		}
+		intermediates, err := fulcio.GetIntermediates()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get Fulcio intermediates")
+		}
+		return &CertificateRoots{Roots: roots, Intermediates: intermediates}, nil
+	}
+	certs, err := parseCertificates([]byte(rootPEM))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse keylessCertificateRoot")
+	}
+	r := &CertificateRoots{Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool()}
+	for _, cert := range certs {
+		// self-signed certificates are roots and the others are intermediates
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			r.Roots.AddCert(cert)
+		} else {
+			r.Intermediates.AddCert(cert)
+		}
+	}
+	return r, nil
+}
+
+// VerifyIdentity verifies the certificate with the roots and returns the identity in the certificate.
+// If identities are given, one of them must match the identity.
+func (r *CertificateRoots) VerifyIdentity(cert *x509.Certificate, identities config.KeylessIdentityList) (*config.KeylessIdentityResult, error) {
+	_, err := cert.Verify(x509.VerifyOptions{
+		// the certificate is short-lived, so it is checked at the time when it was issued.
+		// the signed time is checked with the transparency log.
+		CurrentTime:   cert.NotBefore,
+		Roots:         r.Roots,
+		Intermediates: r.Intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "the certificate is not issued by the trusted roots")
+	}
+	issuer := GetIssuer(cert)
+	subjects := GetSubjects(cert)
+	if len(identities) == 0 {
+		result := &config.KeylessIdentityResult{Issuer: issuer}
+		if len(subjects) > 0 {
+			result.Subject = subjects[0]
+		}
+		return result, nil
+	}
+	result := identities.Match(issuer, subjects)
+	if result == nil {
+		return nil, fmt.Errorf("the certificate identity %v (issuer: %s) does not match any keyless identity; expected: %s", subjects, issuer, identities.String())
+	}
+	return result, nil
+}
+
+// VerifySignature verifies the signature of the message with the public key in the certificate
+func VerifySignature(cert *x509.Certificate, message, sig []byte) error {
+	verifier, err := signature.LoadVerifier(cert.PublicKey, crypto.SHA256)
+	if err != nil {
+		return errors.Wrap(err, "failed to load the public key in the certificate")
+	}
+	return verifier.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message))
+}
+
+// GetIssuer returns the OIDC issuer in the certificate
+func GetIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(issuerV2OID) {
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		}
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(issuerOID) {
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// GetSubjects returns emails and URIs in the subject alternative names of the certificate
+func GetSubjects(cert *x509.Certificate) []string {
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	return subjects
+}
+
+// ParseCertificate parses the first PEM encoded certificate
+func ParseCertificate(pemBytes []byte) (*x509.Certificate, error) {
+	certs, err := parseCertificates(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+func parseCertificates(pemBytes []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	rest := pemBytes
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate is found in the PEM data")
+	}
+	return certs, nil
+}
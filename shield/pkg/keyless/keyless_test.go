@@ -0,0 +1,168 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keyless
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+// localCA stands in for Fulcio
+type localCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newLocalCA(t *testing.T) *localCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate a key: %s", err.Error())
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "local-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create a CA certificate: %s", err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &localCA{cert: cert, key: key}
+}
+
+func (ca *localCA) rootPEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+}
+
+func (ca *localCA) issue(t *testing.T, issuer, email, uri string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate a key: %s", err.Error())
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{Id: issuerOID, Value: []byte(issuer)}},
+	}
+	if email != "" {
+		tmpl.EmailAddresses = []string{email}
+	}
+	if uri != "" {
+		u, _ := url.Parse(uri)
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create a certificate: %s", err.Error())
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	cert, err := ParseCertificate(pemBytes)
+	if err != nil {
+		t.Fatalf("failed to parse the certificate: %s", err.Error())
+	}
+	return cert, key
+}
+
+func TestVerifyIdentity(t *testing.T) {
+	ca := newLocalCA(t)
+	roots, err := LoadCertificateRoots(ca.rootPEM())
+	if err != nil {
+		t.Errorf("failed to load the local CA: %s", err.Error())
+		return
+	}
+
+	githubIssuer := "https://token.actions.githubusercontent.com"
+	workflow := "https://github.com/sample-org/sample-repo/.github/workflows/release.yaml@refs/heads/main"
+	cert, key := ca.issue(t, githubIssuer, "", workflow)
+
+	identities := config.KeylessIdentityList{
+		{Issuer: "https://accounts.google.com", Subject: "signer@example.com"},
+		{Issuer: githubIssuer, SubjectRegExp: `https://github\.com/sample-org/.*`},
+	}
+	result, err := roots.VerifyIdentity(cert, identities)
+	if err != nil {
+		t.Errorf("the certificate should match the workflow identity: %s", err.Error())
+		return
+	}
+	if result.Issuer != githubIssuer || result.Subject != workflow {
+		t.Errorf("unexpected matched identity: %v", result)
+		return
+	}
+
+	// the subject must match as a whole
+	partial := config.KeylessIdentityList{{Issuer: githubIssuer, SubjectRegExp: `sample-org`}}
+	if _, err = roots.VerifyIdentity(cert, partial); err == nil {
+		t.Errorf("a partial match of the subject should not be accepted")
+		return
+	}
+
+	// the same subject from another issuer
+	otherIssuer, _ := ca.issue(t, "https://evil.example.com", "", workflow)
+	if _, err = roots.VerifyIdentity(otherIssuer, identities); err == nil {
+		t.Errorf("a certificate from another issuer should not be accepted")
+		return
+	}
+
+	// a certificate by another CA
+	otherCA := newLocalCA(t)
+	untrusted, _ := otherCA.issue(t, githubIssuer, "", workflow)
+	if _, err = roots.VerifyIdentity(untrusted, identities); err == nil {
+		t.Errorf("a certificate by an untrusted CA should not be accepted")
+		return
+	}
+
+	message := []byte("sample message")
+	digest := sha256.Sum256(message)
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Errorf("failed to sign the message: %s", err.Error())
+		return
+	}
+	if err = VerifySignature(cert, message, sig); err != nil {
+		t.Errorf("the signature should be verified with the certificate: %s", err.Error())
+		return
+	}
+	if err = VerifySignature(untrusted, message, sig); err == nil {
+		t.Errorf("the signature should not be verified with another certificate")
+		return
+	}
+
+	if err = (config.KeylessIdentityList{{Issuer: githubIssuer}}).Validate(); err == nil {
+		t.Errorf("an identity without subject should be rejected")
+		return
+	}
+}
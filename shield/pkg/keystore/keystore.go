@@ -0,0 +1,519 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	kubeutil "github.com/stolostron/integrity-shield/shield/pkg/kubernetes"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// key types
+const (
+	KeyTypeCosign = "cosign"
+	KeyTypePGP    = "pgp"
+	KeyTypeX509   = "x509"
+)
+
+const (
+	defaultPodNamespace = "integrity-shield-operator-system"
+	keyEnvVarPrefix     = "ISHIELD_KEY_"
+	pgpPublicKeyArmor   = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	secretSyncInterval  = 100 * time.Millisecond
+	secretSyncTimeout   = 10 * time.Second
+	// a key which is no longer referred is kept for this period,
+	// so that verification in progress can still read it
+	keyReleaseGracePeriod = 5 * time.Minute
+)
+
+// Key is a public key held in memory.
+// Ref is an `env://` reference which can be used as KeyPath of k8s-manifest-sigstore and KeyRef of cosign.
+type Key struct {
+	Name string
+	Type string
+	Ref  string
+}
+
+// KeyStore watches Secrets referenced by KeyConfigs and holds their public keys in memory.
+// Keys are passed to verification as environment variables of this process,
+// so they are never written to the filesystem.
+// An environment variable is named by the digest of the key and is counted by the Secrets,
+// KMS keys and inline keys which refer to it. When nothing refers to it, it is removed after
+// keyReleaseGracePeriod, because a verification running in another goroutine may still read it.
+// Inline keys which are not used for keyReleaseGracePeriod are released.
+type KeyStore struct {
+	mu               sync.Mutex
+	newClient        func() (kubeclient.Interface, error)
+	client           kubeclient.Interface
+	newDynamicClient func() (dynamic.Interface, error)
+	dynamicClient    dynamic.Interface
+	// Secrets are watched only in this namespace, so that Integrity Shield does not need to read Secrets in the cluster.
+	// If empty, Secrets in any namespace are watched.
+	secretNamespace string
+	secrets         map[string]*secretWatch
+	// ConfigMaps with CRLs of x509 keys
+	configMaps map[string]*configMapWatch
+	inline     map[string]*inlineKey
+	// public keys fetched from KMS providers
+	kms map[string]*kmsKey
+	// cluster-scoped VerificationKeys
+	verificationKeys *verificationKeyWatch
+	// the number of Secrets, KMS keys and inline keys which refer to each environment variable
+	refCount map[string]int
+	// environment variables which are not referred any more and the time when they were released
+	released map[string]time.Time
+	// returns the current time; replaced in tests
+	now func() time.Time
+}
+
+type inlineKey struct {
+	key      Key
+	lastUsed time.Time
+}
+
+type secretWatch struct {
+	informer        cache.SharedIndexInformer
+	stopCh          chan struct{}
+	resourceVersion string
+	keys            []Key
+}
+
+var (
+	defaultStore     *KeyStore
+	defaultStoreOnce sync.Once
+)
+
+// Default returns the key store shared in this process
+func Default() *KeyStore {
+	defaultStoreOnce.Do(func() {
+		defaultStore = newKeyStore(func() (kubeclient.Interface, error) {
+			kubeconf, err := kubeutil.GetKubeConfig()
+			if err != nil {
+				return nil, err
+			}
+			return kubeclient.NewForConfig(kubeconf)
+		}, func() (dynamic.Interface, error) {
+			kubeconf, err := kubeutil.GetKubeConfig()
+			if err != nil {
+				return nil, err
+			}
+			return dynamic.NewForConfig(kubeconf)
+		})
+		defaultStore.secretNamespace = os.Getenv("POD_NAMESPACE")
+		if defaultStore.secretNamespace == "" {
+			defaultStore.secretNamespace = defaultPodNamespace
+		}
+	})
+	return defaultStore
+}
+
+// NewKeyStore returns a key store which watches Secrets with the client
+func NewKeyStore(client kubeclient.Interface) *KeyStore {
+	return NewKeyStoreWithDynamicClient(client, nil)
+}
+
+// NewKeyStoreWithDynamicClient returns a key store which also watches VerificationKeys with the dynamic client
+func NewKeyStoreWithDynamicClient(client kubeclient.Interface, dynamicClient dynamic.Interface) *KeyStore {
+	return newKeyStore(func() (kubeclient.Interface, error) {
+		return client, nil
+	}, func() (dynamic.Interface, error) {
+		if dynamicClient == nil {
+			return nil, errors.New("no dynamic client is configured")
+		}
+		return dynamicClient, nil
+	})
+}
+
+func newKeyStore(newClient func() (kubeclient.Interface, error), newDynamicClient func() (dynamic.Interface, error)) *KeyStore {
+	return &KeyStore{
+		newClient:        newClient,
+		newDynamicClient: newDynamicClient,
+		secrets:          map[string]*secretWatch{},
+		configMaps:       map[string]*configMapWatch{},
+		inline:           map[string]*inlineKey{},
+		kms:              map[string]*kmsKey{},
+		refCount:         map[string]int{},
+		released:         map[string]time.Time{},
+		now:              time.Now,
+	}
+}
+
+// GetKeyRefs returns the references of all public keys in the KeyConfigs.
+// All data in a referenced Secret which can be loaded as a public key are used.
+func (s *KeyStore) GetKeyRefs(keyConfigs []config.KeyConfig) ([]string, error) {
+	refs := []string{}
+	keyConfigs, err := s.ResolveVerificationKeys(keyConfigs)
+	if err != nil {
+		return nil, err
+	}
+	for _, keyConfig := range keyConfigs {
+		if keyConfig.X509 != nil {
+			// the CA which issued the certificate in the signature is resolved by GetX509IssuerRef
+			return nil, fmt.Errorf("the %s cannot be used without the certificate in the signature", keyConfig.Description())
+		}
+		if keyConfig.KMS != nil {
+			key, err := s.GetKMSKey(*keyConfig.KMS)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, key.Ref)
+		}
+		if keyConfig.PGPKeyring != nil {
+			keyring, err := s.GetPGPKeyring(*keyConfig.PGPKeyring)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, keyring.Refs...)
+		}
+		if keyConfig.Secret.Namespace != "" && keyConfig.Secret.Name != "" {
+			keys, err := s.GetSecretKeys(keyConfig.Secret.Namespace, keyConfig.Secret.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				refs = append(refs, key.Ref)
+			}
+		}
+		if keyConfig.Key.PEM != "" && keyConfig.Key.Name != "" {
+			key, err := s.GetInlineKey(keyConfig.Key)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, key.Ref)
+		}
+	}
+	return refs, nil
+}
+
+// GetSecretKeys returns public keys in the Secret.
+// The Secret is watched after the first call, and keys are parsed again only when the Secret is changed.
+func (s *KeyStore) GetSecretKeys(namespace, name string) ([]Key, error) {
+	w, err := s.watchSecret(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	obj, exists, err := w.informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get a secret `%s` in `%s` namespace", name, namespace))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeReleasedKeys(s.now())
+	if !exists {
+		s.releaseKeys(w.keys)
+		w.keys = nil
+		w.resourceVersion = ""
+		return nil, fmt.Errorf("failed to get a secret `%s` in `%s` namespace; not found", name, namespace)
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("failed to get a secret `%s` in `%s` namespace; unexpected object %T", name, namespace, obj)
+	}
+	if secret.ResourceVersion != w.resourceVersion {
+		keys, err := s.publishSecretKeys(secret)
+		if err != nil {
+			return nil, err
+		}
+		s.releaseKeys(w.keys)
+		w.keys = keys
+		w.resourceVersion = secret.ResourceVersion
+	}
+	if len(w.keys) == 0 {
+		return nil, fmt.Errorf("no public keys are found in the secret `%s` in `%s` namespace", name, namespace)
+	}
+	return w.keys, nil
+}
+
+// GetInlineKey returns a public key defined in a profile
+func (s *KeyStore) GetInlineKey(k config.Key) (Key, error) {
+	data := []byte(k.PEM)
+	sum := sha256.Sum256(data)
+	cacheKey := k.Name + "/" + hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.releaseUnusedInlineKeys(now)
+	if cached, ok := s.inline[cacheKey]; ok {
+		cached.lastUsed = now
+		return cached.key, nil
+	}
+	keyType, keyData, err := parseKeyData(data)
+	if err != nil {
+		return Key{}, errors.Wrap(err, fmt.Sprintf("failed to load the key `%s`", k.Name))
+	}
+	key, err := s.publishKey(k.Name, keyType, keyData)
+	if err != nil {
+		return Key{}, err
+	}
+	s.inline[cacheKey] = &inlineKey{key: key, lastUsed: now}
+	return key, nil
+}
+
+// releaseUnusedInlineKeys releases inline keys which are not used for keyReleaseGracePeriod,
+// e.g. keys in profiles which are changed or deleted.
+// The caller must hold s.mu.
+func (s *KeyStore) releaseUnusedInlineKeys(now time.Time) {
+	for cacheKey, cached := range s.inline {
+		if now.Sub(cached.lastUsed) >= keyReleaseGracePeriod {
+			s.releaseKeys([]Key{cached.key})
+			delete(s.inline, cacheKey)
+		}
+	}
+}
+
+// Stop stops watching all Secrets
+func (s *KeyStore) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, w := range s.secrets {
+		close(w.stopCh)
+		s.releaseKeys(w.keys)
+		delete(s.secrets, id)
+	}
+	for id, w := range s.configMaps {
+		close(w.stopCh)
+		delete(s.configMaps, id)
+	}
+	for id, k := range s.kms {
+		s.releaseKeys([]Key{k.key})
+		delete(s.kms, id)
+	}
+	for cacheKey, cached := range s.inline {
+		s.releaseKeys([]Key{cached.key})
+		delete(s.inline, cacheKey)
+	}
+	if s.verificationKeys != nil {
+		close(s.verificationKeys.stopCh)
+		s.verificationKeys = nil
+	}
+}
+
+func (s *KeyStore) watchSecret(namespace, name string) (*secretWatch, error) {
+	if s.secretNamespace != "" && namespace != s.secretNamespace {
+		return nil, fmt.Errorf("failed to get a secret `%s` in `%s` namespace; secrets for verification must be in `%s` namespace", name, namespace, s.secretNamespace)
+	}
+	id := namespace + "/" + name
+	s.mu.Lock()
+	w, ok := s.secrets[id]
+	if !ok {
+		client, err := s.getClient()
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		// watch only the referenced Secret, not all Secrets in the namespace
+		fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+		lw := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return client.CoreV1().Secrets(namespace).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return client.CoreV1().Secrets(namespace).Watch(context.Background(), options)
+			},
+		}
+		w = &secretWatch{
+			informer: cache.NewSharedIndexInformer(lw, &corev1.Secret{}, 0, cache.Indexers{}),
+			stopCh:   make(chan struct{}),
+		}
+		s.secrets[id] = w
+		go w.informer.Run(w.stopCh)
+		log.Debugf("start watching the key secret `%s` in `%s` namespace", name, namespace)
+	}
+	s.mu.Unlock()
+
+	err := waitForSync(w.informer)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get a secret `%s` in `%s` namespace; the secret watch is not synced", name, namespace))
+	}
+	return w, nil
+}
+
+// getClient returns the kubernetes client, which is created at the first call.
+// The caller must hold s.mu.
+func (s *KeyStore) getClient() (kubeclient.Interface, error) {
+	if s.client == nil {
+		client, err := s.newClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create a kubernetes client for the key store")
+		}
+		s.client = client
+	}
+	return s.client, nil
+}
+
+func waitForSync(informer cache.SharedIndexInformer) error {
+	return wait.PollImmediate(secretSyncInterval, secretSyncTimeout, func() (bool, error) {
+		return informer.HasSynced(), nil
+	})
+}
+
+// publishSecretKeys loads all data in the Secret which can be used as public keys.
+// Other data such as private keys are skipped.
+func (s *KeyStore) publishSecretKeys(secret *corev1.Secret) ([]Key, error) {
+	dataNames := []string{}
+	for dataName := range secret.Data {
+		dataNames = append(dataNames, dataName)
+	}
+	sort.Strings(dataNames)
+
+	keys := []Key{}
+	for _, dataName := range dataNames {
+		keyType, keyData, err := parseKeyData(secret.Data[dataName])
+		if err != nil {
+			log.Debugf("`%s` in the secret `%s` in `%s` namespace is not used as a public key; %s", dataName, secret.Name, secret.Namespace, err.Error())
+			continue
+		}
+		key, err := s.publishKey(dataName, keyType, keyData)
+		if err != nil {
+			s.releaseKeys(keys)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// publishKey sets the key to an environment variable named by its digest and counts the reference.
+// The value of a variable never changes, so references which are already passed to verification
+// stay valid until the variable is removed after keyReleaseGracePeriod.
+// The caller must hold s.mu.
+func (s *KeyStore) publishKey(name, keyType string, keyData []byte) (Key, error) {
+	s.removeReleasedKeys(s.now())
+	sum := sha256.Sum256(keyData)
+	envName := keyEnvVarPrefix + hex.EncodeToString(sum[:])
+	if _, found := os.LookupEnv(envName); !found {
+		err := os.Setenv(envName, string(keyData))
+		if err != nil {
+			return Key{}, errors.Wrap(err, fmt.Sprintf("failed to load the key `%s` into memory", name))
+		}
+	}
+	delete(s.released, envName)
+	s.refCount[envName]++
+	return Key{Name: name, Type: keyType, Ref: k8smnfutil.EnvVarFileRefPrefix + envName}, nil
+}
+
+// releaseKeys decrements the references of the keys.
+// A key which is no longer referred is removed by removeReleasedKeys after keyReleaseGracePeriod.
+// The caller must hold s.mu.
+func (s *KeyStore) releaseKeys(keys []Key) {
+	now := s.now()
+	for _, key := range keys {
+		envName := strings.TrimPrefix(key.Ref, k8smnfutil.EnvVarFileRefPrefix)
+		if s.refCount[envName] <= 0 {
+			continue
+		}
+		s.refCount[envName]--
+		if s.refCount[envName] == 0 {
+			delete(s.refCount, envName)
+			s.released[envName] = now
+		}
+	}
+	s.removeReleasedKeys(now)
+}
+
+// removeReleasedKeys unsets environment variables which were released keyReleaseGracePeriod ago.
+// The caller must hold s.mu.
+func (s *KeyStore) removeReleasedKeys(now time.Time) {
+	for envName, releasedAt := range s.released {
+		if now.Sub(releasedAt) < keyReleaseGracePeriod {
+			continue
+		}
+		if err := os.Unsetenv(envName); err != nil {
+			log.Warnf("failed to remove the released key `%s`; %s", envName, err.Error())
+			continue
+		}
+		delete(s.released, envName)
+		log.Debugf("removed the released key `%s`", envName)
+	}
+}
+
+// parseKeyData returns the type of the public key and its data which can be set to an environment variable.
+// A binary PGP keyring is converted into the armored format.
+func parseKeyData(data []byte) (string, []byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte(pgpPublicKeyArmor)) {
+		_, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(trimmed))
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to read the armored PGP public key")
+		}
+		return KeyTypePGP, trimmed, nil
+	}
+	if block, _ := pem.Decode(trimmed); block != nil {
+		switch block.Type {
+		case "PUBLIC KEY":
+			if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return "", nil, errors.Wrap(err, "failed to parse the PEM public key")
+			}
+			return KeyTypeCosign, trimmed, nil
+		case "CERTIFICATE":
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return "", nil, errors.Wrap(err, "failed to parse the PEM certificate")
+			}
+			return KeyTypeX509, trimmed, nil
+		default:
+			return "", nil, fmt.Errorf("PEM block type `%s` is not a public key", block.Type)
+		}
+	}
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil || len(entities) == 0 {
+		return "", nil, errors.New("the data is neither a PEM public key, a PEM certificate nor a PGP public key")
+	}
+	armored := bytes.NewBuffer(nil)
+	w, err := armor.Encode(armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to armor the PGP public key")
+	}
+	for _, e := range entities {
+		if err := e.Serialize(w); err != nil {
+			return "", nil, errors.Wrap(err, "failed to armor the PGP public key")
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, errors.Wrap(err, "failed to armor the PGP public key")
+	}
+	return KeyTypePGP, armored.Bytes(), nil
+}
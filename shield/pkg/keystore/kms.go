@@ -0,0 +1,159 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature/kms"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+
+	// KMS providers
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/aws"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/azure"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/gcp"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/hashivault"
+)
+
+const (
+	kmsKeyCacheTTL  = 5 * time.Minute
+	kmsFetchTimeout = 10 * time.Second
+)
+
+// names of credentials in a Secret which are passed to KMS providers as environment variables
+var kmsCredentialPrefixes = []string{"VAULT_", "TRANSIT_SECRET_ENGINE_PATH", "AWS_", "AZURE_", "GOOGLE_"}
+
+// KMS providers read credentials from environment variables, so keys are fetched one by one
+var kmsEnvMu sync.Mutex
+
+type kmsKey struct {
+	key       Key
+	fetchedAt time.Time
+	// resource version of the credentials Secret
+	credentialsVersion string
+}
+
+// GetKMSKey returns the public key in the KMS. The key is cached and fetched again after a while or when the credentials are changed.
+// If the KMS is not available, the cached key is used.
+func (s *KeyStore) GetKMSKey(k config.KMSKey) (Key, error) {
+	id := k.Ref
+	credentials := map[string][]byte{}
+	credentialsVersion := ""
+	if k.CredentialsSecret != nil {
+		secret, err := s.getSecret(k.CredentialsSecret.Namespace, k.CredentialsSecret.Name)
+		if err != nil {
+			return Key{}, errors.Wrap(err, fmt.Sprintf("failed to get credentials for the KMS key `%s`", k.Ref))
+		}
+		id = fmt.Sprintf("%s/%s/%s", k.Ref, secret.Namespace, secret.Name)
+		credentials = secret.Data
+		credentialsVersion = secret.ResourceVersion
+	}
+
+	s.mu.Lock()
+	cached, ok := s.kms[id]
+	s.mu.Unlock()
+	if ok && cached.credentialsVersion == credentialsVersion && time.Since(cached.fetchedAt) < kmsKeyCacheTTL {
+		return cached.key, nil
+	}
+
+	keyData, err := fetchKMSPublicKey(k.Ref, credentials)
+	if err != nil {
+		if ok {
+			log.Warnf("the cached public key is used because the KMS key `%s` is not fetched; %s", k.Ref, err.Error())
+			return cached.key, nil
+		}
+		return Key{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.publishKey(k.Ref, KeyTypeCosign, keyData)
+	if err != nil {
+		return Key{}, err
+	}
+	if old, ok := s.kms[id]; ok {
+		s.releaseKeys([]Key{old.key})
+	}
+	s.kms[id] = &kmsKey{key: key, fetchedAt: time.Now(), credentialsVersion: credentialsVersion}
+	return key, nil
+}
+
+// fetchKMSPublicKey returns the PEM public key in the KMS.
+// Credentials are set as environment variables only while the key is fetched.
+func fetchKMSPublicKey(ref string, credentials map[string][]byte) ([]byte, error) {
+	kmsEnvMu.Lock()
+	defer kmsEnvMu.Unlock()
+
+	restore := map[string]*string{}
+	defer func() {
+		for name, value := range restore {
+			if value == nil {
+				_ = os.Unsetenv(name)
+			} else {
+				_ = os.Setenv(name, *value)
+			}
+		}
+	}()
+	for name, value := range credentials {
+		if !isKMSCredential(name) {
+			log.Debugf("`%s` is not used as a credential of the KMS key `%s`", name, ref)
+			continue
+		}
+		if current, found := os.LookupEnv(name); found {
+			restore[name] = &current
+		} else {
+			restore[name] = nil
+		}
+		if err := os.Setenv(name, string(value)); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to set credentials for the KMS key `%s`", ref))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kmsFetchTimeout)
+	defer cancel()
+	sv, err := kms.Get(ctx, ref, crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to load the KMS key `%s`", ref))
+	}
+	pub, err := sv.PublicKey()
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get the public key of the KMS key `%s`", ref))
+	}
+	keyData, err := cryptoutils.MarshalPublicKeyToPEM(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to marshal the public key of the KMS key `%s`", ref))
+	}
+	return keyData, nil
+}
+
+func isKMSCredential(name string) bool {
+	for _, prefix := range kmsCredentialPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
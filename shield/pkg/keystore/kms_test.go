@@ -0,0 +1,129 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testVaultToken = "sample-token"
+
+// newTestVaultServer is a stand-in of a Vault dev server which serves public keys of the transit secrets engine
+func newTestVaultServer(keys map[string][]byte, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.Header.Get("X-Vault-Token") != testVaultToken {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		pubPEM, ok := keys[strings.TrimPrefix(r.URL.Path, "/v1/transit/keys/")]
+		if r.Method != http.MethodGet || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"keys": map[string]interface{}{
+					"1": map[string]interface{}{"public_key": string(pubPEM)},
+				},
+				"latest_version": 1,
+			},
+		})
+	}))
+}
+
+func TestKMSKey(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("failed to generate a key: %s", err.Error())
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Errorf("failed to marshal a public key: %s", err.Error())
+		return
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	var requests int32
+	server := newTestVaultServer(map[string][]byte{"sample-key": pubPEM}, &requests)
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault-credentials", Namespace: "sample-ns", ResourceVersion: "1"},
+		Data: map[string][]byte{
+			"VAULT_ADDR":  []byte(server.URL),
+			"VAULT_TOKEN": []byte(testVaultToken),
+			"PATH":        []byte("/not/used"),
+		},
+	}
+	store := NewKeyStore(fake.NewSimpleClientset(secret))
+	defer store.Stop()
+
+	credentials := &config.KeySecret{Name: "vault-credentials", Namespace: "sample-ns"}
+	keyRefs, err := store.GetKeyRefs([]config.KeyConfig{
+		{KMS: &config.KMSKey{Ref: "hashivault://sample-key", CredentialsSecret: credentials}},
+	})
+	if err != nil {
+		t.Errorf("failed to get the KMS key: %s", err.Error())
+		return
+	}
+	keyData, err := k8smnfutil.LoadFileDataInEnvVar(keyRefs[0])
+	if err != nil || strings.TrimSpace(string(keyData)) != strings.TrimSpace(string(pubPEM)) {
+		t.Errorf("key ref should refer to the public key in the KMS; err: %v", err)
+		return
+	}
+	if _, found := os.LookupEnv("VAULT_TOKEN"); found {
+		t.Errorf("credentials should not be left in environment variables")
+		return
+	}
+
+	// the public key is cached
+	if _, err = store.GetKMSKey(config.KMSKey{Ref: "hashivault://sample-key", CredentialsSecret: credentials}); err != nil {
+		t.Errorf("failed to get the cached KMS key: %s", err.Error())
+		return
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("the public key should be fetched once; requests: %d", n)
+		return
+	}
+
+	if _, err = store.GetKMSKey(config.KMSKey{Ref: "hashivault://not-found-key", CredentialsSecret: credentials}); err == nil {
+		t.Errorf("missing key should return an error")
+		return
+	}
+}
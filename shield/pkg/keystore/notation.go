@@ -0,0 +1,40 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/notation"
+)
+
+// GetNotationVerifier loads the trust policy and the trust stores in the Secret of the Notation verifier.
+// The Secret is watched in the same way as key secrets, so an updated trust policy is used without restart.
+func (s *KeyStore) GetNotationVerifier(c *config.NotationVerifier) (*notation.Verifier, error) {
+	ref := c.TrustPolicySecret
+	secret, err := s.getSecret(ref.Namespace, ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := notation.NewVerifier(secret.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to load the notation trust policy in the secret `%s` in `%s` namespace", ref.Name, ref.Namespace))
+	}
+	return v, nil
+}
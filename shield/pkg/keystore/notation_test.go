@@ -0,0 +1,72 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"testing"
+
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const sampleNotationTrustPolicy = `{
+  "version": "1.0",
+  "trustPolicies": [
+    {
+      "name": "sample-images",
+      "registryScopes": ["registry.example.com/sample/app"],
+      "signatureVerification": {"level": "strict"},
+      "trustStores": ["ca:sample-ca"],
+      "trustedIdentities": ["x509.subject: CN=sample-signer"]
+    }
+  ]
+}`
+
+func TestNotationVerifier(t *testing.T) {
+	root := newTestCert(t, 1, newTestCATemplate("sample-root"), nil)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "notation-trust-policy", Namespace: "sample-ns", ResourceVersion: "1"},
+		Data: map[string][]byte{
+			"trustpolicy.json": []byte(sampleNotationTrustPolicy),
+			"ca.sample-ca.pem": certPEM(root.cert),
+		},
+	}
+	// the trust store in the policy is not in the secret
+	missingStore := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "missing-trust-store", Namespace: "sample-ns", ResourceVersion: "1"},
+		Data: map[string][]byte{
+			"trustpolicy.json":  []byte(sampleNotationTrustPolicy),
+			"ca.other-ca.pem":   certPEM(root.cert),
+			"signer-pubkey.pem": certPEM(root.cert),
+		},
+	}
+	store := NewKeyStore(fake.NewSimpleClientset(secret, missingStore))
+	defer store.Stop()
+
+	_, err := store.GetNotationVerifier(&config.NotationVerifier{TrustPolicySecret: config.KeySecret{Name: "notation-trust-policy", Namespace: "sample-ns"}})
+	if err != nil {
+		t.Errorf("failed to load the notation trust policy: %s", err.Error())
+		return
+	}
+	_, err = store.GetNotationVerifier(&config.NotationVerifier{TrustPolicySecret: config.KeySecret{Name: "missing-trust-store", Namespace: "sample-ns"}})
+	if err == nil {
+		t.Errorf("the trust policy without certificates of its trust store should be rejected")
+		return
+	}
+}
@@ -0,0 +1,102 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"golang.org/x/crypto/openpgp"
+)
+
+// PGPKeyring is PGP public keys loaded from a Secret or a ConfigMap.
+// Refs can be used as KeyPath of k8s-manifest-sigstore.
+type PGPKeyring struct {
+	Refs     []string
+	entities openpgp.EntityList
+}
+
+// GetPGPKeyring loads all PGP public keys in the referenced data. Other data are skipped.
+func (s *KeyStore) GetPGPKeyring(ref config.DataRef) (*PGPKeyring, error) {
+	dataList, err := s.GetData(ref)
+	if err != nil {
+		return nil, err
+	}
+	keyring := &PGPKeyring{}
+	for _, data := range dataList {
+		keyType, keyData, err := parseKeyData(data)
+		if err != nil || keyType != KeyTypePGP {
+			log.Debugf("data in the %s is not used as a PGP public key", ref.String())
+			continue
+		}
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyData))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to read the PGP keyring in the %s", ref.String()))
+		}
+		key, err := s.GetInlineKey(config.Key{Name: "pgp-keyring", PEM: string(keyData)})
+		if err != nil {
+			return nil, err
+		}
+		keyring.entities = append(keyring.entities, entities...)
+		keyring.Refs = append(keyring.Refs, key.Ref)
+	}
+	if len(keyring.entities) == 0 {
+		return nil, fmt.Errorf("no PGP public keys are found in the %s", ref.String())
+	}
+	return keyring, nil
+}
+
+// Verify returns the fingerprint and the UID of the key which made the armored detached signature of the message.
+// Revoked keys are not used, and a signature by an expired key is rejected.
+func (k *PGPKeyring) Verify(message, signature []byte, now time.Time) (*config.PGPSignerResult, error) {
+	signer, err := openpgp.CheckArmoredDetachedSignature(k.entities, bytes.NewReader(message), bytes.NewReader(signature))
+	if err != nil {
+		return nil, errors.Wrap(err, "the signature is not made with a key in the PGP keyring")
+	}
+	fingerprint := strings.ToUpper(hex.EncodeToString(signer.PrimaryKey.Fingerprint[:]))
+	identity := primaryIdentity(signer)
+	if identity == nil {
+		return nil, fmt.Errorf("the PGP key %s has no user ID", fingerprint)
+	}
+	if identity.SelfSignature != nil && identity.SelfSignature.KeyExpired(now) {
+		return nil, fmt.Errorf("the PGP key %s (%s) has expired", fingerprint, identity.Name)
+	}
+	return &config.PGPSignerResult{Fingerprint: fingerprint, UID: identity.Name}, nil
+}
+
+// primaryIdentity returns the identity marked as primary, or the first one in the order of the names
+func primaryIdentity(e *openpgp.Entity) *openpgp.Identity {
+	names := []string{}
+	for name, identity := range e.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			return identity
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return e.Identities[names[0]]
+}
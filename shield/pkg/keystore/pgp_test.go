@@ -0,0 +1,115 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPGPEntity(t *testing.T, name, email string) (*openpgp.Entity, []byte) {
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	if err != nil {
+		t.Fatalf("failed to generate a PGP key: %s", err.Error())
+	}
+	buf := bytes.NewBuffer(nil)
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to armor a PGP key: %s", err.Error())
+	}
+	if err = entity.Serialize(w); err != nil {
+		t.Fatalf("failed to serialize a PGP key: %s", err.Error())
+	}
+	_ = w.Close()
+	return entity, buf.Bytes()
+}
+
+func signTestPGPMessage(t *testing.T, entity *openpgp.Entity, message []byte) []byte {
+	sig := bytes.NewBuffer(nil)
+	if err := openpgp.ArmoredDetachSign(sig, entity, bytes.NewReader(message), nil); err != nil {
+		t.Fatalf("failed to sign a message: %s", err.Error())
+	}
+	return sig.Bytes()
+}
+
+func TestPGPKeyring(t *testing.T) {
+	alice, alicePub := newTestPGPEntity(t, "Alice", "alice@example.com")
+	bob, bobPub := newTestPGPEntity(t, "Bob", "bob@example.com")
+	mallory, _ := newTestPGPEntity(t, "Mallory", "mallory@example.com")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample-keyring", Namespace: "sample-ns", ResourceVersion: "1"},
+		Data: map[string][]byte{
+			"alice.gpg": alicePub,
+			"bob.gpg":   bobPub,
+			"README":    []byte("not a key"),
+		},
+	}
+	store := NewKeyStore(fake.NewSimpleClientset(secret))
+	defer store.Stop()
+
+	ref := config.DataRef{Name: "sample-keyring", Namespace: "sample-ns"}
+	keyring, err := store.GetPGPKeyring(ref)
+	if err != nil {
+		t.Errorf("failed to load the PGP keyring: %s", err.Error())
+		return
+	}
+	if len(keyring.Refs) != 2 {
+		t.Errorf("both PGP keys should be loaded: %v", keyring.Refs)
+		return
+	}
+	keyRefs, err := store.GetKeyRefs([]config.KeyConfig{{PGPKeyring: &ref}})
+	if err != nil || len(keyRefs) != 2 {
+		t.Errorf("the PGP keyring should be used as key refs; refs: %v, err: %v", keyRefs, err)
+		return
+	}
+
+	message := []byte("apiVersion: v1\nkind: ConfigMap\n")
+	signer, err := keyring.Verify(message, signTestPGPMessage(t, bob, message), time.Now())
+	if err != nil {
+		t.Errorf("the signature by bob should be verified: %s", err.Error())
+		return
+	}
+	fingerprint := strings.ToUpper(hex.EncodeToString(bob.PrimaryKey.Fingerprint[:]))
+	if signer.Fingerprint != fingerprint || signer.UID != "Bob <bob@example.com>" {
+		t.Errorf("unexpected signer: %v", signer)
+		return
+	}
+	if _, err = keyring.Verify([]byte("tampered"), signTestPGPMessage(t, alice, message), time.Now()); err == nil {
+		t.Errorf("the signature of another message should be rejected")
+		return
+	}
+	if _, err = keyring.Verify(message, signTestPGPMessage(t, mallory, message), time.Now()); err == nil {
+		t.Errorf("the signature by a key not in the keyring should be rejected")
+		return
+	}
+
+	if _, err = store.GetPGPKeyring(config.DataRef{Name: "sample-keyring", Namespace: "sample-ns", Key: "README"}); err == nil {
+		t.Errorf("data without PGP keys should be rejected")
+		return
+	}
+}
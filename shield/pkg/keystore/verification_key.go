@@ -0,0 +1,185 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+type verificationKeyWatch struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+// ResolveVerificationKeys replaces references to VerificationKeys with the keys which they refer to.
+// Revoked keys are never used. Other key configs are returned as they are.
+func (s *KeyStore) ResolveVerificationKeys(keyConfigs []config.KeyConfig) ([]config.KeyConfig, error) {
+	resolved := []config.KeyConfig{}
+	for _, k := range keyConfigs {
+		if !k.IsVerificationKeyRef() {
+			resolved = append(resolved, k)
+			continue
+		}
+		keys, err := s.GetVerificationKeys(k)
+		if err != nil {
+			return nil, err
+		}
+		for _, vk := range keys {
+			resolved = append(resolved, narrowKeyWindow(vk.KeyConfig(), k))
+		}
+	}
+	return resolved, nil
+}
+
+// GetVerificationKeys returns VerificationKeys referred by the key config in name order.
+// VerificationKeys are watched after the first call.
+func (s *KeyStore) GetVerificationKeys(k config.KeyConfig) ([]config.VerificationKey, error) {
+	w, err := s.watchVerificationKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := []config.VerificationKey{}
+	for _, obj := range w.informer.GetStore().List() {
+		// a broken VerificationKey must not block the verification with the other keys
+		vk, err := toVerificationKey(obj)
+		if err != nil {
+			log.Warningf("the verification key is skipped; %s", err.Error())
+			continue
+		}
+		matched, err := k.MatchVerificationKey(vk)
+		if err != nil {
+			// the selector in the key config is invalid
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		if vk.Spec.Revoked {
+			if k.VerificationKey != "" {
+				return nil, fmt.Errorf("the verification key `%s` is revoked", vk.Name)
+			}
+			log.Debugf("the verification key `%s` is revoked and not used", vk.Name)
+			continue
+		}
+		if err := vk.Validate(); err != nil {
+			if k.VerificationKey != "" {
+				return nil, err
+			}
+			log.Warningf("the verification key `%s` is not used; %s", vk.Name, err.Error())
+			continue
+		}
+		keys = append(keys, vk)
+	}
+	if len(keys) == 0 {
+		if k.VerificationKey != "" {
+			return nil, fmt.Errorf("failed to get the verification key `%s`; not found", k.VerificationKey)
+		}
+		return nil, fmt.Errorf("no valid %s are found", k.Description())
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+func (s *KeyStore) watchVerificationKeys() (*verificationKeyWatch, error) {
+	s.mu.Lock()
+	w := s.verificationKeys
+	if w == nil {
+		client, err := s.getDynamicClient()
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		resource := client.Resource(config.VerificationKeyGVR)
+		lw := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return resource.List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return resource.Watch(context.Background(), options)
+			},
+		}
+		w = &verificationKeyWatch{
+			informer: cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{}),
+			stopCh:   make(chan struct{}),
+		}
+		s.verificationKeys = w
+		go w.informer.Run(w.stopCh)
+		log.Debug("start watching verification keys")
+	}
+	s.mu.Unlock()
+
+	err := waitForSync(w.informer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get verification keys; the watch is not synced")
+	}
+	return w, nil
+}
+
+// getDynamicClient returns the dynamic client, which is created at the first call.
+// The caller must hold s.mu.
+func (s *KeyStore) getDynamicClient() (dynamic.Interface, error) {
+	if s.dynamicClient == nil {
+		client, err := s.newDynamicClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create a dynamic client for the key store")
+		}
+		s.dynamicClient = client
+	}
+	return s.dynamicClient, nil
+}
+
+func toVerificationKey(obj interface{}) (config.VerificationKey, error) {
+	vk := config.VerificationKey{}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return vk, fmt.Errorf("failed to get a verification key; unexpected object %T", obj)
+	}
+	data, err := json.Marshal(u.Object)
+	if err != nil {
+		return vk, errors.Wrap(err, fmt.Sprintf("failed to marshal the verification key `%s`", u.GetName()))
+	}
+	if err := json.Unmarshal(data, &vk); err != nil {
+		return vk, errors.Wrap(err, fmt.Sprintf("failed to load the verification key `%s`", u.GetName()))
+	}
+	return vk, nil
+}
+
+// narrowKeyWindow applies the validity window of the reference to the resolved key.
+// The key is retiring if either the key or the reference is marked as retiring.
+func narrowKeyWindow(key, ref config.KeyConfig) config.KeyConfig {
+	if ref.NotBefore != nil && (key.NotBefore == nil || ref.NotBefore.After(key.NotBefore.Time)) {
+		key.NotBefore = ref.NotBefore
+	}
+	if ref.NotAfter != nil && (key.NotAfter == nil || ref.NotAfter.Before(key.NotAfter)) {
+		key.NotAfter = ref.NotAfter
+	}
+	key.Retiring = key.Retiring || ref.Retiring
+	return key
+}
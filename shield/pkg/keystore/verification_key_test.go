@@ -0,0 +1,126 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestVerificationKey(name, team string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apis.integrityshield.io/v1",
+		"kind":       "VerificationKey",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]interface{}{"team": team},
+		},
+		"spec": spec,
+	}}
+}
+
+func TestVerificationKeys(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	releaseKey := newTestVerificationKey("release-key", "release", map[string]interface{}{
+		"keySecret": map[string]interface{}{"name": "release-key", "namespace": "sample-ns"},
+		"owner":     "release-team",
+		"notAfter":  notAfter,
+	})
+	backupKey := newTestVerificationKey("backup-key", "release", map[string]interface{}{
+		"kms": map[string]interface{}{"ref": "hashivault://backup-key"},
+	})
+	revokedKey := newTestVerificationKey("revoked-key", "release", map[string]interface{}{
+		"keySecret": map[string]interface{}{"name": "revoked-key", "namespace": "sample-ns"},
+		"revoked":   true,
+	})
+	devKey := newTestVerificationKey("dev-key", "dev", map[string]interface{}{})
+	// a VerificationKey which cannot be loaded is skipped
+	brokenKey := newTestVerificationKey("broken-key", "release", nil)
+	brokenKey.Object["spec"] = "broken"
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		config.VerificationKeyGVR: "VerificationKeyList",
+	})
+	// the resource name cannot be guessed from the kind, so keys are created with the resource
+	for _, vk := range []*unstructured.Unstructured{releaseKey, backupKey, revokedKey, devKey, brokenKey} {
+		if _, err := dynamicClient.Resource(config.VerificationKeyGVR).Create(context.Background(), vk, metav1.CreateOptions{}); err != nil {
+			t.Errorf("failed to create a verification key: %s", err.Error())
+			return
+		}
+	}
+	store := NewKeyStoreWithDynamicClient(fake.NewSimpleClientset(), dynamicClient)
+	defer store.Stop()
+
+	keyConfigs, err := store.ResolveVerificationKeys([]config.KeyConfig{
+		{Key: config.Key{Name: "inline-key", PEM: "sample"}},
+		{VerificationKey: "release-key", Retiring: true},
+	})
+	if err != nil {
+		t.Errorf("failed to resolve the verification key: %s", err.Error())
+		return
+	}
+	if len(keyConfigs) != 2 || keyConfigs[0].Key.Name != "inline-key" {
+		t.Errorf("other keys should be returned as they are: %v", keyConfigs)
+		return
+	}
+	resolved := keyConfigs[1]
+	if resolved.VerificationKeyName != "release-key" || resolved.Secret.Name != "release-key" || !resolved.Retiring {
+		t.Errorf("the key should be resolved from the verification key: %v", resolved)
+		return
+	}
+	if resolved.NotAfter == nil || resolved.NotAfter.UTC().Format(time.RFC3339) != notAfter {
+		t.Errorf("the validity window of the verification key should be used: %v", resolved.NotAfter)
+		return
+	}
+
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "release"}}
+	keyConfigs, err = store.ResolveVerificationKeys([]config.KeyConfig{{VerificationKeySelector: selector}})
+	if err != nil {
+		t.Errorf("failed to resolve verification keys by the selector: %s", err.Error())
+		return
+	}
+	names := []string{}
+	for _, k := range keyConfigs {
+		names = append(names, k.VerificationKeyName)
+	}
+	if len(names) != 2 || names[0] != "backup-key" || names[1] != "release-key" {
+		t.Errorf("revoked keys and broken keys should not be selected: %v", names)
+		return
+	}
+
+	invalidRefs := map[string]config.KeyConfig{
+		"revoked key":   {VerificationKey: "revoked-key"},
+		"invalid key":   {VerificationKey: "dev-key"},
+		"missing key":   {VerificationKey: "missing-key"},
+		"no valid keys": {VerificationKeySelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "dev"}}},
+	}
+	for name, ref := range invalidRefs {
+		if _, err = store.ResolveVerificationKeys([]config.KeyConfig{ref}); err == nil {
+			t.Errorf("the reference should be rejected: %s", name)
+			return
+		}
+	}
+}
@@ -0,0 +1,344 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const pemTypeCRL = "X509 CRL"
+
+type configMapWatch struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+// X509Trust is a CA bundle and CRLs to verify signing certificates of an x509 key config
+type X509Trust struct {
+	config        *config.X509KeyConfig
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	crls          []*pkix.CertificateList
+}
+
+// GetX509Trust loads the CA bundle and the CRLs of the x509 key config.
+// Self-signed certificates in the bundle are roots and the others are intermediates.
+func (s *KeyStore) GetX509Trust(c *config.X509KeyConfig) (*X509Trust, error) {
+	caData, err := s.GetData(c.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	t := &X509Trust{config: c, roots: x509.NewCertPool(), intermediates: x509.NewCertPool()}
+	numRoots := 0
+	for _, data := range caData {
+		certs, err := parseCertificates(data)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to load the CA bundle in the %s", c.CABundle.String()))
+		}
+		for _, cert := range certs {
+			if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+				t.roots.AddCert(cert)
+				numRoots++
+			} else {
+				t.intermediates.AddCert(cert)
+			}
+		}
+	}
+	if numRoots == 0 {
+		return nil, fmt.Errorf("no root certificate is found in the %s", c.CABundle.String())
+	}
+	for _, ref := range c.CRLs {
+		crlData, err := s.GetData(ref)
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range crlData {
+			crls, err := parseCRLs(data)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("failed to load CRLs in the %s", ref.String()))
+			}
+			t.crls = append(t.crls, crls...)
+		}
+	}
+	return t, nil
+}
+
+// VerifyCertificate returns the CA which issued the signing certificate if the certificate chains to the CA bundle,
+// allows code signing, matches the name constraints and is not revoked.
+func (t *X509Trust) VerifyCertificate(cert *x509.Certificate, now time.Time) (*x509.Certificate, error) {
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         t.roots,
+		Intermediates: t.intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "the certificate is not issued by the CA bundle")
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, errors.New("the key usage of the certificate does not allow digital signature")
+	}
+	if err = t.config.CheckNames(cert); err != nil {
+		return nil, err
+	}
+	errMsgs := []string{}
+	for _, chain := range chains {
+		if err := t.checkRevocation(chain, now); err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		if len(chain) == 1 {
+			// the signing certificate is a root in the bundle
+			return cert, nil
+		}
+		return chain[1], nil
+	}
+	return nil, fmt.Errorf("the certificate `%s` is not accepted; %v", cert.Subject.CommonName, errMsgs)
+}
+
+// checkRevocation checks each certificate in the chain with the CRL by its issuer.
+// If CRLs are configured, the CRL by the issuer of the signing certificate is required.
+func (t *X509Trust) checkRevocation(chain []*x509.Certificate, now time.Time) error {
+	if len(t.crls) == 0 {
+		return nil
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		cert, issuer := chain[i], chain[i+1]
+		crl := t.findCRL(issuer)
+		if crl == nil {
+			if i == 0 {
+				return fmt.Errorf("no CRL by the issuer `%s` of the certificate is found", issuer.Subject.CommonName)
+			}
+			continue
+		}
+		if crl.HasExpired(now) {
+			return fmt.Errorf("the CRL by `%s` expired at %s", issuer.Subject.CommonName, crl.TBSCertList.NextUpdate.Format(time.RFC3339))
+		}
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("the certificate `%s` (serial: %s) is revoked at %s", cert.Subject.CommonName, cert.SerialNumber.String(), revoked.RevocationTime.Format(time.RFC3339))
+			}
+		}
+	}
+	return nil
+}
+
+// findCRL returns the latest CRL signed by the issuer
+func (t *X509Trust) findCRL(issuer *x509.Certificate) *pkix.CertificateList {
+	var found *pkix.CertificateList
+	for _, crl := range t.crls {
+		if issuer.CheckCRLSignature(crl) != nil {
+			continue
+		}
+		if found == nil || crl.TBSCertList.ThisUpdate.After(found.TBSCertList.ThisUpdate) {
+			found = crl
+		}
+	}
+	return found
+}
+
+// GetX509IssuerRef returns the reference of the CA certificate, which is used as KeyPath to verify the signature
+func (s *KeyStore) GetX509IssuerRef(issuer *x509.Certificate) (string, error) {
+	issuerPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.Raw})
+	key, err := s.GetInlineKey(config.Key{Name: "x509-issuer", PEM: string(issuerPEM)})
+	if err != nil {
+		return "", err
+	}
+	return key.Ref, nil
+}
+
+// GetData returns the data in the Secret or the ConfigMap in the order of their keys.
+// If the key is set in the reference, only its data is returned.
+func (s *KeyStore) GetData(ref config.DataRef) ([][]byte, error) {
+	data := map[string][]byte{}
+	if ref.GetKind() == config.DataRefKindConfigMap {
+		cm, err := s.getConfigMap(ref.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range cm.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range cm.BinaryData {
+			data[k] = v
+		}
+	} else {
+		secret, err := s.getSecret(ref.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		data = secret.Data
+	}
+	if ref.Key != "" {
+		v, ok := data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("`%s` is not found in the %s", ref.Key, ref.String())
+		}
+		return [][]byte{v}, nil
+	}
+	keys := []string{}
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := [][]byte{}
+	for _, k := range keys {
+		values = append(values, data[k])
+	}
+	return values, nil
+}
+
+func (s *KeyStore) getSecret(namespace, name string) (*corev1.Secret, error) {
+	w, err := s.watchSecret(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	obj, exists, err := w.informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, fmt.Errorf("failed to get a secret `%s` in `%s` namespace; not found", name, namespace)
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("failed to get a secret `%s` in `%s` namespace; unexpected object %T", name, namespace, obj)
+	}
+	return secret, nil
+}
+
+func (s *KeyStore) getConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	w, err := s.watchConfigMap(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	obj, exists, err := w.informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, fmt.Errorf("failed to get a configmap `%s` in `%s` namespace; not found", name, namespace)
+	}
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil, fmt.Errorf("failed to get a configmap `%s` in `%s` namespace; unexpected object %T", name, namespace, obj)
+	}
+	return cm, nil
+}
+
+// watchConfigMap watches the ConfigMap in the same way as Secrets, so updated CRLs are used without restart
+func (s *KeyStore) watchConfigMap(namespace, name string) (*configMapWatch, error) {
+	id := namespace + "/" + name
+	s.mu.Lock()
+	w, ok := s.configMaps[id]
+	if !ok {
+		client, err := s.getClient()
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+		lw := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return client.CoreV1().ConfigMaps(namespace).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return client.CoreV1().ConfigMaps(namespace).Watch(context.Background(), options)
+			},
+		}
+		w = &configMapWatch{
+			informer: cache.NewSharedIndexInformer(lw, &corev1.ConfigMap{}, 0, cache.Indexers{}),
+			stopCh:   make(chan struct{}),
+		}
+		s.configMaps[id] = w
+		go w.informer.Run(w.stopCh)
+		log.Debugf("start watching the configmap `%s` in `%s` namespace", name, namespace)
+	}
+	s.mu.Unlock()
+
+	err := waitForSync(w.informer)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get a configmap `%s` in `%s` namespace; the configmap watch is not synced", name, namespace))
+	}
+	return w, nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate is found")
+	}
+	return certs, nil
+}
+
+// parseCRLs parses PEM encoded CRLs, or a DER encoded CRL
+func parseCRLs(data []byte) ([]*pkix.CertificateList, error) {
+	crls := []*pkix.CertificateList{}
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != pemTypeCRL {
+			continue
+		}
+		crl, err := x509.ParseDERCRL(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, crl)
+	}
+	if len(crls) > 0 {
+		return crls, nil
+	}
+	crl, err := x509.ParseDERCRL(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "no PEM CRL is found and the data is not a DER CRL")
+	}
+	return []*pkix.CertificateList{crl}, nil
+}
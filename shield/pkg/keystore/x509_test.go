@@ -0,0 +1,168 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCert(t *testing.T, serial int64, tmpl *x509.Certificate, parent *testCA) *testCA {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate a key: %s", err.Error())
+	}
+	tmpl.SerialNumber = big.NewInt(serial)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	parentCert, parentKey := tmpl, crypto.Signer(priv)
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &priv.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create a certificate: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse a certificate: %s", err.Error())
+	}
+	return &testCA{cert: cert, key: priv}
+}
+
+func newTestCATemplate(cn string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+}
+
+func newTestSignerTemplate(cn, email string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:        pkix.Name{CommonName: cn},
+		EmailAddresses: []string{email},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+}
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func TestX509Trust(t *testing.T) {
+	root := newTestCert(t, 1, newTestCATemplate("sample-root"), nil)
+	intermediate := newTestCert(t, 2, newTestCATemplate("sample-intermediate"), root)
+	signer := newTestCert(t, 10, newTestSignerTemplate("sample-signer", "signer@example.com"), intermediate)
+	revoked := newTestCert(t, 11, newTestSignerTemplate("sample-signer", "signer@example.com"), intermediate)
+	other := newTestCert(t, 12, newTestSignerTemplate("other-signer", "other@example.com"), intermediate)
+	serverTmpl := newTestSignerTemplate("sample-signer", "signer@example.com")
+	serverTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	server := newTestCert(t, 13, serverTmpl, intermediate)
+	untrustedRoot := newTestCert(t, 1, newTestCATemplate("untrusted-root"), nil)
+	untrusted := newTestCert(t, 10, newTestSignerTemplate("sample-signer", "signer@example.com"), untrustedRoot)
+
+	crlDER, err := intermediate.cert.CreateCRL(rand.Reader, intermediate.key, []pkix.RevokedCertificate{
+		{SerialNumber: revoked.cert.SerialNumber, RevocationTime: time.Now().Add(-time.Minute)},
+	}, time.Now().Add(-time.Minute), time.Now().Add(30*time.Minute))
+	if err != nil {
+		t.Errorf("failed to create a CRL: %s", err.Error())
+		return
+	}
+
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample-ca", Namespace: "sample-ns", ResourceVersion: "1"},
+		Data: map[string][]byte{
+			"ca.crt": append(certPEM(root.cert), certPEM(intermediate.cert)...),
+		},
+	}
+	crlConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample-crl", Namespace: "sample-ns", ResourceVersion: "1"},
+		BinaryData: map[string][]byte{
+			"intermediate.crl": crlDER,
+		},
+	}
+	store := NewKeyStore(fake.NewSimpleClientset(caSecret, crlConfigMap))
+	defer store.Stop()
+
+	x509Config := &config.X509KeyConfig{
+		CABundle:    config.DataRef{Name: "sample-ca", Namespace: "sample-ns"},
+		CRLs:        []config.DataRef{{Kind: config.DataRefKindConfigMap, Name: "sample-crl", Namespace: "sample-ns"}},
+		CommonNames: []string{"sample-*"},
+		SANs:        []string{"signer@example.com"},
+	}
+	trust, err := store.GetX509Trust(x509Config)
+	if err != nil {
+		t.Errorf("failed to load the x509 trust: %s", err.Error())
+		return
+	}
+
+	issuer, err := trust.VerifyCertificate(signer.cert, time.Now())
+	if err != nil {
+		t.Errorf("the signing certificate should be accepted: %s", err.Error())
+		return
+	}
+	if !issuer.Equal(intermediate.cert) {
+		t.Errorf("the issuer should be the intermediate CA: %s", issuer.Subject.CommonName)
+		return
+	}
+
+	rejected := map[string]*x509.Certificate{
+		"revoked":            revoked.cert,
+		"common name":        other.cert,
+		"extended key usage": server.cert,
+		"untrusted CA":       untrusted.cert,
+		"intermediate CA":    intermediate.cert,
+	}
+	for name, cert := range rejected {
+		if _, err = trust.VerifyCertificate(cert, time.Now()); err == nil {
+			t.Errorf("the certificate should be rejected: %s", name)
+			return
+		}
+	}
+	if _, err = trust.VerifyCertificate(signer.cert, time.Now().Add(45*time.Minute)); err == nil {
+		t.Errorf("the certificate should be rejected with the expired CRL")
+		return
+	}
+
+	// CRLs must be PEM or DER encoded
+	x509Config.CRLs = []config.DataRef{{Name: "sample-ca", Namespace: "sample-ns"}}
+	if _, err = store.GetX509Trust(x509Config); err == nil {
+		t.Errorf("CA certificates should not be loaded as CRLs")
+		return
+	}
+}
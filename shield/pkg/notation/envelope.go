@@ -0,0 +1,238 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// media type of a JWS signature envelope
+	MediaTypeJWSEnvelope = "application/jose+json"
+	// media type of a COSE signature envelope, which is not supported yet
+	MediaTypeCOSEEnvelope = "application/cose"
+	mediaTypePayload      = "application/vnd.cncf.notary.payload.v1+json"
+)
+
+// signing schemes
+const (
+	SigningSchemeX509                 = "notary.x509"
+	SigningSchemeX509SigningAuthority = "notary.x509.signingAuthority"
+)
+
+const (
+	headerSigningScheme        = "io.cncf.notary.signingScheme"
+	headerSigningTime          = "io.cncf.notary.signingTime"
+	headerAuthenticSigningTime = "io.cncf.notary.authenticSigningTime"
+	headerExpiry               = "io.cncf.notary.expiry"
+)
+
+// critical headers which are understood by the verifier
+var supportedCriticalHeaders = map[string]bool{
+	headerSigningScheme:        true,
+	headerAuthenticSigningTime: true,
+	headerExpiry:               true,
+}
+
+// jwsEnvelope is a Notation signature envelope in the flattened JWS JSON serialization.
+// The envelope and the protected header are parsed here, because golang-jwt handles only the compact serialization
+// and go-jose rejects the critical headers of Notation. The signature is verified with the signing methods of golang-jwt.
+type jwsEnvelope struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Header    struct {
+		// DER certificates in standard base64, starting with the signing certificate
+		CertChain [][]byte `json:"x5c"`
+	} `json:"header"`
+	Signature string `json:"signature"`
+}
+
+type jwsProtectedHeader struct {
+	Algorithm            string     `json:"alg"`
+	ContentType          string     `json:"cty"`
+	Critical             []string   `json:"crit"`
+	SigningScheme        string     `json:"io.cncf.notary.signingScheme"`
+	SigningTime          *time.Time `json:"io.cncf.notary.signingTime,omitempty"`
+	AuthenticSigningTime *time.Time `json:"io.cncf.notary.authenticSigningTime,omitempty"`
+	Expiry               *time.Time `json:"io.cncf.notary.expiry,omitempty"`
+}
+
+// descriptor of the signed artifact in the payload
+type targetArtifact struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type payload struct {
+	TargetArtifact targetArtifact `json:"targetArtifact"`
+}
+
+// signedEnvelope is the content of a signature envelope whose signature is verified with the signing certificate
+type signedEnvelope struct {
+	header    jwsProtectedHeader
+	payload   payload
+	certChain []*x509.Certificate
+	signature []byte
+}
+
+// signingTime returns the authentic signing time for the signing authority scheme, and the time asserted by the signer otherwise
+func (e *signedEnvelope) signingTime() *time.Time {
+	if e.header.SigningScheme == SigningSchemeX509SigningAuthority {
+		return e.header.AuthenticSigningTime
+	}
+	return e.header.SigningTime
+}
+
+// verifyJWSEnvelope checks the headers of the envelope and verifies the signature with the signing certificate in the envelope.
+// The certificate chain is not verified here.
+func verifyJWSEnvelope(data []byte) (*signedEnvelope, error) {
+	var env jwsEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the JWS envelope")
+	}
+	if len(env.Header.CertChain) == 0 {
+		return nil, errors.New("no certificate is found in the JWS envelope")
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(env.Protected)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode the protected header")
+	}
+	header, err := parseProtectedHeader(protected)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(env.Signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode the signature")
+	}
+	certChain := []*x509.Certificate{}
+	for _, der := range env.Header.CertChain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse the certificate chain")
+		}
+		certChain = append(certChain, cert)
+	}
+	signingInput := env.Protected + "." + env.Payload
+	if err := verifyJWSSignature(header.Algorithm, certChain[0].PublicKey, signingInput, env.Signature); err != nil {
+		return nil, errors.Wrap(err, "failed to verify the signature with the signing certificate")
+	}
+	payloadData, err := base64.RawURLEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode the payload")
+	}
+	var p payload
+	if err := json.Unmarshal(payloadData, &p); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the payload")
+	}
+	return &signedEnvelope{header: *header, payload: p, certChain: certChain, signature: signature}, nil
+}
+
+func parseProtectedHeader(data []byte) (*jwsProtectedHeader, error) {
+	var header jwsProtectedHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the protected header")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the protected header")
+	}
+	if header.ContentType != mediaTypePayload {
+		return nil, fmt.Errorf("unsupported payload content type `%s`", header.ContentType)
+	}
+	signingSchemeIsCritical := false
+	for _, h := range header.Critical {
+		if !supportedCriticalHeaders[h] {
+			return nil, fmt.Errorf("unsupported critical header `%s`", h)
+		}
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("critical header `%s` is not found", h)
+		}
+		signingSchemeIsCritical = signingSchemeIsCritical || h == headerSigningScheme
+	}
+	if !signingSchemeIsCritical {
+		return nil, fmt.Errorf("`%s` must be a critical header", headerSigningScheme)
+	}
+	if header.Expiry != nil && !containsString(header.Critical, headerExpiry) {
+		return nil, fmt.Errorf("`%s` must be a critical header", headerExpiry)
+	}
+	switch header.SigningScheme {
+	case SigningSchemeX509:
+		if header.SigningTime == nil {
+			return nil, fmt.Errorf("`%s` is required for the signing scheme `%s`", headerSigningTime, header.SigningScheme)
+		}
+	case SigningSchemeX509SigningAuthority:
+		if header.AuthenticSigningTime == nil || !containsString(header.Critical, headerAuthenticSigningTime) {
+			return nil, fmt.Errorf("critical `%s` is required for the signing scheme `%s`", headerAuthenticSigningTime, header.SigningScheme)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing scheme `%s`", header.SigningScheme)
+	}
+	return &header, nil
+}
+
+// jwsSigningMethods are the JWS algorithms of Notation, i.e. RSASSA-PSS or ECDSA with SHA-2.
+// RSASSA-PSS signatures must have a salt of the hash size as Notation signers make, so the salt length is not auto-detected.
+var jwsSigningMethods = map[string]jwt.SigningMethod{
+	"PS256": strictPSS(jwt.SigningMethodPS256),
+	"PS384": strictPSS(jwt.SigningMethodPS384),
+	"PS512": strictPSS(jwt.SigningMethodPS512),
+	"ES256": jwt.SigningMethodES256,
+	"ES384": jwt.SigningMethodES384,
+	"ES512": jwt.SigningMethodES512,
+}
+
+func strictPSS(m *jwt.SigningMethodRSAPSS) *jwt.SigningMethodRSAPSS {
+	return &jwt.SigningMethodRSAPSS{SigningMethodRSA: m.SigningMethodRSA, Options: m.Options}
+}
+
+// verifyJWSSignature verifies the base64url signature on the signing input with the public key by the JWS algorithm.
+// ES256, ES384 and ES512 are used only with P-256, P-384 and P-521 respectively.
+func verifyJWSSignature(alg string, pub crypto.PublicKey, signingInput, signature string) error {
+	method, ok := jwsSigningMethods[alg]
+	if !ok {
+		return fmt.Errorf("unsupported signature algorithm `%s`", alg)
+	}
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if _, ok := method.(*jwt.SigningMethodRSAPSS); !ok {
+			return fmt.Errorf("signature algorithm `%s` cannot be used with an RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		m, ok := method.(*jwt.SigningMethodECDSA)
+		if !ok {
+			return fmt.Errorf("signature algorithm `%s` cannot be used with an ECDSA key", alg)
+		}
+		if bitSize := key.Curve.Params().BitSize; bitSize != m.CurveBits {
+			return fmt.Errorf("signature algorithm `%s` cannot be used with a %d-bit ECDSA key", alg, bitSize)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return method.Verify(signingInput, signature, pub)
+}
@@ -0,0 +1,342 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// TrustPolicyKey is the key of the trust policy in the data of a trust policy Secret
+	TrustPolicyKey = "trustpolicy.json"
+	// ArtifactTypeSignature is the artifact type of Notation signatures in a registry
+	ArtifactTypeSignature = "application/vnd.cncf.notary.signature"
+
+	maxSignatureAttempts = 50
+	maxEnvelopeSize      = 4 << 20
+)
+
+// Verifier verifies Notation signatures of images, which are stored as OCI referrers of the images, with a trust policy and trust stores
+type Verifier struct {
+	policy *TrustPolicyDocument
+	// certificates of each trust store, e.g. `ca:acme-rockets`
+	trustStores map[string][]*x509.Certificate
+	// Keychain and Transport are used to access registries. The default keychain and transport are used if they are not set.
+	Keychain  authn.Keychain
+	Transport http.RoundTripper
+	// Reject is called for each verified signature, and the signature is not accepted if it returns an error, e.g. by a revocation list
+	Reject func(*Result) error
+}
+
+// Result is a Notation signature of an image which is accepted by the trust policy
+type Result struct {
+	Image  string
+	Digest string
+	// name of the trust policy
+	Policy string
+	// true if the verification level of the trust policy is `skip`
+	Skipped bool
+	// subject of the signing certificate
+	Signer      string
+	SignedTime  *time.Time
+	Certificate *x509.Certificate
+	Signature   []byte
+	// failures of validations whose action is `log`
+	Warnings []string
+}
+
+// NewVerifier loads the trust policy and the trust stores in the data of a Secret.
+// The trust policy is in `trustpolicy.json`, and the other data are PEM certificates whose keys are `<type>.<name>.pem` or `<type>.<name>.crt`,
+// e.g. `ca.acme-rockets.pem` for the trust store `ca:acme-rockets`.
+func NewVerifier(data map[string][]byte) (*Verifier, error) {
+	policyData, ok := data[TrustPolicyKey]
+	if !ok {
+		return nil, fmt.Errorf("`%s` is not found", TrustPolicyKey)
+	}
+	var policy TrustPolicyDocument
+	if err := json.Unmarshal(policyData, &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the trust policy")
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	v := &Verifier{policy: &policy, trustStores: map[string][]*x509.Certificate{}}
+	keys := []string{}
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == TrustPolicyKey {
+			continue
+		}
+		storeName, ok := trustStoreName(k)
+		if !ok {
+			log.Debugf("`%s` is not loaded as trust store certificates", k)
+			continue
+		}
+		certs, err := parseCertificates(data[k])
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to load certificates in `%s`", k))
+		}
+		v.trustStores[storeName] = append(v.trustStores[storeName], certs...)
+	}
+	for _, p := range policy.TrustPolicies {
+		for _, store := range p.TrustStores {
+			if len(v.trustStores[store]) == 0 {
+				return nil, fmt.Errorf("no certificate is found for the trust store `%s` in the trust policy `%s`", store, p.Name)
+			}
+		}
+	}
+	return v, nil
+}
+
+// trustStoreName returns the trust store of the data key, e.g. `ca:acme-rockets` for `ca.acme-rockets.pem`
+func trustStoreName(key string) (string, bool) {
+	base := strings.TrimSuffix(strings.TrimSuffix(key, ".pem"), ".crt")
+	if base == key {
+		return "", false
+	}
+	parts := strings.SplitN(base, ".", 2)
+	if len(parts) != 2 || parts[1] == "" || (parts[0] != TrustStoreTypeCA && parts[0] != TrustStoreTypeSigningAuthority) {
+		return "", false
+	}
+	return parts[0] + ":" + parts[1], true
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate is found")
+	}
+	return certs, nil
+}
+
+// Verify returns the first Notation signature of the image which is accepted by the trust policy of the repository.
+// If the verification level of the trust policy is `skip`, no signature is verified and the result is Skipped.
+func (v *Verifier) Verify(ctx context.Context, imageRef string) (*Result, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse image ref `%s`", imageRef))
+	}
+	policy := v.policy.match(ref.Context())
+	if policy == nil {
+		return nil, fmt.Errorf("no trust policy is defined for the repository `%s`", ref.Context().Name())
+	}
+	if policy.SignatureVerification.Level == LevelSkip {
+		return &Result{Image: imageRef, Policy: policy.Name, Skipped: true}, nil
+	}
+	opts := v.remoteOptions(ctx)
+	desc, err := remote.Head(ref, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get the image `%s`", imageRef))
+	}
+	sigDescs, err := v.listSignatures(ctx, ref.Context(), desc.Digest.String(), opts)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to list signatures of the image `%s`", imageRef))
+	}
+	if len(sigDescs) == 0 {
+		return nil, fmt.Errorf("no notation signature is found for the image `%s`", imageRef)
+	}
+	errMsgs := []string{}
+	for i, sigDesc := range sigDescs {
+		if i >= maxSignatureAttempts {
+			errMsgs = append(errMsgs, fmt.Sprintf("only %d signatures are checked", maxSignatureAttempts))
+			break
+		}
+		result, err := v.verifySignature(ref.Context(), targetArtifact{MediaType: string(desc.MediaType), Digest: desc.Digest.String(), Size: desc.Size}, sigDesc, policy, opts)
+		if err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("[%s] %s", sigDesc.Digest, err.Error()))
+			continue
+		}
+		result.Image = imageRef
+		if v.Reject != nil {
+			if err := v.Reject(result); err != nil {
+				errMsgs = append(errMsgs, fmt.Sprintf("[%s] %s", sigDesc.Digest, err.Error()))
+				continue
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("no notation signature of the image `%s` is accepted by the trust policy `%s`; %s", imageRef, policy.Name, strings.Join(errMsgs, "; "))
+}
+
+// verifySignature verifies the signature envelope of the signature manifest by the trust policy
+func (v *Verifier) verifySignature(repo name.Repository, target targetArtifact, sigDesc descriptor, policy *TrustPolicy, opts []remote.Option) (*Result, error) {
+	envelopeDesc, err := getSignatureEnvelopeDescriptor(repo, target, sigDesc, opts)
+	if err != nil {
+		return nil, err
+	}
+	if envelopeDesc.MediaType != MediaTypeJWSEnvelope {
+		return nil, fmt.Errorf("unsupported signature envelope `%s`", envelopeDesc.MediaType)
+	}
+	data, err := getBlob(repo, *envelopeDesc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// integrity is always enforced
+	env, err := verifyJWSEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	signed := env.payload.TargetArtifact
+	if signed.Digest != target.Digest || signed.Size != target.Size || signed.MediaType != target.MediaType {
+		return nil, fmt.Errorf("the signature is made for another artifact `%s`", signed.Digest)
+	}
+
+	result := &Result{
+		Digest:      target.Digest,
+		Policy:      policy.Name,
+		Signer:      env.certChain[0].Subject.String(),
+		SignedTime:  env.signingTime(),
+		Certificate: env.certChain[0],
+		Signature:   env.signature,
+	}
+	now := time.Now()
+	validations := []struct {
+		name  string
+		check func() error
+	}{
+		{ValidationAuthenticity, func() error { return v.checkAuthenticity(env, policy) }},
+		{ValidationAuthenticTimestamp, func() error { return checkAuthenticTimestamp(env, now) }},
+		{ValidationExpiry, func() error { return checkExpiry(env, now) }},
+	}
+	for _, validation := range validations {
+		action := policy.action(validation.name)
+		if action == ActionSkip {
+			continue
+		}
+		if err := validation.check(); err != nil {
+			if action == ActionEnforce {
+				return nil, err
+			}
+			log.Warnf("the %s validation of the notation signature of `%s` failed; %s", validation.name, target.Digest, err.Error())
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %s", validation.name, err.Error()))
+		}
+	}
+	return result, nil
+}
+
+// checkAuthenticity verifies that the certificate chain in the envelope chains to a trust store of the policy at the signing time,
+// and that the signing certificate is one of the trusted identities
+func (v *Verifier) checkAuthenticity(env *signedEnvelope, policy *TrustPolicy) error {
+	storeType := TrustStoreTypeCA
+	if env.header.SigningScheme == SigningSchemeX509SigningAuthority {
+		storeType = TrustStoreTypeSigningAuthority
+	}
+	roots := x509.NewCertPool()
+	numRoots := 0
+	for _, store := range policy.trustStores(storeType) {
+		for _, cert := range v.trustStores[storeType+":"+store] {
+			roots.AddCert(cert)
+			numRoots++
+		}
+	}
+	if numRoots == 0 {
+		return fmt.Errorf("no trust store of the type `%s` is defined in the trust policy for the signing scheme `%s`", storeType, env.header.SigningScheme)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range env.certChain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := env.certChain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   *env.signingTime(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return errors.Wrap(err, "the signing certificate is not trusted")
+	}
+	if !policy.isTrustedIdentity(env.certChain[0]) {
+		return fmt.Errorf("the signer `%s` is not a trusted identity", env.certChain[0].Subject.String())
+	}
+	return nil
+}
+
+// checkAuthenticTimestamp checks the certificate chain at the current time, because the signing time asserted by the signer is not authentic.
+// The signing time of the signing authority scheme is authentic.
+func checkAuthenticTimestamp(env *signedEnvelope, now time.Time) error {
+	if env.header.SigningScheme == SigningSchemeX509SigningAuthority {
+		return nil
+	}
+	for _, cert := range env.certChain {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("the certificate `%s` is not valid at the current time", cert.Subject.String())
+		}
+	}
+	return nil
+}
+
+func checkExpiry(env *signedEnvelope, now time.Time) error {
+	if env.header.Expiry != nil && now.After(*env.header.Expiry) {
+		return fmt.Errorf("the signature expired at %s", env.header.Expiry.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (v *Verifier) remoteOptions(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(v.keychain()),
+		remote.WithTransport(v.transport()),
+	}
+}
+
+func (v *Verifier) keychain() authn.Keychain {
+	if v.Keychain != nil {
+		return v.Keychain
+	}
+	return authn.DefaultKeychain
+}
+
+func (v *Verifier) transport() http.RoundTripper {
+	if v.Transport != nil {
+		return v.Transport
+	}
+	return remote.DefaultTransport
+}
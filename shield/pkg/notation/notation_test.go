@@ -0,0 +1,485 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const testTrustPolicy = `{
+  "version": "1.0",
+  "trustPolicies": [
+    {
+      "name": "sample-images",
+      "registryScopes": ["%s/sample/app"],
+      "signatureVerification": {"level": "%s"%s},
+      "trustStores": ["ca:sample-ca"],
+      "trustedIdentities": ["x509.subject: O=sample-org, CN=%s"]
+    },
+    {
+      "name": "others",
+      "registryScopes": ["*"],
+      "signatureVerification": {"level": "skip"}
+    }
+  ]
+}`
+
+// testSigner signs images with Notation JWS envelopes and pushes the signatures to a local registry
+type testSigner struct {
+	registry string
+	caPEM    []byte
+	cert     *x509.Certificate
+	priv     *ecdsa.PrivateKey
+}
+
+func newTestSigner(registryHost string) (*testSigner, error) {
+	now := time.Now()
+	caPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sample-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caPriv.Public(), caPriv)
+	if err != nil {
+		return nil, err
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{Organization: []string{"sample-org"}, CommonName: "sample-builder"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, priv.Public(), caPriv)
+	if err != nil {
+		return nil, err
+	}
+	cert, _ := x509.ParseCertificate(certDER)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	return &testSigner{registry: registryHost, caPEM: caPEM, cert: cert, priv: priv}, nil
+}
+
+// pushImage pushes a random image and returns its descriptor
+func (s *testSigner) pushImage(ref string) (targetArtifact, error) {
+	img, err := random.Image(64, 1)
+	if err != nil {
+		return targetArtifact{}, err
+	}
+	r, _ := name.ParseReference(ref)
+	if err := remote.Write(r, img); err != nil {
+		return targetArtifact{}, err
+	}
+	desc, err := remote.Head(r)
+	if err != nil {
+		return targetArtifact{}, err
+	}
+	return targetArtifact{MediaType: string(desc.MediaType), Digest: desc.Digest.String(), Size: desc.Size}, nil
+}
+
+// envelope returns a JWS envelope of the target with the extra protected headers
+func (s *testSigner) envelope(target targetArtifact, extraHeaders map[string]interface{}) ([]byte, error) {
+	header := map[string]interface{}{
+		"alg":                    "ES256",
+		"cty":                    mediaTypePayload,
+		"crit":                   []string{headerSigningScheme},
+		headerSigningScheme:      SigningSchemeX509,
+		headerSigningTime:        time.Now().Add(-time.Minute).Format(time.RFC3339),
+		"io.cncf.notary.unknown": "ignored",
+	}
+	for k, v := range extraHeaders {
+		header[k] = v
+	}
+	headerJSON, _ := json.Marshal(header)
+	payloadJSON, _ := json.Marshal(payload{TargetArtifact: target})
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protected + "." + encodedPayload))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.priv, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+	return json.Marshal(map[string]interface{}{
+		"payload":   encodedPayload,
+		"protected": protected,
+		"header":    map[string]interface{}{"x5c": [][]byte{s.cert.Raw}},
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
+
+// pushSignature pushes the envelope as a signature manifest of the subject and returns its descriptor
+func (s *testSigner) pushSignature(repo string, subject targetArtifact, envelope []byte) (descriptor, error) {
+	r, _ := name.NewRepository(repo)
+	config := static.NewLayer([]byte("{}"), types.MediaType("application/vnd.oci.empty.v1+json"))
+	layer := static.NewLayer(envelope, types.MediaType(MediaTypeJWSEnvelope))
+	if err := remote.WriteLayer(r, config); err != nil {
+		return descriptor{}, err
+	}
+	if err := remote.WriteLayer(r, layer); err != nil {
+		return descriptor{}, err
+	}
+	configDigest, _ := config.Digest()
+	layerDigest, _ := layer.Digest()
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"artifactType":  ArtifactTypeSignature,
+		"config":        descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: configDigest.String(), Size: 2},
+		"layers":        []descriptor{{MediaType: MediaTypeJWSEnvelope, Digest: layerDigest.String(), Size: int64(len(envelope))}},
+		"subject":       descriptor{MediaType: subject.MediaType, Digest: subject.Digest, Size: subject.Size},
+	})
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+	if err := putManifest(fmt.Sprintf("http://%s/v2/%s/manifests/%s", s.registry, r.RepositoryStr(), digest), "application/vnd.oci.image.manifest.v1+json", manifest); err != nil {
+		return descriptor{}, err
+	}
+	return descriptor{MediaType: "application/vnd.oci.image.manifest.v1+json", ArtifactType: ArtifactTypeSignature, Digest: digest, Size: int64(len(manifest))}, nil
+}
+
+// pushReferrersTag pushes the referrers index of the subject with the referrers tag schema
+func (s *testSigner) pushReferrersTag(repo string, subject targetArtifact, referrers []descriptor) error {
+	r, _ := name.NewRepository(repo)
+	index, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeImageIndex,
+		"manifests":     referrers,
+	})
+	tag := strings.Replace(subject.Digest, ":", "-", 1)
+	return putManifest(fmt.Sprintf("http://%s/v2/%s/manifests/%s", s.registry, r.RepositoryStr(), tag), mediaTypeImageIndex, index)
+}
+
+func putManifest(url, mediaType string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to put a manifest: %s", resp.Status)
+	}
+	return nil
+}
+
+func newTestVerifier(s *testSigner, level, override, identity string) (*Verifier, error) {
+	return NewVerifier(map[string][]byte{
+		TrustPolicyKey:     []byte(fmt.Sprintf(testTrustPolicy, s.registry, level, override, identity)),
+		"ca.sample-ca.pem": s.caPEM,
+	})
+}
+
+func TestVerify(t *testing.T) {
+	// a local registry stand-in, which serves the referrers API only if referrersAPI is set
+	var referrersAPI []descriptor
+	reg := registry.New(registry.Logger(log.New(ioutil.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/referrers/") && referrersAPI != nil {
+			w.Header().Set("Content-Type", mediaTypeImageIndex)
+			_ = json.NewEncoder(w).Encode(imageIndex{Manifests: referrersAPI})
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	s, err := newTestSigner(host)
+	if err != nil {
+		t.Errorf("failed to create a signer: %s", err.Error())
+		return
+	}
+	repo := host + "/sample/app"
+	target, err := s.pushImage(repo + ":0.1.0")
+	if err != nil {
+		t.Errorf("failed to push an image: %s", err.Error())
+		return
+	}
+	other, _ := s.pushImage(repo + ":0.2.0")
+	envelope, _ := s.envelope(target, nil)
+	sigDesc, err := s.pushSignature(repo, target, envelope)
+	if err != nil {
+		t.Errorf("failed to push a signature: %s", err.Error())
+		return
+	}
+	// a signature of another image in the referrers of the target
+	otherEnvelope, _ := s.envelope(other, nil)
+	otherSigDesc, _ := s.pushSignature(repo, target, otherEnvelope)
+	if err = s.pushReferrersTag(repo, target, []descriptor{otherSigDesc, sigDesc}); err != nil {
+		t.Errorf("failed to push referrers: %s", err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	verifier, err := newTestVerifier(s, LevelStrict, "", "sample-builder")
+	if err != nil {
+		t.Errorf("failed to load the trust policy: %s", err.Error())
+		return
+	}
+	result, err := verifier.Verify(ctx, repo+":0.1.0")
+	if err != nil {
+		t.Errorf("failed to verify the signature with the referrers tag: %s", err.Error())
+		return
+	}
+	if result.Digest != target.Digest || result.Policy != "sample-images" || result.Signer != "CN=sample-builder,O=sample-org" {
+		t.Errorf("unexpected result: %+v", result)
+		return
+	}
+
+	// the referrers API is used if it is supported
+	referrersAPI = []descriptor{sigDesc}
+	if _, err = verifier.Verify(ctx, repo+"@"+target.Digest); err != nil {
+		t.Errorf("failed to verify the signature with the referrers API: %s", err.Error())
+		return
+	}
+	referrersAPI = []descriptor{}
+	if _, err = verifier.Verify(ctx, repo+"@"+target.Digest); err == nil {
+		t.Errorf("the image should not be verified without signatures in the referrers")
+		return
+	}
+	referrersAPI = nil
+
+	// signatures can be rejected, e.g. by a revocation list
+	verifier.Reject = func(r *Result) error { return fmt.Errorf("the signature by %s is revoked", r.Signer) }
+	if _, err = verifier.Verify(ctx, repo+":0.1.0"); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("the rejected signature should not be accepted: %v", err)
+		return
+	}
+
+	untrusted, _ := newTestVerifier(s, LevelStrict, "", "release-builder")
+	if _, err = untrusted.Verify(ctx, repo+":0.1.0"); err == nil || !strings.Contains(err.Error(), "not a trusted identity") {
+		t.Errorf("the signature by an untrusted identity should not be accepted: %v", err)
+		return
+	}
+	audit, _ := newTestVerifier(s, LevelAudit, "", "release-builder")
+	if result, err = audit.Verify(ctx, repo+":0.1.0"); err != nil || len(result.Warnings) != 1 {
+		t.Errorf("the signature should be accepted with a warning in the audit level: %v, %v", result, err)
+		return
+	}
+
+	expiredEnvelope, _ := s.envelope(other, map[string]interface{}{
+		"crit":       []string{headerSigningScheme, headerExpiry},
+		headerExpiry: time.Now().Add(-time.Second).Format(time.RFC3339),
+	})
+	expiredSigDesc, _ := s.pushSignature(repo, other, expiredEnvelope)
+	_ = s.pushReferrersTag(repo, other, []descriptor{expiredSigDesc})
+	if _, err = verifier.Verify(ctx, repo+":0.2.0"); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("the expired signature should not be accepted: %v", err)
+		return
+	}
+	expiryLogged, _ := newTestVerifier(s, LevelStrict, `, "override": {"expiry": "log"}`, "sample-builder")
+	if _, err = expiryLogged.Verify(ctx, repo+":0.2.0"); err != nil {
+		t.Errorf("the expired signature should be accepted by the override: %s", err.Error())
+		return
+	}
+
+	// images in other repositories are not verified by the `*` policy with the level `skip`
+	if result, err = verifier.Verify(ctx, host+"/sample/other:0.1.0"); err != nil || !result.Skipped {
+		t.Errorf("the image should be skipped: %v, %v", result, err)
+		return
+	}
+}
+
+func TestVerifyMalformedEnvelope(t *testing.T) {
+	s, err := newTestSigner("registry.example.com")
+	if err != nil {
+		t.Errorf("failed to create a signer: %s", err.Error())
+		return
+	}
+	target := targetArtifact{MediaType: "application/vnd.oci.image.manifest.v1+json", Digest: "sha256:" + strings.Repeat("0", 64), Size: 100}
+	envelope, err := s.envelope(target, nil)
+	if err != nil {
+		t.Errorf("failed to sign the target: %s", err.Error())
+		return
+	}
+	if _, err = verifyJWSEnvelope(envelope); err != nil {
+		t.Errorf("failed to verify the envelope: %s", err.Error())
+		return
+	}
+
+	// modify returns the envelope whose field is replaced with the value
+	modify := func(field string, value interface{}) []byte {
+		var env map[string]interface{}
+		_ = json.Unmarshal(envelope, &env)
+		env[field] = value
+		data, _ := json.Marshal(env)
+		return data
+	}
+	var env jwsEnvelope
+	_ = json.Unmarshal(envelope, &env)
+	otherPayload, _ := json.Marshal(payload{TargetArtifact: targetArtifact{MediaType: target.MediaType, Digest: "sha256:" + strings.Repeat("1", 64), Size: 100}})
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaCertDER, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{SerialNumber: big.NewInt(3)}, &x509.Certificate{SerialNumber: big.NewInt(3)}, rsaKey.Public(), rsaKey)
+
+	malformed := map[string][]byte{
+		"not JSON":             []byte("sample-envelope"),
+		"truncated JSON":       envelope[:len(envelope)/2],
+		"no certificate":       modify("header", map[string]interface{}{}),
+		"invalid certificate":  modify("header", map[string]interface{}{"x5c": [][]byte{[]byte("sample-certificate")}}),
+		"another certificate":  modify("header", map[string]interface{}{"x5c": [][]byte{rsaCertDER}}),
+		"protected not base64": modify("protected", "!"+env.Protected),
+		"protected not JSON":   modify("protected", base64.RawURLEncoding.EncodeToString([]byte("sample-header"))),
+		"signature not base64": modify("signature", "!"+env.Signature),
+		"tampered payload":     modify("payload", base64.RawURLEncoding.EncodeToString(otherPayload)),
+		"truncated signature":  modify("signature", env.Signature[:len(env.Signature)/2]),
+	}
+	headers := map[string]map[string]interface{}{
+		"unsupported critical header": {"crit": []string{headerSigningScheme, "io.cncf.notary.unknown"}},
+		"missing critical header":     {"crit": []string{headerSigningScheme, headerExpiry}},
+		"non-critical signing scheme": {"crit": []string{}},
+		"non-critical expiry":         {headerExpiry: time.Now().Add(time.Hour).Format(time.RFC3339)},
+		"unsupported signing scheme":  {headerSigningScheme: "notary.sample"},
+		"no signing time":             {headerSigningTime: nil},
+		"content type":                {"cty": "application/json"},
+		"none algorithm":              {"alg": "none"},
+		"HMAC algorithm":              {"alg": "HS256"},
+		"RSA algorithm":               {"alg": "PS256"},
+		"curve of algorithm":          {"alg": "ES384"},
+	}
+	for name, header := range headers {
+		malformed[name], err = s.envelope(target, header)
+		if err != nil {
+			t.Errorf("failed to sign the target (%s): %s", name, err.Error())
+			return
+		}
+	}
+	for name, data := range malformed {
+		if _, err = verifyJWSEnvelope(data); err == nil {
+			t.Errorf("the envelope with a malformed or tampered part (%s) should be rejected", name)
+			return
+		}
+	}
+}
+
+func TestVerifyJWSSignature(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Errorf("failed to generate a key: %s", err.Error())
+		return
+	}
+	signingInput := "sample-header.sample-payload"
+	digest := sha256.Sum256([]byte(signingInput))
+	sign := func(saltLength int) string {
+		sig, _ := rsa.SignPSS(rand.Reader, priv, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: saltLength})
+		return base64.RawURLEncoding.EncodeToString(sig)
+	}
+	if err = verifyJWSSignature("PS256", priv.Public(), signingInput, sign(rsa.PSSSaltLengthEqualsHash)); err != nil {
+		t.Errorf("failed to verify the RSASSA-PSS signature: %s", err.Error())
+		return
+	}
+	if err = verifyJWSSignature("PS256", priv.Public(), signingInput, sign(rsa.PSSSaltLengthAuto)); err == nil {
+		t.Errorf("the RSASSA-PSS signature with a salt of another size should be rejected")
+		return
+	}
+	if err = verifyJWSSignature("PS384", priv.Public(), signingInput, sign(rsa.PSSSaltLengthEqualsHash)); err == nil {
+		t.Errorf("the signature should be rejected with another algorithm")
+		return
+	}
+}
+
+func TestTrustPolicy(t *testing.T) {
+	invalidPolicies := []string{
+		// unsupported version
+		`{"version": "0.9", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "skip"}}]}`,
+		// the same scope in two policies
+		`{"version": "1.0", "trustPolicies": [
+			{"name": "a", "registryScopes": ["registry.example.com/app"], "signatureVerification": {"level": "skip"}},
+			{"name": "b", "registryScopes": ["registry.example.com/app"], "signatureVerification": {"level": "skip"}}]}`,
+		// no trust store
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "strict"}, "trustedIdentities": ["*"]}]}`,
+		// invalid trusted identity
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "strict"}, "trustStores": ["ca:a"], "trustedIdentities": ["CN=builder"]}]}`,
+		// integrity cannot be overridden
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "strict", "override": {"integrity": "log"}}, "trustStores": ["ca:a"], "trustedIdentities": ["*"]}]}`,
+		// wildcard in a registry scope
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["registry.example.com/*"], "signatureVerification": {"level": "skip"}}]}`,
+	}
+	for i, p := range invalidPolicies {
+		var doc TrustPolicyDocument
+		if err := json.Unmarshal([]byte(p), &doc); err != nil {
+			t.Errorf("failed to parse the trust policy %d: %s", i, err.Error())
+			return
+		}
+		if err := doc.Validate(); err == nil {
+			t.Errorf("the trust policy %d should be invalid", i)
+			return
+		}
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{Country: []string{"US"}, Organization: []string{"sample, inc."}, CommonName: "builder"}}
+	cert.Subject.Names = []pkix.AttributeTypeAndValue{
+		{Type: []int{2, 5, 4, 6}, Value: "US"},
+		{Type: []int{2, 5, 4, 10}, Value: "sample, inc."},
+		{Type: []int{2, 5, 4, 3}, Value: "builder"},
+	}
+	p := TrustPolicy{TrustedIdentities: []string{`x509.subject: CN=builder, O=sample\, inc.`}}
+	if !p.isTrustedIdentity(cert) {
+		t.Errorf("the subject should match the trusted identity")
+		return
+	}
+	p.TrustedIdentities = []string{"x509.subject: CN=builder, O=other"}
+	if p.isTrustedIdentity(cert) {
+		t.Errorf("the subject should not match the trusted identity")
+		return
+	}
+}
@@ -0,0 +1,188 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+)
+
+const (
+	mediaTypeImageIndex = "application/vnd.oci.image.index.v1+json"
+	maxManifestSize     = 4 << 20
+)
+
+// descriptor is an OCI descriptor with the artifact type, which is not supported by the registry client yet
+type descriptor struct {
+	MediaType    string `json:"mediaType"`
+	ArtifactType string `json:"artifactType,omitempty"`
+	Digest       string `json:"digest"`
+	Size         int64  `json:"size"`
+}
+
+type imageIndex struct {
+	Manifests []descriptor `json:"manifests"`
+}
+
+// signatureManifest is an OCI image manifest or an OCI artifact manifest of a signature
+type signatureManifest struct {
+	ArtifactType string       `json:"artifactType,omitempty"`
+	Config       *descriptor  `json:"config,omitempty"`
+	Layers       []descriptor `json:"layers,omitempty"`
+	Blobs        []descriptor `json:"blobs,omitempty"`
+	Subject      *descriptor  `json:"subject,omitempty"`
+}
+
+var errReferrersAPINotSupported = errors.New("the referrers API is not supported")
+
+// listSignatures returns the descriptors of Notation signatures of the image with the referrers API,
+// or with the referrers tag schema (`sha256-<hex>`) if the registry does not support the API
+func (v *Verifier) listSignatures(ctx context.Context, repo name.Repository, digest string, opts []remote.Option) ([]descriptor, error) {
+	index, err := v.getReferrers(ctx, repo, digest)
+	if errors.Is(err, errReferrersAPINotSupported) {
+		index, err = getReferrersByTag(repo, digest, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sigDescs := []descriptor{}
+	for _, d := range index.Manifests {
+		// a registry may ignore the filter of the artifact type
+		if d.ArtifactType == ArtifactTypeSignature {
+			sigDescs = append(sigDescs, d)
+		}
+	}
+	return sigDescs, nil
+}
+
+func (v *Verifier) getReferrers(ctx context.Context, repo name.Repository, digest string) (*imageIndex, error) {
+	auth, err := v.keychain().Resolve(repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the registry credentials")
+	}
+	tr, err := transport.NewWithContext(ctx, repo.Registry, auth, v.transport(), []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, err
+	}
+	u := url.URL{
+		Scheme:   repo.Registry.Scheme(),
+		Host:     repo.RegistryStr(),
+		Path:     fmt.Sprintf("/v2/%s/referrers/%s", repo.RepositoryStr(), digest),
+		RawQuery: "artifactType=" + url.QueryEscape(ArtifactTypeSignature),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeImageIndex)
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errReferrersAPINotSupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status of the referrers API: %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.HasPrefix(contentType, mediaTypeImageIndex) {
+		return nil, errReferrersAPINotSupported
+	}
+	var index imageIndex
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&index); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the referrers")
+	}
+	return &index, nil
+}
+
+func getReferrersByTag(repo name.Repository, digest string, opts []remote.Option) (*imageIndex, error) {
+	tag := repo.Tag(strings.Replace(digest, ":", "-", 1))
+	desc, err := remote.Get(tag, opts...)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return &imageIndex{}, nil
+		}
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get the referrers tag `%s`", tag.TagStr()))
+	}
+	var index imageIndex
+	if err := json.Unmarshal(desc.Manifest, &index); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the referrers")
+	}
+	return &index, nil
+}
+
+// getSignatureEnvelopeDescriptor returns the descriptor of the envelope in the signature manifest of the target artifact
+func getSignatureEnvelopeDescriptor(repo name.Repository, target targetArtifact, sigDesc descriptor, opts []remote.Option) (*descriptor, error) {
+	if sigDesc.Size > maxManifestSize {
+		return nil, fmt.Errorf("the signature manifest is too large: %d bytes", sigDesc.Size)
+	}
+	desc, err := remote.Get(repo.Digest(sigDesc.Digest), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the signature manifest")
+	}
+	var m signatureManifest
+	if err := json.Unmarshal(desc.Manifest, &m); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the signature manifest")
+	}
+	if m.Subject == nil || m.Subject.Digest != target.Digest {
+		return nil, errors.New("the signature manifest does not refer to the image")
+	}
+	blobs := m.Layers
+	if len(blobs) == 0 {
+		blobs = m.Blobs
+	}
+	if len(blobs) != 1 {
+		return nil, fmt.Errorf("the signature manifest must have one signature envelope, but has %d", len(blobs))
+	}
+	return &blobs[0], nil
+}
+
+func getBlob(repo name.Repository, d descriptor, opts []remote.Option) ([]byte, error) {
+	if d.Size > maxEnvelopeSize {
+		return nil, fmt.Errorf("the signature envelope is too large: %d bytes", d.Size)
+	}
+	layer, err := remote.Layer(repo.Digest(d.Digest), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the signature envelope")
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the signature envelope")
+	}
+	defer rc.Close()
+	// the digest is verified when the blob is read to the end
+	data, err := io.ReadAll(io.LimitReader(rc, maxEnvelopeSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the signature envelope")
+	}
+	if int64(len(data)) != d.Size {
+		return nil, fmt.Errorf("the size of the signature envelope is %d bytes, but %d bytes are expected", len(data), d.Size)
+	}
+	return data, nil
+}
@@ -0,0 +1,348 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+)
+
+const trustPolicyVersion = "1.0"
+
+// verification levels of a trust policy
+const (
+	LevelStrict     = "strict"
+	LevelPermissive = "permissive"
+	LevelAudit      = "audit"
+	LevelSkip       = "skip"
+)
+
+// validations which can be overridden in a trust policy. Integrity is always enforced.
+const (
+	ValidationAuthenticity       = "authenticity"
+	ValidationAuthenticTimestamp = "authenticTimestamp"
+	ValidationExpiry             = "expiry"
+	ValidationRevocation         = "revocation"
+)
+
+// actions of a validation
+const (
+	ActionEnforce = "enforce"
+	ActionLog     = "log"
+	ActionSkip    = "skip"
+)
+
+// types of trust stores
+const (
+	TrustStoreTypeCA               = "ca"
+	TrustStoreTypeSigningAuthority = "signingAuthority"
+)
+
+const (
+	wildcard                = "*"
+	trustedIdentityX509Subj = "x509.subject"
+)
+
+var levelActions = map[string]map[string]string{
+	LevelStrict: {
+		ValidationAuthenticity:       ActionEnforce,
+		ValidationAuthenticTimestamp: ActionEnforce,
+		ValidationExpiry:             ActionEnforce,
+		ValidationRevocation:         ActionEnforce,
+	},
+	LevelPermissive: {
+		ValidationAuthenticity:       ActionEnforce,
+		ValidationAuthenticTimestamp: ActionLog,
+		ValidationExpiry:             ActionLog,
+		ValidationRevocation:         ActionLog,
+	},
+	LevelAudit: {
+		ValidationAuthenticity:       ActionLog,
+		ValidationAuthenticTimestamp: ActionLog,
+		ValidationExpiry:             ActionLog,
+		ValidationRevocation:         ActionLog,
+	},
+}
+
+// TrustPolicyDocument is a Notation trust policy (trustpolicy.json)
+type TrustPolicyDocument struct {
+	Version       string        `json:"version"`
+	TrustPolicies []TrustPolicy `json:"trustPolicies"`
+}
+
+// TrustPolicy defines how signatures of images in the registry scopes are verified
+type TrustPolicy struct {
+	Name                  string                `json:"name"`
+	RegistryScopes        []string              `json:"registryScopes"`
+	SignatureVerification SignatureVerification `json:"signatureVerification"`
+	// e.g. `ca:acme-rockets`
+	TrustStores []string `json:"trustStores,omitempty"`
+	// e.g. `x509.subject: C=US, ST=WA, O=acme-rockets.io, CN=SecureBuilder`, or `*` for any identity
+	TrustedIdentities []string `json:"trustedIdentities,omitempty"`
+}
+
+// SignatureVerification is the verification level and overrides of validations
+type SignatureVerification struct {
+	Level    string            `json:"level"`
+	Override map[string]string `json:"override,omitempty"`
+}
+
+// Validate returns an error if the trust policies are not valid or a registry scope is in multiple policies
+func (d *TrustPolicyDocument) Validate() error {
+	if d.Version != trustPolicyVersion {
+		return fmt.Errorf("trust policy version must be `%s`; %s", trustPolicyVersion, d.Version)
+	}
+	if len(d.TrustPolicies) == 0 {
+		return errors.New("no trust policy is defined")
+	}
+	names := map[string]bool{}
+	scopes := map[string]string{}
+	for _, p := range d.TrustPolicies {
+		if p.Name == "" {
+			return errors.New("name of a trust policy must be set")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("trust policy `%s` is defined more than once", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.validate(); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid trust policy `%s`", p.Name))
+		}
+		for _, scope := range p.RegistryScopes {
+			if other, ok := scopes[scope]; ok {
+				return fmt.Errorf("registry scope `%s` is in both trust policies `%s` and `%s`", scope, other, p.Name)
+			}
+			scopes[scope] = p.Name
+		}
+	}
+	return nil
+}
+
+func (p TrustPolicy) validate() error {
+	if len(p.RegistryScopes) == 0 {
+		return errors.New("registryScopes must be set")
+	}
+	for _, scope := range p.RegistryScopes {
+		if scope == wildcard && len(p.RegistryScopes) > 1 {
+			return errors.New("`*` cannot be used with other registry scopes")
+		}
+		if scope == wildcard {
+			continue
+		}
+		if _, err := name.NewRepository(scope, name.StrictValidation); err != nil || !strings.Contains(scope, "/") {
+			return fmt.Errorf("registry scope must be `<registry>/<repository>` or `*`; %s", scope)
+		}
+	}
+	level := p.SignatureVerification.Level
+	if level == LevelSkip {
+		if len(p.TrustStores) > 0 || len(p.TrustedIdentities) > 0 || len(p.SignatureVerification.Override) > 0 {
+			return errors.New("trustStores, trustedIdentities and override cannot be set with the verification level `skip`")
+		}
+		return nil
+	}
+	if _, ok := levelActions[level]; !ok {
+		return fmt.Errorf("verification level must be one of strict, permissive, audit and skip; %s", level)
+	}
+	for validation, action := range p.SignatureVerification.Override {
+		if _, ok := levelActions[LevelStrict][validation]; !ok {
+			return fmt.Errorf("validation `%s` cannot be overridden", validation)
+		}
+		if action != ActionEnforce && action != ActionLog && action != ActionSkip {
+			return fmt.Errorf("action of `%s` must be one of enforce, log and skip; %s", validation, action)
+		}
+		if validation == ValidationAuthenticity && action == ActionSkip {
+			return errors.New("authenticity cannot be skipped")
+		}
+	}
+	if len(p.TrustStores) == 0 {
+		return errors.New("trustStores must be set")
+	}
+	for _, store := range p.TrustStores {
+		parts := strings.SplitN(store, ":", 2)
+		if len(parts) != 2 || parts[1] == "" || (parts[0] != TrustStoreTypeCA && parts[0] != TrustStoreTypeSigningAuthority) {
+			return fmt.Errorf("trust store must be `ca:<name>` or `signingAuthority:<name>`; %s", store)
+		}
+	}
+	if len(p.TrustedIdentities) == 0 {
+		return errors.New("trustedIdentities must be set")
+	}
+	for _, identity := range p.TrustedIdentities {
+		if identity == wildcard {
+			if len(p.TrustedIdentities) > 1 {
+				return errors.New("`*` cannot be used with other trusted identities")
+			}
+			continue
+		}
+		if _, err := parseTrustedIdentity(identity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match returns the trust policy of the repository. A policy with the repository in the scopes is preferred to a policy with `*`.
+func (d *TrustPolicyDocument) match(repository name.Repository) *TrustPolicy {
+	var wildcardPolicy *TrustPolicy
+	for i, p := range d.TrustPolicies {
+		for _, scope := range p.RegistryScopes {
+			if scope == wildcard {
+				wildcardPolicy = &d.TrustPolicies[i]
+				continue
+			}
+			// e.g. `docker.io/library/nginx` is `index.docker.io/library/nginx`
+			if repo, err := name.NewRepository(scope, name.StrictValidation); err == nil && repo.Name() == repository.Name() {
+				return &d.TrustPolicies[i]
+			}
+		}
+	}
+	return wildcardPolicy
+}
+
+// action returns the action of the validation by the verification level and the override
+func (p *TrustPolicy) action(validation string) string {
+	if action, ok := p.SignatureVerification.Override[validation]; ok {
+		return action
+	}
+	return levelActions[p.SignatureVerification.Level][validation]
+}
+
+// trustStores returns the names of the trust stores of the type in the policy
+func (p *TrustPolicy) trustStores(storeType string) []string {
+	names := []string{}
+	for _, store := range p.TrustStores {
+		if parts := strings.SplitN(store, ":", 2); len(parts) == 2 && parts[0] == storeType {
+			names = append(names, parts[1])
+		}
+	}
+	return names
+}
+
+// isTrustedIdentity returns true if the subject of the signing certificate has all attributes of one of the trusted identities
+func (p *TrustPolicy) isTrustedIdentity(cert *x509.Certificate) bool {
+	subject := subjectAttributes(cert)
+	for _, identity := range p.TrustedIdentities {
+		if identity == wildcard {
+			return true
+		}
+		attrs, err := parseTrustedIdentity(identity)
+		if err != nil {
+			continue
+		}
+		matched := true
+		for k, v := range attrs {
+			if !containsString(subject[k], v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedIdentity parses `x509.subject: <DN>` into attributes, e.g. `CN=SecureBuilder, O=acme-rockets.io`.
+// A comma in a value is escaped with a backslash.
+func parseTrustedIdentity(identity string) (map[string]string, error) {
+	parts := strings.SplitN(identity, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) != trustedIdentityX509Subj {
+		return nil, fmt.Errorf("trusted identity must be `x509.subject: <distinguished name>` or `*`; %s", identity)
+	}
+	attrs := map[string]string{}
+	for _, rdn := range splitEscaped(parts[1], ',') {
+		kv := strings.SplitN(rdn, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid distinguished name in the trusted identity; %s", identity)
+		}
+		k := strings.ToUpper(strings.TrimSpace(kv[0]))
+		v := strings.TrimSpace(kv[1])
+		if k == "" || v == "" {
+			return nil, fmt.Errorf("invalid distinguished name in the trusted identity; %s", identity)
+		}
+		if _, ok := attrs[k]; ok {
+			return nil, fmt.Errorf("attribute `%s` is set more than once in the trusted identity; %s", k, identity)
+		}
+		attrs[k] = v
+	}
+	if len(attrs) == 0 {
+		return nil, fmt.Errorf("no attribute is set in the trusted identity; %s", identity)
+	}
+	return attrs, nil
+}
+
+func splitEscaped(s string, sep rune) []string {
+	parts := []string{}
+	current := strings.Builder{}
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == sep:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	return append(parts, current.String())
+}
+
+// short names of subject attributes in distinguished names
+var attributeNames = map[string]string{
+	"2.5.4.3":              "CN",
+	"2.5.4.5":              "SERIALNUMBER",
+	"2.5.4.6":              "C",
+	"2.5.4.7":              "L",
+	"2.5.4.8":              "ST",
+	"2.5.4.9":              "STREET",
+	"2.5.4.10":             "O",
+	"2.5.4.11":             "OU",
+	"2.5.4.17":             "POSTALCODE",
+	"1.2.840.113549.1.9.1": "E",
+}
+
+func subjectAttributes(cert *x509.Certificate) map[string][]string {
+	attrs := map[string][]string{}
+	for _, atv := range cert.Subject.Names {
+		attrName, ok := attributeNames[atv.Type.String()]
+		if !ok {
+			attrName = atv.Type.String()
+		}
+		if v, ok := atv.Value.(string); ok {
+			attrs[attrName] = append(attrs[attrName], v)
+		}
+	}
+	return attrs
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	kubeutil "github.com/stolostron/integrity-shield/shield/pkg/kubernetes"
+	admission "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sjson "k8s.io/apimachinery/pkg/util/json"
+	kubeclient "k8s.io/client-go/kubernetes"
+)
+
+// Allow message
+var (
+	SkipExpression = "Allowed by skip expression."
+)
+
+type expressionResult struct {
+	inScope      bool
+	skip         bool
+	ignoreFields []string
+}
+
+// evalExpressionRules evaluates CEL expressions in the rule and the common profile.
+// An error is returned only if the expressions cannot be compiled.
+// Evaluation errors are logged and handled so that verification is not skipped by mistake.
+func evalExpressionRules(request *admission.AdmissionRequest, resource unstructured.Unstructured, ruleExprs, commonExprs *config.ExpressionRules) (*expressionResult, error) {
+	result := &expressionResult{inScope: true}
+	if !ruleExprs.Enabled() && !commonExprs.Enabled() {
+		return result, nil
+	}
+	ruleCompiled, err := config.GetCompiledExpressionRules(ruleExprs)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid expressions in the profile")
+	}
+	commonCompiled, err := config.GetCompiledExpressionRules(commonExprs)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid expressions in the request filter profile")
+	}
+	useNamespace := ruleExprs.UsesVariable(config.ExpressionVarNamespaceObject) || commonExprs.UsesVariable(config.ExpressionVarNamespaceObject)
+	vars := makeExpressionVariables(request, resource, useNamespace)
+
+	logger := log.WithFields(log.Fields{
+		"namespace": request.Namespace,
+		"name":      request.Name,
+		"kind":      request.Kind.Kind,
+		"operation": request.Operation,
+	})
+	inScope, err := ruleCompiled.InScope(vars)
+	if err != nil {
+		logger.Warningf("scope expression is handled as true; %s", err.Error())
+		inScope = true
+	}
+	result.inScope = inScope
+
+	for _, compiled := range []*config.CompiledExpressionRules{ruleCompiled, commonCompiled} {
+		skip, err := compiled.Skip(vars)
+		if err != nil {
+			logger.Warningf("skip expression is handled as false; %s", err.Error())
+			skip = false
+		}
+		result.skip = result.skip || skip
+		fields, err := compiled.IgnoreFields(vars)
+		if err != nil {
+			logger.Warningf("some ignore expressions are handled as false; %s", err.Error())
+		}
+		result.ignoreFields = append(result.ignoreFields, fields...)
+	}
+	return result, nil
+}
+
+// makeExpressionVariables returns `object`, `oldObject`, `request` and `namespaceObject` for expressions.
+// Integers are kept as int so that expressions like `object.spec.replicas > 3` work.
+func makeExpressionVariables(request *admission.AdmissionRequest, resource unstructured.Unstructured, useNamespace bool) map[string]interface{} {
+	vars := map[string]interface{}{
+		config.ExpressionVarObject:          resource.Object,
+		config.ExpressionVarOldObject:       nil,
+		config.ExpressionVarRequest:         nil,
+		config.ExpressionVarNamespaceObject: nil,
+	}
+	if len(request.OldObject.Raw) > 0 {
+		var oldResource unstructured.Unstructured
+		err := json.Unmarshal(request.OldObject.Raw, &oldResource)
+		if err == nil {
+			vars[config.ExpressionVarOldObject] = oldResource.Object
+		}
+	}
+	reqWithoutObjects := request.DeepCopy()
+	reqWithoutObjects.Object = runtime.RawExtension{}
+	reqWithoutObjects.OldObject = runtime.RawExtension{}
+	reqBytes, err := json.Marshal(reqWithoutObjects)
+	if err == nil {
+		var reqMap map[string]interface{}
+		if err := k8sjson.Unmarshal(reqBytes, &reqMap); err == nil {
+			vars[config.ExpressionVarRequest] = reqMap
+		}
+	}
+	if useNamespace && request.Namespace != "" {
+		nsObj, err := getNamespaceObject(request.Namespace)
+		if err != nil {
+			log.Debugf("namespaceObject is null because the namespace `%s` is not found; %s", request.Namespace, err.Error())
+		} else {
+			vars[config.ExpressionVarNamespaceObject] = nsObj
+		}
+	}
+	return vars
+}
+
+func getNamespaceObject(name string) (map[string]interface{}, error) {
+	ns, err := getNamespace(name)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(ns)
+}
+
+// NamespaceGetter returns a Namespace by name, e.g. from an informer cache.
+type NamespaceGetter func(name string) (*corev1.Namespace, error)
+
+var (
+	namespaceGetter NamespaceGetter
+	namespaceClient kubeclient.Interface
+	namespaceMu     sync.Mutex
+)
+
+// SetNamespaceGetter sets the getter for Namespaces which are referred by expressions and signer bindings.
+// If it is not set, Namespaces are read from the API server with a client which is created at the first call.
+func SetNamespaceGetter(getter NamespaceGetter) {
+	namespaceMu.Lock()
+	defer namespaceMu.Unlock()
+	namespaceGetter = getter
+}
+
+func getNamespace(name string) (*corev1.Namespace, error) {
+	namespaceMu.Lock()
+	getter := namespaceGetter
+	if getter == nil && namespaceClient == nil {
+		kubeconf, err := kubeutil.GetKubeConfig()
+		if err != nil {
+			namespaceMu.Unlock()
+			return nil, err
+		}
+		client, err := kubeclient.NewForConfig(kubeconf)
+		if err != nil {
+			namespaceMu.Unlock()
+			return nil, err
+		}
+		namespaceClient = client
+	}
+	client := namespaceClient
+	namespaceMu.Unlock()
+
+	if getter != nil {
+		return getter(name)
+	}
+	return client.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+}
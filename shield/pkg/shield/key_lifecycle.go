@@ -0,0 +1,215 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/keystore"
+	"github.com/stolostron/integrity-shield/shield/pkg/tlog"
+	"github.com/stolostron/integrity-shield/shield/pkg/tsa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ManifestVerifyResult is a result of VerifyResource with checks of key lifecycle and signer bindings
+type ManifestVerifyResult struct {
+	*k8smanifest.VerifyResourceResult
+	// set if a signature is verified but not accepted, e.g. by the validity window of the key
+	FailReason string
+	Warnings   []string
+	// set if the rule has a signature threshold
+	SignatureThreshold *config.SignatureThresholdResult
+	// set if the transparency log entry of the signature is verified
+	TlogEntry *tlog.Entry
+	// set if the rule has keyless identities or a keyless certificate root
+	KeylessIdentity *config.KeylessIdentityResult
+	// set if the signature is made with a key in a PGP keyring
+	PGPSigner *config.PGPSignerResult
+	// names of the VerificationKeys which verified the signatures
+	VerificationKeys []string
+	// set if the signature has a timestamp which is verified with the timestamp authority of the rule
+	Timestamp *tsa.Timestamp
+}
+
+// verifyManifestWithKeys verifies the resource with all keys without lifecycle or signer bindings at once, as before,
+// and then with each key which has a validity window, is retiring or is bound by signer bindings.
+func verifyManifestWithKeys(resource unstructured.Unstructured, keyConfigs []config.KeyConfig, signatureRef config.SignatureRef, vo *k8smanifest.VerifyResourceOption, verifyCache *VerifyResultCache, authz *signerAuthorization, timestamps *trustedTimestamps) (*ManifestVerifyResult, error) {
+	plain, individual := splitKeyConfigs(keyConfigs, authz)
+	if len(individual) == 0 {
+		result, err := verifyManifestWithKeySubset(resource, keyConfigs, signatureRef, vo, verifyCache)
+		if err != nil {
+			return nil, err
+		}
+		if result.Verified {
+			if authzErr := authz.authorize(nil, result.Signer); authzErr != nil {
+				return rejectedManifestVerifyResult(result, []string{authzErr.Error()}), nil
+			}
+		}
+		return &ManifestVerifyResult{VerifyResourceResult: result}, nil
+	}
+
+	attempts := [][]config.KeyConfig{}
+	if len(plain) > 0 {
+		attempts = append(attempts, plain)
+	}
+	for _, key := range individual {
+		attempts = append(attempts, []config.KeyConfig{key})
+	}
+
+	now := time.Now()
+	errMsgs := []string{}
+	failReasons := []string{}
+	var unverified, rejected *k8smanifest.VerifyResourceResult
+	for i, keys := range attempts {
+		result, err := verifyManifestWithKeySubset(resource, keys, signatureRef, vo, verifyCache)
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		if !result.Verified {
+			if unverified == nil {
+				unverified = result
+			}
+			continue
+		}
+		// keys without lifecycle or signer bindings are verified together
+		var key *config.KeyConfig
+		if i > 0 || len(plain) == 0 {
+			key = &keys[0]
+		}
+		var checkErr error
+		if key != nil {
+			// the trusted timestamp is used instead of the signed time asserted by the signer if the rule has a timestamp authority
+			var signedTime *time.Time
+			signedTime, checkErr = timestamps.signedTime(*key, result.SignedTime)
+			if checkErr == nil {
+				checkErr = key.CheckSignedTime(signedTime, now)
+			}
+		}
+		if checkErr == nil {
+			checkErr = authz.authorize(key, result.Signer)
+		}
+		if checkErr != nil {
+			failReasons = append(failReasons, checkErr.Error())
+			if rejected == nil {
+				rejected = result
+			}
+			continue
+		}
+		mvResult := &ManifestVerifyResult{VerifyResourceResult: result}
+		if key != nil && key.Retiring {
+			mvResult.Warnings = append(mvResult.Warnings, retiringKeyWarning(*key))
+		}
+		if key != nil && key.VerificationKeyName != "" {
+			mvResult.VerificationKeys = []string{key.VerificationKeyName}
+		}
+		return mvResult, nil
+	}
+
+	if rejected != nil {
+		return rejectedManifestVerifyResult(rejected, failReasons), nil
+	}
+	if unverified != nil {
+		return &ManifestVerifyResult{VerifyResourceResult: unverified}, nil
+	}
+	if len(errMsgs) == 1 {
+		return nil, errors.New(errMsgs[0])
+	}
+	return nil, fmt.Errorf("failed to verify signature with any key; %s", strings.Join(errMsgs, "; "))
+}
+
+// splitKeyConfigs returns keys which can be verified together and keys which must be verified one by one
+func splitKeyConfigs(keyConfigs []config.KeyConfig, authz *signerAuthorization) ([]config.KeyConfig, []config.KeyConfig) {
+	plain, individual := config.SplitKeyConfigsByLifecycle(keyConfigs)
+	unbound := []config.KeyConfig{}
+	for _, k := range plain {
+		// x509 keys are resolved from the certificate in the signature, so each of them is verified alone.
+		// VerificationKeys are also verified alone to report which of them verified the signature.
+		if authz.isBoundKey(k) || k.X509 != nil || k.VerificationKeyName != "" {
+			individual = append(individual, k)
+		} else {
+			unbound = append(unbound, k)
+		}
+	}
+	return unbound, individual
+}
+
+// rejectedManifestVerifyResult returns a result for a signature which is verified but not accepted
+func rejectedManifestVerifyResult(result *k8smanifest.VerifyResourceResult, failReasons []string) *ManifestVerifyResult {
+	return rejectResult(&ManifestVerifyResult{VerifyResourceResult: result}, fmt.Sprintf("the signature by %s is not accepted; %s", result.Signer, strings.Join(failReasons, "; ")))
+}
+
+// rejectResult returns an unverified copy of the result with the reason, and keeps all other details such as warnings and the tlog entry.
+// The result itself is not changed, because it may be shared by other profiles through the cache.
+func rejectResult(result *ManifestVerifyResult, reason string) *ManifestVerifyResult {
+	r := *result.VerifyResourceResult
+	r.Verified = false
+	mvResult := *result
+	mvResult.VerifyResourceResult = &r
+	mvResult.FailReason = reason
+	mvResult.Warnings = append([]string{}, result.Warnings...)
+	mvResult.VerificationKeys = append([]string{}, result.VerificationKeys...)
+	return &mvResult
+}
+
+func verifyManifestWithKeySubset(resource unstructured.Unstructured, keyConfigs []config.KeyConfig, signatureRef config.SignatureRef, vo *k8smanifest.VerifyResourceOption, verifyCache *VerifyResultCache) (*k8smanifest.VerifyResourceResult, error) {
+	attemptVo := *vo
+	if len(keyConfigs) == 1 && keyConfigs[0].X509 != nil {
+		// only the accepted signature set is passed to k8s-manifest-sigstore
+		issuerRef, signedResource, err := getX509SignatureSet(resource, keyConfigs[0], vo)
+		if err != nil {
+			return nil, err
+		}
+		attemptVo.KeyPath = issuerRef
+		resource = signedResource
+	} else if len(keyConfigs) != 0 {
+		keyPathList, err := keystore.Default().GetKeyRefs(keyConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load keys: %s", err.Error())
+		}
+		if len(keyPathList) == 0 {
+			return nil, fmt.Errorf("KeyConfigs is not properly configured, failed to set public key.")
+		}
+		attemptVo.KeyPath = strings.Join(keyPathList, ",")
+	}
+	// the result is shared among profiles with the same keys, signature reference and verify option
+	cacheKey := makeKeyedManifestVerifyCacheKey(keyConfigs, signatureRef, &attemptVo)
+	cached, err := verifyCache.Do(cacheKey, func() (interface{}, error) {
+		return k8smanifest.VerifyResource(resource, &attemptVo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, _ := cached.(*k8smanifest.VerifyResourceResult)
+	if result == nil {
+		return nil, errors.New("VerifyResource returned no result")
+	}
+	return result, nil
+}
+
+func retiringKeyWarning(key config.KeyConfig) string {
+	msg := fmt.Sprintf("this resource depends on the retiring %s", key.Description())
+	if key.NotAfter != nil {
+		msg = fmt.Sprintf("%s which is valid until %s", msg, key.NotAfter.Format(time.RFC3339))
+	}
+	return msg + "; sign it again with an active key"
+}
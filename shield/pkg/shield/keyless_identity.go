@@ -0,0 +1,116 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	ishieldimage "github.com/stolostron/integrity-shield/shield/pkg/image"
+	"github.com/stolostron/integrity-shield/shield/pkg/keyless"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// hasKeylessIdentityPolicy returns true if certificates of keyless signatures are checked by Integrity Shield
+func hasKeylessIdentityPolicy(rule *config.ManifestVerifyRule) bool {
+	return rule.IsKeyless() && (len(rule.KeylessIdentities) > 0 || rule.KeylessCertificateRoot != "")
+}
+
+// applyKeylessIdentityPolicy checks the certificate of a verified keyless signature with the certificate roots
+// and the keyless identities of the rule. The result becomes unverified if no certificate is accepted.
+func applyKeylessIdentityPolicy(rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption, result *ManifestVerifyResult) *ManifestVerifyResult {
+	if result == nil || result.VerifyResourceResult == nil || !result.Verified || !hasKeylessIdentityPolicy(rule) {
+		return result
+	}
+	identity, err := verifyKeylessIdentity(rule, resource, vo)
+	if err != nil {
+		return rejectResult(result, fmt.Sprintf("the keyless signature by %s is not accepted; %s", result.Signer, err.Error()))
+	}
+	mvResult := *result
+	mvResult.KeylessIdentity = identity
+	return &mvResult
+}
+
+// verifyKeylessIdentity returns the identity of the first signature whose certificate is issued by the roots and matches the identities
+func verifyKeylessIdentity(rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption) (*config.KeylessIdentityResult, error) {
+	roots, err := keyless.LoadCertificateRoots(rule.KeylessCertificateRoot)
+	if err != nil {
+		return nil, err
+	}
+	if vo.ResourceBundleRef != "" {
+		// every bundle must be signed by one of the identities
+		var identity *config.KeylessIdentityResult
+		for _, ref := range k8smnfutil.SplitCommaSeparatedString(vo.ResourceBundleRef) {
+			identity, err = ishieldimage.VerifyKeylessIdentityInImage(context.Background(), ref, roots, rule.KeylessIdentities)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return identity, nil
+	}
+	sigSets, err := getSignatureSets(resource, vo)
+	if err != nil {
+		return nil, err
+	}
+	errMsgs := []string{}
+	for _, sigSet := range sigSets {
+		if sigSet[signatureSetCertificateKey] == "" {
+			continue
+		}
+		identity, err := verifyKeylessIdentityInSignatureSet(roots, sigSet, rule.KeylessIdentities)
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		return identity, nil
+	}
+	if len(errMsgs) == 0 {
+		return nil, errors.New("no certificate is found in the signature")
+	}
+	return nil, errors.New(strings.Join(errMsgs, "; "))
+}
+
+// verifyKeylessIdentityInSignatureSet checks that the signature is made with the certificate, because
+// signature sets in annotations share one message and any one of them may have been verified.
+func verifyKeylessIdentityInSignatureSet(roots *keyless.CertificateRoots, sigSet map[string]string, identities config.KeylessIdentityList) (*config.KeylessIdentityResult, error) {
+	certPEM, err := decodeGzipBase64(sigSet[signatureSetCertificateKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the certificate; %s", err.Error())
+	}
+	cert, err := keyless.ParseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the certificate; %s", err.Error())
+	}
+	message, err := decodeGzipBase64(sigSet[signatureSetMessageKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the message; %s", err.Error())
+	}
+	signature, err := base64.StdEncoding.DecodeString(sigSet[signatureSetSignatureKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the signature; %s", err.Error())
+	}
+	if err = keyless.VerifySignature(cert, message, signature); err != nil {
+		return nil, fmt.Errorf("the signature is not made with the certificate; %s", err.Error())
+	}
+	return roots.VerifyIdentity(cert, identities)
+}
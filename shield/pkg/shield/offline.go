@@ -0,0 +1,67 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"errors"
+	"fmt"
+
+	cosign "github.com/sigstore/cosign/cmd/cosign/cli"
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// InitializeSigstore initializes cosign, or checks the mounted trust material in offline mode
+func InitializeSigstore() {
+	if !config.IsOfflineMode() {
+		log.Info("initialize cosign.")
+		//  "TUF_ROOT" is set to "/ishield-app/sigstore"
+		_ = cosign.Initialize()
+		return
+	}
+	log.Info("offline mode is enabled; the mounted trust material is used instead of the TUF repository.")
+	if err := config.CheckOfflineTrustMaterial(); err != nil {
+		log.Warningf("verification which needs the trust material will fail; %s", err.Error())
+	}
+}
+
+// checkOfflineVerification returns an error if the verification of the resource needs network access in offline mode
+func checkOfflineVerification(rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption) error {
+	if !config.IsOfflineMode() {
+		return nil
+	}
+	err := rule.CheckOffline()
+	if err != nil {
+		return fmt.Errorf("offline mode: %s", err.Error())
+	}
+	if !rule.IsKeyless() {
+		return nil
+	}
+	// a keyless signature without a bundle is searched in the transparency log
+	sigSets, err := getSignatureSets(resource, vo)
+	if err != nil {
+		return err
+	}
+	for _, sigSet := range sigSets {
+		if sigSet[signatureSetBundleKey] != "" {
+			return nil
+		}
+	}
+	return errors.New("offline mode: the keyless signature has no Rekor bundle, and the transparency log cannot be searched in offline mode")
+}
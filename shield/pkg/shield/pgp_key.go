@@ -0,0 +1,111 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/keystore"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyPGPKeyringPolicy records the PGP key which made the verified signature.
+// If all keys of the rule are PGP keyrings, the result becomes unverified when no key in them is accepted, e.g. the key has expired.
+func applyPGPKeyringPolicy(rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption, result *ManifestVerifyResult) *ManifestVerifyResult {
+	if result == nil || result.VerifyResourceResult == nil || !result.Verified || vo.ResourceBundleRef != "" {
+		return result
+	}
+	keyrings, pgpOnly := pgpKeyringConfigs(rule)
+	if len(keyrings) == 0 {
+		return result
+	}
+	signer, err := verifyPGPSigner(keyrings, resource, vo)
+	if err != nil {
+		if !pgpOnly {
+			// the signature may be verified with another key
+			log.Debugf("the signature is not verified with PGP keyrings; %s", err.Error())
+			return result
+		}
+		return rejectResult(result, fmt.Sprintf("the PGP signature by %s is not accepted; %s", result.Signer, err.Error()))
+	}
+	mvResult := *result
+	mvResult.PGPSigner = signer
+	return &mvResult
+}
+
+// pgpKeyringConfigs returns PGP keyrings of the rule and of the threshold signers, and whether the rule has no other keys
+func pgpKeyringConfigs(rule *config.ManifestVerifyRule) ([]config.KeyConfig, bool) {
+	all := append([]config.KeyConfig{}, rule.KeyConfigs...)
+	if rule.SignatureThreshold != nil {
+		for _, s := range rule.SignatureThreshold.Signers {
+			all = append(all, s.KeyConfigs...)
+		}
+	}
+	keyrings := []config.KeyConfig{}
+	for _, k := range all {
+		if k.PGPKeyring != nil {
+			keyrings = append(keyrings, k)
+		}
+	}
+	return keyrings, len(keyrings) == len(all)
+}
+
+// verifyPGPSigner returns the key of the first signature which is made with one of the keyrings
+func verifyPGPSigner(keyrings []config.KeyConfig, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption) (*config.PGPSignerResult, error) {
+	sigSets, err := getSignatureSets(resource, vo)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	errMsgs := []string{}
+	for _, sigSet := range sigSets {
+		message, err := decodeGzipBase64(sigSet[signatureSetMessageKey])
+		if err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("failed to decode the message; %s", err.Error()))
+			continue
+		}
+		// the signature is an armored PGP signature encoded in base64
+		signature, err := base64.StdEncoding.DecodeString(sigSet[signatureSetSignatureKey])
+		if err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("failed to decode the signature; %s", err.Error()))
+			continue
+		}
+		for _, k := range keyrings {
+			keyring, err := keystore.Default().GetPGPKeyring(*k.PGPKeyring)
+			if err != nil {
+				return nil, err
+			}
+			signer, err := keyring.Verify(message, signature, now)
+			if err != nil {
+				errMsgs = append(errMsgs, err.Error())
+				continue
+			}
+			return signer, nil
+		}
+	}
+	if len(errMsgs) == 0 {
+		return nil, errors.New("no signature is found")
+	}
+	return nil, errors.New(strings.Join(errMsgs, "; "))
+}
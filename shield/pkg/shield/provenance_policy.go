@@ -0,0 +1,168 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	ishieldimage "github.com/stolostron/integrity-shield/shield/pkg/image"
+)
+
+// attestationVerifier verifies signatures of provenance attestations
+type attestationVerifier interface {
+	VerifyImage(ctx context.Context, imageRef string) ([][]byte, error)
+	VerifyEnvelope(ctx context.Context, envelope []byte) ([]byte, error)
+}
+
+// newProvenanceVerifier returns a verifier with the keys of the rule and its threshold signers, or with the keyless identities of the rule
+func newProvenanceVerifier(rule *config.ManifestVerifyRule) attestationVerifier {
+	keyConfigs := []config.KeyConfig{}
+	keyConfigs = append(keyConfigs, rule.KeyConfigs...)
+	if rule.SignatureThreshold != nil {
+		for _, signer := range rule.SignatureThreshold.Signers {
+			keyConfigs = append(keyConfigs, signer.KeyConfigs...)
+		}
+	}
+	return ishieldimage.NewAttestationVerifier(keyConfigs, rule.KeylessIdentities, rule.KeylessCertificateRoot)
+}
+
+// checkProvenancePolicy returns an error if no provenance is attached, or if the signature of any attached provenance
+// is not verified or any verified provenance does not satisfy the policy. The policy is never evaluated on an unverified attestation.
+func checkProvenancePolicy(ctx context.Context, policy *config.ProvenancePolicy, verifier attestationVerifier, provenances []*k8smanifest.Provenance, now time.Time) error {
+	violations := []string{}
+	found := 0
+	for _, prov := range provenances {
+		if prov == nil || prov.RawAttestation == "" {
+			continue
+		}
+		found++
+		statements, err := verifyProvenanceAttestation(ctx, verifier, prov)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("[%s] the signature of the provenance is not verified; %s", provenanceArtifactName(prov), err.Error()))
+			continue
+		}
+		for _, raw := range statements {
+			statement, err := config.ParseProvenanceStatement(string(raw))
+			if err == nil {
+				err = policy.Check(*statement, now)
+			}
+			if err != nil {
+				violations = append(violations, fmt.Sprintf("[%s] %s", provenanceArtifactName(prov), err.Error()))
+			}
+		}
+	}
+	if found == 0 {
+		return errors.New("no provenance is attached")
+	}
+	if len(violations) > 0 {
+		return errors.New(strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// verifyProvenanceAttestation returns the in-toto statements of the provenance whose signatures are verified.
+// Provenance in a ConfigMap must be a signed DSSE envelope. Provenance of an image is read from the cosign attestations
+// attached to the image, instead of the unsigned statement which is found in the transparency log by the image digest.
+func verifyProvenanceAttestation(ctx context.Context, verifier attestationVerifier, prov *k8smanifest.Provenance) ([][]byte, error) {
+	if prov.ConfigMapRef != "" {
+		statement, err := verifier.VerifyEnvelope(ctx, []byte(prov.RawAttestation))
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{statement}, nil
+	}
+	imageRef, err := provenanceImageRef(prov)
+	if err != nil {
+		return nil, err
+	}
+	attested, err := verifier.VerifyImage(ctx, imageRef)
+	if err != nil {
+		return nil, err
+	}
+	statements := [][]byte{}
+	for _, raw := range attested {
+		if isProvenanceStatement(raw) {
+			statements = append(statements, raw)
+		}
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no signed provenance is attached to the image `%s`", imageRef)
+	}
+	return statements, nil
+}
+
+// provenanceImageRef returns the image ref with the digest of the provenance
+func provenanceImageRef(prov *k8smanifest.Provenance) (string, error) {
+	if prov.Artifact == "" {
+		return "", errors.New("the artifact of the provenance is unknown")
+	}
+	if prov.Hash == "" {
+		return prov.Artifact, nil
+	}
+	ref, err := name.ParseReference(prov.Artifact)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the artifact `%s` of the provenance; %s", prov.Artifact, err.Error())
+	}
+	digest := prov.Hash
+	if !strings.Contains(digest, ":") {
+		digest = "sha256:" + digest
+	}
+	return ref.Context().Digest(digest).String(), nil
+}
+
+// isProvenanceStatement returns true for SLSA provenance and Tekton Chains provenance, but not for other predicates such as SBOMs
+func isProvenanceStatement(raw []byte) bool {
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+	}
+	if err := json.Unmarshal(raw, &statement); err != nil {
+		return false
+	}
+	return strings.Contains(statement.PredicateType, "provenance")
+}
+
+func provenanceArtifactName(prov *k8smanifest.Provenance) string {
+	if prov.Artifact != "" {
+		return prov.Artifact
+	}
+	if prov.ConfigMapRef != "" {
+		return prov.ConfigMapRef
+	}
+	return string(prov.ArtifactType)
+}
+
+// applyProvenancePolicy makes a verified result unverified if the signature of the provenance is not verified
+// with the keys or the keyless identities of the rule, or if the provenance does not satisfy the policy
+func applyProvenancePolicy(rule *config.ManifestVerifyRule, result *ManifestVerifyResult) *ManifestVerifyResult {
+	policy := rule.ProvenancePolicy
+	if policy == nil || result == nil || result.VerifyResourceResult == nil || !result.Verified {
+		return result
+	}
+	err := checkProvenancePolicy(context.Background(), policy, newProvenanceVerifier(rule), result.Provenances, time.Now())
+	if err == nil {
+		return result
+	}
+	return rejectResult(result, fmt.Sprintf("the provenance does not satisfy the provenance policy; %s", err.Error()))
+}
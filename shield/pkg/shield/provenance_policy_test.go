@@ -0,0 +1,132 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+const (
+	sampleProvenance = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[],"predicate":{"builder":{"id":"https://github.com/slsa-framework/slsa-github-generator/generic@v1"},"buildType":"https://github.com/slsa-framework/slsa-github-generator/generic@v1"}}`
+	otherProvenance  = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[],"predicate":{"builder":{"id":"https://example.com/untrusted-builder"},"buildType":"https://github.com/slsa-framework/slsa-github-generator/generic@v1"}}`
+	sampleSBOM       = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://cyclonedx.org/bom","subject":[],"predicate":{}}`
+)
+
+// fakeAttestationVerifier returns the statements of verified attestations for each image, and accepts only the listed envelopes
+type fakeAttestationVerifier struct {
+	images    map[string][]string
+	envelopes map[string]string
+}
+
+func (f *fakeAttestationVerifier) VerifyImage(ctx context.Context, imageRef string) ([][]byte, error) {
+	statements, ok := f.images[imageRef]
+	if !ok {
+		return nil, errors.New("no attestation is verified")
+	}
+	raw := [][]byte{}
+	for _, s := range statements {
+		raw = append(raw, []byte(s))
+	}
+	return raw, nil
+}
+
+func (f *fakeAttestationVerifier) VerifyEnvelope(ctx context.Context, envelope []byte) ([]byte, error) {
+	statement, ok := f.envelopes[string(envelope)]
+	if !ok {
+		return nil, errors.New("the attestation is not verified with the keys")
+	}
+	return []byte(statement), nil
+}
+
+func TestCheckProvenancePolicy(t *testing.T) {
+	policy := &k8smnfconfig.ProvenancePolicy{
+		BuilderIDs: []string{"https://github.com/slsa-framework/slsa-github-generator/*"},
+	}
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	signedImage := "registry.example.com/signed-image@" + digest
+	verifier := &fakeAttestationVerifier{
+		images: map[string][]string{
+			signedImage: {sampleProvenance, sampleSBOM},
+			"registry.example.com/other-image@" + digest: {otherProvenance},
+			"registry.example.com/sbom-image@" + digest:  {sampleSBOM},
+		},
+		envelopes: map[string]string{
+			"signed-envelope": sampleProvenance,
+		},
+	}
+	imageProv := func(image string) *k8smanifest.Provenance {
+		// the statement found in the transparency log is not used for the policy
+		return &k8smanifest.Provenance{RawAttestation: sampleProvenance, Artifact: "registry.example.com/" + image + ":v1", Hash: digest}
+	}
+
+	testCases := []struct {
+		name        string
+		provenances []*k8smanifest.Provenance
+		wantErr     string
+	}{
+		{
+			name:        "verified provenance of an image",
+			provenances: []*k8smanifest.Provenance{imageProv("signed-image")},
+		},
+		{
+			name:        "verified provenance in a configmap",
+			provenances: []*k8smanifest.Provenance{{RawAttestation: "signed-envelope", ConfigMapRef: "k8s://ConfigMap/sample-ns/sample-prov"}},
+		},
+		{
+			name:        "no provenance",
+			provenances: []*k8smanifest.Provenance{{Artifact: "registry.example.com/signed-image:v1"}},
+			wantErr:     "no provenance is attached",
+		},
+		{
+			name:        "unsigned statement in a configmap",
+			provenances: []*k8smanifest.Provenance{{RawAttestation: sampleProvenance, ConfigMapRef: "k8s://ConfigMap/sample-ns/sample-prov"}},
+			wantErr:     "the signature of the provenance is not verified",
+		},
+		{
+			name:        "image without verified attestations",
+			provenances: []*k8smanifest.Provenance{imageProv("signed-image"), imageProv("unsigned-image")},
+			wantErr:     "the signature of the provenance is not verified",
+		},
+		{
+			name:        "verified provenance which does not satisfy the policy",
+			provenances: []*k8smanifest.Provenance{imageProv("other-image")},
+			wantErr:     "builder ID `https://example.com/untrusted-builder` is not allowed",
+		},
+		{
+			name:        "image with verified attestations but no provenance",
+			provenances: []*k8smanifest.Provenance{imageProv("sbom-image")},
+			wantErr:     "no signed provenance is attached",
+		},
+	}
+	for _, tc := range testCases {
+		err := checkProvenancePolicy(context.Background(), policy, verifier, tc.provenances, time.Now())
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: got: %v\nwant an error with: %s", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -28,7 +28,9 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/stolostron/integrity-shield/shield/pkg/config"
+	ishieldimage "github.com/stolostron/integrity-shield/shield/pkg/image"
 	kubeutil "github.com/stolostron/integrity-shield/shield/pkg/kubernetes"
+	"github.com/stolostron/integrity-shield/shield/pkg/tlog"
 	kubeclient "k8s.io/client-go/kubernetes"
 
 	// "sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -49,6 +51,17 @@ const (
 const timeFormat = "2006-01-02T15:04:05Z"
 
 func RequestHandler(req *admission.AdmissionRequest, paramObj *config.ParameterObject) *ResultFromRequestHandler {
+	return RequestHandlerWithContext(context.Background(), req, paramObj, nil)
+}
+
+// RequestHandlerWithContext is RequestHandler with a context which bounds the verification.
+// When the context is done, the remaining steps (image verification, events and decision logs) are not run
+// because the caller has already responded to the request.
+// If verifyCache is not nil, identical verification work is shared with other profiles evaluated for the same request.
+func RequestHandlerWithContext(ctx context.Context, req *admission.AdmissionRequest, paramObj *config.ParameterObject, verifyCache *VerifyResultCache) *ResultFromRequestHandler {
+	if ctx.Err() != nil {
+		return NewIncompleteResult(req, paramObj, "Verification was canceled: "+ctx.Err().Error())
+	}
 	// load request handler config
 	rhconfig, err := config.LoadRequestHandlerConfig()
 	if err != nil {
@@ -88,27 +101,7 @@ func RequestHandler(req *admission.AdmissionRequest, paramObj *config.ParameterO
 	}).Info("Process new request")
 
 	// get enforce action
-	enforce := false
-	if paramObj.Action == nil {
-		if rhconfig.DefaultConstraintAction.Mode != "" {
-			if rhconfig.DefaultConstraintAction.Mode == "enforce" {
-				enforce = true
-			}
-		}
-	} else {
-		if paramObj.Action.Mode != "enforce" && paramObj.Action.Mode != "inform" {
-			log.WithFields(log.Fields{
-				"namespace": req.Namespace,
-				"name":      req.Name,
-				"kind":      req.Kind.Kind,
-				"operation": req.Operation,
-				"userName":  req.UserInfo.Username,
-			}).Warningf("Run mode should be set to 'enforce' or 'inform' in rule,%s", paramObj.ConstraintName)
-		}
-		if paramObj.Action.Mode == "enforce" {
-			enforce = true
-		}
-	}
+	enforce := isEnforceAction(req, paramObj, rhconfig)
 	if enforce {
 		log.Info("Enforce action is enabled.")
 	} else {
@@ -119,6 +112,15 @@ func RequestHandler(req *admission.AdmissionRequest, paramObj *config.ParameterO
 	allow := false
 	message := ""
 
+	// subresource check
+	if handled, subAllow, subMessage := CheckSubresourceRequest(req, paramObj.SubresourcePolicies); handled {
+		r := makeResultFromRequestHandler(subAllow, subMessage, enforce, req)
+		if rhconfig.SideEffectConfig.CreateDenyEvent {
+			_ = createOrUpdateEvent(req, r, paramObj.ConstraintName)
+		}
+		return r
+	}
+
 	// prepare manifest verify config
 	dryRunNs := os.Getenv("POD_NAMESPACE")
 	if dryRunNs == "" {
@@ -127,14 +129,24 @@ func RequestHandler(req *admission.AdmissionRequest, paramObj *config.ParameterO
 	mvConfig := &config.ManifestVerifyConfig{
 		RequestFilterProfile: rhconfig.RequestFilterProfile,
 		DryRunNamespcae:      dryRunNs,
+		RevocationList:       rhconfig.RevocationList,
 	}
 
 	// verify resource
-	allow, message, err = VerifyResource(req, mvConfig, &paramObj.ManifestVerifyRule)
+	allow, message, detail, err := verifyResource(req, mvConfig, &paramObj.ManifestVerifyRule, verifyCache)
 	if err != nil {
 		log.Errorf("IntegrityShield failed to decide the response. %s", err.Error())
 		return makeResultFromRequestHandler(allow, message, enforce, req)
 	}
+	if ctx.Err() != nil {
+		log.WithFields(log.Fields{
+			"namespace": req.Namespace,
+			"name":      req.Name,
+			"kind":      req.Kind.Kind,
+			"operation": req.Operation,
+		}).Warningf("verification is canceled after manifest verification: %s", paramObj.ConstraintName)
+		return makeResultFromRequestHandler(false, "IntegrityShield failed to decide the response. Verification was canceled: "+ctx.Err().Error(), enforce, req)
+	}
 
 	// report decision log if skip user
 	if allow && message == SkipUser {
@@ -144,13 +156,32 @@ func RequestHandler(req *admission.AdmissionRequest, paramObj *config.ParameterO
 	}
 
 	// verify image
-	imageAllow, imageMessage := VerifyImagesInManifest(req, paramObj.ImageProfile)
+	imageAllow, imageMessage, imageResults := verifyImagesInManifest(ctx, req, paramObj.ImageProfile, rhconfig.RevocationList, verifyCache)
 	if allow && !imageAllow {
 		message = imageMessage
 		allow = false
+	} else if allow && imageMessage != "" {
+		message = fmt.Sprintf("%s, [Image] %s", message, imageMessage)
 	}
 
 	r := makeResultFromRequestHandler(allow, message, enforce, req)
+	r.Warnings = detail.Warnings
+	r.SignatureThreshold = detail.SignatureThreshold
+	r.TlogEntry = detail.TlogEntry
+	r.KeylessIdentity = detail.KeylessIdentity
+	r.PGPSigner = detail.PGPSigner
+	r.VerificationKeys = detail.VerificationKeys
+	r.ImageKeylessIdentities = ishieldimage.KeylessIdentities(imageResults)
+	r.ImageResults = imageResults
+	for _, w := range detail.Warnings {
+		log.WithFields(log.Fields{
+			"namespace": req.Namespace,
+			"name":      req.Name,
+			"kind":      req.Kind.Kind,
+			"operation": req.Operation,
+			"userName":  req.UserInfo.Username,
+		}).Warning(w)
+	}
 	// generate events
 	if rhconfig.SideEffectConfig.CreateDenyEvent {
 		_ = createOrUpdateEvent(req, r, paramObj.ConstraintName)
@@ -165,9 +196,60 @@ func RequestHandler(req *admission.AdmissionRequest, paramObj *config.ParameterO
 	return r
 }
 
+// NewIncompleteResult returns a result for a request which could not be evaluated, e.g. because of timeout.
+// The request is denied only if the action of the profile is enforce.
+func NewIncompleteResult(req *admission.AdmissionRequest, paramObj *config.ParameterObject, message string) *ResultFromRequestHandler {
+	rhconfig, err := config.LoadRequestHandlerConfig()
+	if err != nil || rhconfig == nil {
+		rhconfig = &config.RequestHandlerConfig{}
+	}
+	enforce := isEnforceAction(req, paramObj, rhconfig)
+	errMsg := "IntegrityShield failed to decide the response. " + message
+	return makeResultFromRequestHandler(false, errMsg, enforce, req)
+}
+
+func isEnforceAction(req *admission.AdmissionRequest, paramObj *config.ParameterObject, rhconfig *config.RequestHandlerConfig) bool {
+	enforce := false
+	if paramObj.Action == nil {
+		if rhconfig.DefaultConstraintAction.Mode != "" {
+			if rhconfig.DefaultConstraintAction.Mode == "enforce" {
+				enforce = true
+			}
+		}
+	} else {
+		if paramObj.Action.Mode != "enforce" && paramObj.Action.Mode != "inform" {
+			log.WithFields(log.Fields{
+				"namespace": req.Namespace,
+				"name":      req.Name,
+				"kind":      req.Kind.Kind,
+				"operation": req.Operation,
+				"userName":  req.UserInfo.Username,
+			}).Warningf("Run mode should be set to 'enforce' or 'inform' in rule,%s", paramObj.ConstraintName)
+		}
+		if paramObj.Action.Mode == "enforce" {
+			enforce = true
+		}
+	}
+	return enforce
+}
+
 type ResultFromRequestHandler struct {
-	Allow   bool   `json:"allow"`
-	Message string `json:"message"`
+	Allow    bool     `json:"allow"`
+	Message  string   `json:"message"`
+	Warnings []string `json:"warnings,omitempty"`
+	// signers found and missing for the signature threshold of the rule
+	SignatureThreshold *config.SignatureThresholdResult `json:"signatureThreshold,omitempty"`
+	// transparency log entry of the verified signature
+	TlogEntry *tlog.Entry `json:"tlogEntry,omitempty"`
+	// keyless identities which matched the certificates of the resource signature and the image signatures
+	KeylessIdentity        *config.KeylessIdentityResult  `json:"keylessIdentity,omitempty"`
+	ImageKeylessIdentities []config.KeylessIdentityResult `json:"imageKeylessIdentities,omitempty"`
+	// result of each image, e.g. the resolved digest and the signer
+	ImageResults []ishieldimage.ImageVerifyResult `json:"imageResults,omitempty"`
+	// fingerprint and UID of the PGP key which made the signature
+	PGPSigner *config.PGPSignerResult `json:"pgpSigner,omitempty"`
+	// names of the VerificationKeys which verified the signature
+	VerificationKeys []string `json:"verificationKeys,omitempty"`
 }
 
 func makeResultFromRequestHandler(allow bool, msg string, enforce bool, req *admission.AdmissionRequest) *ResultFromRequestHandler {
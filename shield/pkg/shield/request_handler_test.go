@@ -17,6 +17,7 @@
 package shield
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"testing"
@@ -122,3 +123,35 @@ func TestMutationCheck(t *testing.T) {
 		return
 	}
 }
+
+func TestRequestHandlerWithCanceledContext(t *testing.T) {
+	adreqBytes, err := ioutil.ReadFile(adreq1Path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var adreq *admission.AdmissionRequest
+	err = json.Unmarshal(adreqBytes, &adreq)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	paramObj := &k8smnfconfig.ParameterObject{
+		ConstraintName: "sample-constraint",
+		Action:         &k8smnfconfig.Action{Mode: "enforce"},
+	}
+	r := RequestHandlerWithContext(ctx, adreq, paramObj, nil)
+	if r.Allow {
+		t.Errorf("a request with a canceled context must not be allowed: %s", r.Message)
+		return
+	}
+	paramObj.Action.Mode = "inform"
+	r = RequestHandlerWithContext(ctx, adreq, paramObj, nil)
+	if !r.Allow {
+		t.Errorf("a request with a canceled context must be allowed in inform mode: %s", r.Message)
+		return
+	}
+}
@@ -0,0 +1,177 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	ishieldimage "github.com/stolostron/integrity-shield/shield/pkg/image"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ApplyRevocationList rejects the verified result if the signer, the key, the signature or the signed manifest is revoked.
+// The observer calls this with the revocation list in the RequestHandlerConfig after VerifyManifestWithRule.
+func ApplyRevocationList(revocations *config.RevocationList, rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption, result *ManifestVerifyResult) *ManifestVerifyResult {
+	return applyRevocationList(revocations, rule, resource, vo, result)
+}
+
+func applyRevocationList(revocations *config.RevocationList, rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption, result *ManifestVerifyResult) *ManifestVerifyResult {
+	if revocations.Empty() || result == nil || result.VerifyResourceResult == nil || !result.Verified {
+		return result
+	}
+	entry, err := findRevocation(revocations, rule, resource, vo, result)
+	if err != nil {
+		// the signature cannot be accepted if it is unknown whether it is revoked
+		return rejectedRevocationResult(result, fmt.Sprintf("failed to check the revocation list; %s", err.Error()))
+	}
+	if entry == nil {
+		return result
+	}
+	log.Infof("the signature of %s `%s` is rejected; %s", resource.GetKind(), resource.GetName(), entry.String())
+	return rejectedRevocationResult(result, entry.String())
+}
+
+func rejectedRevocationResult(result *ManifestVerifyResult, reason string) *ManifestVerifyResult {
+	return rejectResult(result, fmt.Sprintf("the signature by %s is not accepted; %s", result.Signer, reason))
+}
+
+// findRevocation returns the first entry which revokes the signer or one of the signature sets of the resource.
+// For signatures in an image, the image, its signatures and the keys or the certificates which made them are checked.
+func findRevocation(revocations *config.RevocationList, rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption, result *ManifestVerifyResult) (*config.RevocationEntry, error) {
+	if entry := revocations.CheckSigner(result.Signer); entry != nil {
+		return entry, nil
+	}
+	if result.KeylessIdentity != nil {
+		if entry := revocations.CheckSigner(result.KeylessIdentity.Subject); entry != nil {
+			return entry, nil
+		}
+	}
+	if result.PGPSigner != nil {
+		if entry := revocations.CheckKeyFingerprint(result.PGPSigner.Fingerprint); entry != nil {
+			return entry, nil
+		}
+	}
+	keys, err := loadPublicKeys(ruleKeyConfigs(rule))
+	if err != nil {
+		return nil, err
+	}
+	if vo.ResourceBundleRef != "" {
+		// every bundle is checked, because the resource is verified only if all of them are signed
+		for _, ref := range k8smnfutil.SplitCommaSeparatedString(vo.ResourceBundleRef) {
+			entry, err := ishieldimage.FindRevocationInImage(context.Background(), ref, keys, revocations)
+			if err != nil || entry != nil {
+				return entry, err
+			}
+		}
+		return nil, nil
+	}
+	sigSets, err := getSignatureSets(resource, vo)
+	if err != nil {
+		return nil, err
+	}
+	for _, sigSet := range sigSets {
+		entry, err := findRevocationInSignatureSet(revocations, sigSet, keys)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+func findRevocationInSignatureSet(revocations *config.RevocationList, sigSet map[string]string, keys []crypto.PublicKey) (*config.RevocationEntry, error) {
+	if sigSet[signatureSetSignatureKey] == "" {
+		return nil, nil
+	}
+	message, err := decodeGzipBase64(sigSet[signatureSetMessageKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the message; %s", err.Error())
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigSet[signatureSetSignatureKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the signature; %s", err.Error())
+	}
+	if entry := revocations.CheckSignature(sig); entry != nil {
+		return entry, nil
+	}
+	if entry := revocations.CheckManifest(message); entry != nil {
+		return entry, nil
+	}
+	if sigSet[signatureSetCertificateKey] != "" {
+		cert, err := decodeSignatureCertificate(sigSet[signatureSetCertificateKey])
+		if err != nil {
+			return nil, err
+		}
+		return revocations.CheckKey(cert.PublicKey), nil
+	}
+	// the key which made the signature is not recorded in the signature set, so it is found by verifying the signature again
+	for _, pub := range keys {
+		if !isSignedWithKey(pub, sig, message) {
+			continue
+		}
+		if entry := revocations.CheckKey(pub); entry != nil {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// isSignedWithKey returns true if the signature of the message is made with the public key
+func isSignedWithKey(pub crypto.PublicKey, sig, message []byte) bool {
+	verifier, err := signature.LoadVerifier(pub, crypto.SHA256)
+	if err != nil {
+		return false
+	}
+	return verifier.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message)) == nil
+}
+
+// loadPublicKeys returns PEM public keys of the keys. PGP keyrings and x509 CAs are not loaded.
+func loadPublicKeys(all []config.KeyConfig) ([]crypto.PublicKey, error) {
+	keyConfigs := []config.KeyConfig{}
+	for _, k := range all {
+		if k.PGPKeyring == nil && k.X509 == nil {
+			keyConfigs = append(keyConfigs, k)
+		}
+	}
+	keyData, err := loadKeyData(keyConfigs)
+	if err != nil {
+		return nil, err
+	}
+	keys := []crypto.PublicKey{}
+	for _, data := range keyData {
+		pub, err := cryptoutils.UnmarshalPEMToPublicKey(data)
+		if err != nil {
+			// e.g. a PGP public key in a secret
+			log.Debugf("the key is not loaded as a public key; %s", err.Error())
+			continue
+		}
+		keys = append(keys, pub)
+	}
+	return keys, nil
+}
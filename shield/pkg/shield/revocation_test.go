@@ -0,0 +1,119 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyRevocationList(t *testing.T) {
+	message := []byte("sample-message")
+	signerKey := generateTestKey(t)
+	signerCert := createTestCertificate(t, &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "sample-signer"},
+		EmailAddresses: []string{"signer@example.com"},
+	}, nil, signerKey, signerKey)
+	sig := signTestMessage(t, signerKey, message)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signerCert.Raw})
+
+	c := k8smanifest.AnnotationConfig{}
+	resource := unstructured.Unstructured{}
+	resource.SetAnnotations(map[string]string{
+		c.MessageAnnotationKey():      base64.StdEncoding.EncodeToString(k8smnfutil.GzipCompress(message)),
+		c.SignatureAnnotationKey(0):   base64.StdEncoding.EncodeToString(sig),
+		c.CertificateAnnotationKey(0): base64.StdEncoding.EncodeToString(k8smnfutil.GzipCompress(certPEM)),
+	})
+	rule := &k8smnfconfig.ManifestVerifyRule{}
+	vo := &k8smanifest.VerifyResourceOption{}
+	newResult := func() *ManifestVerifyResult {
+		return &ManifestVerifyResult{
+			VerifyResourceResult: &k8smanifest.VerifyResourceResult{Verified: true, Signer: "signer@example.com"},
+			Warnings:             []string{"sample warning"},
+		}
+	}
+	fingerprint, _ := k8smnfconfig.KeyFingerprint(signerKey.Public())
+
+	cases := []struct {
+		name    string
+		entry   k8smnfconfig.RevocationEntry
+		revoked bool
+	}{
+		{"revoked signer", k8smnfconfig.RevocationEntry{Signer: "signer@*"}, true},
+		{"revoked key in the certificate", k8smnfconfig.RevocationEntry{KeyFingerprint: fingerprint}, true},
+		{"revoked signature", k8smnfconfig.RevocationEntry{SignatureDigest: testSHA256Digest(sig)}, true},
+		{"revoked manifest", k8smnfconfig.RevocationEntry{ManifestDigest: testSHA256Digest(message)}, true},
+		{"other signer", k8smnfconfig.RevocationEntry{Signer: "other@example.com"}, false},
+		{"other manifest", k8smnfconfig.RevocationEntry{ManifestDigest: testSHA256Digest([]byte("other-message"))}, false},
+	}
+	for _, c := range cases {
+		revocations := &k8smnfconfig.RevocationList{Entries: []k8smnfconfig.RevocationEntry{c.entry}}
+		result := newResult()
+		applied := applyRevocationList(revocations, rule, resource, vo, result)
+		if c.revoked {
+			if applied.Verified {
+				t.Errorf("%s should be rejected", c.name)
+				return
+			}
+			if applied.FailReason == "" || len(applied.Warnings) != 1 {
+				t.Errorf("%s: the rejected result should have the reason and keep the details: %+v", c.name, applied)
+				return
+			}
+		} else if !applied.Verified {
+			t.Errorf("%s should not be rejected: %s", c.name, applied.FailReason)
+			return
+		}
+		if !result.Verified {
+			t.Errorf("%s: the original result should not be changed", c.name)
+			return
+		}
+	}
+
+	// the observer calls the exported function
+	revocations := &k8smnfconfig.RevocationList{Entries: []k8smnfconfig.RevocationEntry{{KeyFingerprint: fingerprint}}}
+	if applied := ApplyRevocationList(revocations, rule, resource, vo, newResult()); applied.Verified {
+		t.Errorf("signature by the revoked key should be rejected")
+		return
+	}
+	if applied := ApplyRevocationList(nil, rule, resource, vo, newResult()); !applied.Verified {
+		t.Errorf("signature should be accepted without a revocation list")
+		return
+	}
+	unverified := newResult()
+	unverified.Verified = false
+	if applied := ApplyRevocationList(revocations, rule, resource, vo, unverified); applied != unverified {
+		t.Errorf("unverified result should be returned as it is")
+		return
+	}
+}
+
+func testSHA256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
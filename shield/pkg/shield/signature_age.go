@@ -0,0 +1,57 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"fmt"
+	"time"
+
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+// applySignatureAgePolicy makes a verified result unverified if the signature is older than maxSignatureAge and the grace period
+func applySignatureAgePolicy(rule *config.ManifestVerifyRule, result *ManifestVerifyResult, now time.Time) *ManifestVerifyResult {
+	if rule.MaxSignatureAge == nil || result == nil || result.VerifyResourceResult == nil || !result.Verified {
+		return result
+	}
+	warning, err := rule.CheckSignatureAge(signatureAgeTime(result), now)
+	if err != nil {
+		return rejectResult(result, fmt.Sprintf("the signature is not accepted by maxSignatureAge; %s", err.Error()))
+	}
+	if warning != "" {
+		mvResult := *result
+		mvResult.Warnings = append(append([]string{}, result.Warnings...), warning)
+		return &mvResult
+	}
+	return result
+}
+
+// signatureAgeTime returns the time from which the signature age is calculated.
+// The time of a verified timestamp and the integrated time of a verified tlog entry are used in this order.
+// If neither is available, the signed time asserted by the signer in the signature is used as a fallback,
+// and it is not verified by any third party.
+func signatureAgeTime(result *ManifestVerifyResult) *time.Time {
+	if result.Timestamp != nil {
+		t := result.Timestamp.Time
+		return &t
+	}
+	if result.TlogEntry != nil {
+		t := result.TlogEntry.IntegratedTime
+		return &t
+	}
+	return result.SignedTime
+}
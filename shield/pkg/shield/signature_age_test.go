@@ -0,0 +1,75 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/tlog"
+	"github.com/stolostron/integrity-shield/shield/pkg/tsa"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplySignatureAgePolicy(t *testing.T) {
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	rule := &k8smnfconfig.ManifestVerifyRule{MaxSignatureAge: &metav1.Duration{Duration: 24 * time.Hour}}
+	recent := now.Add(-time.Hour)
+	old := now.Add(-48 * time.Hour)
+
+	newResult := func(signedTime time.Time) *ManifestVerifyResult {
+		return &ManifestVerifyResult{
+			VerifyResourceResult: &k8smanifest.VerifyResourceResult{Verified: true, Signer: "sample-signer", SignedTime: &signedTime},
+			Warnings:             []string{"sample warning"},
+			VerificationKeys:     []string{"sample-key"},
+		}
+	}
+
+	// the signed time asserted by the signer is used only if nothing else is verified
+	if r := applySignatureAgePolicy(rule, newResult(recent), now); !r.Verified {
+		t.Errorf("recent signature should be accepted: %s", r.FailReason)
+		return
+	}
+
+	// the integrated time of the verified tlog entry is used instead of the asserted time
+	withTlog := newResult(recent)
+	withTlog.TlogEntry = &tlog.Entry{IntegratedTime: old}
+	rejected := applySignatureAgePolicy(rule, withTlog, now)
+	if rejected.Verified {
+		t.Errorf("signature integrated into the log long ago should not be accepted")
+		return
+	}
+	if rejected.TlogEntry == nil || len(rejected.Warnings) != 1 || len(rejected.VerificationKeys) != 1 || rejected.Signer != "sample-signer" {
+		t.Errorf("rejected result should keep the details: %+v", rejected)
+		return
+	}
+	if !withTlog.Verified {
+		t.Errorf("the original result should not be changed")
+		return
+	}
+
+	// the time of the verified timestamp is used before the tlog entry
+	withTimestamp := newResult(old)
+	withTimestamp.TlogEntry = &tlog.Entry{IntegratedTime: old}
+	withTimestamp.Timestamp = &tsa.Timestamp{Time: recent}
+	if r := applySignatureAgePolicy(rule, withTimestamp, now); !r.Verified {
+		t.Errorf("signature with a recent timestamp should be accepted: %s", r.FailReason)
+		return
+	}
+}
@@ -0,0 +1,113 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// verifyManifestWithThreshold verifies the resource with each signer in the threshold,
+// and the resource is verified only if signatures by enough signers are found.
+// ruleKeyConfigs are used for signers which have only an identity.
+func verifyManifestWithThreshold(resource unstructured.Unstructured, threshold *config.SignatureThreshold, ruleKeyConfigs []config.KeyConfig, signatureRef config.SignatureRef, vo *k8smanifest.VerifyResourceOption, verifyCache *VerifyResultCache, authz *signerAuthorization, timestamps *trustedTimestamps) (*ManifestVerifyResult, error) {
+	thresholdResult := &config.SignatureThresholdResult{
+		MinSigners: threshold.MinSigners,
+		Found:      []string{},
+		Missing:    []string{},
+	}
+	errMsgs := []string{}
+	failReasons := []string{}
+	warnings := []string{}
+	verificationKeys := []string{}
+	var verified, unverified *ManifestVerifyResult
+	for _, signer := range threshold.Signers {
+		keyConfigs := signer.KeyConfigs
+		signerVo := *vo
+		if signer.Identity != "" {
+			if len(keyConfigs) == 0 {
+				keyConfigs = ruleKeyConfigs
+			}
+			signerVo.Signers = k8smanifest.SignerList{signer.Identity}
+		}
+		result, err := verifyManifestWithKeys(resource, keyConfigs, signatureRef, &signerVo, verifyCache, authz, timestamps)
+		if err != nil {
+			log.Debugf("signature by the signer `%s` is not found; %s", signer.Name, err.Error())
+			thresholdResult.Missing = append(thresholdResult.Missing, signer.Name)
+			errMsgs = append(errMsgs, fmt.Sprintf("[%s] %s", signer.Name, err.Error()))
+			continue
+		}
+		if !result.Verified {
+			thresholdResult.Missing = append(thresholdResult.Missing, signer.Name)
+			if result.FailReason != "" {
+				failReasons = append(failReasons, fmt.Sprintf("[%s] %s", signer.Name, result.FailReason))
+			}
+			if unverified == nil {
+				unverified = result
+			}
+			continue
+		}
+		thresholdResult.Found = append(thresholdResult.Found, signer.Name)
+		warnings = append(warnings, result.Warnings...)
+		verificationKeys = append(verificationKeys, result.VerificationKeys...)
+		if verified == nil {
+			verified = result
+		}
+	}
+
+	if thresholdResult.Satisfied() {
+		// the verified result may be shared by other profiles through the cache, so the signers are set to a copy
+		r := *verified.VerifyResourceResult
+		r.Signer = strings.Join(thresholdResult.Found, ", ")
+		return &ManifestVerifyResult{
+			VerifyResourceResult: &r,
+			Warnings:             warnings,
+			SignatureThreshold:   thresholdResult,
+			VerificationKeys:     verificationKeys,
+		}, nil
+	}
+	// a diff is reported as it is, because no signer can verify the resource
+	if unverified != nil && unverified.Diff != nil && unverified.Diff.Size() > 0 {
+		unverified.SignatureThreshold = thresholdResult
+		return unverified, nil
+	}
+	var base *k8smanifest.VerifyResourceResult
+	if verified != nil {
+		base = verified.VerifyResourceResult
+	} else if unverified != nil {
+		base = unverified.VerifyResourceResult
+	}
+	if base == nil {
+		if len(errMsgs) == 0 {
+			return nil, errors.New("no signer is defined in signatureThreshold")
+		}
+		return nil, fmt.Errorf("failed to verify signature by any signer; %s", strings.Join(errMsgs, "; "))
+	}
+	r := *base
+	r.Signer = strings.Join(thresholdResult.Found, ", ")
+	failReason := thresholdResult.String()
+	if len(failReasons) > 0 {
+		failReason = fmt.Sprintf("%s; %s", failReason, strings.Join(failReasons, "; "))
+	}
+	return rejectResult(&ManifestVerifyResult{VerifyResourceResult: &r, SignatureThreshold: thresholdResult}, failReason), nil
+}
@@ -0,0 +1,82 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	admission "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// signerAuthorization checks if a verified signer is authorized for the object by the signer bindings of the rule.
+// A nil signerAuthorization authorizes any signer.
+type signerAuthorization struct {
+	bindings []config.SignerBinding
+	target   config.MatchTarget
+}
+
+func newSignerAuthorization(bindings []config.SignerBinding, target config.MatchTarget) *signerAuthorization {
+	if len(bindings) == 0 {
+		return nil
+	}
+	return &signerAuthorization{bindings: bindings, target: target}
+}
+
+func (a *signerAuthorization) isBoundKey(key config.KeyConfig) bool {
+	if a == nil {
+		return false
+	}
+	return config.IsBoundKey(a.bindings, key)
+}
+
+func (a *signerAuthorization) authorize(key *config.KeyConfig, signer string) error {
+	if a == nil {
+		return nil
+	}
+	return config.AuthorizeSigner(a.bindings, key, signer, a.target)
+}
+
+// makeSignerBindingTarget returns the requested object as a target of signer bindings.
+// Namespace labels are loaded only if any binding has `namespaceSelector`.
+func makeSignerBindingTarget(request *admission.AdmissionRequest, resource unstructured.Unstructured, bindings []config.SignerBinding) config.MatchTarget {
+	target := config.MatchTarget{
+		ApiGroup:    request.Kind.Group,
+		Kind:        request.Kind.Kind,
+		Name:        resource.GetName(),
+		Namespace:   request.Namespace,
+		Namespaced:  request.Namespace != "" && !config.IsNamespaceKind(request.Kind.Group, request.Kind.Kind),
+		Labels:      resource.GetLabels(),
+		Annotations: resource.GetAnnotations(),
+	}
+	if !target.Namespaced {
+		return target
+	}
+	for _, b := range bindings {
+		if b.Match.NamespaceSelector == nil {
+			continue
+		}
+		ns, err := getNamespace(request.Namespace)
+		if err != nil {
+			log.Warnf("failed to get a namespace `%s` for signer bindings; %s", request.Namespace, err.Error())
+		} else {
+			target.NamespaceLabels = ns.GetLabels()
+		}
+		break
+	}
+	return target
+}
@@ -0,0 +1,98 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"encoding/json"
+	"fmt"
+
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	admission "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const scaleSubresource = "scale"
+
+// Allow message
+var (
+	SubresourceAllowed = "Allowed by subresourcePolicies rule."
+)
+
+// CheckSubresourceRequest decides a request for a subresource by SubresourcePolicies.
+// If `handled` is false, the request should be verified in the same way as the main resource.
+func CheckSubresourceRequest(request *admission.AdmissionRequest, policies config.SubresourcePolicyList) (handled bool, allow bool, message string) {
+	if request.SubResource == "" {
+		return false, false, ""
+	}
+	policy := policies.Find(request.SubResource)
+	if policy == nil {
+		return false, false, ""
+	}
+	switch policy.Action {
+	case config.SubresourceActionAllow:
+		return true, true, SubresourceAllowed
+	case config.SubresourceActionVerify, "":
+		return false, false, ""
+	case config.SubresourceActionBoundedChange:
+		if request.SubResource != scaleSubresource {
+			return true, false, fmt.Sprintf("boundedChange action is supported only for `%s` subresource, but `%s` is requested.", scaleSubresource, request.SubResource)
+		}
+		allow, message := checkReplicaBounds(request, policy.Replicas)
+		return true, allow, message
+	default:
+		return true, false, fmt.Sprintf("unknown action `%s` in subresourcePolicies.", policy.Action)
+	}
+}
+
+func checkReplicaBounds(request *admission.AdmissionRequest, bounds *config.ReplicaBounds) (bool, string) {
+	replicas, found, err := getReplicas(request.Object.Raw)
+	if err != nil || !found {
+		return false, "Failed to get replicas in the requested scale object."
+	}
+	if bounds == nil {
+		return true, fmt.Sprintf("Allowed because replicas %d is within the bounds.", replicas)
+	}
+	if bounds.Min != nil && replicas < int64(*bounds.Min) {
+		return false, fmt.Sprintf("Replicas %d is less than the minimum %d.", replicas, *bounds.Min)
+	}
+	if bounds.Max != nil && replicas > int64(*bounds.Max) {
+		return false, fmt.Sprintf("Replicas %d is more than the maximum %d.", replicas, *bounds.Max)
+	}
+	if bounds.MaxChange != nil && len(request.OldObject.Raw) > 0 {
+		oldReplicas, found, err := getReplicas(request.OldObject.Raw)
+		if err != nil || !found {
+			return false, "Failed to get replicas in the current scale object."
+		}
+		change := replicas - oldReplicas
+		if change < 0 {
+			change = -change
+		}
+		if change > int64(*bounds.MaxChange) {
+			return false, fmt.Sprintf("Replicas change from %d to %d exceeds the maximum change %d.", oldReplicas, replicas, *bounds.MaxChange)
+		}
+	}
+	return true, fmt.Sprintf("Allowed because replicas %d is within the bounds.", replicas)
+}
+
+func getReplicas(raw []byte) (int64, bool, error) {
+	var obj unstructured.Unstructured
+	err := json.Unmarshal(raw, &obj)
+	if err != nil {
+		return 0, false, err
+	}
+	return unstructured.NestedInt64(obj.Object, "spec", "replicas")
+}
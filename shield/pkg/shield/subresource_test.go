@@ -0,0 +1,90 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"fmt"
+	"testing"
+
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	admission "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newScaleRequest(oldReplicas, replicas int) *admission.AdmissionRequest {
+	scale := `{"apiVersion":"autoscaling/v1","kind":"Scale","metadata":{"name":"sample-deploy","namespace":"sample-ns"},"spec":{"replicas":%d}}`
+	return &admission.AdmissionRequest{
+		Name:        "sample-deploy",
+		Namespace:   "sample-ns",
+		SubResource: "scale",
+		Operation:   admission.Update,
+		Object:      runtime.RawExtension{Raw: []byte(fmt.Sprintf(scale, replicas))},
+		OldObject:   runtime.RawExtension{Raw: []byte(fmt.Sprintf(scale, oldReplicas))},
+	}
+}
+
+func TestCheckSubresourceRequest(t *testing.T) {
+	max := int32(5)
+	maxChange := int32(2)
+	policies := k8smnfconfig.SubresourcePolicyList{
+		{
+			Subresources: []string{"status"},
+			Action:       k8smnfconfig.SubresourceActionAllow,
+		},
+		{
+			Subresources: []string{"scale"},
+			Action:       k8smnfconfig.SubresourceActionBoundedChange,
+			Replicas: &k8smnfconfig.ReplicaBounds{
+				Max:       &max,
+				MaxChange: &maxChange,
+			},
+		},
+	}
+
+	// main resource is not handled by subresource policies
+	mainReq := newScaleRequest(1, 2)
+	mainReq.SubResource = ""
+	if handled, _, _ := CheckSubresourceRequest(mainReq, policies); handled {
+		t.Errorf("request for main resource should not be handled: got: %v\nwant: %v", handled, false)
+		return
+	}
+
+	statusReq := newScaleRequest(1, 2)
+	statusReq.SubResource = "status"
+	if handled, allow, _ := CheckSubresourceRequest(statusReq, policies); !handled || !allow {
+		t.Errorf("status request should be allowed: got: %v, %v\nwant: %v, %v", handled, allow, true, true)
+		return
+	}
+
+	testCases := []struct {
+		oldReplicas int
+		replicas    int
+		allow       bool
+	}{
+		{oldReplicas: 2, replicas: 3, allow: true},
+		{oldReplicas: 2, replicas: 6, allow: false}, // more than max
+		{oldReplicas: 1, replicas: 4, allow: false}, // change is more than maxChange
+		{oldReplicas: 3, replicas: 1, allow: true},
+	}
+	for _, tc := range testCases {
+		handled, allow, msg := CheckSubresourceRequest(newScaleRequest(tc.oldReplicas, tc.replicas), policies)
+		if !handled || allow != tc.allow {
+			t.Errorf("unexpected result for scale from %d to %d: got: %v (%s)\nwant: %v", tc.oldReplicas, tc.replicas, allow, msg, tc.allow)
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/tsa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// trustedTimestamps are the signatures of a resource whose RFC 3161 timestamps are verified with the timestamp authority of the rule.
+// A nil trustedTimestamps means that the rule has no timestamp authority, and the signed time asserted by the signer is used.
+type trustedTimestamps struct {
+	required bool
+	// true if the resource has only one signature, so the timestamp is not matched with keys
+	singleSignature bool
+	signatures      []timestampedSignature
+	// reasons why no timestamp is verified
+	errMsgs []string
+}
+
+type timestampedSignature struct {
+	signature []byte
+	message   []byte
+	timestamp *tsa.Timestamp
+}
+
+// timestampAnnotationKey returns the annotation of the timestamp token of the i-th signature, e.g. `cosign.sigstore.dev/signature_timestamp`.
+// The key starts with the signature annotation, so it is ignored in the manifest comparison like the signature.
+func timestampAnnotationKey(c k8smanifest.AnnotationConfig, i int) string {
+	return c.SignatureAnnotationKey(i) + "_timestamp"
+}
+
+// loadTrustedTimestamps verifies the timestamp tokens of the signatures with the timestamp authority of the rule
+func loadTrustedTimestamps(rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption) (*trustedTimestamps, error) {
+	if rule.TimestampAuthority == nil {
+		return nil, nil
+	}
+	verifier, err := rule.TimestampAuthority.Verifier()
+	if err != nil {
+		return nil, err
+	}
+	t := &trustedTimestamps{required: rule.TimestampAuthority.Required}
+	if vo.ResourceBundleRef != "" {
+		t.errMsgs = append(t.errMsgs, "timestamps of signatures in an image are not supported")
+		return t, nil
+	}
+	sigSets, err := getSignatureSets(resource, vo)
+	if err != nil {
+		return nil, err
+	}
+	t.singleSignature = len(sigSets) == 1
+	for _, sigSet := range sigSets {
+		if sigSet[signatureSetTimestampKey] == "" {
+			continue
+		}
+		s, err := verifyTimestampInSignatureSet(verifier, sigSet)
+		if err != nil {
+			t.errMsgs = append(t.errMsgs, err.Error())
+			continue
+		}
+		t.signatures = append(t.signatures, *s)
+	}
+	if len(t.signatures) == 0 && len(t.errMsgs) == 0 {
+		t.errMsgs = append(t.errMsgs, "no timestamp is found in the signature")
+	}
+	return t, nil
+}
+
+func verifyTimestampInSignatureSet(verifier *tsa.Verifier, sigSet map[string]string) (*timestampedSignature, error) {
+	message, err := decodeGzipBase64(sigSet[signatureSetMessageKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the message; %s", err.Error())
+	}
+	signature, err := base64.StdEncoding.DecodeString(sigSet[signatureSetSignatureKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the signature; %s", err.Error())
+	}
+	token, err := base64.StdEncoding.DecodeString(sigSet[signatureSetTimestampKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the timestamp; %s", err.Error())
+	}
+	ts, err := verifier.Verify(token, signature)
+	if err != nil {
+		return nil, err
+	}
+	return &timestampedSignature{signature: signature, message: message, timestamp: ts}, nil
+}
+
+// find returns the timestamp of the signature made with one of the keys.
+// If the resource has only one signature, its timestamp is returned without checking the keys.
+func (t *trustedTimestamps) find(keyConfigs []config.KeyConfig) *tsa.Timestamp {
+	if len(t.signatures) == 0 {
+		return nil
+	}
+	if t.singleSignature {
+		return t.signatures[0].timestamp
+	}
+	keys, err := loadPublicKeys(keyConfigs)
+	if err != nil {
+		log.Debugf("failed to load keys to find the timestamp; %s", err.Error())
+		return nil
+	}
+	for _, s := range t.signatures {
+		for _, pub := range keys {
+			if isSignedWithKey(pub, s.signature, s.message) {
+				return s.timestamp
+			}
+		}
+	}
+	return nil
+}
+
+// signedTime returns the time to check the validity window of the key.
+// The trusted timestamp is used instead of the signed time asserted by the signer.
+func (t *trustedTimestamps) signedTime(key config.KeyConfig, asserted *time.Time) (*time.Time, error) {
+	if t == nil {
+		return asserted, nil
+	}
+	if ts := t.find([]config.KeyConfig{key}); ts != nil {
+		signedTime := ts.Time
+		return &signedTime, nil
+	}
+	if t.required {
+		return nil, fmt.Errorf("no trusted timestamp is found for the signature with the %s; %s", key.Description(), strings.Join(t.errMsgs, "; "))
+	}
+	return asserted, nil
+}
+
+// applyTimestampPolicy replaces the signed time of a verified result with the trusted timestamp.
+// If the timestamp authority is required, the result becomes unverified without a trusted timestamp.
+func applyTimestampPolicy(rule *config.ManifestVerifyRule, timestamps *trustedTimestamps, result *ManifestVerifyResult) *ManifestVerifyResult {
+	if timestamps == nil || result == nil || result.VerifyResourceResult == nil || !result.Verified {
+		return result
+	}
+	ts := timestamps.find(ruleKeyConfigs(rule))
+	if ts == nil {
+		if !timestamps.required {
+			return result
+		}
+		return rejectResult(result, fmt.Sprintf("no trusted timestamp is found for the signature; %s", strings.Join(timestamps.errMsgs, "; ")))
+	}
+	r := *result.VerifyResourceResult
+	signedTime := ts.Time
+	r.SignedTime = &signedTime
+	mvResult := *result
+	mvResult.VerifyResourceResult = &r
+	mvResult.Timestamp = ts
+	return &mvResult
+}
@@ -0,0 +1,233 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	log "github.com/sirupsen/logrus"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/keyless"
+	"github.com/stolostron/integrity-shield/shield/pkg/keystore"
+	"github.com/stolostron/integrity-shield/shield/pkg/tlog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	signatureSetMessageKey     = "message"
+	signatureSetSignatureKey   = "signature"
+	signatureSetCertificateKey = "certificate"
+	signatureSetBundleKey      = "bundle"
+	signatureSetTimestampKey   = "timestamp"
+)
+
+// applyTlogPolicy checks the transparency log entry of a verified signature with the pinned log keys.
+// If requireTlogEntry is set, the result becomes unverified without a verified entry.
+// Otherwise, the entry is only recorded if the log keys are configured.
+func applyTlogPolicy(rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption, result *ManifestVerifyResult) *ManifestVerifyResult {
+	if result == nil || result.VerifyResourceResult == nil || !result.Verified {
+		return result
+	}
+	verifier, err := tlog.Default()
+	if err != nil {
+		if !rule.RequireTlogEntry {
+			return result
+		}
+		return rejectedTlogResult(result, err)
+	}
+	entry, err := verifyTlogEntry(verifier, rule, resource, vo)
+	if err != nil {
+		if !rule.RequireTlogEntry {
+			log.Debugf("transparency log entry is not verified; %s", err.Error())
+			return result
+		}
+		return rejectedTlogResult(result, err)
+	}
+	// the verified result may be shared by other profiles through the cache, so the signed time is set to a copy
+	r := *result.VerifyResourceResult
+	if r.SignedTime == nil {
+		// the integrated time is signed by the log, so it is used for the signature age
+		integratedTime := entry.IntegratedTime
+		r.SignedTime = &integratedTime
+	}
+	mvResult := *result
+	mvResult.VerifyResourceResult = &r
+	mvResult.TlogEntry = entry
+	return &mvResult
+}
+
+func rejectedTlogResult(result *ManifestVerifyResult, err error) *ManifestVerifyResult {
+	return rejectResult(result, fmt.Sprintf("no transparency log entry is verified for the signature; %s", err.Error()))
+}
+
+// verifyTlogEntry returns the entry in the first signature set whose signature is verified with the keys of the rule,
+// or with a certificate which is accepted by the certificate roots and the keyless identities of the rule.
+// The bundle of a signature set which is not verified is never used, even if the entry in it is valid.
+func verifyTlogEntry(verifier *tlog.Verifier, rule *config.ManifestVerifyRule, resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption) (*tlog.Entry, error) {
+	if vo.ResourceBundleRef != "" {
+		return nil, errors.New("transparency log entries of signatures in an image are not supported")
+	}
+	sigSets, err := getSignatureSets(resource, vo)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := loadPublicKeys(ruleKeyConfigs(rule))
+	if err != nil {
+		return nil, err
+	}
+	var roots *keyless.CertificateRoots
+	if rule.IsKeyless() {
+		roots, err = keyless.LoadCertificateRoots(rule.KeylessCertificateRoot)
+		if err != nil {
+			return nil, err
+		}
+	}
+	errMsgs := []string{}
+	for _, sigSet := range sigSets {
+		if sigSet[signatureSetBundleKey] == "" {
+			continue
+		}
+		entry, err := verifyTlogEntryInSignatureSet(verifier, sigSet, keys, roots, rule.KeylessIdentities)
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		return entry, nil
+	}
+	if len(errMsgs) == 0 {
+		return nil, errors.New("no bundle is found in the signature")
+	}
+	return nil, errors.New(strings.Join(errMsgs, "; "))
+}
+
+func verifyTlogEntryInSignatureSet(verifier *tlog.Verifier, sigSet map[string]string, keys []crypto.PublicKey, roots *keyless.CertificateRoots, identities config.KeylessIdentityList) (*tlog.Entry, error) {
+	message, err := decodeGzipBase64(sigSet[signatureSetMessageKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the message; %s", err.Error())
+	}
+	signature, err := base64.StdEncoding.DecodeString(sigSet[signatureSetSignatureKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the signature; %s", err.Error())
+	}
+	bundle, err := decodeGzipBase64(sigSet[signatureSetBundleKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the bundle; %s", err.Error())
+	}
+	signingKey, err := signatureSetSigningKey(sigSet, signature, message, keys, roots, identities)
+	if err != nil {
+		return nil, err
+	}
+	// the entry must be made with the key or the certificate which verified the signature
+	return verifier.VerifyBundle(bundle, signature, message, [][]byte{signingKey})
+}
+
+// signatureSetSigningKey returns the PEM of the key or the certificate which made the signature in the set.
+// A certificate is returned only if it is accepted by the roots and the identities.
+func signatureSetSigningKey(sigSet map[string]string, signature, message []byte, keys []crypto.PublicKey, roots *keyless.CertificateRoots, identities config.KeylessIdentityList) ([]byte, error) {
+	if roots != nil && sigSet[signatureSetCertificateKey] != "" {
+		if _, err := verifyKeylessIdentityInSignatureSet(roots, sigSet, identities); err != nil {
+			return nil, err
+		}
+		cert, err := decodeGzipBase64(sigSet[signatureSetCertificateKey])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the certificate; %s", err.Error())
+		}
+		return cert, nil
+	}
+	for _, pub := range keys {
+		if !isSignedWithKey(pub, signature, message) {
+			continue
+		}
+		return cryptoutils.MarshalPublicKeyToPEM(pub)
+	}
+	return nil, errors.New("the signature is not verified with the keys of the rule")
+}
+
+// getSignatureSets returns signature sets in the signature configmap or the annotations
+func getSignatureSets(resource unstructured.Unstructured, vo *k8smanifest.VerifyResourceOption) ([]map[string]string, error) {
+	if vo.SignatureResourceRef == "" {
+		annotations := resource.GetAnnotations()
+		sigSets := vo.AnnotationConfig.GetAllSignatureSets(annotations)
+		for i := range sigSets {
+			if ts, ok := annotations[timestampAnnotationKey(vo.AnnotationConfig, i)]; ok {
+				sigSets[i][signatureSetTimestampKey] = ts
+			}
+		}
+		return sigSets, nil
+	}
+	cm, err := k8smanifest.GetConfigMapFromK8sObjectRef(vo.SignatureResourceRef)
+	if err != nil {
+		return nil, err
+	}
+	sigSet := map[string]string{}
+	for _, key := range []string{signatureSetMessageKey, signatureSetSignatureKey, signatureSetCertificateKey, signatureSetBundleKey, signatureSetTimestampKey} {
+		sigSet[key] = cm.Data[key]
+	}
+	return []map[string]string{sigSet}, nil
+}
+
+// ruleKeyConfigs returns public keys of the rule and of the threshold signers.
+// x509 keys are not included because their certificates are in the signatures.
+func ruleKeyConfigs(rule *config.ManifestVerifyRule) []config.KeyConfig {
+	all := append([]config.KeyConfig{}, rule.KeyConfigs...)
+	if rule.SignatureThreshold != nil {
+		for _, s := range rule.SignatureThreshold.Signers {
+			all = append(all, s.KeyConfigs...)
+		}
+	}
+	keyConfigs := []config.KeyConfig{}
+	for _, k := range all {
+		if k.X509 == nil {
+			keyConfigs = append(keyConfigs, k)
+		}
+	}
+	return keyConfigs
+}
+
+func loadKeyData(keyConfigs []config.KeyConfig) ([][]byte, error) {
+	if len(keyConfigs) == 0 {
+		return nil, nil
+	}
+	keyRefs, err := keystore.Default().GetKeyRefs(keyConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load keys: %s", err.Error())
+	}
+	keys := [][]byte{}
+	for _, ref := range keyRefs {
+		data, err := k8smnfutil.LoadFileDataInEnvVar(ref)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load keys: %s", err.Error())
+		}
+		keys = append(keys, data)
+	}
+	return keys, nil
+}
+
+func decodeGzipBase64(value string) ([]byte, error) {
+	gzipped, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return k8smnfutil.GzipDecompress(gzipped), nil
+}
@@ -0,0 +1,156 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/keyless"
+)
+
+func TestSignatureSetSigningKey(t *testing.T) {
+	message := []byte("sample-message")
+	trustedKey := generateTestKey(t)
+	otherKey := generateTestKey(t)
+
+	// the key which made the signature is used, and the other keys are not
+	sig := signTestMessage(t, trustedKey, message)
+	keys := []crypto.PublicKey{otherKey.Public(), trustedKey.Public()}
+	signingKey, err := signatureSetSigningKey(map[string]string{}, sig, message, keys, nil, nil)
+	if err != nil {
+		t.Errorf("signature by the trusted key should be verified: %s", err.Error())
+		return
+	}
+	expected, _ := cryptoutils.MarshalPublicKeyToPEM(trustedKey.Public())
+	if !bytes.Equal(signingKey, expected) {
+		t.Errorf("the key which made the signature should be returned")
+		return
+	}
+
+	// a set signed by another key is not used even if its bundle may be valid
+	untrusted := signTestMessage(t, otherKey, message)
+	if _, err := signatureSetSigningKey(map[string]string{}, untrusted, message, []crypto.PublicKey{trustedKey.Public()}, nil, nil); err == nil {
+		t.Errorf("signature by an untrusted key should not be verified")
+		return
+	}
+
+	// the certificate of a keyless signature is checked with the roots and the identities
+	caKey := generateTestKey(t)
+	caCert := createTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sample-ca"},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, caKey, caKey)
+	signerKey := generateTestKey(t)
+	signerCert := createTestCertificate(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		EmailAddresses:  []string{"signer@example.com"},
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}, Value: []byte("https://issuer.example.com")}},
+	}, caCert, signerKey, caKey)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signerCert.Raw})
+	sigSet := map[string]string{signatureSetCertificateKey: base64.StdEncoding.EncodeToString(k8smnfutil.GzipCompress(certPEM))}
+	sigSet[signatureSetMessageKey] = base64.StdEncoding.EncodeToString(k8smnfutil.GzipCompress(message))
+	keylessSig := signTestMessage(t, signerKey, message)
+	sigSet[signatureSetSignatureKey] = base64.StdEncoding.EncodeToString(keylessSig)
+
+	roots, err := keyless.LoadCertificateRoots(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})))
+	if err != nil {
+		t.Errorf("failed to load the roots: %s", err.Error())
+		return
+	}
+	identities := k8smnfconfig.KeylessIdentityList{{Issuer: "https://issuer.example.com", Subject: "signer@example.com"}}
+	signingKey, err = signatureSetSigningKey(sigSet, keylessSig, message, nil, roots, identities)
+	if err != nil {
+		t.Errorf("certificate issued by the roots for the identity should be accepted: %s", err.Error())
+		return
+	}
+	if !bytes.Equal(signingKey, certPEM) {
+		t.Errorf("the certificate which made the signature should be returned")
+		return
+	}
+	others := k8smnfconfig.KeylessIdentityList{{Issuer: "https://issuer.example.com", Subject: "other@example.com"}}
+	if _, err := signatureSetSigningKey(sigSet, keylessSig, message, nil, roots, others); err == nil {
+		t.Errorf("certificate of another identity should not be accepted")
+		return
+	}
+	otherRoots, _ := keyless.LoadCertificateRoots(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: createTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, otherKey, otherKey).Raw})))
+	if _, err := signatureSetSigningKey(sigSet, keylessSig, message, nil, otherRoots, identities); err == nil {
+		t.Errorf("certificate issued by other roots should not be accepted")
+		return
+	}
+}
+
+func generateTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate a key: %s", err.Error())
+	}
+	return key
+}
+
+func signTestMessage(t *testing.T, key *ecdsa.PrivateKey, message []byte) []byte {
+	digest := sha256.Sum256(message)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign the message: %s", err.Error())
+	}
+	return sig
+}
+
+// createTestCertificate creates a self-signed certificate if the parent is nil
+func createTestCertificate(t *testing.T, tmpl, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create a certificate: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse the certificate: %s", err.Error())
+	}
+	return cert
+}
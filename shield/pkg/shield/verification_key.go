@@ -0,0 +1,68 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/keystore"
+)
+
+// resolveVerificationKeys returns a copy of the rule whose references to VerificationKeys
+// are replaced with the keys, so that the other policies see them as ordinary keys.
+func resolveVerificationKeys(rule *config.ManifestVerifyRule) (*config.ManifestVerifyRule, error) {
+	if !hasVerificationKeyRef(rule) {
+		return rule, nil
+	}
+	store := keystore.Default()
+	resolved := *rule
+	keyConfigs, err := store.ResolveVerificationKeys(rule.KeyConfigs)
+	if err != nil {
+		return nil, err
+	}
+	resolved.KeyConfigs = keyConfigs
+	if rule.SignatureThreshold != nil {
+		threshold := *rule.SignatureThreshold
+		threshold.Signers = []config.ThresholdSigner{}
+		for _, signer := range rule.SignatureThreshold.Signers {
+			signer.KeyConfigs, err = store.ResolveVerificationKeys(signer.KeyConfigs)
+			if err != nil {
+				return nil, err
+			}
+			threshold.Signers = append(threshold.Signers, signer)
+		}
+		resolved.SignatureThreshold = &threshold
+	}
+	return &resolved, nil
+}
+
+func hasVerificationKeyRef(rule *config.ManifestVerifyRule) bool {
+	for _, k := range rule.KeyConfigs {
+		if k.IsVerificationKeyRef() {
+			return true
+		}
+	}
+	if rule.SignatureThreshold != nil {
+		for _, s := range rule.SignatureThreshold.Signers {
+			for _, k := range s.KeyConfigs {
+				if k.IsVerificationKeyRef() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
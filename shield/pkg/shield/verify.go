@@ -17,19 +17,21 @@
 package shield
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
 	"github.com/sigstore/k8s-manifest-sigstore/pkg/util/mapnode"
 	log "github.com/sirupsen/logrus"
+	"github.com/stolostron/integrity-shield/shield/pkg/bundlecache"
 	config "github.com/stolostron/integrity-shield/shield/pkg/config"
 	ishieldimage "github.com/stolostron/integrity-shield/shield/pkg/image"
+	"github.com/stolostron/integrity-shield/shield/pkg/keyless"
+	"github.com/stolostron/integrity-shield/shield/pkg/tlog"
 	admission "k8s.io/api/admission/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -51,9 +53,86 @@ var (
 // VerifyResource checks if manifest is valid based on signature, ManifestVerifyRule and RequestFilterProfile which is included in ManifestVerifyConfig.
 // VerifyResource uses the default profile if ManifestVerifyConfig input is nil.
 func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.ManifestVerifyConfig, rule *config.ManifestVerifyRule) (allow bool, message string, err error) {
+	allow, message, _, err = verifyResource(request, mvconfig, rule, nil)
+	return allow, message, err
+}
+
+// VerifyManifestWithRule verifies the resource with keys, the signature threshold, signer bindings and the provenance policy in the rule.
+// target is the resource to be checked with signer bindings. KeyPath in the verify option is replaced with the keys.
+func VerifyManifestWithRule(resource unstructured.Unstructured, rule *config.ManifestVerifyRule, target config.MatchTarget, vo *k8smanifest.VerifyResourceOption) (*ManifestVerifyResult, error) {
+	return verifyManifestWithRule(resource, rule, target, vo, nil)
+}
+
+func verifyManifestWithRule(resource unstructured.Unstructured, rule *config.ManifestVerifyRule, target config.MatchTarget, vo *k8smanifest.VerifyResourceOption, verifyCache *VerifyResultCache) (*ManifestVerifyResult, error) {
+	if rule.ProvenancePolicy != nil {
+		// provenance is required to evaluate the policy
+		vo.Provenance = true
+	}
+	if err := checkOfflineVerification(rule, resource, vo); err != nil {
+		return nil, err
+	}
+	rule, err := resolveVerificationKeys(rule)
+	if err != nil {
+		return nil, err
+	}
+	if vo.ResourceBundleRef != "" {
+		// the bundle is read from the cache by digest instead of being pulled for every verification
+		digestRefs, err := bundlecache.Default().Prepare(vo.ResourceBundleRef)
+		if err != nil {
+			return nil, err
+		}
+		bundleVo := *vo
+		bundleVo.ResourceBundleRef = digestRefs
+		vo = &bundleVo
+	}
+	if vo.ResourceBundleRef != "" && hasKeylessIdentityPolicy(rule) && rule.KeylessCertificateRoot != "" {
+		// the signature of the bundle is verified with the same roots as keyless identities
+		roots, err := keyless.LoadCertificateRoots(rule.KeylessCertificateRoot)
+		if err != nil {
+			return nil, err
+		}
+		rootVo := *vo
+		rootVo.RootCerts = roots.Roots
+		vo = &rootVo
+	}
+	timestamps, err := loadTrustedTimestamps(rule, resource, vo)
+	if err != nil {
+		return nil, err
+	}
+	authz := newSignerAuthorization(rule.SignerBindings, target)
+	var result *ManifestVerifyResult
+	if rule.SignatureThreshold != nil {
+		result, err = verifyManifestWithThreshold(resource, rule.SignatureThreshold, rule.KeyConfigs, rule.SignatureRef, vo, verifyCache, authz, timestamps)
+	} else {
+		result, err = verifyManifestWithKeys(resource, rule.KeyConfigs, rule.SignatureRef, vo, verifyCache, authz, timestamps)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result = applyKeylessIdentityPolicy(rule, resource, vo, result)
+	result = applyPGPKeyringPolicy(rule, resource, vo, result)
+	result = applyTlogPolicy(rule, resource, vo, result)
+	result = applyTimestampPolicy(rule, timestamps, result)
+	result = applyProvenancePolicy(rule, result)
+	return applySignatureAgePolicy(rule, result, time.Now()), nil
+}
+
+// verifyDetail is shown in the decision in addition to the message
+type verifyDetail struct {
+	// e.g. a dependency on a retiring key
+	Warnings           []string
+	SignatureThreshold *config.SignatureThresholdResult
+	TlogEntry          *tlog.Entry
+	KeylessIdentity    *config.KeylessIdentityResult
+	PGPSigner          *config.PGPSignerResult
+	VerificationKeys   []string
+}
+
+// verifyResource also returns the detail of the signature verification
+func verifyResource(request *admission.AdmissionRequest, mvconfig *config.ManifestVerifyConfig, rule *config.ManifestVerifyRule, verifyCache *VerifyResultCache) (allow bool, message string, detail verifyDetail, err error) {
 	// allow dryrun request
 	if *request.DryRun {
-		return true, "Allowed because of DryRun request", nil
+		return true, "Allowed because of DryRun request", detail, nil
 	}
 
 	// log setting
@@ -71,7 +150,9 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 	}
 	if mvconfig.RequestFilterProfile == nil {
 		log.Info("RequestFilterProfile is nil. Use default profile.")
+		revocations := mvconfig.RevocationList
 		mvconfig = config.NewManifestVerifyConfig(mvconfig.DryRunNamespcae)
+		mvconfig.RevocationList = revocations
 	}
 
 	log.WithFields(log.Fields{
@@ -82,13 +163,6 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 		"userName":  request.UserInfo.Username,
 	}).Info("Start manifest verification.")
 
-	// prepare tmpDir
-	tmpDir, err := ioutil.TempDir("", string(request.UID))
-	if err != nil {
-		return false, "", errors.New(fmt.Sprintf("failed to make temp dir; %s; %s", tmpDir, err))
-	}
-	defer os.RemoveAll(tmpDir)
-
 	// unmarshal admission request object
 	var resource unstructured.Unstructured
 	objectBytes := request.Object.Raw
@@ -96,7 +170,7 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 	if err != nil {
 		log.Errorf("Failed to Unmarshal a requested object into %T; %s", resource, err.Error())
 		errMsg := "IntegrityShield failed to decide the response. Failed to Unmarshal a requested object: " + err.Error()
-		return false, errMsg, err
+		return false, errMsg, detail, err
 	}
 
 	commonSkipUserMatched := false
@@ -107,20 +181,28 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 	signatureResource = isAllowedSignatureResource(resource, request.OldObject.Raw, request.Operation)
 
 	//filter by user listed in common profile
-	commonSkipUserMatched = mvconfig.RequestFilterProfile.SkipUsers.Match(resource, request.UserInfo.Username)
+	commonSkipUserMatched = mvconfig.RequestFilterProfile.SkipUsers.MatchUserInfo(resource, request.UserInfo)
 
 	// skip object
 	skipObjectMatched = skipObjectsMatch(mvconfig.RequestFilterProfile.SkipObjects, resource)
 
+	// CEL expressions in the rule and the common profile
+	exprResult, err := evalExpressionRules(request, resource, rule.Expressions, mvconfig.RequestFilterProfile.Expressions)
+	if err != nil {
+		log.Errorf("Failed to evaluate expressions; %s", err.Error())
+		errMsg := "IntegrityShield failed to decide the response. " + err.Error()
+		return false, errMsg, detail, err
+	}
+
 	// Proccess with parameter
 	//filter by user
-	skipUserMatched := rule.SkipUsers.Match(resource, request.UserInfo.Username)
+	skipUserMatched := rule.SkipUsers.MatchUserInfo(resource, request.UserInfo)
 
 	//force check user
-	inScopeUserMatched := rule.InScopeUsers.Match(resource, request.UserInfo.Username)
+	inScopeUserMatched := rule.InScopeUsers.MatchUserInfo(resource, request.UserInfo)
 
 	//check scope
-	inScopeObjMatched := rule.InScopeObjects.Match(resource)
+	inScopeObjMatched := rule.InScopeObjects.Match(resource) && exprResult.inScope
 
 	allow = false
 	message = ""
@@ -136,9 +218,13 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 	} else if skipObjectMatched {
 		allow = true
 		message = SkipObject
+	} else if exprResult.skip {
+		allow = true
+		message = SkipExpression
 	} else if isUpdateRequest(request.Operation) {
 		// mutation check
 		ignoreFields := getMatchedIgnoreFields(rule.IgnoreFields, mvconfig.RequestFilterProfile.IgnoreFields, resource)
+		ignoreFields = append(ignoreFields, exprResult.ignoreFields...)
 		mutated, err := mutationCheck(request.Object.Raw, request.OldObject.Raw, ignoreFields)
 		if err != nil {
 			log.Errorf("Failed to check mutation: %s", err.Error())
@@ -157,9 +243,18 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 		if found {
 			signatureAnnotationType = SignatureAnnotationTypeShield
 		}
-		vo, err := setVerifyOption(rule, mvconfig, signatureAnnotationType, tmpDir)
+		vo, err := setVerifyOption(rule, mvconfig, signatureAnnotationType)
 		if err != nil {
-			return false, err.Error(), err
+			return false, err.Error(), detail, err
+		}
+		if len(exprResult.ignoreFields) > 0 {
+			fields := k8smanifest.ObjectFieldBindingList{}
+			fields = append(fields, vo.IgnoreFields...)
+			fields = append(fields, k8smanifest.ObjectFieldBinding{
+				Fields:  exprResult.ignoreFields,
+				Objects: k8smanifest.ObjectReferenceList{k8smanifest.ObjectToReference(resource)},
+			})
+			vo.IgnoreFields = fields
 		}
 		voBytes, _ := json.Marshal(vo)
 		log.WithFields(log.Fields{
@@ -169,8 +264,9 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 			"operation": request.Operation,
 			"userName":  request.UserInfo.Username,
 		}).Debug("VerifyOption: ", string(voBytes))
-		// call VerifyResource with resource, verifyOption, keypath, imageRef
-		result, err := k8smanifest.VerifyResource(resource, vo)
+		// call VerifyResource with resource, verifyOption, keys, imageRef
+		target := makeSignerBindingTarget(request, resource, rule.SignerBindings)
+		result, err := verifyManifestWithRule(resource, rule, target, vo, verifyCache)
 		resBytes, _ := json.Marshal(result)
 		log.WithFields(log.Fields{
 			"namespace": request.Namespace,
@@ -188,17 +284,30 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 				"operation": request.Operation,
 				"userName":  request.UserInfo.Username,
 			}).Warningf("Signature verification is required for this request, but verifyResource return error ; %s", err.Error())
-			return false, err.Error(), nil
+			return false, err.Error(), detail, nil
 		}
+		// revocations are not cached with the result, so a newly revoked signature is rejected immediately
+		result = applyRevocationList(mvconfig.RevocationList, rule, resource, vo, result)
 
 		if result.InScope {
+			detail.SignatureThreshold = result.SignatureThreshold
 			if result.Verified {
 				allow = true
 				message = fmt.Sprintf("Singed by a valid signer: %s", result.Signer)
+				if result.SignatureThreshold != nil {
+					message = fmt.Sprintf("Signed by enough valid signers; %s", result.SignatureThreshold.String())
+				}
+				detail.Warnings = append(detail.Warnings, result.Warnings...)
+				detail.TlogEntry = result.TlogEntry
+				detail.KeylessIdentity = result.KeylessIdentity
+				detail.PGPSigner = result.PGPSigner
+				detail.VerificationKeys = result.VerificationKeys
 			} else {
 				allow = false
 				message = "Signature verification is required for this request, but no signature is found."
-				if result.Diff != nil && result.Diff.Size() > 0 {
+				if result.FailReason != "" {
+					message = fmt.Sprintf("Signature verification is required for this request, but %s", result.FailReason)
+				} else if result.Diff != nil && result.Diff.Size() > 0 {
 					message = fmt.Sprintf("Signature verification is required for this request, but failed to verify signature. diff found: %s", result.Diff.String())
 				} else if result.Signer != "" {
 					message = fmt.Sprintf("Signature verification is required for this request, but no signer config matches with this resource. This is signed by %s", result.Signer)
@@ -217,7 +326,7 @@ func VerifyResource(request *admission.AdmissionRequest, mvconfig *config.Manife
 		"operation": request.Operation,
 		"userName":  request.UserInfo.Username,
 	}).Infof("Completed manifest verification: allow %s: %s", strconv.FormatBool(allow), message)
-	return allow, message, nil
+	return allow, message, detail, nil
 }
 
 func mutationCheck(rawOldObject, rawObject []byte, IgnoreFields []string) (bool, error) {
@@ -265,7 +374,7 @@ func mutationCheck(rawOldObject, rawObject []byte, IgnoreFields []string) (bool,
 	return true, nil
 }
 
-func setVerifyOption(constraint *config.ManifestVerifyRule, mvconfig *config.ManifestVerifyConfig, signatureAnnotationType, tmpDir string) (*k8smanifest.VerifyResourceOption, error) {
+func setVerifyOption(constraint *config.ManifestVerifyRule, mvconfig *config.ManifestVerifyConfig, signatureAnnotationType string) (*k8smanifest.VerifyResourceOption, error) {
 	// get verifyOption and imageRef from Parameter
 	vo := &constraint.VerifyResourceOption
 
@@ -295,39 +404,6 @@ func setVerifyOption(constraint *config.ManifestVerifyRule, mvconfig *config.Man
 		vo.AnnotationConfig.AnnotationKeyDomain = AnnotationKeyDomainShield
 	}
 
-	// prepare local key for verifyResource
-	if len(constraint.KeyConfigs) != 0 {
-		keyPathList := []string{}
-		for _, keyconfig := range constraint.KeyConfigs {
-			if keyconfig.Secret.Namespace != "" && keyconfig.Secret.Name != "" {
-				if keyconfig.Secret.Mount {
-					keyPath, err := keyconfig.LoadKeySecret()
-					if err != nil {
-						log.Errorf("Failed to load key secret: %s", err.Error())
-						return nil, fmt.Errorf("Failed to load key secret: %s", err.Error())
-					}
-					keyPathList = append(keyPathList, keyPath)
-				} else {
-					keyRef := keyconfig.ConvertToCosignKeyRef()
-					keyPathList = append(keyPathList, keyRef)
-				}
-			}
-			if keyconfig.Key.PEM != "" && keyconfig.Key.Name != "" {
-				keyPath, err := keyconfig.ConvertToLocalFilePath(tmpDir)
-				if err != nil {
-					return nil, fmt.Errorf("Failed to get local file path: %s", err.Error())
-				}
-				keyPathList = append(keyPathList, keyPath)
-			}
-		}
-		if len(keyPathList) == 0 {
-			return nil, fmt.Errorf("KeyConfigs is not properly configured, failed to set public key.")
-		}
-		keyPathString := strings.Join(keyPathList, ",")
-		if keyPathString != "" {
-			vo.KeyPath = keyPathString
-		}
-	}
 	// merge params in common profile
 	if len(mvconfig.RequestFilterProfile.IgnoreFields) == 0 {
 		return vo, nil
@@ -339,6 +415,18 @@ func setVerifyOption(constraint *config.ManifestVerifyRule, mvconfig *config.Man
 	return vo, nil
 }
 
+func makeManifestVerifyCacheKey(rule *config.ManifestVerifyRule, vo *k8smanifest.VerifyResourceOption) string {
+	return makeKeyedManifestVerifyCacheKey(rule.KeyConfigs, rule.SignatureRef, vo)
+}
+
+// KeyPath refers to keys in the key store, so keys are identified by KeyConfigs instead.
+// Provenance is not marshaled in the option, so it is added separately.
+func makeKeyedManifestVerifyCacheKey(keyConfigs []config.KeyConfig, signatureRef config.SignatureRef, vo *k8smanifest.VerifyResourceOption) string {
+	voForKey := *vo
+	voForKey.KeyPath = ""
+	return makeVerifyCacheKey("manifest", keyConfigs, signatureRef, voForKey, vo.Provenance)
+}
+
 func skipObjectsMatch(l k8smanifest.ObjectReferenceList, obj unstructured.Unstructured) bool {
 	if len(l) == 0 {
 		return false
@@ -395,6 +483,12 @@ func isCreateRequest(operation admission.Operation) bool {
 
 // Image verification
 func VerifyImagesInManifest(request *admission.AdmissionRequest, imageProfile config.ImageProfile) (bool, string) {
+	allow, message, _ := verifyImagesInManifest(context.Background(), request, imageProfile, nil, nil)
+	return allow, message
+}
+
+// verifyImagesInManifest also returns the result of each image, e.g. the resolved digest and the signer
+func verifyImagesInManifest(ctx context.Context, request *admission.AdmissionRequest, imageProfile config.ImageProfile, revocations *config.RevocationList, verifyCache *VerifyResultCache) (bool, string, []ishieldimage.ImageVerifyResult) {
 	// unmarshal admission request object
 	var resource unstructured.Unstructured
 	objectBytes := request.Object.Raw
@@ -402,23 +496,29 @@ func VerifyImagesInManifest(request *admission.AdmissionRequest, imageProfile co
 	if err != nil {
 		log.Errorf("Failed to Unmarshal a requested object into %T; %s", resource, err.Error())
 		errMsg := "IntegrityShield failed to decide the response. Failed to Unmarshal a requested object: " + err.Error()
-		return false, errMsg
+		return false, errMsg, nil
 	}
 
 	imageAllow := true
 	imageMessage := ""
 	var imageVerifyResults []ishieldimage.ImageVerifyResult
 	if imageProfile.Enabled() {
-		_, err := ishieldimage.VerifyImageInManifest(resource, imageProfile)
+		cacheKey := makeVerifyCacheKey("image", imageProfile, revocations)
+		cached, err := verifyCache.Do(cacheKey, func() (interface{}, error) {
+			results, err := ishieldimage.VerifyImageInManifestWithResults(ctx, resource, imageProfile, revocations)
+			return results, err
+		})
+		imageVerifyResults, _ = cached.([]ishieldimage.ImageVerifyResult)
 		if err != nil {
 			log.Errorf("Failed to verify images: %s", err.Error())
 			imageAllow = false
 			imageMessage = "Image signature verification is required, but failed to verify signature: " + err.Error()
 		} else {
+			imageMessage = ishieldimage.ResultsMessage(imageVerifyResults)
 			for _, res := range imageVerifyResults {
-				if res.InScope && !res.Verified {
+				if res.Denied() {
 					imageAllow = false
-					imageMessage = "Image signature verification is required, but failed to verify signature: " + res.FailReason
+					imageMessage = "Image signature verification is required, but failed to verify signature: " + res.Message()
 					break
 				}
 			}
@@ -431,5 +531,5 @@ func VerifyImagesInManifest(request *admission.AdmissionRequest, imageProfile co
 		"operation": request.Operation,
 		"userName":  request.UserInfo.Username,
 	}).Infof("Complete image verification: allow %s: %s", strconv.FormatBool(imageAllow), imageMessage)
-	return imageAllow, imageMessage
+	return imageAllow, imageMessage, imageVerifyResults
 }
@@ -0,0 +1,76 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// VerifyResultCache shares the results of identical verification work
+// between profiles which are evaluated for the same admission request.
+// The first caller for a key runs the verification and the others wait for its result.
+// A VerifyResultCache must not be reused across admission requests.
+type VerifyResultCache struct {
+	mu      sync.Mutex
+	entries map[string]*verifyCacheEntry
+}
+
+type verifyCacheEntry struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+func NewVerifyResultCache() *VerifyResultCache {
+	return &VerifyResultCache{
+		entries: map[string]*verifyCacheEntry{},
+	}
+}
+
+// Do returns the cached result for the key, or runs fn and caches its result.
+// If the cache is nil, fn is always called.
+func (c *VerifyResultCache) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	if c == nil || key == "" {
+		return fn()
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &verifyCacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.value, entry.err = fn()
+	})
+	return entry.value, entry.err
+}
+
+// makeVerifyCacheKey returns a key which identifies verification work by its inputs.
+// An empty key is returned if the inputs cannot be serialized.
+func makeVerifyCacheKey(kind string, inputs ...interface{}) string {
+	inputBytes, err := json.Marshal(inputs)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(inputBytes)
+	return kind + ":" + hex.EncodeToString(sum[:])
+}
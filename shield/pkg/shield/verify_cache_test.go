@@ -0,0 +1,104 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+)
+
+func TestVerifyResultCache(t *testing.T) {
+	cache := NewVerifyResultCache()
+	var calls int32
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return true, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.Do("same-key", fn)
+			if err != nil || v != true {
+				t.Errorf("unexpected cached result: got: %v, %v\nwant: %v, %v", v, err, true, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("verification should run only once for the same key: got: %v\nwant: %v", calls, 1)
+		return
+	}
+
+	_, _ = cache.Do("another-key", fn)
+	if calls != 2 {
+		t.Errorf("verification should run for a different key: got: %v\nwant: %v", calls, 2)
+		return
+	}
+
+	// nil cache always calls fn
+	var nilCache *VerifyResultCache
+	_, _ = nilCache.Do("same-key", fn)
+	if calls != 3 {
+		t.Errorf("nil cache should not share results: got: %v\nwant: %v", calls, 3)
+		return
+	}
+}
+
+func TestManifestVerifyCacheKey(t *testing.T) {
+	rule1 := &k8smnfconfig.ManifestVerifyRule{
+		KeyConfigs: []k8smnfconfig.KeyConfig{
+			{Secret: k8smnfconfig.KeySecret{Name: "key-a", Namespace: "ns"}},
+		},
+		SignatureRef: k8smnfconfig.SignatureRef{ImageRef: "sample-registry/sample-signature:0.1.0"},
+	}
+	rule2 := &k8smnfconfig.ManifestVerifyRule{
+		KeyConfigs: []k8smnfconfig.KeyConfig{
+			{Secret: k8smnfconfig.KeySecret{Name: "key-a", Namespace: "ns"}},
+		},
+		SignatureRef: k8smnfconfig.SignatureRef{ImageRef: "sample-registry/sample-signature:0.1.0"},
+	}
+	rule3 := &k8smnfconfig.ManifestVerifyRule{
+		KeyConfigs: []k8smnfconfig.KeyConfig{
+			{Secret: k8smnfconfig.KeySecret{Name: "key-b", Namespace: "ns"}},
+		},
+		SignatureRef: k8smnfconfig.SignatureRef{ImageRef: "sample-registry/sample-signature:0.1.0"},
+	}
+	// key paths differ per profile because of temp dirs, but they should not change the key
+	vo1 := &k8smanifest.VerifyResourceOption{}
+	vo1.KeyPath = "/tmp/profile-1/key-a.pub"
+	vo2 := &k8smanifest.VerifyResourceOption{}
+	vo2.KeyPath = "/tmp/profile-2/key-a.pub"
+
+	key1 := makeManifestVerifyCacheKey(rule1, vo1)
+	key2 := makeManifestVerifyCacheKey(rule2, vo2)
+	key3 := makeManifestVerifyCacheKey(rule3, vo1)
+	if key1 != key2 {
+		t.Errorf("same keys and signature reference should have the same cache key: got: %s\nwant: %s", key2, key1)
+		return
+	}
+	if key1 == key3 {
+		t.Errorf("different keys should have different cache keys: got: %s", key3)
+		return
+	}
+}
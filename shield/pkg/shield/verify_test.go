@@ -0,0 +1,76 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	admission "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestVerifyImagesInManifest(t *testing.T) {
+	revokedDigest := "sha256:" + strings.Repeat("a", 64)
+	revokedImage := "registry.example.com/sample/app@" + revokedDigest
+	otherImage := "other.example.com/sample/app@sha256:" + strings.Repeat("b", 64)
+	pod, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "sample-pod", "namespace": "sample-ns"},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": revokedImage},
+				map[string]interface{}{"name": "other", "image": otherImage},
+			},
+		},
+	})
+	request := &admission.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Name:      "sample-pod",
+		Namespace: "sample-ns",
+		Operation: admission.Create,
+		Object:    runtime.RawExtension{Raw: pod},
+	}
+	profile := k8smnfconfig.ImageProfile{Policies: []k8smnfconfig.ImagePolicy{
+		{Name: "sample-images", Match: k8smnfconfig.ImageRefList{"registry.example.com/*"}},
+	}}
+	revocations := &k8smnfconfig.RevocationList{Entries: []k8smnfconfig.RevocationEntry{{ManifestDigest: revokedDigest}}}
+
+	// the revoked image is denied, and the image which matches no policy is not in scope
+	allow, message, results := verifyImagesInManifest(context.Background(), request, profile, revocations, NewVerifyResultCache())
+	if allow || !strings.Contains(message, revokedImage) || !strings.Contains(message, "revoked") {
+		t.Errorf("the revoked image should be denied: %v, %s", allow, message)
+		return
+	}
+	if len(results) != 2 || !results[0].Denied() || results[1].InScope || results[1].ImageRef != otherImage {
+		t.Errorf("unexpected image results: %+v", results)
+		return
+	}
+
+	// the images which are not in scope are allowed, and the message has the result of each image
+	profile.Policies[0].Mode = k8smnfconfig.ImagePolicyModeSkip
+	allow, message, results = verifyImagesInManifest(context.Background(), request, profile, nil, nil)
+	if !allow || len(results) != 2 || message != results[0].Message()+", "+results[1].Message() || results[0].InScope {
+		t.Errorf("the images should be allowed with their results: %v, %s", allow, message)
+		return
+	}
+}
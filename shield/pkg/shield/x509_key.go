@@ -0,0 +1,143 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	config "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/keystore"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// getX509SignatureSet returns the reference of the CA which issued the certificate of an accepted signature set,
+// and the resource which has only that signature set. The certificate is checked here and the signature is verified
+// with it in-process, so that k8s-manifest-sigstore verifies the resource only with this set and never with
+// another certificate issued by the same CA, e.g. a revoked one.
+func getX509SignatureSet(resource unstructured.Unstructured, keyConfig config.KeyConfig, vo *k8smanifest.VerifyResourceOption) (string, unstructured.Unstructured, error) {
+	if vo.ResourceBundleRef != "" {
+		return "", resource, fmt.Errorf("the %s cannot be used for signatures in an image", keyConfig.Description())
+	}
+	trust, err := keystore.Default().GetX509Trust(keyConfig.X509)
+	if err != nil {
+		return "", resource, err
+	}
+	sigSets, err := getSignatureSets(resource, vo)
+	if err != nil {
+		return "", resource, err
+	}
+	now := time.Now()
+	errMsgs := []string{}
+	for _, sigSet := range sigSets {
+		if sigSet[signatureSetCertificateKey] == "" {
+			continue
+		}
+		issuer, err := verifyX509SignatureSet(trust, sigSet, now)
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		ref, err := keystore.Default().GetX509IssuerRef(issuer)
+		if err != nil {
+			return "", resource, err
+		}
+		if vo.SignatureResourceRef != "" {
+			// the signature configmap has only one signature set
+			return ref, resource, nil
+		}
+		return ref, resourceWithSignatureSet(resource, vo.AnnotationConfig, sigSet), nil
+	}
+	if len(errMsgs) == 0 {
+		return "", resource, fmt.Errorf("no certificate is found in the signature for the %s", keyConfig.Description())
+	}
+	return "", resource, errors.New(strings.Join(errMsgs, "; "))
+}
+
+// verifyX509SignatureSet checks the certificate in the signature set with the CRLs, the extended key usages and the name constraints,
+// and returns the issuer if the signature is made with the certificate
+func verifyX509SignatureSet(trust *keystore.X509Trust, sigSet map[string]string, now time.Time) (*x509.Certificate, error) {
+	cert, err := decodeSignatureCertificate(sigSet[signatureSetCertificateKey])
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := trust.VerifyCertificate(cert, now)
+	if err != nil {
+		return nil, err
+	}
+	message, err := decodeGzipBase64(sigSet[signatureSetMessageKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the message; %s", err.Error())
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigSet[signatureSetSignatureKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the signature; %s", err.Error())
+	}
+	if !isSignedWithKey(cert.PublicKey, sig, message) {
+		return nil, errors.New("the signature is not made with the certificate")
+	}
+	return issuer, nil
+}
+
+// resourceWithSignatureSet returns a copy of the resource whose annotations have only the signature set.
+// The message is shared by all signature sets, so it is kept as it is.
+func resourceWithSignatureSet(resource unstructured.Unstructured, c k8smanifest.AnnotationConfig, sigSet map[string]string) unstructured.Unstructured {
+	copied := resource.DeepCopy()
+	annotations := copied.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for i := 0; ; i++ {
+		if _, ok := annotations[c.SignatureAnnotationKey(i)]; !ok {
+			break
+		}
+		delete(annotations, c.SignatureAnnotationKey(i))
+		delete(annotations, c.CertificateAnnotationKey(i))
+		delete(annotations, c.BundleAnnotationKey(i))
+	}
+	annotations[c.SignatureAnnotationKey(0)] = sigSet[signatureSetSignatureKey]
+	if sigSet[signatureSetCertificateKey] != "" {
+		annotations[c.CertificateAnnotationKey(0)] = sigSet[signatureSetCertificateKey]
+	}
+	if sigSet[signatureSetBundleKey] != "" {
+		annotations[c.BundleAnnotationKey(0)] = sigSet[signatureSetBundleKey]
+	}
+	copied.SetAnnotations(annotations)
+	return *copied
+}
+
+func decodeSignatureCertificate(value string) (*x509.Certificate, error) {
+	certPEM, err := decodeGzipBase64(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the certificate; %s", err.Error())
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, errors.New("failed to decode the certificate; no PEM data is found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the certificate; %s", err.Error())
+	}
+	return cert, nil
+}
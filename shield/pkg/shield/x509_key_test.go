@@ -0,0 +1,67 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shield
+
+import (
+	"testing"
+
+	"github.com/sigstore/k8s-manifest-sigstore/pkg/k8smanifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestResourceWithSignatureSet(t *testing.T) {
+	c := k8smanifest.AnnotationConfig{}
+	resource := unstructured.Unstructured{}
+	resource.SetAnnotations(map[string]string{
+		c.MessageAnnotationKey():        "sample-message",
+		c.SignatureAnnotationKey(0):     "revoked-signature",
+		c.CertificateAnnotationKey(0):   "revoked-certificate",
+		c.BundleAnnotationKey(0):        "revoked-bundle",
+		c.SignatureAnnotationKey(1):     "accepted-signature",
+		c.CertificateAnnotationKey(1):   "accepted-certificate",
+		"sample.example.com/annotation": "sample",
+	})
+	vo := &k8smanifest.VerifyResourceOption{}
+	sigSets, _ := getSignatureSets(resource, vo)
+	if len(sigSets) != 2 {
+		t.Errorf("two signature sets should be found, but %d", len(sigSets))
+		return
+	}
+
+	signed := resourceWithSignatureSet(resource, c, sigSets[1])
+	found, _ := getSignatureSets(signed, vo)
+	if len(found) != 1 {
+		t.Errorf("only the accepted signature set should be left, but %d", len(found))
+		return
+	}
+	if found[0][signatureSetSignatureKey] != "accepted-signature" || found[0][signatureSetCertificateKey] != "accepted-certificate" || found[0][signatureSetMessageKey] != "sample-message" {
+		t.Errorf("unexpected signature set: %v", found[0])
+		return
+	}
+	if _, ok := signed.GetAnnotations()[c.BundleAnnotationKey(0)]; ok {
+		t.Errorf("the bundle of the other signature set should be removed")
+		return
+	}
+	if signed.GetAnnotations()["sample.example.com/annotation"] != "sample" {
+		t.Errorf("other annotations should be kept")
+		return
+	}
+	if resource.GetAnnotations()[c.SignatureAnnotationKey(1)] != "accepted-signature" {
+		t.Errorf("the original resource should not be changed")
+		return
+	}
+}
@@ -0,0 +1,257 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PEM encoded public keys of transparency logs which are trusted to sign entry timestamps
+	RekorPublicKeysEnvKey = "REKOR_PUBLIC_KEYS"
+	// a file of the log public key, which is also used by cosign
+	RekorPublicKeyFileEnvKey = "SIGSTORE_REKOR_PUBLIC_KEY"
+)
+
+// Entry is a transparency log entry which is verified offline with the signed entry timestamp (SET)
+type Entry struct {
+	LogIndex       int64     `json:"logIndex"`
+	LogID          string    `json:"logID"`
+	IntegratedTime time.Time `json:"integratedTime"`
+}
+
+// Verifier verifies Rekor bundles with pinned log public keys without accessing the log
+type Verifier struct {
+	// log ID (hex encoded sha256 of the DER public key) -> public key
+	logKeys map[string]*ecdsa.PublicKey
+}
+
+// rekorBundle is the bundle format of cosign
+type rekorBundle struct {
+	SignedEntryTimestamp []byte
+	Payload              rekorPayload
+}
+
+type rekorPayload struct {
+	Body           interface{} `json:"body"`
+	IntegratedTime int64       `json:"integratedTime"`
+	LogIndex       int64       `json:"logIndex"`
+	LogID          string      `json:"logID"`
+}
+
+// body of `hashedrekord` and `rekord` entries
+type rekordBody struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Signature struct {
+			Content   string `json:"content"`
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+		Data struct {
+			// the artifact itself, which may be in a `rekord` entry instead of the hash
+			Content string `json:"content"`
+			Hash    struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+	} `json:"spec"`
+}
+
+var defaultVerifier *Verifier
+var defaultVerifierErr error
+var defaultVerifierOnce sync.Once
+
+// Default returns a verifier with the log public keys in the environment variable and the key file
+func Default() (*Verifier, error) {
+	defaultVerifierOnce.Do(func() {
+		keys := os.Getenv(RekorPublicKeysEnvKey)
+		if keyFile := os.Getenv(RekorPublicKeyFileEnvKey); keyFile != "" {
+			keyData, err := ioutil.ReadFile(keyFile)
+			if err != nil {
+				defaultVerifierErr = errors.Wrap(err, "failed to read the transparency log public key file")
+				return
+			}
+			keys = keys + "\n" + string(keyData)
+		}
+		if strings.TrimSpace(keys) == "" {
+			defaultVerifierErr = errors.New("no transparency log public key is configured")
+			return
+		}
+		defaultVerifier, defaultVerifierErr = NewVerifier([]byte(keys))
+	})
+	return defaultVerifier, defaultVerifierErr
+}
+
+// NewVerifier returns a verifier with ECDSA public keys in the PEM data
+func NewVerifier(pemData []byte) (*Verifier, error) {
+	v := &Verifier{logKeys: map[string]*ecdsa.PublicKey{}}
+	rest := pemData
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse a transparency log public key")
+		}
+		ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("transparency log public key must be ECDSA, but %T is found", pub)
+		}
+		sum := sha256.Sum256(block.Bytes)
+		v.logKeys[hex.EncodeToString(sum[:])] = ecdsaPub
+	}
+	if len(v.logKeys) == 0 {
+		return nil, errors.New("no transparency log public key is found")
+	}
+	return v, nil
+}
+
+// VerifyBundle verifies the SET in the bundle with the pinned log key, and checks that the entry records
+// the signature of the message. If allowedKeys (PEM public keys or certificates) are given,
+// the entry must be made with one of them.
+func (v *Verifier) VerifyBundle(rawBundle, signature, message []byte, allowedKeys [][]byte) (*Entry, error) {
+	var b rekorBundle
+	err := json.Unmarshal(rawBundle, &b)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the bundle")
+	}
+	logKey, ok := v.logKeys[b.Payload.LogID]
+	if !ok {
+		return nil, fmt.Errorf("the log ID `%s` in the bundle is not pinned", b.Payload.LogID)
+	}
+	err = verifySET(b.Payload, b.SignedEntryTimestamp, logKey)
+	if err != nil {
+		return nil, err
+	}
+	err = checkEntryBody(b.Payload.Body, signature, message, allowedKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		LogIndex:       b.Payload.LogIndex,
+		LogID:          b.Payload.LogID,
+		IntegratedTime: time.Unix(b.Payload.IntegratedTime, 0).UTC(),
+	}, nil
+}
+
+// the SET is a signature of the log over the canonicalized payload
+func verifySET(payload rekorPayload, set []byte, logKey *ecdsa.PublicKey) error {
+	contents, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the bundle payload")
+	}
+	canonicalized, err := jsoncanonicalizer.Transform(contents)
+	if err != nil {
+		return errors.Wrap(err, "failed to canonicalize the bundle payload")
+	}
+	hash := sha256.Sum256(canonicalized)
+	if !ecdsa.VerifyASN1(logKey, hash[:], set) {
+		return errors.New("failed to verify the signed entry timestamp with the pinned log key")
+	}
+	return nil
+}
+
+func checkEntryBody(body interface{}, signature, message []byte, allowedKeys [][]byte) error {
+	b64Body, ok := body.(string)
+	if !ok {
+		return fmt.Errorf("the entry body must be a base64 string, but %T is found", body)
+	}
+	bodyBytes, err := base64.StdEncoding.DecodeString(b64Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode the entry body")
+	}
+	var entry rekordBody
+	err = json.Unmarshal(bodyBytes, &entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal the entry body")
+	}
+	if entry.Kind != "hashedrekord" && entry.Kind != "rekord" {
+		return fmt.Errorf("the entry kind `%s` is not supported", entry.Kind)
+	}
+	entrySig, err := base64.StdEncoding.DecodeString(entry.Spec.Signature.Content)
+	if err != nil || !bytes.Equal(entrySig, signature) {
+		return errors.New("the entry does not record this signature")
+	}
+	// the entry must be bound to the message by its hash, or by the content in a `rekord` entry
+	switch {
+	case entry.Spec.Data.Hash.Value != "":
+		if entry.Spec.Data.Hash.Algorithm != "" && entry.Spec.Data.Hash.Algorithm != "sha256" {
+			return fmt.Errorf("the hash algorithm `%s` in the entry is not supported", entry.Spec.Data.Hash.Algorithm)
+		}
+		sum := sha256.Sum256(message)
+		if entry.Spec.Data.Hash.Value != hex.EncodeToString(sum[:]) {
+			return errors.New("the entry does not record the hash of this message")
+		}
+	case entry.Kind == "rekord" && entry.Spec.Data.Content != "":
+		content, err := base64.StdEncoding.DecodeString(entry.Spec.Data.Content)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode the content in the entry")
+		}
+		if !bytes.Equal(content, message) {
+			return errors.New("the entry does not record this message")
+		}
+	default:
+		return errors.New("neither the hash nor the content of the message is found in the entry")
+	}
+	if len(allowedKeys) == 0 {
+		return nil
+	}
+	entryKey, err := base64.StdEncoding.DecodeString(entry.Spec.Signature.PublicKey.Content)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode the public key in the entry")
+	}
+	for _, k := range allowedKeys {
+		if samePEM(entryKey, k) {
+			return nil
+		}
+	}
+	return errors.New("the entry is not made with a verification key")
+}
+
+func samePEM(a, b []byte) bool {
+	blockA, _ := pem.Decode(a)
+	blockB, _ := pem.Decode(b)
+	if blockA == nil || blockB == nil {
+		return bytes.Equal(bytes.TrimSpace(a), bytes.TrimSpace(b))
+	}
+	return bytes.Equal(blockA.Bytes, blockB.Bytes)
+}
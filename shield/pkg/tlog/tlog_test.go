@@ -0,0 +1,236 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+)
+
+// fakeRekor is a local stand-in of a transparency log which issues bundles like cosign
+type fakeRekor struct {
+	priv     *ecdsa.PrivateKey
+	pubPEM   []byte
+	logID    string
+	logIndex int64
+}
+
+func newFakeRekor() (*fakeRekor, error) {
+	priv, pubPEM, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pubPEM)
+	sum := sha256.Sum256(block.Bytes)
+	return &fakeRekor{priv: priv, pubPEM: pubPEM, logID: hex.EncodeToString(sum[:])}, nil
+}
+
+func (r *fakeRekor) upload(signature, message, signerPEM []byte, integratedTime time.Time) ([]byte, error) {
+	hash := sha256.Sum256(message)
+	data := map[string]interface{}{
+		"hash": map[string]interface{}{"algorithm": "sha256", "value": hex.EncodeToString(hash[:])},
+	}
+	return r.uploadEntry("hashedrekord", data, signature, signerPEM, integratedTime)
+}
+
+// uploadEntry issues a bundle of an entry with the data, e.g. a `rekord` entry without the hash
+func (r *fakeRekor) uploadEntry(kind string, data map[string]interface{}, signature, signerPEM []byte, integratedTime time.Time) ([]byte, error) {
+	body := map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       kind,
+		"spec": map[string]interface{}{
+			"signature": map[string]interface{}{
+				"content":   base64.StdEncoding.EncodeToString(signature),
+				"publicKey": map[string]interface{}{"content": base64.StdEncoding.EncodeToString(signerPEM)},
+			},
+			"data": data,
+		},
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	r.logIndex++
+	payload := rekorPayload{
+		Body:           base64.StdEncoding.EncodeToString(bodyBytes),
+		IntegratedTime: integratedTime.Unix(),
+		LogIndex:       r.logIndex,
+		LogID:          r.logID,
+	}
+	contents, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	canonicalized, err := jsoncanonicalizer.Transform(contents)
+	if err != nil {
+		return nil, err
+	}
+	setHash := sha256.Sum256(canonicalized)
+	set, err := ecdsa.SignASN1(rand.Reader, r.priv, setHash[:])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rekorBundle{SignedEntryTimestamp: set, Payload: payload})
+}
+
+func generateKey() (*ecdsa.PrivateKey, []byte, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func signMessage(priv *ecdsa.PrivateKey, message []byte) ([]byte, error) {
+	hash := sha256.Sum256(message)
+	return ecdsa.SignASN1(rand.Reader, priv, hash[:])
+}
+
+func TestVerifyBundle(t *testing.T) {
+	rekor, err := newFakeRekor()
+	if err != nil {
+		t.Errorf("failed to start a fake rekor: %s", err.Error())
+		return
+	}
+	signer, signerPEM, err := generateKey()
+	if err != nil {
+		t.Errorf("failed to generate a signer key: %s", err.Error())
+		return
+	}
+	message := []byte("sample manifest")
+	signature, err := signMessage(signer, message)
+	if err != nil {
+		t.Errorf("failed to sign: %s", err.Error())
+		return
+	}
+	integratedTime := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	bundle, err := rekor.upload(signature, message, signerPEM, integratedTime)
+	if err != nil {
+		t.Errorf("failed to upload: %s", err.Error())
+		return
+	}
+
+	v, err := NewVerifier(rekor.pubPEM)
+	if err != nil {
+		t.Errorf("failed to load the log key: %s", err.Error())
+		return
+	}
+	entry, err := v.VerifyBundle(bundle, signature, message, [][]byte{signerPEM})
+	if err != nil {
+		t.Errorf("bundle from the pinned log should be verified: %s", err.Error())
+		return
+	}
+	if entry.LogIndex != 1 || !entry.IntegratedTime.Equal(integratedTime) || entry.LogID != rekor.logID {
+		t.Errorf("unexpected entry: %v", entry)
+		return
+	}
+
+	otherSigner, otherPEM, _ := generateKey()
+	otherSignature, _ := signMessage(otherSigner, message)
+	cases := []struct {
+		name        string
+		verifier    func() (*Verifier, error)
+		signature   []byte
+		message     []byte
+		allowedKeys [][]byte
+	}{
+		{"unpinned log", func() (*Verifier, error) {
+			other, err := newFakeRekor()
+			if err != nil {
+				return nil, err
+			}
+			return NewVerifier(other.pubPEM)
+		}, signature, message, nil},
+		{"other signature", nil, otherSignature, message, nil},
+		{"other message", nil, signature, []byte("tampered manifest"), nil},
+		{"other signer", nil, signature, message, [][]byte{otherPEM}},
+	}
+	for _, c := range cases {
+		cv := v
+		if c.verifier != nil {
+			if cv, err = c.verifier(); err != nil {
+				t.Errorf("failed to make a verifier for %s: %s", c.name, err.Error())
+				return
+			}
+		}
+		if _, err = cv.VerifyBundle(bundle, c.signature, c.message, c.allowedKeys); err == nil {
+			t.Errorf("bundle should not be verified with %s", c.name)
+			return
+		}
+	}
+
+	// a `rekord` entry must record the hash or the content of the message
+	messageHash := sha256.Sum256(message)
+	rekordCases := []struct {
+		name   string
+		data   map[string]interface{}
+		verify bool
+	}{
+		{"hash", map[string]interface{}{"hash": map[string]interface{}{"algorithm": "sha256", "value": hex.EncodeToString(messageHash[:])}}, true},
+		{"content", map[string]interface{}{"content": base64.StdEncoding.EncodeToString(message)}, true},
+		{"content of another message", map[string]interface{}{"content": base64.StdEncoding.EncodeToString([]byte("tampered manifest"))}, false},
+		{"neither hash nor content", map[string]interface{}{}, false},
+		{"empty hash", map[string]interface{}{"hash": map[string]interface{}{"algorithm": "sha256", "value": ""}}, false},
+	}
+	for _, c := range rekordCases {
+		rekordBundle, err := rekor.uploadEntry("rekord", c.data, signature, signerPEM, integratedTime)
+		if err != nil {
+			t.Errorf("failed to upload a rekord entry with %s: %s", c.name, err.Error())
+			return
+		}
+		_, err = v.VerifyBundle(rekordBundle, signature, message, [][]byte{signerPEM})
+		if c.verify && err != nil {
+			t.Errorf("rekord entry with %s should be verified: %s", c.name, err.Error())
+			return
+		}
+		if !c.verify && err == nil {
+			t.Errorf("rekord entry with %s should not be verified", c.name)
+			return
+		}
+	}
+
+	// the SET does not cover a modified payload
+	var tampered rekorBundle
+	_ = json.Unmarshal(bundle, &tampered)
+	tampered.Payload.IntegratedTime = time.Now().Unix()
+	tamperedBundle, _ := json.Marshal(tampered)
+	if _, err = v.VerifyBundle(tamperedBundle, signature, message, nil); err == nil {
+		t.Errorf("bundle with a modified payload should not be verified")
+		return
+	}
+
+	if _, err = NewVerifier([]byte(fmt.Sprintf("%s\n", "not a key"))); err == nil {
+		t.Errorf("verifier without any key should not be made")
+		return
+	}
+}
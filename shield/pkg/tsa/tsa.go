@@ -0,0 +1,398 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	// hash functions of message imprints
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	// only SHA-2 is accepted for message imprints and signatures
+	hashOIDs = map[string]crypto.Hash{
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+const generalizedTimeLayout = "20060102150405Z0700"
+
+// Timestamp is the time in an RFC 3161 timestamp token which is verified with the trusted TSA certificate chain
+type Timestamp struct {
+	Time         time.Time `json:"time"`
+	TSA          string    `json:"tsa"`
+	SerialNumber string    `json:"serialNumber"`
+}
+
+// Verifier verifies RFC 3161 timestamp tokens with pinned TSA certificate chains without accessing the TSA
+type Verifier struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	// all certificates in the chain, which are also used to find the TSA certificate
+	certs []*x509.Certificate
+}
+
+// The CMS (RFC 5652) and RFC 3161 structures below are parsed with encoding/asn1 rather than a pkcs7 package.
+// The pkcs7 packages available for Go are either archived or untagged, and they look up the signer certificate only
+// in the token and verify its chain at the current time, whereas a token here may omit the TSA certificate which is
+// pinned in the chain, and the chain must be valid at genTime. Only the fields needed for verification are parsed,
+// and any trailing data is rejected.
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type timeStampResp struct {
+	Status pkiStatusInfo
+	Token  contentInfo `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status int
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// tstInfo has the fields which are used for verification. Optional fields after genTime are not parsed.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// NewVerifier returns a verifier with the PEM certificates. Self-signed certificates are trusted as roots,
+// and the others are used as intermediates or as TSA certificates which are not embedded in tokens.
+func NewVerifier(pemChain []byte) (*Verifier, error) {
+	v := &Verifier{roots: x509.NewCertPool(), intermediates: x509.NewCertPool()}
+	rest := pemChain
+	hasRoot := false
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse a TSA certificate")
+		}
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			v.roots.AddCert(cert)
+			hasRoot = true
+		} else {
+			v.intermediates.AddCert(cert)
+		}
+		v.certs = append(v.certs, cert)
+	}
+	if !hasRoot {
+		return nil, errors.New("no root certificate is found in the TSA certificate chain")
+	}
+	return v, nil
+}
+
+// Verify verifies the DER timestamp token (or a timestamp response which has the token) of the signature,
+// and returns the time in the token. The token must be signed by a TSA certificate which is valid at the time
+// and is issued by the chain for timestamping.
+func (v *Verifier) Verify(token, signature []byte) (*Timestamp, error) {
+	ci, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	var sd signedData
+	if err = unmarshalStrict(ci.Content.Bytes, &sd); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the signed data in the timestamp token")
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("the timestamp token has an unexpected content type `%s`", sd.EncapContentInfo.EContentType.String())
+	}
+	var info tstInfo
+	if err = unmarshalStrict(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the timestamp info")
+	}
+	genTime, err := parseGeneralizedTime(info.GenTime)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkMessageImprint(info.MessageImprint, signature); err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("the timestamp token must have one signer, but %d signers are found", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	embedded, err := parseCertificates(sd.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	tsaCert, err := findSignerCertificate(si, append(embedded, v.certs...))
+	if err != nil {
+		return nil, err
+	}
+	if err = verifySignerInfo(si, sd.EncapContentInfo.EContent, tsaCert); err != nil {
+		return nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range append(embedded, v.certs...) {
+		intermediates.AddCert(c)
+	}
+	_, err = tsaCert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   genTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "the TSA certificate is not trusted")
+	}
+	return &Timestamp{
+		Time:         genTime,
+		TSA:          tsaCert.Subject.String(),
+		SerialNumber: info.SerialNumber.String(),
+	}, nil
+}
+
+func parseToken(token []byte) (*contentInfo, error) {
+	var ci contentInfo
+	if err := unmarshalStrict(token, &ci); err == nil && ci.ContentType.Equal(oidSignedData) {
+		return &ci, nil
+	}
+	var resp timeStampResp
+	if err := unmarshalStrict(token, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the timestamp token")
+	}
+	// granted (0) or grantedWithMods (1)
+	if resp.Status.Status > 1 {
+		return nil, fmt.Errorf("the timestamp request was not granted; status %d", resp.Status.Status)
+	}
+	if !resp.Token.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("no timestamp token is found in the timestamp response")
+	}
+	return &resp.Token, nil
+}
+
+// unmarshalStrict parses the DER data and rejects data after it
+func unmarshalStrict(data []byte, val interface{}) error {
+	rest, err := asn1.Unmarshal(data, val)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%d bytes of trailing data are found", len(rest))
+	}
+	return nil
+}
+
+func parseGeneralizedTime(raw asn1.RawValue) (time.Time, error) {
+	if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagGeneralizedTime {
+		return time.Time{}, errors.New("genTime in the timestamp info is not a GeneralizedTime")
+	}
+	// fractional seconds are accepted by time.Parse
+	t, err := time.Parse(generalizedTimeLayout, string(raw.Bytes))
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse genTime in the timestamp info")
+	}
+	return t, nil
+}
+
+// checkMessageImprint checks that the token is issued for the signature
+func checkMessageImprint(imprint messageImprint, signature []byte) error {
+	hash, ok := hashOIDs[imprint.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("the hash algorithm `%s` of the message imprint is not supported", imprint.HashAlgorithm.Algorithm.String())
+	}
+	h := hash.New()
+	h.Write(signature)
+	if !bytes.Equal(h.Sum(nil), imprint.HashedMessage) {
+		return errors.New("the timestamp token is not issued for the signature")
+	}
+	return nil
+}
+
+func parseCertificates(raw asn1.RawValue) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	rest := raw.Bytes
+	for len(rest) > 0 {
+		var certRaw asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &certRaw)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse certificates in the timestamp token")
+		}
+		cert, err := x509.ParseCertificate(certRaw.FullBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse a certificate in the timestamp token")
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// findSignerCertificate returns the certificate identified by the issuer and the serial number, or by the subject key ID
+func findSignerCertificate(si signerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0 {
+		for _, c := range certs {
+			if len(c.SubjectKeyId) > 0 && bytes.Equal(c.SubjectKeyId, si.SID.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("the TSA certificate is not found by the subject key ID")
+	}
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(si.SID.FullBytes, &ias); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the signer ID in the timestamp token")
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return c, nil
+		}
+	}
+	return nil, errors.New("the TSA certificate is not found by the issuer and the serial number")
+}
+
+// verifySignerInfo checks the signed attributes with the timestamp info and the signature on them
+func verifySignerInfo(si signerInfo, content []byte, cert *x509.Certificate) error {
+	hash, ok := hashOIDs[si.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("the digest algorithm `%s` of the timestamp token is not supported", si.DigestAlgorithm.Algorithm.String())
+	}
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return errors.New("no signed attributes are found in the timestamp token")
+	}
+	// each of the attributes must appear once with a single value (RFC 5652 section 11)
+	contentTypes, digests := 0, 0
+	var contentTypeOK, digestOK bool
+	rest := si.SignedAttrs.Bytes
+	for len(rest) > 0 {
+		var attr attribute
+		var err error
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse signed attributes in the timestamp token")
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			contentTypes++
+			var ct asn1.ObjectIdentifier
+			if err = unmarshalStrict(attr.Values.Bytes, &ct); err == nil && ct.Equal(oidTSTInfo) {
+				contentTypeOK = true
+			}
+		case attr.Type.Equal(oidMessageDigest):
+			digests++
+			var digest []byte
+			h := hash.New()
+			h.Write(content)
+			if err = unmarshalStrict(attr.Values.Bytes, &digest); err == nil && bytes.Equal(digest, h.Sum(nil)) {
+				digestOK = true
+			}
+		}
+	}
+	if contentTypes != 1 || digests != 1 || !contentTypeOK || !digestOK {
+		return errors.New("the signed attributes do not match the timestamp info")
+	}
+	// the signature is made on the DER encoding of the attributes with the SET tag instead of the implicit tag
+	signed := append([]byte{}, si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+	return verifySignature(cert.PublicKey, hash, signed, si.Signature)
+}
+
+func verifySignature(pub crypto.PublicKey, hash crypto.Hash, signed, signature []byte) error {
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return errors.Wrap(err, "failed to verify the signature of the timestamp token")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, signature) {
+			return errors.New("failed to verify the signature of the timestamp token")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, signed, signature) {
+			return errors.New("failed to verify the signature of the timestamp token")
+		}
+	default:
+		return fmt.Errorf("the key type %T of the TSA certificate is not supported", pub)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+// fakeTSA is a local timestamp authority which issues RFC 3161 timestamp tokens
+type fakeTSA struct {
+	rootPEM []byte
+	cert    *x509.Certificate
+	priv    *ecdsa.PrivateKey
+	serial  int64
+}
+
+func newFakeTSA(notBefore, notAfter time.Time, extKeyUsage x509.ExtKeyUsage) (*fakeTSA, error) {
+	rootPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sample-tsa-root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, rootPriv.Public(), rootPriv)
+	if err != nil {
+		return nil, err
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "sample-tsa"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, root, priv.Public(), rootPriv)
+	if err != nil {
+		return nil, err
+	}
+	cert, _ := x509.ParseCertificate(certDER)
+	rootPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+	return &fakeTSA{rootPEM: rootPEM, cert: cert, priv: priv}, nil
+}
+
+// timestamp returns a DER timestamp token of the signature at the time
+func (a *fakeTSA) timestamp(signature []byte, genTime string) ([]byte, error) {
+	return a.timestampWith(signature, genTime, nil)
+}
+
+// timestampWith returns a DER timestamp token whose signed data is modified by mutate after it is signed
+func (a *fakeTSA) timestampWith(signature []byte, genTime string, mutate func(sd *signedData)) ([]byte, error) {
+	a.serial++
+	imprint := sha256.Sum256(signature)
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: messageImprint{HashAlgorithm: sha256Alg, HashedMessage: imprint[:]},
+		SerialNumber:   big.NewInt(a.serial),
+		GenTime:        asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagGeneralizedTime, Bytes: []byte(genTime)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	contentType, _ := asn1.Marshal(oidTSTInfo)
+	infoDigest := sha256.Sum256(info)
+	digest, _ := asn1.Marshal(infoDigest[:])
+	attrs, err := asn1.Marshal(struct {
+		Attrs []attribute `asn1:"set"`
+	}{Attrs: []attribute{
+		{Type: oidContentType, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: contentType}},
+		{Type: oidMessageDigest, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: digest}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	// the struct is encoded as a SEQUENCE of the SET, so the SET is taken out of it
+	var attrSet asn1.RawValue
+	_, _ = asn1.Unmarshal(attrs, &attrSet)
+	var signedAttrs asn1.RawValue
+	_, _ = asn1.Unmarshal(attrSet.Bytes, &signedAttrs)
+	attrsDigest := sha256.Sum256(signedAttrs.FullBytes)
+	sig, err := ecdsa.SignASN1(rand.Reader, a.priv, attrsDigest[:])
+	if err != nil {
+		return nil, err
+	}
+	sid, _ := asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: a.cert.RawIssuer}, SerialNumber: a.cert.SerialNumber})
+	data := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: info},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256Alg,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttrs.Bytes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          sig,
+		}},
+	}
+	if mutate != nil {
+		mutate(&data)
+	}
+	sd, err := asn1.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	now := time.Now()
+	authority, err := newFakeTSA(now.Add(-24*time.Hour), now.Add(24*time.Hour), x509.ExtKeyUsageTimeStamping)
+	if err != nil {
+		t.Errorf("failed to create a TSA: %s", err.Error())
+		return
+	}
+	verifier, err := NewVerifier(authority.rootPEM)
+	if err != nil {
+		t.Errorf("failed to load the TSA certificate chain: %s", err.Error())
+		return
+	}
+	signature := []byte("sample-signature")
+	genTime := now.Add(-time.Hour).UTC()
+	token, err := authority.timestamp(signature, genTime.Format("20060102150405")+".25Z")
+	if err != nil {
+		t.Errorf("failed to issue a timestamp token: %s", err.Error())
+		return
+	}
+	ts, err := verifier.Verify(token, signature)
+	if err != nil {
+		t.Errorf("failed to verify the timestamp token: %s", err.Error())
+		return
+	}
+	expected := genTime.Truncate(time.Second).Add(250 * time.Millisecond)
+	if !ts.Time.Equal(expected) || ts.TSA != "CN=sample-tsa" {
+		t.Errorf("unexpected timestamp: %v (expected: %s)", ts, expected)
+		return
+	}
+
+	// the token in a timestamp response
+	resp, _ := asn1.Marshal(struct {
+		Status pkiStatusInfo
+		Token  asn1.RawValue
+	}{Status: pkiStatusInfo{Status: 0}, Token: asn1.RawValue{FullBytes: token}})
+	if _, err = verifier.Verify(resp, signature); err != nil {
+		t.Errorf("failed to verify the timestamp response: %s", err.Error())
+		return
+	}
+
+	if _, err = verifier.Verify(token, []byte("other-signature")); err == nil {
+		t.Errorf("the token of another signature should be rejected")
+		return
+	}
+	expiredToken, _ := authority.timestamp(signature, now.Add(-48*time.Hour).UTC().Format("20060102150405Z"))
+	if _, err = verifier.Verify(expiredToken, signature); err == nil {
+		t.Errorf("the token out of the validity of the TSA certificate should be rejected")
+		return
+	}
+
+	other, _ := newFakeTSA(now.Add(-24*time.Hour), now.Add(24*time.Hour), x509.ExtKeyUsageTimeStamping)
+	otherToken, _ := other.timestamp(signature, genTime.Format("20060102150405Z"))
+	if _, err = verifier.Verify(otherToken, signature); err == nil {
+		t.Errorf("the token by an untrusted TSA should be rejected")
+		return
+	}
+	codeSigning, _ := newFakeTSA(now.Add(-24*time.Hour), now.Add(24*time.Hour), x509.ExtKeyUsageCodeSigning)
+	codeSigningVerifier, _ := NewVerifier(codeSigning.rootPEM)
+	codeSigningToken, _ := codeSigning.timestamp(signature, genTime.Format("20060102150405Z"))
+	if _, err = codeSigningVerifier.Verify(codeSigningToken, signature); err == nil {
+		t.Errorf("the token by a certificate without timestamping usage should be rejected")
+		return
+	}
+}
+
+func TestVerifyMalformedTimestamp(t *testing.T) {
+	now := time.Now()
+	authority, err := newFakeTSA(now.Add(-24*time.Hour), now.Add(24*time.Hour), x509.ExtKeyUsageTimeStamping)
+	if err != nil {
+		t.Errorf("failed to create a TSA: %s", err.Error())
+		return
+	}
+	verifier, err := NewVerifier(authority.rootPEM)
+	if err != nil {
+		t.Errorf("failed to load the TSA certificate chain: %s", err.Error())
+		return
+	}
+	signature := []byte("sample-signature")
+	genTime := now.Add(-time.Hour).UTC().Format("20060102150405Z")
+	token, err := authority.timestamp(signature, genTime)
+	if err != nil {
+		t.Errorf("failed to issue a timestamp token: %s", err.Error())
+		return
+	}
+
+	malformed := map[string][]byte{
+		"empty":         {},
+		"not DER":       []byte("sample-token"),
+		"truncated":     token[:len(token)/2],
+		"trailing data": append(append([]byte{}, token...), 0x00),
+	}
+	mutations := map[string]func(sd *signedData){
+		"content type": func(sd *signedData) {
+			sd.EncapContentInfo.EContentType = oidSignedData
+		},
+		"timestamp info": func(sd *signedData) {
+			var info tstInfo
+			_, _ = asn1.Unmarshal(sd.EncapContentInfo.EContent, &info)
+			info.SerialNumber = big.NewInt(100)
+			sd.EncapContentInfo.EContent, _ = asn1.Marshal(info)
+		},
+		"no signer": func(sd *signedData) {
+			sd.SignerInfos = []signerInfo{}
+		},
+		"two signers": func(sd *signedData) {
+			sd.SignerInfos = append(sd.SignerInfos, sd.SignerInfos[0])
+		},
+		"unknown signer": func(sd *signedData) {
+			sid, _ := asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: authority.cert.RawIssuer}, SerialNumber: big.NewInt(100)})
+			sd.SignerInfos[0].SID = asn1.RawValue{FullBytes: sid}
+		},
+		"SHA-1 digest": func(sd *signedData) {
+			sd.SignerInfos[0].DigestAlgorithm = pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}}
+		},
+		"no signed attributes": func(sd *signedData) {
+			sd.SignerInfos[0].SignedAttrs = asn1.RawValue{}
+		},
+		"malformed signed attributes": func(sd *signedData) {
+			sd.SignerInfos[0].SignedAttrs.Bytes = []byte{0x30, 0x05, 0x01}
+		},
+		"duplicated signed attributes": func(sd *signedData) {
+			attrs := sd.SignerInfos[0].SignedAttrs.Bytes
+			sd.SignerInfos[0].SignedAttrs.Bytes = append(append([]byte{}, attrs...), attrs...)
+		},
+		"signature": func(sd *signedData) {
+			sd.SignerInfos[0].Signature = []byte("sample-signature")
+		},
+	}
+	for name, mutate := range mutations {
+		malformed[name], err = authority.timestampWith(signature, genTime, mutate)
+		if err != nil {
+			t.Errorf("failed to issue a timestamp token (%s): %s", name, err.Error())
+			return
+		}
+	}
+	malformed["genTime"], _ = authority.timestamp(signature, "sample-time")
+	for name, tok := range malformed {
+		if _, err = verifier.Verify(tok, signature); err == nil {
+			t.Errorf("the token with a malformed or tampered part (%s) should be rejected", name)
+			return
+		}
+	}
+
+	// a response which is not granted
+	rejected, _ := asn1.Marshal(struct {
+		Status pkiStatusInfo
+	}{Status: pkiStatusInfo{Status: 2}})
+	if _, err = verifier.Verify(rejected, signature); err == nil {
+		t.Errorf("the rejected timestamp response should be rejected")
+		return
+	}
+}
@@ -25,11 +25,13 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/stolostron/integrity-shield/shield/pkg/shield"
 	ac "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/controller"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -46,10 +48,11 @@ const tlsDir = `/run/secrets/tls`
 
 type k8sManifestHandler struct {
 	Client client.Client
+	Cache  *ac.ResourceCache
 }
 
 func (h *k8sManifestHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
-	res := ac.ProcessRequest(req)
+	res := ac.ProcessRequest(req, h.Cache)
 	return res
 }
 
@@ -62,8 +65,10 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var probeAddr string
 	var enableLeaderElection bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -71,21 +76,44 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "22a603b9.sigstore.dev",
-		CertDir:            tlsDir,
+	kubeconfig := ctrl.GetConfigOrDie()
+	mgr, err := ctrl.NewManager(kubeconfig, ctrl.Options{
+		Scheme:                 scheme,
+		MetricsBindAddress:     metricsAddr,
+		HealthProbeBindAddress: probeAddr,
+		Port:                   9443,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       "22a603b9.sigstore.dev",
+		CertDir:                tlsDir,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// informer-backed cache for profiles, namespaces and the controller config
+	resourceCache, err := ac.NewResourceCache(kubeconfig, mgr.GetRESTMapper())
+	if err != nil {
+		setupLog.Error(err, "unable to set up resource cache")
+		os.Exit(1)
+	}
+	if err := mgr.Add(resourceCache); err != nil {
+		setupLog.Error(err, "unable to add resource cache to manager")
+		os.Exit(1)
+	}
+	// namespaces referred by expressions and signer bindings are also read from the cache
+	shield.SetNamespaceGetter(resourceCache.GetNamespace)
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("cache-sync", resourceCache.ReadyCheck); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+
 	hookServer := mgr.GetWebhookServer()
-	hookServer.Register("/validate-resource", &webhook.Admission{Handler: &k8sManifestHandler{Client: mgr.GetClient()}})
+	hookServer.Register("/validate-resource", &webhook.Admission{Handler: &k8sManifestHandler{Client: mgr.GetClient(), Cache: resourceCache}})
 
 	// +kubebuilder:scaffold:builder
 
@@ -35,17 +35,9 @@ type ManifestIntegrityProfileSpec struct {
 	Parameters k8smnfconfig.ParameterObject `json:"parameters,omitempty"`
 }
 
+// MatchCondition is shared with the observer so that both paths select the same resources
 type MatchCondition struct {
-	Kinds              []Kinds               `json:"kinds,omitempty"`
-	Namespaces         []string              `json:"namespaces,omitempty"`
-	ExcludedNamespaces []string              `json:"excludedNamespaces,omitempty"`
-	LabelSelector      *metav1.LabelSelector `json:"labelSelector,omitempty"`
-	NamespaceSelector  *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
-}
-
-type Kinds struct {
-	Kinds     []string `json:"kinds,omitempty"`
-	ApiGroups []string `json:"apiGroups,omitempty"`
+	k8smnfconfig.MatchCondition `json:",inline"`
 }
 
 // ManifestIntegrityProfileStatus defines the observed state of ManifestIntegrityProfile
@@ -24,32 +24,6 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Kinds) DeepCopyInto(out *Kinds) {
-	*out = *in
-	if in.Kinds != nil {
-		in, out := &in.Kinds, &out.Kinds
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
-	if in.ApiGroups != nil {
-		in, out := &in.ApiGroups, &out.ApiGroups
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Kinds.
-func (in *Kinds) DeepCopy() *Kinds {
-	if in == nil {
-		return nil
-	}
-	out := new(Kinds)
-	in.DeepCopyInto(out)
-	return out
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManifestIntegrityProfile) DeepCopyInto(out *ManifestIntegrityProfile) {
 	*out = *in
@@ -17,15 +17,24 @@
 package config
 
 import (
+	"time"
+
 	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	defaultMaxConcurrentProfiles = 4
+	// shorter than the default webhook timeout (10s) so that a response is returned in time
+	defaultRequestTimeoutSeconds = 8
+)
+
 type AdmissionControllerConfig struct {
 	InScopeNamespaceSelector NamespaceSelector `json:"inScopeNamespaceSelector,omitempty"`
 	Allow                    Allow             `json:"allow,omitempty"`
 	SideEffect               SideEffectConfig  `json:"sideEffect,omitempty"`
 	Mode                     string            `json:"mode,omitempty"`
+	Evaluation               EvaluationConfig  `json:"evaluation,omitempty"`
 	Options                  []string          `json:"option,omitempty"`
 }
 
@@ -43,6 +52,14 @@ type SideEffectConfig struct {
 	UpdateMIPStatusForDeniedRequest bool `json:"updateMIPStatusForDeniedRequest"`
 }
 
+// EvaluationConfig controls how matched profiles are evaluated for a request.
+type EvaluationConfig struct {
+	// the number of profiles evaluated in parallel
+	MaxConcurrentProfiles int `json:"maxConcurrentProfiles,omitempty"`
+	// the time budget shared by all profiles evaluated for a request
+	RequestTimeoutSeconds int `json:"requestTimeoutSeconds,omitempty"`
+}
+
 func (ns NamespaceSelector) Match(rns string) bool {
 	excluded := false
 	included := false
@@ -89,6 +106,20 @@ func (allow Allow) Match(kind metav1.GroupVersionKind) bool {
 	return false
 }
 
+func (e EvaluationConfig) GetMaxConcurrentProfiles() int {
+	if e.MaxConcurrentProfiles <= 0 {
+		return defaultMaxConcurrentProfiles
+	}
+	return e.MaxConcurrentProfiles
+}
+
+func (e EvaluationConfig) GetRequestTimeout() time.Duration {
+	if e.RequestTimeoutSeconds <= 0 {
+		return defaultRequestTimeoutSeconds * time.Second
+	}
+	return time.Duration(e.RequestTimeoutSeconds) * time.Second
+}
+
 func CheckIfDetectOnly(mode string) bool {
 	return mode == "detect"
 }
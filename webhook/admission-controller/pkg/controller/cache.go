@@ -0,0 +1,201 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	miprofile "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/apis/manifestintegrityprofile/v1"
+	mipversioned "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/client/manifestintegrityprofile/clientset/versioned"
+	mipinformers "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/client/manifestintegrityprofile/informers/externalversions"
+	miplisters "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/client/manifestintegrityprofile/listers/manifestintegrityprofile/v1"
+	acconfig "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	kubeinformers "k8s.io/client-go/informers"
+	kubeclient "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const defaultCacheResyncPeriod = 10 * time.Minute
+
+// ResourceCache holds informer-backed listers for the resources which are
+// referred while processing admission requests, so that ProcessRequest does not
+// call the API server for ManifestIntegrityProfiles, Namespaces and the controller config.
+type ResourceCache struct {
+	ConfigNamespace string
+	ConfigName      string
+	ConfigKey       string
+	// used to find the kind of the main resource for subresource requests
+	RESTMapper meta.RESTMapper
+
+	profileLister   miplisters.ManifestIntegrityProfileLister
+	namespaceLister corelisters.NamespaceLister
+	configMapLister corelisters.ConfigMapLister
+
+	mipInformerFactory  mipinformers.SharedInformerFactory
+	kubeInformerFactory kubeinformers.SharedInformerFactory
+	cmInformerFactory   kubeinformers.SharedInformerFactory
+
+	cacheSynced []cache.InformerSynced
+}
+
+// NewResourceCache sets up shared informers for ManifestIntegrityProfiles, Namespaces and
+// the admission controller ConfigMap. Informers are not started until Start() is called.
+func NewResourceCache(kubeconfig *rest.Config, mapper meta.RESTMapper) (*ResourceCache, error) {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultPodNamespace
+	}
+	configName := os.Getenv("CONTROLLER_CONFIG_NAME")
+	if configName == "" {
+		configName = defaultControllerConfigName
+	}
+	configKey := os.Getenv("CONTROLLER_CONFIG_KEY")
+	if configKey == "" {
+		configKey = defaultConfigKeyInConfigMap
+	}
+
+	clientset, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	mipClientset, err := mipversioned.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	mipInformerFactory := mipinformers.NewSharedInformerFactory(mipClientset, defaultCacheResyncPeriod)
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(clientset, defaultCacheResyncPeriod)
+	// only the controller config is watched in the pod namespace
+	cmInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(clientset, defaultCacheResyncPeriod,
+		kubeinformers.WithNamespace(namespace),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", configName).String()
+		}),
+	)
+
+	profileInformer := mipInformerFactory.Apis().V1().ManifestIntegrityProfiles()
+	namespaceInformer := kubeInformerFactory.Core().V1().Namespaces()
+	configMapInformer := cmInformerFactory.Core().V1().ConfigMaps()
+
+	rc := &ResourceCache{
+		ConfigNamespace:     namespace,
+		ConfigName:          configName,
+		ConfigKey:           configKey,
+		RESTMapper:          mapper,
+		profileLister:       profileInformer.Lister(),
+		namespaceLister:     namespaceInformer.Lister(),
+		configMapLister:     configMapInformer.Lister(),
+		mipInformerFactory:  mipInformerFactory,
+		kubeInformerFactory: kubeInformerFactory,
+		cmInformerFactory:   cmInformerFactory,
+		cacheSynced: []cache.InformerSynced{
+			profileInformer.Informer().HasSynced,
+			namespaceInformer.Informer().HasSynced,
+			configMapInformer.Informer().HasSynced,
+		},
+	}
+	return rc, nil
+}
+
+// Start runs all informers and blocks until the context is done.
+// This implements manager.Runnable so that the cache can be started by the controller-runtime manager.
+func (rc *ResourceCache) Start(ctx context.Context) error {
+	log.Info("starting informers for admission controller cache.")
+	rc.mipInformerFactory.Start(ctx.Done())
+	rc.kubeInformerFactory.Start(ctx.Done())
+	rc.cmInformerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), rc.cacheSynced...) {
+		return errors.New("failed to wait for admission controller caches to sync")
+	}
+	log.Info("admission controller cache is synced.")
+	<-ctx.Done()
+	return nil
+}
+
+// NeedLeaderElection returns false because every replica needs its own cache to serve admission requests.
+func (rc *ResourceCache) NeedLeaderElection() bool {
+	return false
+}
+
+// HasSynced returns true when all informers have completed the initial list.
+func (rc *ResourceCache) HasSynced() bool {
+	for _, synced := range rc.cacheSynced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadyCheck is a healthz.Checker which reports ready only after the cache has synced.
+func (rc *ResourceCache) ReadyCheck(_ *http.Request) error {
+	if !rc.HasSynced() {
+		return errors.New("admission controller cache is not synced yet")
+	}
+	return nil
+}
+
+// ListProfiles returns all ManifestIntegrityProfiles in the cache.
+// The returned objects are copies, so callers may modify them.
+func (rc *ResourceCache) ListProfiles() ([]miprofile.ManifestIntegrityProfile, error) {
+	cached, err := rc.profileLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	profiles := []miprofile.ManifestIntegrityProfile{}
+	for _, p := range cached {
+		profiles = append(profiles, *p.DeepCopy())
+	}
+	return profiles, nil
+}
+
+// GetNamespace returns a Namespace in the cache.
+func (rc *ResourceCache) GetNamespace(name string) (*corev1.Namespace, error) {
+	return rc.namespaceLister.Get(name)
+}
+
+// GetAdmissionControllerConfig loads the admission controller config from the cached ConfigMap.
+func (rc *ResourceCache) GetAdmissionControllerConfig() (*acconfig.AdmissionControllerConfig, error) {
+	cm, err := rc.configMapLister.ConfigMaps(rc.ConfigNamespace).Get(rc.ConfigName)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get a configmap `%s` in `%s` namespace", rc.ConfigName, rc.ConfigNamespace))
+	}
+	cfgBytes, found := cm.Data[rc.ConfigKey]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("`%s` is not found in configmap", rc.ConfigKey))
+	}
+	var sc *acconfig.AdmissionControllerConfig
+	err = yaml.Unmarshal([]byte(cfgBytes), &sc)
+	if err != nil {
+		return sc, errors.Wrap(err, fmt.Sprintf("failed to unmarshal config.yaml into %T", sc))
+	}
+	return sc, nil
+}
@@ -19,8 +19,10 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
 
-	k8smnfutil "github.com/sigstore/k8s-manifest-sigstore/pkg/util"
+	"github.com/pkg/errors"
 	"github.com/sigstore/k8s-manifest-sigstore/pkg/util/kubeutil"
 	log "github.com/sirupsen/logrus"
 	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
@@ -28,8 +30,7 @@ import (
 	mipclient "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/client/manifestintegrityprofile/clientset/versioned/typed/manifestintegrityprofile/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/labels"
-	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
@@ -37,151 +38,107 @@ func GetParametersFromConstraint(constraint miprofile.ManifestIntegrityProfileSp
 	return &constraint.Parameters
 }
 
-func LoadConstraints() ([]miprofile.ManifestIntegrityProfile, error) {
-	config, err := kubeutil.GetKubeConfig()
-	if err != nil {
-		return nil, nil
-	}
-	clientset, err := mipclient.NewForConfig(config)
-	if err != nil {
-		log.Error(err)
-		return nil, nil
-	}
-	miplist, err := clientset.ManifestIntegrityProfiles().List(context.Background(), metav1.ListOptions{})
+func LoadConstraints(rc *ResourceCache) ([]miprofile.ManifestIntegrityProfile, error) {
+	miplist, err := rc.ListProfiles()
 	if err != nil {
 		log.Error("failed to get ManifestIntegrityProfiles:", err.Error())
 		return nil, nil
 	}
-	return miplist.Items, nil
+	// sort by name so that results are accumulated in a deterministic order
+	sort.Slice(miplist, func(i, j int) bool {
+		return miplist[i].Name < miplist[j].Name
+	})
+	return miplist, nil
 }
 
-// Match
-func matchCheck(req admission.Request, match miprofile.MatchCondition) bool {
-	// check if excludedNamespace
-	if len(match.ExcludedNamespaces) != 0 {
-		for _, ens := range match.ExcludedNamespaces {
-			if k8smnfutil.MatchPattern(ens, req.Namespace) {
-				return false
-			}
-		}
-	}
-	// check if matched kinds/namespace/label
-	var nsMatched bool
-	var kindsMatched bool
-	var labelMatched bool
-	var nslabelMatched bool
-	nsMatched = checkNamespaceMatch(req, match.Namespaces)
-	kindsMatched = checkKindMatch(req, match.Kinds)
-	labelMatched = checkLabelMatch(req, match.LabelSelector)
-	nslabelMatched = checkNamespaceLabelMatch(req.Namespace, match.NamespaceSelector)
-
-	if nsMatched && kindsMatched && nslabelMatched && labelMatched {
-		return true
-	}
-	return false
-}
-
-func checkNamespaceLabelMatch(namespace string, labelSelector *metav1.LabelSelector) bool {
-	if labelSelector == nil {
-		return true
+// validateProfileRequest checks a ManifestIntegrityProfile in the request so that invalid profiles are rejected when they are created or updated.
+// `isProfile` is false if the request is not for a ManifestIntegrityProfile.
+func validateProfileRequest(req admission.Request) (isProfile bool, err error) {
+	if req.Kind.Group != miprofile.SchemeGroupVersion.Group || req.Kind.Kind != "ManifestIntegrityProfile" {
+		return false, nil
 	}
-	config, err := kubeutil.GetKubeConfig()
-	if err != nil {
-		return false
+	if req.SubResource != "" || len(req.Object.Raw) == 0 {
+		return false, nil
 	}
-	clientset, err := kubeclient.NewForConfig(config)
+	var profile miprofile.ManifestIntegrityProfile
+	err = json.Unmarshal(req.Object.Raw, &profile)
 	if err != nil {
-		log.Error(err)
-		return false
+		return true, errors.Wrap(err, "failed to unmarshal ManifestIntegrityProfile")
 	}
-	ns, err := clientset.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
+	err = k8smnfconfig.ValidateManifestVerifyRule(&profile.Spec.Parameters.ManifestVerifyRule)
 	if err != nil {
-		log.Errorf("failed to get a namespace `%s`:`%s`", namespace, err.Error())
-		return false
+		return true, errors.Wrap(err, fmt.Sprintf("invalid ManifestIntegrityProfile `%s`", profile.Name))
 	}
-	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	err = profile.Spec.Parameters.ImageProfile.Validate()
 	if err != nil {
-		log.Errorf("failed to convert the LabelSelector api type into a struct that implements labels.Selector; %s", err.Error())
-		return false
+		return true, errors.Wrap(err, fmt.Sprintf("invalid ManifestIntegrityProfile `%s`", profile.Name))
 	}
-	labelsMap := ns.GetLabels()
-	labelsSet := labels.Set(labelsMap)
-	matched := selector.Matches(labelsSet)
-	return matched
+	return true, nil
 }
 
-func checkLabelMatch(req admission.Request, labelSelector *metav1.LabelSelector) bool {
-	if labelSelector == nil {
-		return true
-	}
-	var resource unstructured.Unstructured
-	objectBytes := req.AdmissionRequest.Object.Raw
-	err := json.Unmarshal(objectBytes, &resource)
-	if err != nil {
-		log.Errorf("failed to Unmarshal a requested object into %T; %s", resource, err.Error())
+// Match
+func matchCheck(req admission.Request, match miprofile.MatchCondition, rc *ResourceCache) bool {
+	kind := requestKind(req, rc)
+	target := k8smnfconfig.MatchTarget{
+		ApiGroup:   kind.Group,
+		Kind:       kind.Kind,
+		Name:       req.Name,
+		Namespace:  req.Namespace,
+		Namespaced: isNamespacedRequest(req, kind),
+	}
+	// kind, scope and namespace name are checked first because they do not need any object
+	if !match.MatchKind(target.ApiGroup, target.Kind) || !match.MatchScope(target.Namespaced) {
 		return false
 	}
-	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
-	if err != nil {
-		log.Errorf("failed to convert the LabelSelector api type into a struct that implements labels.Selector; %s", err.Error())
+	if target.Namespaced && !match.MatchNamespaceName(target.Namespace) {
 		return false
 	}
-	labelsMap := resource.GetLabels()
-	labelsSet := labels.Set(labelsMap)
-	matched := selector.Matches(labelsSet)
-	return matched
-}
-
-func checkNamespaceMatch(req admission.Request, match []string) bool {
-	matched := false
-	if len(match) == 0 {
-		matched = true
-	} else {
-		// check if cluster scope
-		if req.Namespace == "" {
-			matched = true
+	if match.LabelSelector != nil || match.AnnotationSelector != nil || k8smnfconfig.IsNamespaceKind(target.ApiGroup, target.Kind) {
+		var resource unstructured.Unstructured
+		objectBytes := req.AdmissionRequest.Object.Raw
+		err := json.Unmarshal(objectBytes, &resource)
+		if err != nil {
+			log.Errorf("failed to Unmarshal a requested object into %T; %s", resource, err.Error())
+			return false
 		}
-		for _, ns := range match {
-			if k8smnfutil.MatchPattern(ns, req.Namespace) {
-				matched = true
-			}
+		target.Labels = resource.GetLabels()
+		target.Annotations = resource.GetAnnotations()
+	}
+	if match.NamespaceSelector != nil && target.Namespaced {
+		ns, err := rc.GetNamespace(req.Namespace)
+		if err != nil {
+			log.Errorf("failed to get a namespace `%s`:`%s`", req.Namespace, err.Error())
+			return false
 		}
+		target.NamespaceLabels = ns.GetLabels()
 	}
-	return matched
+	return match.Match(target)
 }
 
-func checkKindMatch(req admission.Request, match []miprofile.Kinds) bool {
-	matched := false
-	if len(match) == 0 {
-		matched = true
-	} else {
-		for _, kinds := range match {
-			kind := false
-			group := false
-			if len(kinds.Kinds) == 0 {
-				kind = true
-			} else {
-				for _, k := range kinds.Kinds {
-					if k8smnfutil.MatchPattern(k, req.Kind.Kind) {
-						kind = true
-					}
-				}
-			}
-			if len(kinds.ApiGroups) == 0 {
-				group = true
-			} else {
-				for _, g := range kinds.ApiGroups {
-					if k8smnfutil.MatchPattern(g, req.Kind.Group) {
-						group = true
-					}
-				}
-			}
-			if kind && group {
-				matched = true
-			}
-		}
+// the namespace in a request for a Namespace object is the name of the namespace itself
+func isNamespacedRequest(req admission.Request, kind metav1.GroupVersionKind) bool {
+	if k8smnfconfig.IsNamespaceKind(kind.Group, kind.Kind) {
+		return false
+	}
+	return req.Namespace != ""
+}
+
+// requestKind returns the kind of the main resource for subresource requests such as `deployments/scale`
+func requestKind(req admission.Request, rc *ResourceCache) metav1.GroupVersionKind {
+	if req.SubResource == "" || rc.RESTMapper == nil {
+		return req.Kind
+	}
+	gvr := schema.GroupVersionResource{
+		Group:    req.Resource.Group,
+		Version:  req.Resource.Version,
+		Resource: req.Resource.Resource,
+	}
+	gvk, err := rc.RESTMapper.KindFor(gvr)
+	if err != nil {
+		log.Debugf("failed to get the kind of `%s`; %s", gvr.String(), err.Error())
+		return req.Kind
 	}
-	return matched
+	return metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}
 }
 
 // Status
@@ -0,0 +1,121 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stolostron/integrity-shield/shield/pkg/shield"
+	miprofile "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/apis/manifestintegrityprofile/v1"
+	acconfig "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// requestHandler evaluates a profile for a request; it is replaced in tests.
+var requestHandler = shield.RequestHandlerWithContext
+
+// evaluateProfiles runs the request handler for every matched profile with bounded parallelism.
+// All profiles share one time budget; profiles which are not completed within the budget get an incomplete result.
+// Results are returned in the same order as the profiles so that accumulated messages are deterministic.
+// The budget is canceled when this function returns, so that profiles still running stop their remaining steps.
+func evaluateProfiles(req admission.Request, constraints []miprofile.ManifestIntegrityProfile, evalConfig acconfig.EvaluationConfig, rc *ResourceCache) []Result {
+	timeout := evalConfig.GetRequestTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// admission.Request holds an admission.k8s.io/v1 request for both v1 and v1beta1 reviews
+	reqv1 := req.AdmissionRequest.DeepCopy()
+
+	// identical verification work across profiles is done only once per request
+	verifyCache := shield.NewVerifyResultCache()
+	sem := make(chan struct{}, evalConfig.GetMaxConcurrentProfiles())
+
+	results := make([]Result, len(constraints))
+	resultChs := make([]chan *shield.ResultFromRequestHandler, len(constraints))
+	for i := range constraints {
+		constraint := constraints[i]
+		//match check: kind, namespace, label
+		isMatched := matchCheck(req, constraint.Spec.Match, rc)
+		if !isMatched {
+			results[i] = Result{
+				ReqHandlerResult: &shield.ResultFromRequestHandler{
+					Allow:   true,
+					Message: "not protected",
+				},
+				Profile: constraint.Name,
+			}
+			continue
+		}
+
+		// pick parameters from constaint
+		paramObj := GetParametersFromConstraint(constraint.Spec)
+
+		resultCh := make(chan *shield.ResultFromRequestHandler, 1)
+		resultChs[i] = resultCh
+		go func() {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			// call request handler & receive result from request handler (allow, message)
+			resultCh <- requestHandler(ctx, reqv1.DeepCopy(), paramObj, verifyCache)
+		}()
+	}
+
+	for i, resultCh := range resultChs {
+		if resultCh == nil {
+			continue
+		}
+		rhr := waitForResult(ctx, resultCh)
+		if rhr == nil {
+			log.WithFields(log.Fields{
+				"namespace": req.Namespace,
+				"name":      req.Name,
+				"kind":      req.Kind.Kind,
+				"operation": req.Operation,
+			}).Warningf("profile evaluation is not completed within %s: %s", timeout.String(), constraints[i].Name)
+			paramObj := GetParametersFromConstraint(constraints[i].Spec)
+			msg := fmt.Sprintf("Verification was not completed within the request time budget (%s).", timeout.String())
+			rhr = shield.NewIncompleteResult(reqv1, paramObj, msg)
+		}
+		results[i] = Result{
+			ReqHandlerResult: rhr,
+			Profile:          constraints[i].Name,
+		}
+	}
+	return results
+}
+
+// waitForResult returns nil if the result is not received before the context is done.
+func waitForResult(ctx context.Context, resultCh chan *shield.ResultFromRequestHandler) *shield.ResultFromRequestHandler {
+	// a result which is already received is preferred to the deadline
+	select {
+	case rhr := <-resultCh:
+		return rhr
+	default:
+	}
+	select {
+	case rhr := <-resultCh:
+		return rhr
+	case <-ctx.Done():
+		return nil
+	}
+}
@@ -0,0 +1,273 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	k8smnfconfig "github.com/stolostron/integrity-shield/shield/pkg/config"
+	"github.com/stolostron/integrity-shield/shield/pkg/shield"
+	miprofile "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/apis/manifestintegrityprofile/v1"
+	acconfig "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/config"
+	admv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// fakeProfile is evaluated by fakeHandler instead of the request handler
+type fakeProfile struct {
+	name string
+	// the verification of the profile takes this time; a delay longer than the budget blocks until the budget expires
+	delay time.Duration
+	// profiles with the same signature reference share the verification work
+	imageRef string
+	allow    bool
+}
+
+// fakeHandler records how the profiles are evaluated
+type fakeHandler struct {
+	profiles map[string]fakeProfile
+
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+	verified   map[string]int
+	canceled   chan string
+}
+
+func newFakeHandler(profiles []fakeProfile) *fakeHandler {
+	h := &fakeHandler{
+		profiles: map[string]fakeProfile{},
+		verified: map[string]int{},
+		canceled: make(chan string, len(profiles)),
+	}
+	for _, p := range profiles {
+		h.profiles[p.name] = p
+	}
+	return h
+}
+
+func (h *fakeHandler) handle(ctx context.Context, req *admv1.AdmissionRequest, paramObj *k8smnfconfig.ParameterObject, verifyCache *shield.VerifyResultCache) *shield.ResultFromRequestHandler {
+	p := h.profiles[paramObj.ConstraintName]
+	h.mu.Lock()
+	h.running++
+	if h.running > h.maxRunning {
+		h.maxRunning = h.running
+	}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.running--
+		h.mu.Unlock()
+	}()
+
+	_, _ = verifyCache.Do(p.imageRef, func() (interface{}, error) {
+		h.mu.Lock()
+		h.verified[p.imageRef]++
+		h.mu.Unlock()
+		select {
+		case <-time.After(p.delay):
+		case <-ctx.Done():
+			h.canceled <- p.name
+		}
+		return nil, nil
+	})
+	if ctx.Err() != nil {
+		return shield.NewIncompleteResult(req, paramObj, "canceled")
+	}
+	msg := "verified"
+	if !p.allow {
+		msg = "denied by " + p.name
+	}
+	return &shield.ResultFromRequestHandler{Allow: p.allow, Message: msg}
+}
+
+func TestEvaluateProfiles(t *testing.T) {
+	testCases := []struct {
+		name       string
+		evalConfig acconfig.EvaluationConfig
+		profiles   []fakeProfile
+		// expected results in the profile order
+		wantAllow []bool
+		// the accumulated message
+		wantMessage string
+		// profiles whose results are incomplete
+		wantIncomplete []string
+		// the number of verifications for each signature reference
+		wantVerified map[string]int
+		// the upper bound of profiles evaluated at the same time
+		wantMaxRunning int
+		maxDuration    time.Duration
+	}{
+		{
+			name:       "results follow the profile order whatever the completion order is",
+			evalConfig: acconfig.EvaluationConfig{MaxConcurrentProfiles: 3},
+			profiles: []fakeProfile{
+				{name: "profile-a", delay: 150 * time.Millisecond, imageRef: "sample/a"},
+				{name: "profile-b", delay: 75 * time.Millisecond, imageRef: "sample/b"},
+				{name: "profile-c", imageRef: "sample/c"},
+			},
+			wantAllow:      []bool{false, false, false},
+			wantMessage:    "[profile-a]denied by profile-a;[profile-b]denied by profile-b;[profile-c]denied by profile-c",
+			wantVerified:   map[string]int{"sample/a": 1, "sample/b": 1, "sample/c": 1},
+			wantMaxRunning: 3,
+			maxDuration:    time.Second,
+		},
+		{
+			name:       "a slow profile is incomplete and does not block the response",
+			evalConfig: acconfig.EvaluationConfig{RequestTimeoutSeconds: 1},
+			profiles: []fakeProfile{
+				{name: "profile-fast", imageRef: "sample/fast", allow: true},
+				{name: "profile-slow", delay: time.Minute, imageRef: "sample/slow", allow: true},
+			},
+			wantAllow:      []bool{true, false},
+			wantIncomplete: []string{"profile-slow"},
+			wantVerified:   map[string]int{"sample/fast": 1, "sample/slow": 1},
+			wantMaxRunning: 2,
+			maxDuration:    3 * time.Second,
+		},
+		{
+			name:       "identical verification work runs only once",
+			evalConfig: acconfig.EvaluationConfig{MaxConcurrentProfiles: 4},
+			profiles: []fakeProfile{
+				{name: "profile-a", delay: 50 * time.Millisecond, imageRef: "sample/shared", allow: true},
+				{name: "profile-b", delay: 50 * time.Millisecond, imageRef: "sample/shared", allow: true},
+				{name: "profile-c", delay: 50 * time.Millisecond, imageRef: "sample/shared", allow: true},
+			},
+			wantAllow:      []bool{true, true, true},
+			wantMessage:    "[profile-a]verified;[profile-b]verified;[profile-c]verified",
+			wantVerified:   map[string]int{"sample/shared": 1},
+			wantMaxRunning: 3,
+			maxDuration:    time.Second,
+		},
+		{
+			name:       "profiles are evaluated with bounded parallelism",
+			evalConfig: acconfig.EvaluationConfig{MaxConcurrentProfiles: 2},
+			profiles: []fakeProfile{
+				{name: "profile-a", delay: 50 * time.Millisecond, imageRef: "sample/a", allow: true},
+				{name: "profile-b", delay: 50 * time.Millisecond, imageRef: "sample/b", allow: true},
+				{name: "profile-c", delay: 50 * time.Millisecond, imageRef: "sample/c", allow: true},
+				{name: "profile-d", delay: 50 * time.Millisecond, imageRef: "sample/d", allow: true},
+				{name: "profile-e", delay: 50 * time.Millisecond, imageRef: "sample/e", allow: true},
+			},
+			wantAllow:      []bool{true, true, true, true, true},
+			wantVerified:   map[string]int{"sample/a": 1, "sample/b": 1, "sample/c": 1, "sample/d": 1, "sample/e": 1},
+			wantMaxRunning: 2,
+			maxDuration:    time.Second,
+		},
+	}
+
+	origHandler := requestHandler
+	defer func() { requestHandler = origHandler }()
+
+	for _, tc := range testCases {
+		h := newFakeHandler(tc.profiles)
+		requestHandler = h.handle
+
+		constraints := []miprofile.ManifestIntegrityProfile{}
+		for _, p := range tc.profiles {
+			constraints = append(constraints, miprofile.ManifestIntegrityProfile{
+				ObjectMeta: metav1.ObjectMeta{Name: p.name},
+				Spec: miprofile.ManifestIntegrityProfileSpec{
+					Parameters: k8smnfconfig.ParameterObject{
+						ConstraintName: p.name,
+						Action:         &k8smnfconfig.Action{Mode: "enforce"},
+					},
+				},
+			})
+		}
+		req := admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			Namespace: "sample-ns",
+			Name:      "sample-cm",
+			Operation: admv1.Create,
+		}}
+
+		start := time.Now()
+		results := evaluateProfiles(req, constraints, tc.evalConfig, &ResourceCache{})
+		elapsed := time.Since(start)
+
+		if elapsed > tc.maxDuration {
+			t.Errorf("%s: evaluation took %s; expected at most %s", tc.name, elapsed.String(), tc.maxDuration.String())
+			return
+		}
+		if len(results) != len(tc.profiles) {
+			t.Errorf("%s: expected %d results, got %d", tc.name, len(tc.profiles), len(results))
+			return
+		}
+		for i, r := range results {
+			if r.Profile != tc.profiles[i].name {
+				t.Errorf("%s: result %d should be for `%s`, got `%s`", tc.name, i, tc.profiles[i].name, r.Profile)
+				return
+			}
+			if r.ReqHandlerResult.Allow != tc.wantAllow[i] {
+				t.Errorf("%s: expected allow %v for `%s`, got %v: %s", tc.name, tc.wantAllow[i], r.Profile, r.ReqHandlerResult.Allow, r.ReqHandlerResult.Message)
+				return
+			}
+			incomplete := strings.Contains(r.ReqHandlerResult.Message, "not completed within the request time budget")
+			wantIncomplete := false
+			for _, name := range tc.wantIncomplete {
+				if name == r.Profile {
+					wantIncomplete = true
+				}
+			}
+			if incomplete != wantIncomplete {
+				t.Errorf("%s: expected incomplete %v for `%s`, got message: %s", tc.name, wantIncomplete, r.Profile, r.ReqHandlerResult.Message)
+				return
+			}
+		}
+		if tc.wantMessage != "" {
+			if msg := getAccumulatedResult(results).Message; msg != tc.wantMessage {
+				t.Errorf("%s: unexpected accumulated message: %s", tc.name, msg)
+				return
+			}
+		}
+
+		// profiles still running after the response must see the canceled budget and stop
+		for _, name := range tc.wantIncomplete {
+			select {
+			case canceled := <-h.canceled:
+				if canceled != name {
+					t.Errorf("%s: unexpected canceled profile `%s`", tc.name, canceled)
+					return
+				}
+			case <-time.After(time.Second):
+				t.Errorf("%s: `%s` is still running after the response", tc.name, name)
+				return
+			}
+		}
+
+		h.mu.Lock()
+		verified := h.verified
+		maxRunning := h.maxRunning
+		h.mu.Unlock()
+		for ref, want := range tc.wantVerified {
+			if verified[ref] != want {
+				t.Errorf("%s: expected %d verifications of `%s`, got %d", tc.name, want, ref, verified[ref])
+				return
+			}
+		}
+		if maxRunning > tc.wantMaxRunning {
+			t.Errorf("%s: expected at most %d profiles evaluated at the same time, got %d", tc.name, tc.wantMaxRunning, maxRunning)
+			return
+		}
+	}
+}
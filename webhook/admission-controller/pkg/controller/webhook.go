@@ -17,23 +17,13 @@
 package controller
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/ghodss/yaml"
-	"github.com/pkg/errors"
-	cosign "github.com/sigstore/cosign/cmd/cosign/cli"
-	"github.com/sigstore/k8s-manifest-sigstore/pkg/util/kubeutil"
 	log "github.com/sirupsen/logrus"
 	"github.com/stolostron/integrity-shield/shield/pkg/shield"
 	acconfig "github.com/stolostron/integrity-shield/webhook/admission-controller/pkg/config"
-	admissionv1 "k8s.io/api/admission/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	kubeclient "k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
@@ -53,8 +43,9 @@ var logLevelMap = map[string]log.Level{
 }
 
 type AccumulatedResult struct {
-	Allow   bool
-	Message string
+	Allow    bool
+	Message  string
+	Warnings []string
 }
 
 func init() {
@@ -71,18 +62,34 @@ func init() {
 	}
 	log.SetLevel(logLevel)
 
-	log.Info("initialize cosign.")
-	_ = cosign.Initialize()
+	shield.InitializeSigstore()
 }
 
-func ProcessRequest(req admission.Request) admission.Response {
+func ProcessRequest(req admission.Request, rc *ResourceCache) admission.Response {
+	// requests are not verified with partial profiles; the webhook is not ready until the cache has synced
+	if !rc.HasSynced() {
+		log.WithFields(log.Fields{
+			"namespace": req.Namespace,
+			"name":      req.Name,
+			"kind":      req.Kind.Kind,
+			"operation": req.Operation,
+		}).Warning("denied a request because admission controller cache is not synced yet")
+		return admission.Denied("admission controller cache is not synced yet; the request cannot be verified")
+	}
+
 	// load ac2 config
-	config, err := loadAdmissionControllerConfig()
+	config, err := rc.GetAdmissionControllerConfig()
 	if err != nil {
 		log.Errorf("failed to load admission controller config; %s", err.Error())
 		return admission.Allowed("error but allow for development")
 	}
 
+	// reject invalid profiles such as profiles with expressions which cannot be compiled
+	if isProfile, err := validateProfileRequest(req); isProfile && err != nil {
+		log.Warningf("denied an invalid profile; %s", err.Error())
+		return admission.Denied(err.Error())
+	}
+
 	// isScope check
 	inScopeNamespace := config.InScopeNamespaceSelector.Match(req.Namespace)
 	if !inScopeNamespace {
@@ -95,42 +102,14 @@ func ProcessRequest(req admission.Request) admission.Response {
 	}
 
 	// load constraints
-	constraints, err := LoadConstraints()
+	constraints, err := LoadConstraints(rc)
 	if err != nil {
 		log.Errorf("failed to load constratints; %s", err.Error())
 		return admission.Allowed("error but allow for development")
 	}
 
-	results := []Result{}
-
-	for _, constraint := range constraints {
-		res := Result{}
-		//match check: kind, namespace, label
-		isMatched := matchCheck(req, constraint.Spec.Match)
-		if !isMatched {
-			r := Result{
-				ReqHandlerResult: &shield.ResultFromRequestHandler{
-					Allow:   true,
-					Message: "not protected",
-				},
-				Profile: constraint.Name,
-			}
-			results = append(results, r)
-			continue
-		}
-
-		// pick parameters from constaint
-		paramObj := GetParametersFromConstraint(constraint.Spec)
-
-		// call request handler & receive result from request handler (allow, message)
-		var reqv1 admissionv1.AdmissionRequest
-		reqstr, _ := json.Marshal(req)
-		_ = json.Unmarshal([]byte(reqstr), &reqv1)
-		rhr := shield.RequestHandler(&reqv1, paramObj)
-		res.ReqHandlerResult = rhr
-		res.Profile = constraint.Name
-		results = append(results, res)
-	}
+	// evaluate matched constraints concurrently
+	results := evaluateProfiles(req, constraints, config.Evaluation, rc)
 
 	// accumulate results from constraints
 	ar := getAccumulatedResult(results)
@@ -159,57 +138,20 @@ func ProcessRequest(req admission.Request) admission.Response {
 
 	// return admission response
 	if ar.Allow {
-		return admission.Allowed(ar.Message)
+		return admission.Allowed(ar.Message).WithWarnings(ar.Warnings...)
 	} else {
-		return admission.Denied(ar.Message)
+		return admission.Denied(ar.Message).WithWarnings(ar.Warnings...)
 	}
 }
 
-func loadAdmissionControllerConfig() (*acconfig.AdmissionControllerConfig, error) {
-	namespace := os.Getenv("POD_NAMESPACE")
-	if namespace == "" {
-		namespace = defaultPodNamespace
-	}
-	configName := os.Getenv("CONTROLLER_CONFIG_NAME")
-	if configName == "" {
-		configName = defaultControllerConfigName
-	}
-	configKey := os.Getenv("CONTROLLER_CONFIG_KEY")
-	if configKey == "" {
-		configKey = defaultConfigKeyInConfigMap
-	}
-	// load
-	config, err := kubeutil.GetKubeConfig()
-	if err != nil {
-		return nil, nil
-	}
-	clientset, err := kubeclient.NewForConfig(config)
-	if err != nil {
-		log.Error(err)
-		return nil, nil
-	}
-	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.Background(), configName, metav1.GetOptions{})
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("failed to get a configmap `%s` in `%s` namespace", configName, namespace))
-	}
-
-	cfgBytes, found := cm.Data[configKey]
-	if !found {
-		return nil, errors.New(fmt.Sprintf("`%s` is not found in configmap", configKey))
-	}
-	var sc *acconfig.AdmissionControllerConfig
-	err = yaml.Unmarshal([]byte(cfgBytes), &sc)
-	if err != nil {
-		return sc, errors.Wrap(err, fmt.Sprintf("failed to unmarshal config.yaml into %T", sc))
-	}
-	return sc, nil
-}
-
 func getAccumulatedResult(results []Result) *AccumulatedResult {
 	denyMessages := []string{}
 	allowMessages := []string{}
 	accumulatedRes := &AccumulatedResult{}
 	for _, result := range results {
+		for _, w := range result.ReqHandlerResult.Warnings {
+			accumulatedRes.Warnings = append(accumulatedRes.Warnings, "["+result.Profile+"]"+w)
+		}
 		if !result.ReqHandlerResult.Allow {
 			msg := "[" + result.Profile + "]" + result.ReqHandlerResult.Message
 			denyMessages = append(denyMessages, msg)
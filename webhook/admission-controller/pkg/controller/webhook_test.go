@@ -0,0 +1,62 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controller
+
+import (
+	"testing"
+
+	admv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestProcessRequestBeforeCacheSync(t *testing.T) {
+	synced := false
+	rc := &ResourceCache{
+		cacheSynced: []cache.InformerSynced{
+			func() bool { return true },
+			func() bool { return synced },
+		},
+	}
+	req := admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		Namespace: "sample-ns",
+		Name:      "sample-cm",
+		Operation: admv1.Create,
+	}}
+
+	resp := ProcessRequest(req, rc)
+	if resp.Allowed {
+		t.Errorf("a request before the cache sync must be denied: %s", resp.Result.Message)
+		return
+	}
+	if err := rc.ReadyCheck(nil); err == nil {
+		t.Errorf("the admission controller must not be ready before the cache sync")
+		return
+	}
+
+	synced = true
+	if !rc.HasSynced() {
+		t.Errorf("the cache must be synced after all informers are synced")
+		return
+	}
+	if err := rc.ReadyCheck(nil); err != nil {
+		t.Errorf("the admission controller must be ready after the cache sync: %s", err.Error())
+		return
+	}
+}